@@ -19,9 +19,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	fiber := config.NewFiber()
 	zap := config.NewZap()
 	koanf := config.NewKoanf(zap)
+	fiber := config.NewFiber(koanf, zap)
 	rds := config.NewRedisClient(koanf, zap)
 	postgresql := config.NewPostgresqlPool(koanf, zap)
 
@@ -42,11 +42,9 @@ func main() {
 		Config:  koanf,
 	})
 
-	GO_SERVER_PORT := koanf.String("GO_SERVER")
-
 	var err error
 	go func() {
-		err = fiber.Listen(GO_SERVER_PORT)
+		err = config.Listen(fiber, koanf, zap)
 		if err != nil {
 			zap.Fatal("Error Starting Server", zapLog.Error(err))
 		}
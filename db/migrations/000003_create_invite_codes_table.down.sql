@@ -0,0 +1 @@
+DROP TABLE IF EXISTS invite_codes;
\ No newline at end of file
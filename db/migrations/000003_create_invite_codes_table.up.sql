@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS invite_codes(
+    id serial PRIMARY KEY,
+    code varchar(64) unique NOT NULL,
+    max_uses integer NOT NULL CHECK (max_uses > 0),
+    used_count integer NOT NULL DEFAULT 0,
+    expires_at timestamp,
+    created_by integer REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL
+);
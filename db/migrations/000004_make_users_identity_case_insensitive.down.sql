@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_username_length_check,
+    DROP CONSTRAINT IF EXISTS users_email_length_check,
+    ALTER COLUMN username TYPE varchar(20),
+    ALTER COLUMN email TYPE varchar(254);
@@ -0,0 +1,7 @@
+CREATE EXTENSION IF NOT EXISTS citext;
+
+ALTER TABLE users
+    ALTER COLUMN username TYPE citext,
+    ALTER COLUMN email TYPE citext,
+    ADD CONSTRAINT users_username_length_check CHECK (char_length(username) <= 20),
+    ADD CONSTRAINT users_email_length_check CHECK (char_length(email) <= 254);
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_canonical citext;
+
+UPDATE users SET email = lower(email), email_canonical = lower(email) WHERE email_canonical IS NULL;
+
+ALTER TABLE users
+    ALTER COLUMN email_canonical SET NOT NULL,
+    ADD CONSTRAINT users_email_canonical_key UNIQUE (email_canonical);
@@ -0,0 +1,9 @@
+-- existing rows are seeded with the lowercased username, BackfillUsecase rewrites
+-- them with the real confusable skeleton on the next start
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_skeleton text;
+
+UPDATE users SET username_skeleton = lower(username) WHERE username_skeleton IS NULL;
+
+ALTER TABLE users
+    ALTER COLUMN username_skeleton SET NOT NULL,
+    ADD CONSTRAINT users_username_skeleton_key UNIQUE (username_skeleton);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS login_events(
+    id bigserial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip varchar(45) NOT NULL,
+    country varchar(2) NOT NULL DEFAULT '',
+    device_id varchar(64) NOT NULL DEFAULT '',
+    success boolean NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_id_created_at_idx ON login_events (user_id, created_at DESC);
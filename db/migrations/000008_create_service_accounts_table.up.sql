@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS service_accounts(
+    id serial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    client_id varchar(64) unique NOT NULL,
+    client_secret varchar(60),
+    public_key text,
+    scopes text NOT NULL DEFAULT '',
+    owner_id integer REFERENCES users(id) ON DELETE SET NULL,
+    disabled boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    CHECK (client_secret IS NOT NULL OR public_key IS NOT NULL)
+);
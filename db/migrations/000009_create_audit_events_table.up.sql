@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_events(
+    id bigserial PRIMARY KEY,
+    actor_id integer REFERENCES users(id) ON DELETE SET NULL,
+    user_id integer REFERENCES users(id) ON DELETE SET NULL,
+    action varchar(64) NOT NULL,
+    session_id varchar(36) NOT NULL DEFAULT '',
+    ip varchar(45) NOT NULL,
+    detail text NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_created_at_idx ON audit_events (actor_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS audit_events_user_id_created_at_idx ON audit_events (user_id, created_at DESC);
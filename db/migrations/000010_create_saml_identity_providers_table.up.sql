@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS saml_identity_providers(
+    id serial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    domain citext unique NOT NULL,
+    entity_id text NOT NULL,
+    metadata_xml text NOT NULL,
+    provision_users boolean NOT NULL DEFAULT true,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
@@ -0,0 +1,2 @@
+-- deactivated users keep their row and history but can no longer log in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active boolean NOT NULL DEFAULT true;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS scim_group_members;
+DROP TABLE IF EXISTS scim_groups;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_scim_tenant_id_scim_user_name_key,
+    DROP COLUMN IF EXISTS external_id,
+    DROP COLUMN IF EXISTS scim_user_name,
+    DROP COLUMN IF EXISTS scim_tenant_id;
+
+DROP TABLE IF EXISTS scim_tenants;
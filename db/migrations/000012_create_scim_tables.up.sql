@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS scim_tenants(
+    id serial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    domain citext unique NOT NULL,
+    token_hash varchar(64) unique NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+-- users pushed by a tenant's identity provider remember the tenant and the identifiers the IdP knows them by
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS scim_tenant_id integer REFERENCES scim_tenants(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS scim_user_name citext,
+    ADD COLUMN IF NOT EXISTS external_id text,
+    ADD CONSTRAINT users_scim_tenant_id_scim_user_name_key UNIQUE (scim_tenant_id, scim_user_name);
+
+CREATE TABLE IF NOT EXISTS scim_groups(
+    id serial PRIMARY KEY,
+    tenant_id integer NOT NULL REFERENCES scim_tenants(id) ON DELETE CASCADE,
+    display_name varchar(255) NOT NULL,
+    external_id text,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    CONSTRAINT scim_groups_tenant_id_display_name_key UNIQUE (tenant_id, display_name)
+);
+
+CREATE TABLE IF NOT EXISTS scim_group_members(
+    group_id integer NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
@@ -0,0 +1,2 @@
+-- an empty locale means the user has no preference and requests are answered in the Accept-Language of the client
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
\ No newline at end of file
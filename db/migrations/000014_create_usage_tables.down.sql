@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS usage_counters;
+
+ALTER TABLE users DROP COLUMN IF EXISTS plan;
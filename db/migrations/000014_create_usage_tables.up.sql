@@ -0,0 +1,12 @@
+-- an empty plan means the user is on DEFAULT_PLAN
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan varchar(50) NOT NULL DEFAULT '';
+
+-- usage is counted in Redis and flushed here, count is the total of the window so far
+CREATE TABLE IF NOT EXISTS usage_counters(
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    metric varchar(50) NOT NULL,
+    window_start date NOT NULL,
+    count bigint NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY (user_id, metric, window_start)
+);
@@ -0,0 +1,7 @@
+-- the policy each backfill last ran with, the application rewrites email_canonical and username_skeleton
+-- of every user when its Go implementation no longer matches the stored fingerprint
+CREATE TABLE IF NOT EXISTS identity_backfills(
+    name varchar(50) PRIMARY KEY,
+    fingerprint text NOT NULL,
+    updated_at timestamp NOT NULL
+);
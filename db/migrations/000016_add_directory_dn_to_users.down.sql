@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_directory_dn_key,
+    DROP COLUMN IF EXISTS directory_dn;
@@ -0,0 +1,4 @@
+-- users created by an LDAP login remember the entry they belong to, only those rows are refreshed from the directory
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS directory_dn citext,
+    ADD CONSTRAINT users_directory_dn_key UNIQUE (directory_dn);
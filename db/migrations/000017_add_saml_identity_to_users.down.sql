@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_saml_identity_provider_id_saml_name_id_key,
+    DROP COLUMN IF EXISTS saml_name_id,
+    DROP COLUMN IF EXISTS saml_identity_provider_id;
@@ -0,0 +1,6 @@
+-- users who sign in with SAML remember the identity provider and the NameID it knows them by, later logins are
+-- matched on those instead of the email address
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS saml_identity_provider_id integer REFERENCES saml_identity_providers(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS saml_name_id text,
+    ADD CONSTRAINT users_saml_identity_provider_id_saml_name_id_key UNIQUE (saml_identity_provider_id, saml_name_id);
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	http "cutterproject/internal/delivery/http"
 	"cutterproject/internal/delivery/http/middleware"
 	"cutterproject/internal/delivery/http/route"
@@ -24,15 +25,92 @@ type ServerConfig struct {
 
 func Server(config *ServerConfig) {
 	userRepository := repository.NewUserRepository(config.Log, config.DB, config.DBCache)
-	userUsecase := usecase.NewUserUsecase(userRepository, config.DB, config.Log, config.Config)
+	inviteRepository := repository.NewInviteRepository(config.Log, config.DB)
+	challengeRepository := repository.NewChallengeRepository(config.Log, config.DBCache)
+	loginEventRepository := repository.NewLoginEventRepository(config.Log, config.DB)
+	deviceRepository := repository.NewDeviceRepository(config.Log, config.DBCache)
+	serviceAccountRepository := repository.NewServiceAccountRepository(config.Log, config.DB, config.DBCache)
+	sessionRepository := repository.NewSessionRepository(config.Log, config.DBCache)
+	dpopRepository := repository.NewDPoPRepository(config.Log, config.DBCache)
+	auditEventRepository := repository.NewAuditEventRepository(config.Log, config.DB)
+	samlRepository := repository.NewSAMLRepository(config.Log, config.DB, config.DBCache)
+	scimRepository := repository.NewSCIMRepository(config.Log, config.DB)
+	rateLimitRepository := repository.NewRateLimitRepository(config.Log, config.DBCache)
+	quotaRepository := repository.NewQuotaRepository(config.Log, config.DB, config.DBCache)
+	ipFilterRepository := repository.NewIPFilterRepository(config.Log, config.DBCache)
+
+	emailPolicy := NewEmailPolicy(config.Config, config.Log)
+	mailer := NewMailer(config.Config, config.Log)
+	geoIP := NewGeoIP(config.Config, config.Log)
+	trustedProxies := NewTrustedProxies(config.Config, config.Log)
+	trustedProxyHeader := NewTrustedProxyHeader(config.Config, config.Log)
+	tokenFormat := NewTokenFormat(config.Config, config.Log)
+	serviceProvider := NewSAMLServiceProvider(config.Config, config.Log)
+	authenticator := NewAuthenticator(config.Config, config.Log, userRepository, emailPolicy)
+
+	dpopUsecase := usecase.NewDPoPUsecase(dpopRepository, config.Log, config.Config)
+	backfillUsecase := usecase.NewBackfillUsecase(userRepository, emailPolicy, config.Log, config.Config)
+	quotaUsecase := usecase.NewQuotaUsecase(quotaRepository, config.Log, config.Config)
+	ipFilterUsecase := usecase.NewIPFilterUsecase(ipFilterRepository, geoIP, config.Log, config.Config)
+	sessionUsecase := usecase.NewSessionUsecase(sessionRepository, serviceAccountRepository, tokenFormat, config.Log, config.Config)
+	stepUpUsecase := usecase.NewStepUpUsecase(loginEventRepository, userRepository, geoIP, mailer, config.Log, config.Config)
+	userUsecase := usecase.NewUserUsecase(userRepository, inviteRepository, emailPolicy, authenticator, mailer, stepUpUsecase, sessionUsecase, dpopUsecase, config.DB, config.Log, config.Config)
+	inviteUsecase := usecase.NewInviteUsecase(inviteRepository, quotaUsecase, config.Log, config.Config)
+	deviceUsecase := usecase.NewDeviceUsecase(deviceRepository, userUsecase, dpopUsecase, config.Log, config.Config)
+	serviceAccountUsecase := usecase.NewServiceAccountUsecase(serviceAccountRepository, dpopUsecase, quotaUsecase, tokenFormat, config.Log, config.Config)
+	impersonationUsecase := usecase.NewImpersonationUsecase(userRepository, auditEventRepository, sessionUsecase, dpopUsecase, config.Log, config.Config)
+	samlUsecase := usecase.NewSAMLUsecase(samlRepository, userRepository, userUsecase, emailPolicy, serviceProvider, config.Log, config.Config)
+	scimUsecase := usecase.NewSCIMUsecase(userRepository, scimRepository, sessionUsecase, emailPolicy, config.Log, config.Config)
+	challengeUsecase := usecase.NewChallengeUsecase(NewChallengeVerifier(config.Config, config.Log, challengeRepository), config.Log, config.Config)
+	rateLimitUsecase := usecase.NewRateLimitUsecase(rateLimitRepository, config.Log, config.Config)
+
 	userController := http.NewUserController(userUsecase, config.Log, config.Config)
+	inviteController := http.NewInviteController(inviteUsecase, config.Log, config.Config)
+	challengeController := http.NewChallengeController(challengeUsecase, config.Log, config.Config)
+	deviceController := http.NewDeviceController(deviceUsecase, config.Log, config.Config)
+	oauthController := http.NewOAuthController(serviceAccountUsecase, sessionUsecase, config.Log, config.Config)
+	serviceAccountController := http.NewServiceAccountController(serviceAccountUsecase, config.Log, config.Config)
+	impersonationController := http.NewImpersonationController(impersonationUsecase, config.Log, config.Config)
+	samlController := http.NewSAMLController(samlUsecase, config.Log, config.Config)
+	scimController := http.NewSCIMController(scimUsecase, config.Log, config.Config)
+	quotaController := http.NewQuotaController(quotaUsecase, config.Log, config.Config)
+	ipFilterController := http.NewIPFilterController(ipFilterUsecase, config.Log, config.Config)
+
+	authMiddleware := middleware.NewAuthMiddleware(config.Router, config.Log, config.Config, userUsecase, sessionUsecase, serviceAccountUsecase, dpopUsecase, impersonationUsecase, tokenFormat)
+	challengeMiddleware := middleware.NewChallengeMiddleware(config.Log, config.Config, challengeUsecase)
+	scimMiddleware := middleware.NewSCIMMiddleware(config.Log, config.Config, scimUsecase)
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(config.Log, config.Config, rateLimitUsecase)
+	quotaMiddleware := middleware.NewQuotaMiddleware(config.Log, config.Config, quotaUsecase)
+	ipFilterMiddleware := middleware.NewIPFilterMiddleware(config.Log, config.Config, ipFilterUsecase)
 
-	authMiddleware := middleware.NewAuthMiddleware(config.Router, config.Log, config.Config, userUsecase)
+	// only one process runs a backfill, the others find it locked or already done
+	go backfillUsecase.Run(context.Background())
+	// counters are flushed for the whole life of the process, the last minute of usage is in Redis either way
+	go quotaUsecase.FlushPeriodically(context.Background())
+	// every prefork child keeps its own copy of the admin managed IP lists
+	go ipFilterUsecase.RefreshPeriodically(context.Background())
 
 	routeConfig := route.RouteConfig{
-		App:            config.Router,
-		UserController: userController,
-		AuthMiddleware: authMiddleware,
+		App:                      config.Router,
+		TrustedProxies:           trustedProxies,
+		TrustedProxyHeader:       trustedProxyHeader,
+		UserController:           userController,
+		InviteController:         inviteController,
+		ChallengeController:      challengeController,
+		DeviceController:         deviceController,
+		OAuthController:          oauthController,
+		ServiceAccountController: serviceAccountController,
+		ImpersonationController:  impersonationController,
+		SAMLController:           samlController,
+		SCIMController:           scimController,
+		QuotaController:          quotaController,
+		IPFilterController:       ipFilterController,
+		AuthMiddleware:           authMiddleware,
+		ChallengeMiddleware:      challengeMiddleware,
+		SCIMMiddleware:           scimMiddleware,
+		RateLimitMiddleware:      rateLimitMiddleware,
+		QuotaMiddleware:          quotaMiddleware,
+		IPFilterMiddleware:       ipFilterMiddleware,
 	}
 
 	routeConfig.SetupRoute()
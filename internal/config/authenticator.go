@@ -0,0 +1,30 @@
+package config
+
+import (
+	"cutterproject/internal/repository"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// NewAuthenticator picks how login passwords are checked from AUTH_BACKEND, the bcrypt hashes
+// in the users table when it is not configured
+func NewAuthenticator(config *koanf.Koanf, log *zap.Logger, userRepository *repository.UserRepository, emailPolicy *util.EmailPolicy) usecase.Authenticator {
+	switch backend := config.String("AUTH_BACKEND"); backend {
+	case "", usecase.AuthenticatorPassword:
+		return usecase.NewPasswordAuthenticator(userRepository, emailPolicy)
+	case usecase.AuthenticatorLDAP:
+		authenticator, err := usecase.NewLDAPAuthenticator(userRepository, emailPolicy, log, config)
+		if err != nil {
+			log.Fatal("Failed to configure LDAP authentication", zap.Error(err))
+		}
+		log.Info("Authenticating logins against LDAP", zap.String("url", authenticator.URL), zap.String("baseDN", authenticator.BaseDN))
+		return authenticator
+	default:
+		log.Fatal("Unknown AUTH_BACKEND, expected password or ldap", zap.String("backend", backend))
+	}
+
+	return nil
+}
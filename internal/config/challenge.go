@@ -0,0 +1,28 @@
+package config
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/usecase"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// NewChallengeVerifier picks the backend configured by CHALLENGE_PROVIDER, proof of work when it is not set.
+// It returns nil when challenges are disabled and refuses to start with a provider it does not know
+func NewChallengeVerifier(config *koanf.Koanf, log *zap.Logger, challengeRepository *repository.ChallengeRepository) usecase.ChallengeVerifier {
+	switch provider := strings.ToLower(strings.TrimSpace(config.String("CHALLENGE_PROVIDER"))); provider {
+	case constant.CHALLENGE_PROVIDER_NONE:
+		return nil
+	case "", constant.CHALLENGE_PROVIDER_POW:
+		return usecase.NewProofOfWorkVerifier(challengeRepository, config)
+	case constant.CHALLENGE_PROVIDER_HCAPTCHA, constant.CHALLENGE_PROVIDER_TURNSTILE:
+		return usecase.NewSiteVerifyVerifier(provider, config)
+	default:
+		log.Fatal("Unknown CHALLENGE_PROVIDER, expected pow, hcaptcha, turnstile or none", zap.String("provider", provider))
+	}
+
+	return nil
+}
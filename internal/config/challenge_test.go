@@ -0,0 +1,53 @@
+package config
+
+import (
+	"cutterproject/internal/usecase"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewChallengeVerifier(t *testing.T) {
+	cases := []struct {
+		provider string
+		want     string
+	}{
+		{"", "pow"},
+		{"pow", "pow"},
+		{"hcaptcha", "siteverify"},
+		{"Turnstile", "siteverify"},
+		{"none", "none"},
+	}
+
+	for _, c := range cases {
+		config := koanf.New(".")
+		config.Set("CHALLENGE_PROVIDER", c.provider)
+
+		got := "none"
+		switch NewChallengeVerifier(config, zap.NewNop(), nil).(type) {
+		case *usecase.ProofOfWorkVerifier:
+			got = "pow"
+		case *usecase.SiteVerifyVerifier:
+			got = "siteverify"
+		}
+		if got != c.want {
+			t.Errorf("CHALLENGE_PROVIDER=%q gave %s, want %s", c.provider, got, c.want)
+		}
+	}
+}
+
+func TestNewChallengeVerifierRejectsUnknownProvider(t *testing.T) {
+	config := koanf.New(".")
+	config.Set("CHALLENGE_PROVIDER", "recaptcha")
+	log := zap.NewNop().WithOptions(zap.WithFatalHook(zapcore.WriteThenPanic))
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown CHALLENGE_PROVIDER did not stop startup")
+		}
+	}()
+
+	NewChallengeVerifier(config, log, nil)
+}
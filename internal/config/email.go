@@ -0,0 +1,42 @@
+package config
+
+import (
+	"cutterproject/internal/util"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+func NewEmailPolicy(config *koanf.Koanf, log *zap.Logger) *util.EmailPolicy {
+	policy := &util.EmailPolicy{
+		StripPlusTag:    config.Bool("EMAIL_CANONICALIZE_PLUS_TAG"),
+		DotAliasDomains: map[string]struct{}{},
+	}
+
+	for _, domain := range strings.Split(config.String("EMAIL_DOT_ALIAS_DOMAINS"), ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			policy.DotAliasDomains[domain] = struct{}{}
+		}
+	}
+
+	blocklistPath := config.String("EMAIL_DISPOSABLE_DOMAINS_FILE")
+	if blocklistPath == "" {
+		return policy
+	}
+
+	blocklist, err := util.NewDomainBlocklist(blocklistPath, log)
+	if err != nil {
+		log.Fatal("Failed to load disposable email domain blocklist", zap.Error(err))
+	}
+
+	err = blocklist.Watch()
+	if err != nil {
+		log.Warn("Failed to watch disposable email domain blocklist, hot reload is disabled", zap.Error(err))
+	}
+
+	policy.Blocklist = blocklist
+
+	return policy
+}
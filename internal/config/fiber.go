@@ -1,15 +1,19 @@
 package config
 
 import (
+	"cutterproject/internal/exception"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
 )
 
-func NewFiber() *fiber.App {
+func NewFiber(config *koanf.Koanf, log *zap.Logger) *fiber.App {
 	app := fiber.New(fiber.Config{
-		Prefork:               true,
+		// fiber cannot prefork the custom listener PROXY protocol needs, see Listen
+		Prefork:               !config.Bool("PROXY_PROTOCOL_ENABLED"),
 		AppName:               "Cutter Project",
 		BodyLimit:             4 * 1024 * 1024, // 4MB
 		ReadBufferSize:        4096,
@@ -23,6 +27,7 @@ func NewFiber() *fiber.App {
 		ReduceMemoryUsage:     true,
 		JSONEncoder:           sonic.Marshal,
 		JSONDecoder:           sonic.Unmarshal,
+		ErrorHandler:          exception.NewErrorHandler(log),
 	})
 
 	return app
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"cutterproject/internal/util"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// NewGeoIP returns nil when GEOIP_DATABASE_FILE is not configured, country based rules are skipped then
+func NewGeoIP(config *koanf.Koanf, log *zap.Logger) *util.GeoIP {
+	path := config.String("GEOIP_DATABASE_FILE")
+	if path == "" {
+		return nil
+	}
+
+	geoIP, err := util.NewGeoIP(path)
+	if err != nil {
+		log.Fatal("Failed to open GeoIP database", zap.String("path", path), zap.Error(err))
+	}
+
+	return geoIP
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"cutterproject/internal/mail"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+func NewMailer(config *koanf.Koanf, log *zap.Logger) mail.Mailer {
+	host := config.String("SMTP_HOST")
+	if host == "" {
+		log.Warn("SMTP_HOST is not configured, outgoing mail will only be logged")
+		return &mail.LogMailer{Log: log}
+	}
+
+	port := config.String("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &mail.SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: config.String("SMTP_USERNAME"),
+		Password: config.String("SMTP_PASSWORD"),
+		From:     config.String("SMTP_FROM"),
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/proxyproto"
+	"cutterproject/internal/util"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// DefaultProxyHeaderTimeout bounds how long a load balancer may take to send the PROXY header of a connection
+var DefaultProxyHeaderTimeout = 5 * time.Second
+
+// NewTrustedProxies parses TRUSTED_PROXIES, without it no forwarding header or PROXY header is believed
+func NewTrustedProxies(config *koanf.Koanf, log *zap.Logger) util.TrustedProxies {
+	proxies, err := util.ParseIPNetworks(config.String("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES", zap.Error(err))
+	}
+
+	return proxies
+}
+
+// NewTrustedProxyHeader reads TRUSTED_PROXY_HEADER, the forwarding header the trusted proxies write. It defaults
+// to X-Forwarded-For, which is what most load balancers append to
+func NewTrustedProxyHeader(config *koanf.Koanf, log *zap.Logger) string {
+	switch header := config.String("TRUSTED_PROXY_HEADER"); header {
+	case "":
+		return constant.TRUSTED_PROXY_HEADER_XFF
+	case constant.TRUSTED_PROXY_HEADER_XFF, constant.TRUSTED_PROXY_HEADER_FORWARDED:
+		return header
+	default:
+		log.Fatal("TRUSTED_PROXY_HEADER must be xff or forwarded", zap.String("header", header))
+		return ""
+	}
+}
+
+// Listen serves app on GO_SERVER, with PROXY_PROTOCOL_ENABLED connections from trusted proxies must start with a
+// PROXY protocol header. Fiber cannot prefork a custom listener, NewFiber turns prefork off in that case
+func Listen(app *fiber.App, config *koanf.Koanf, log *zap.Logger) error {
+	addr := config.String("GO_SERVER")
+
+	if !config.Bool("PROXY_PROTOCOL_ENABLED") {
+		return app.Listen(addr)
+	}
+
+	proxies := NewTrustedProxies(config, log)
+	if len(proxies) == 0 {
+		log.Fatal("PROXY_PROTOCOL_ENABLED needs the load balancers in TRUSTED_PROXIES")
+	}
+
+	headerTimeout := DefaultProxyHeaderTimeout
+	if seconds := config.Int("PROXY_PROTOCOL_HEADER_TIMEOUT"); seconds > 0 {
+		headerTimeout = time.Duration(seconds) * time.Second
+	}
+
+	listener, err := net.Listen(app.Config().Network, addr)
+	if err != nil {
+		return err
+	}
+
+	return app.Listener(proxyproto.NewListener(listener, proxies.Contains, headerTimeout))
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/knadh/koanf/v2"
+	dsig "github.com/russellhaering/goxmldsig"
+	"go.uber.org/zap"
+)
+
+// NewSAMLServiceProvider loads the SP key pair SAML requests are signed with, SAML stays disabled and nil is
+// returned until SAML_SP_CERTIFICATE_FILE is configured. The IdP side is stored per email domain in the database
+func NewSAMLServiceProvider(config *koanf.Koanf, log *zap.Logger) *saml.ServiceProvider {
+	certificateFile := config.String("SAML_SP_CERTIFICATE_FILE")
+	if certificateFile == "" {
+		return nil
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(certificateFile, config.String("SAML_SP_KEY_FILE"))
+	if err != nil {
+		log.Fatal("Failed to load the SAML service provider key pair", zap.Error(err))
+	}
+
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		log.Fatal("Failed to parse the SAML service provider certificate", zap.Error(err))
+	}
+
+	key, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		log.Fatal("SAML service provider key cannot sign")
+	}
+
+	baseURL, err := url.Parse(strings.TrimRight(config.String("PUBLIC_BASE_URL"), "/"))
+	if err != nil || baseURL.Host == "" {
+		log.Fatal("PUBLIC_BASE_URL is required for SAML, IdPs send users back to it", zap.Error(err))
+	}
+
+	metadataURL := baseURL.JoinPath("/saml/metadata")
+	acsURL := baseURL.JoinPath("/saml/acs")
+
+	entityId := config.String("SAML_SP_ENTITY_ID")
+	if entityId == "" {
+		entityId = metadataURL.String()
+	}
+
+	log.Info("SAML single sign-on enabled", zap.String("entityId", entityId))
+
+	return &saml.ServiceProvider{
+		EntityID:          entityId,
+		Key:               key,
+		Certificate:       certificate,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+		SignatureMethod:   signatureMethod(key),
+	}
+}
+
+// signatureMethod picks the SHA-256 algorithm AuthnRequests are signed with for the key type
+func signatureMethod(key crypto.Signer) string {
+	if _, ok := key.Public().(*ecdsa.PublicKey); ok {
+		return dsig.ECDSASHA256SignatureMethod
+	}
+
+	return dsig.RSASHA256SignatureMethod
+}
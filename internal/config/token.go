@@ -0,0 +1,34 @@
+package config
+
+import (
+	"cutterproject/internal/util"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// NewTokenFormat picks the access token format from TOKEN_FORMAT, JWT when it is not configured.
+// Switching formats invalidates every access token issued with the previous one
+func NewTokenFormat(config *koanf.Koanf, log *zap.Logger) util.TokenFormat {
+	switch format := config.String("TOKEN_FORMAT"); format {
+	case "", util.TokenFormatJWT:
+		return util.NewJWTTokenFormat(config.String("JWT_SECRET_KEY"))
+	case util.TokenFormatPasetoLocal:
+		tokenFormat, err := util.NewPasetoLocalTokenFormat(config.String("PASETO_LOCAL_KEY"))
+		if err != nil {
+			log.Fatal("Failed to load PASETO_LOCAL_KEY", zap.Error(err))
+		}
+		return tokenFormat
+	case util.TokenFormatPasetoPublic:
+		tokenFormat, err := util.NewPasetoPublicTokenFormat(config.String("PASETO_SECRET_KEY"))
+		if err != nil {
+			log.Fatal("Failed to load PASETO_SECRET_KEY", zap.Error(err))
+		}
+		log.Info("PASETO public key for verifying access tokens", zap.String("publicKey", tokenFormat.PublicKey.ExportHex()))
+		return tokenFormat
+	default:
+		log.Fatal("Unknown TOKEN_FORMAT, expected jwt, paseto-local or paseto-public", zap.String("format", format))
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+package constant
+
+const (
+	AUDIT_ACTION_IMPERSONATION_STARTED = "impersonation.started"
+	AUDIT_ACTION_IMPERSONATED_REQUEST  = "impersonation.request"
+)
@@ -0,0 +1,7 @@
+package constant
+
+// Backfills that rewrite derived identity columns of every user when the Go code deriving them changes
+const (
+	BACKFILL_EMAIL_CANONICAL   = "email_canonical"
+	BACKFILL_USERNAME_SKELETON = "username_skeleton"
+)
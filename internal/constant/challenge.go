@@ -0,0 +1,8 @@
+package constant
+
+const (
+	CHALLENGE_PROVIDER_NONE      = "none"
+	CHALLENGE_PROVIDER_POW       = "pow"
+	CHALLENGE_PROVIDER_HCAPTCHA  = "hcaptcha"
+	CHALLENGE_PROVIDER_TURNSTILE = "turnstile"
+)
@@ -8,4 +8,17 @@ const (
 	ERR_INVALID_REQUEST_BODY_MESSAGE    = "The request is invalid or malformed"
 	ERR_NOT_FOUND_ERROR                 = "NOT_FOUND_ERROR"
 	ERR_UNATHORIZED_ERROR               = "UNAUTHORIEZED_ERROR"
+	ERR_FORBIDDEN_ERROR                 = "FORBIDDEN_ERROR"
+	ERR_CONFLICT_ERROR                  = "CONFLICT_ERROR"
+	ERR_REAUTHENTICATION_REQUIRED_ERROR = "REAUTHENTICATION_REQUIRED_ERROR"
+	ERR_STEP_UP_REQUIRED_ERROR          = "STEP_UP_REQUIRED_ERROR"
+	ERR_CHALLENGE_REQUIRED_ERROR        = "CHALLENGE_REQUIRED_ERROR"
+	ERR_CHALLENGE_FAILED_ERROR          = "CHALLENGE_FAILED_ERROR"
+	ERR_INVALID_DPOP_PROOF_ERROR        = "INVALID_DPOP_PROOF_ERROR"
+	ERR_IMPERSONATION_FORBIDDEN_ERROR   = "IMPERSONATION_FORBIDDEN_ERROR"
+	ERR_TOO_MANY_REQUESTS_ERROR         = "TOO_MANY_REQUESTS_ERROR"
+	ERR_UNSUPPORTED_MEDIA_TYPE_ERROR    = "UNSUPPORTED_MEDIA_TYPE_ERROR"
+	ERR_PAYLOAD_TOO_LARGE_ERROR         = "PAYLOAD_TOO_LARGE_ERROR"
+	ERR_QUOTA_EXCEEDED_ERROR            = "QUOTA_EXCEEDED_ERROR"
+	ERR_IP_BLOCKED_ERROR                = "IP_BLOCKED_ERROR"
 )
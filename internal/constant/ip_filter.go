@@ -0,0 +1,15 @@
+package constant
+
+// IP filter lists, a request from a denied network is blocked and once an allow list has entries so is every
+// request from outside it
+const (
+	IP_FILTER_LIST_ALLOW = "allow"
+	IP_FILTER_LIST_DENY  = "deny"
+)
+
+// Why the IP filter blocked a request, blocked requests are counted per reason
+const (
+	IP_FILTER_BLOCKED_DENY_LIST  = "deny_list"
+	IP_FILTER_BLOCKED_ALLOW_LIST = "allow_list"
+	IP_FILTER_BLOCKED_COUNTRY    = "country"
+)
@@ -0,0 +1,28 @@
+package constant
+
+const (
+	GRANT_TYPE_DEVICE_CODE        = "urn:ietf:params:oauth:grant-type:device_code"
+	GRANT_TYPE_CLIENT_CREDENTIALS = "client_credentials"
+	CLIENT_ASSERTION_TYPE_JWT     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	OAUTH_ERR_INVALID_REQUEST        = "invalid_request"
+	OAUTH_ERR_INVALID_CLIENT         = "invalid_client"
+	OAUTH_ERR_INVALID_GRANT          = "invalid_grant"
+	OAUTH_ERR_UNSUPPORTED_GRANT_TYPE = "unsupported_grant_type"
+	OAUTH_ERR_AUTHORIZATION_PENDING  = "authorization_pending"
+	OAUTH_ERR_SLOW_DOWN              = "slow_down"
+	OAUTH_ERR_ACCESS_DENIED          = "access_denied"
+	OAUTH_ERR_EXPIRED_TOKEN          = "expired_token"
+	OAUTH_ERR_INVALID_SCOPE          = "invalid_scope"
+	OAUTH_ERR_INSUFFICIENT_SCOPE     = "insufficient_scope"
+	OAUTH_ERR_INVALID_DPOP_PROOF     = "invalid_dpop_proof"
+
+	TOKEN_TYPE_HINT_ACCESS_TOKEN  = "access_token"
+	TOKEN_TYPE_HINT_REFRESH_TOKEN = "refresh_token"
+
+	SCOPE_TOKEN_INTROSPECT = "token:introspect"
+
+	DEVICE_STATUS_PENDING  = "pending"
+	DEVICE_STATUS_APPROVED = "approved"
+	DEVICE_STATUS_DENIED   = "denied"
+)
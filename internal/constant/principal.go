@@ -0,0 +1,6 @@
+package constant
+
+const (
+	PRINCIPAL_TYPE_USER    = "user"
+	PRINCIPAL_TYPE_SERVICE = "service"
+)
@@ -0,0 +1,8 @@
+package constant
+
+// The forwarding header trusted proxies write, the other one is passed through from clients unchanged and is
+// never read
+const (
+	TRUSTED_PROXY_HEADER_XFF       = "xff"
+	TRUSTED_PROXY_HEADER_FORWARDED = "forwarded"
+)
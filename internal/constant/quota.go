@@ -0,0 +1,17 @@
+package constant
+
+const (
+	PLAN_FREE       = "free"
+	PLAN_PRO        = "pro"
+	PLAN_ENTERPRISE = "enterprise"
+)
+
+// Metered usage and the windows it is counted over
+const (
+	QUOTA_METRIC_API_CALLS        = "api_calls"
+	QUOTA_METRIC_SERVICE_ACCOUNTS = "service_accounts"
+	QUOTA_METRIC_INVITES          = "invites"
+
+	QUOTA_WINDOW_DAY   = "day"
+	QUOTA_WINDOW_MONTH = "month"
+)
@@ -0,0 +1,8 @@
+package constant
+
+// What a rate limit policy counts requests by, clients the key does not apply to are counted by IP
+const (
+	RATE_LIMIT_BY_IP      = "ip"
+	RATE_LIMIT_BY_USER    = "user"
+	RATE_LIMIT_BY_API_KEY = "apikey"
+)
@@ -0,0 +1,8 @@
+package constant
+
+const (
+	REGISTRATION_MODE_OPEN   = "open"
+	REGISTRATION_MODE_INVITE = "invite"
+	REGISTRATION_MODE_DOMAIN = "domain"
+	REGISTRATION_MODE_CLOSED = "closed"
+)
@@ -0,0 +1,6 @@
+package constant
+
+const (
+	ROLE_USER  = "user"
+	ROLE_ADMIN = "admin"
+)
@@ -0,0 +1,21 @@
+package constant
+
+const (
+	SCIM_SCHEMA_USER                    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIM_SCHEMA_GROUP                   = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIM_SCHEMA_SERVICE_PROVIDER_CONFIG = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIM_SCHEMA_LIST_RESPONSE           = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIM_SCHEMA_PATCH_OP                = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIM_SCHEMA_ERROR                   = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	SCIM_ERR_INVALID_FILTER = "invalidFilter"
+	SCIM_ERR_INVALID_SYNTAX = "invalidSyntax"
+	SCIM_ERR_INVALID_PATH   = "invalidPath"
+	SCIM_ERR_INVALID_VALUE  = "invalidValue"
+	SCIM_ERR_NO_TARGET      = "noTarget"
+	SCIM_ERR_UNIQUENESS     = "uniqueness"
+
+	SCIM_PATCH_OP_ADD     = "add"
+	SCIM_PATCH_OP_REPLACE = "replace"
+	SCIM_PATCH_OP_REMOVE  = "remove"
+)
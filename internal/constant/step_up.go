@@ -0,0 +1,9 @@
+package constant
+
+const (
+	STEP_UP_METHOD_EMAIL_OTP = "email_otp"
+
+	STEP_UP_REASON_NEW_DEVICE      = "new_device"
+	STEP_UP_REASON_NEW_COUNTRY     = "new_country"
+	STEP_UP_REASON_RECENT_FAILURES = "recent_failures"
+)
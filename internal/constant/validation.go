@@ -0,0 +1,23 @@
+package constant
+
+// Field error codes reported in the errors list of a VALIDATION_ERROR, one per violated rule
+const (
+	FIELD_ERR_REQUIRED           = "REQUIRED"
+	FIELD_ERR_MIN_LENGTH         = "MIN_LENGTH"
+	FIELD_ERR_MAX_LENGTH         = "MAX_LENGTH"
+	FIELD_ERR_INVALID_EMAIL      = "INVALID_EMAIL"
+	FIELD_ERR_INVALID_USERNAME   = "INVALID_USERNAME"
+	FIELD_ERR_RESERVED           = "RESERVED"
+	FIELD_ERR_UNSUPPORTED_LOCALE = "UNSUPPORTED_LOCALE"
+	// reported with INVALID_REQUEST_BODY_ERROR when a JSON body can not be decoded, offset is the byte it failed at
+	FIELD_ERR_INVALID_JSON    = "INVALID_JSON"
+	FIELD_ERR_INVALID_TYPE    = "INVALID_TYPE"
+	FIELD_ERR_UNKNOWN_FIELD   = "UNKNOWN_FIELD"
+	FIELD_ERR_DUPLICATE_FIELD = "DUPLICATE_FIELD"
+
+	FIELD_ERR_QUOTA_EXCEEDED = "QUOTA_EXCEEDED"
+
+	// reported with CONFLICT_ERROR for every unique field of a user that is already taken
+	FIELD_ERR_TAKEN       = "TAKEN"
+	FIELD_ERR_TOO_SIMILAR = "TOO_SIMILAR"
+)
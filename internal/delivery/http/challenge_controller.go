@@ -0,0 +1,33 @@
+package http
+
+import (
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type ChallengeController struct {
+	ChallengeUsecase *usecase.ChallengeUsecase
+	Log              *zap.Logger
+	Config           *koanf.Koanf
+}
+
+func NewChallengeController(challengeUsecase *usecase.ChallengeUsecase, zap *zap.Logger, koanf *koanf.Koanf) *ChallengeController {
+	return &ChallengeController{
+		ChallengeUsecase: challengeUsecase,
+		Log:              zap,
+		Config:           koanf,
+	}
+}
+
+func (controller ChallengeController) Issue(ctx *fiber.Ctx) error {
+	response, err := controller.ChallengeUsecase.Issue(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type DeviceController struct {
+	DeviceUsecase *usecase.DeviceUsecase
+	Log           *zap.Logger
+	Config        *koanf.Koanf
+}
+
+func NewDeviceController(deviceUsecase *usecase.DeviceUsecase, zap *zap.Logger, koanf *koanf.Koanf) *DeviceController {
+	return &DeviceController{
+		DeviceUsecase: deviceUsecase,
+		Log:           zap,
+		Config:        koanf,
+	}
+}
+
+func (controller DeviceController) CreateCode(ctx *fiber.Ctx) error {
+	var payload model.DeviceCodeRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return &model.OAuthError{ErrorCode: constant.OAUTH_ERR_INVALID_REQUEST}
+	}
+
+	response, err := controller.DeviceUsecase.CreateCode(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller DeviceController) Approve(ctx *fiber.Ctx) error {
+	var payload model.DeviceApproveRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	userId := ctx.Locals("userId").(int)
+
+	response, err := controller.DeviceUsecase.Approve(ctx, userId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller DeviceController) Token(ctx *fiber.Ctx) error {
+	var payload model.DeviceTokenRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return &model.OAuthError{ErrorCode: constant.OAUTH_ERR_INVALID_REQUEST}
+	}
+
+	response, err := controller.DeviceUsecase.Token(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return util.SendSuccessResponseWithData(ctx, response)
+}
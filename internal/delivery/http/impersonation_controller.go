@@ -0,0 +1,42 @@
+package http
+
+import (
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type ImpersonationController struct {
+	ImpersonationUsecase *usecase.ImpersonationUsecase
+	Log                  *zap.Logger
+	Config               *koanf.Koanf
+}
+
+func NewImpersonationController(impersonationUsecase *usecase.ImpersonationUsecase, zap *zap.Logger, koanf *koanf.Koanf) *ImpersonationController {
+	return &ImpersonationController{
+		ImpersonationUsecase: impersonationUsecase,
+		Log:                  zap,
+		Config:               koanf,
+	}
+}
+
+func (controller ImpersonationController) Impersonate(ctx *fiber.Ctx) error {
+	var payload model.ImpersonationRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	adminId := ctx.Locals("userId").(int)
+
+	response, err := controller.ImpersonationUsecase.Impersonate(ctx, adminId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type InviteController struct {
+	InviteUsecase *usecase.InviteUsecase
+	Log           *zap.Logger
+	Config        *koanf.Koanf
+}
+
+func NewInviteController(inviteUsecase *usecase.InviteUsecase, zap *zap.Logger, koanf *koanf.Koanf) *InviteController {
+	return &InviteController{
+		InviteUsecase: inviteUsecase,
+		Log:           zap,
+		Config:        koanf,
+	}
+}
+
+func (controller InviteController) Create(ctx *fiber.Ctx) error {
+	var payload model.InviteCodeCreateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	adminId := ctx.Locals("userId").(int)
+
+	response, err := controller.InviteUsecase.Create(ctx, adminId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller InviteController) List(ctx *fiber.Ctx) error {
+	response, err := controller.InviteUsecase.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type IPFilterController struct {
+	IPFilterUsecase *usecase.IPFilterUsecase
+	Log             *zap.Logger
+	Config          *koanf.Koanf
+}
+
+func NewIPFilterController(ipFilterUsecase *usecase.IPFilterUsecase, zap *zap.Logger, koanf *koanf.Koanf) *IPFilterController {
+	return &IPFilterController{
+		IPFilterUsecase: ipFilterUsecase,
+		Log:             zap,
+		Config:          koanf,
+	}
+}
+
+func (controller IPFilterController) List(ctx *fiber.Ctx) error {
+	response, err := controller.IPFilterUsecase.Rules(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller IPFilterController) Add(ctx *fiber.Ctx) error {
+	var payload model.IPFilterRuleRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.IPFilterUsecase.AddRule(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller IPFilterController) Remove(ctx *fiber.Ctx) error {
+	var payload model.IPFilterRuleRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.IPFilterUsecase.RemoveRule(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
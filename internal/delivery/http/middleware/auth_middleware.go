@@ -1,10 +1,15 @@
 package middleware
 
 import (
+	"cutterproject/internal/constant"
 	"cutterproject/internal/model"
 	"cutterproject/internal/usecase"
 	"cutterproject/internal/util"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/knadh/koanf/v2"
@@ -12,48 +17,196 @@ import (
 )
 
 type AuthMiddleware struct {
-	App         *fiber.App
-	Log         *zap.Logger
-	Config      *koanf.Koanf
-	UserUsecase *usecase.UserUsecase
+	App                   *fiber.App
+	Log                   *zap.Logger
+	Config                *koanf.Koanf
+	UserUsecase           *usecase.UserUsecase
+	SessionUsecase        *usecase.SessionUsecase
+	ServiceAccountUsecase *usecase.ServiceAccountUsecase
+	DPoPUsecase           *usecase.DPoPUsecase
+	ImpersonationUsecase  *usecase.ImpersonationUsecase
+	TokenFormat           util.TokenFormat
 }
 
-func NewAuthMiddleware(app *fiber.App, zap *zap.Logger, koanf *koanf.Koanf, userUsecase *usecase.UserUsecase) *AuthMiddleware {
+func NewAuthMiddleware(app *fiber.App, zap *zap.Logger, koanf *koanf.Koanf, userUsecase *usecase.UserUsecase, sessionUsecase *usecase.SessionUsecase, serviceAccountUsecase *usecase.ServiceAccountUsecase, dpopUsecase *usecase.DPoPUsecase, impersonationUsecase *usecase.ImpersonationUsecase, tokenFormat util.TokenFormat) *AuthMiddleware {
 	return &AuthMiddleware{
-		App:         app,
-		Log:         zap,
-		Config:      koanf,
-		UserUsecase: userUsecase,
+		App:                   app,
+		Log:                   zap,
+		Config:                koanf,
+		UserUsecase:           userUsecase,
+		SessionUsecase:        sessionUsecase,
+		ServiceAccountUsecase: serviceAccountUsecase,
+		DPoPUsecase:           dpopUsecase,
+		ImpersonationUsecase:  impersonationUsecase,
+		TokenFormat:           tokenFormat,
 	}
 }
 
-func (middleware *AuthMiddleware) ProtectedRoute() fiber.Handler {
+// ProtectedRoute accepts the listed principal types, only users when none are given. It sets the principalType
+// and claims locals, plus userId and sessionId for users or serviceAccountId for service accounts. Impersonation
+// tokens also set actorId and every request made with them is audited. Users with a language preference get the
+// locale local, see i18n.Locale
+func (middleware *AuthMiddleware) ProtectedRoute(principalTypes ...string) fiber.Handler {
+	if len(principalTypes) == 0 {
+		principalTypes = []string{constant.PRINCIPAL_TYPE_USER}
+	}
+
 	return func(ctx *fiber.Ctx) error {
 		var validationErr *model.ValidationError
 
 		accessToken := ctx.Get("Authorization")
-		tokenString, userId, err := util.ValidateAccessToken(accessToken, middleware.Log, middleware.Config.String("JWT_SECRET_KEY"))
+		tokenString, claims, err := util.ValidateAccessToken(accessToken, middleware.Log, middleware.TokenFormat)
+		if err != nil {
+			return unauthorized(err)
+		}
+
+		err = middleware.DPoPUsecase.VerifyRequest(ctx, tokenString, claims)
 		if err != nil {
 			if errors.As(err, &validationErr) {
-				return util.SendErrorResponseNotFound(ctx, err)
+				ctx.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`DPoP error="%s"`, constant.OAUTH_ERR_INVALID_DPOP_PROOF))
 			}
 
-			return util.SendErrorResponseInternalServer(ctx, middleware.Log, err)
+			return err
 		}
 
-		err = middleware.UserUsecase.GetAccessToken(ctx, userId, tokenString)
-		if err != nil {
-			if errors.As(err, &validationErr) {
-				return util.SendErrorResponseNotFound(ctx, err)
+		principalType := constant.PRINCIPAL_TYPE_USER
+		if claims.IsService() {
+			principalType = constant.PRINCIPAL_TYPE_SERVICE
+		}
+
+		if !slices.Contains(principalTypes, principalType) {
+			return &model.ValidationError{
+				Code:    constant.ERR_FORBIDDEN_ERROR,
+				Message: fmt.Sprintf("This endpoint is not available to %s principals", principalType),
+			}
+		}
+
+		if principalType == constant.PRINCIPAL_TYPE_SERVICE {
+			err = middleware.ServiceAccountUsecase.ValidateServiceToken(ctx, claims)
+			if err != nil {
+				return unauthorized(err)
 			}
 
-			return util.SendErrorResponseInternalServer(ctx, middleware.Log, err)
+			ctx.Locals("principalType", principalType)
+			ctx.Locals("serviceAccountId", claims.ServiceAccountId)
+			ctx.Locals("claims", claims)
+
+			return ctx.Next()
+		}
+
+		userId := claims.UserId
+		session, err := middleware.SessionUsecase.Validate(ctx, claims)
+		if err != nil {
+			return unauthorized(err)
 		}
 
+		ctx.Locals("principalType", principalType)
 		ctx.Locals("userId", userId)
+		ctx.Locals("sessionId", session.Id)
+		ctx.Locals("claims", claims)
+		if session.Locale != "" {
+			ctx.Locals("locale", session.Locale)
+		}
+
+		if claims.IsImpersonated() {
+			ctx.Locals("actorId", claims.Actor.UserId)
+
+			err = middleware.ImpersonationUsecase.RecordRequest(ctx, claims)
+			if err != nil {
+				return err
+			}
+		}
+
+		util.Logger(ctx, middleware.Log).Debug("Middleware here", zap.Int("userId", userId))
+
+		return ctx.Next()
+	}
+}
+
+// RequireScope must be registered after ProtectedRoute, service tokens must carry the scope while
+// users are not scoped and always pass
+func (middleware *AuthMiddleware) RequireScope(scope string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		claims := ctx.Locals("claims").(*model.Claims)
+
+		if claims.IsService() && !slices.Contains(strings.Fields(claims.Scope), scope) {
+			ctx.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="%s", scope="%s"`, constant.OAUTH_ERR_INSUFFICIENT_SCOPE, scope))
+			return &model.ValidationError{
+				Code:    constant.ERR_FORBIDDEN_ERROR,
+				Message: fmt.Sprintf("The %s scope is required", scope),
+			}
+		}
+
+		return ctx.Next()
+	}
+}
+
+// BlockImpersonation must be registered after ProtectedRoute, it keeps impersonation tokens away from
+// operations only the account owner may perform
+func (middleware *AuthMiddleware) BlockImpersonation() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		claims := ctx.Locals("claims").(*model.Claims)
+
+		if claims.IsImpersonated() {
+			util.Logger(ctx, middleware.Log).Info("Blocked impersonated request", zap.String("method", ctx.Method()), zap.String("path", ctx.Path()))
+			return &model.ValidationError{
+				Code:    constant.ERR_IMPERSONATION_FORBIDDEN_ERROR,
+				Message: "This operation is not available while impersonating a user",
+			}
+		}
+
+		return ctx.Next()
+	}
+}
+
+// AdminRoute must be registered after ProtectedRoute since it relies on the userId local
+func (middleware *AuthMiddleware) AdminRoute() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userId := ctx.Locals("userId").(int)
+		role, err := middleware.UserUsecase.GetUserRole(ctx, userId)
+		if err != nil {
+			return unauthorized(err)
+		}
 
-		middleware.Log.Debug("Middleware here", zap.Int("userId", userId))
+		if role != constant.ROLE_ADMIN {
+			return &model.ValidationError{
+				Code:    constant.ERR_FORBIDDEN_ERROR,
+				Message: "Admin privileges are required",
+			}
+		}
+
+		return ctx.Next()
+	}
+}
+
+// RequireFreshAuth must be registered after ProtectedRoute, it rejects tokens whose auth_time is older than maxAge
+// with a dedicated error code so clients know to prompt for /api/auth/reauthenticate instead of a full login
+func (middleware *AuthMiddleware) RequireFreshAuth(maxAge time.Duration) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		claims := ctx.Locals("claims").(*model.Claims)
+
+		if claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > maxAge {
+			return &model.ValidationError{
+				Code:    constant.ERR_REAUTHENTICATION_REQUIRED_ERROR,
+				Message: fmt.Sprintf("This operation requires you to have authenticated within the last %d minutes", int(maxAge.Minutes())),
+			}
+		}
 
 		return ctx.Next()
 	}
 }
+
+// unauthorized answers a token that was rejected by any of the lookups behind it with 401, the lookups report
+// missing sessions or users as not found
+func unauthorized(err error) error {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) {
+		return &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: validationErr.Message,
+			Param:   validationErr.Param,
+		}
+	}
+
+	return err
+}
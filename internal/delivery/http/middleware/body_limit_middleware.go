@@ -0,0 +1,12 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// BodyLimit sets the largest body in bytes util.ReadJSONBody accepts on the routes below it, a route can register
+// it again to override the limit of its group. The server wide BodyLimit still caps every request
+func BodyLimit(limit int) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Locals("bodyLimit", limit)
+		return ctx.Next()
+	}
+}
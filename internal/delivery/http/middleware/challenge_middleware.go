@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type ChallengeMiddleware struct {
+	Log              *zap.Logger
+	Config           *koanf.Koanf
+	ChallengeUsecase *usecase.ChallengeUsecase
+}
+
+func NewChallengeMiddleware(zap *zap.Logger, koanf *koanf.Koanf, challengeUsecase *usecase.ChallengeUsecase) *ChallengeMiddleware {
+	return &ChallengeMiddleware{
+		Log:              zap,
+		Config:           koanf,
+		ChallengeUsecase: challengeUsecase,
+	}
+}
+
+// RequireChallenge verifies the X-Challenge / X-Challenge-Solution headers before the handler runs. Failed
+// credential checks the handler reports with a model.CredentialError are counted so the next challenge for that
+// IP gets harder, other errors such as a taken username or a login that needs step-up are not
+func (middleware *ChallengeMiddleware) RequireChallenge() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !middleware.ChallengeUsecase.Enabled() {
+			return ctx.Next()
+		}
+
+		var validationErr *model.ValidationError
+
+		err := middleware.ChallengeUsecase.Verify(ctx, ctx.Get("X-Challenge"), ctx.Get("X-Challenge-Solution"))
+		if err != nil {
+			if errors.As(err, &validationErr) {
+				middleware.ChallengeUsecase.RecordFailure(ctx)
+			}
+
+			return err
+		}
+
+		err = ctx.Next()
+
+		var credentialErr *model.CredentialError
+		if errors.As(err, &credentialErr) {
+			middleware.ChallengeUsecase.RecordFailure(ctx)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/exception"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type countingChallengeVerifier struct {
+	failures int
+}
+
+func (verifier *countingChallengeVerifier) Issue(ctx context.Context, ip string) (model.ChallengeResponse, error) {
+	return model.ChallengeResponse{Provider: "fake"}, nil
+}
+
+func (verifier *countingChallengeVerifier) Verify(ctx context.Context, solution model.ChallengeSolution) error {
+	return nil
+}
+
+func (verifier *countingChallengeVerifier) RecordFailure(ctx context.Context, ip string) error {
+	verifier.failures++
+	return nil
+}
+
+func TestRequireChallengeRecordsFailures(t *testing.T) {
+	verifier := &countingChallengeVerifier{}
+	challengeMiddleware := NewChallengeMiddleware(zap.NewNop(), koanf.New("."), usecase.NewChallengeUsecase(verifier, zap.NewNop(), koanf.New(".")))
+
+	app := fiber.New(fiber.Config{ErrorHandler: exception.NewErrorHandler(zap.NewNop())})
+	app.Post("/login", challengeMiddleware.RequireChallenge(), func(ctx *fiber.Ctx) error {
+		switch ctx.Query("fail") {
+		case "password":
+			return &model.CredentialError{Err: &model.ValidationError{Code: constant.ERR_VALIDATION_CODE, Message: "Password is incorrect", Param: "password"}}
+		case "code":
+			return &model.CredentialError{Err: &model.ValidationError{Code: constant.ERR_UNATHORIZED_ERROR, Message: "Too many incorrect codes, please sign in again", Param: "code"}}
+		case "taken":
+			return &model.ValidationError{Code: constant.ERR_CONFLICT_ERROR, Message: "Username is already exist", Param: "username"}
+		case "invalid":
+			return &model.ValidationError{Code: constant.ERR_VALIDATION_CODE, Message: "Email is not a valid email address", Param: "email"}
+		case "step-up":
+			return &model.StepUpRequiredError{Code: constant.ERR_STEP_UP_REQUIRED_ERROR, Message: "Verification code required"}
+		}
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	cases := []struct {
+		name     string
+		target   string
+		solution string
+		status   int
+		failures int
+	}{
+		{"missing solution", "/login", "", fiber.StatusForbidden, 1},
+		{"wrong password", "/login?fail=password", "42", fiber.StatusBadRequest, 2},
+		{"wrong one-time code", "/login?fail=code", "42", fiber.StatusUnauthorized, 3},
+		// honest users run into these, they must not make their own challenges harder
+		{"username taken", "/login?fail=taken", "42", fiber.StatusConflict, 3},
+		{"invalid request", "/login?fail=invalid", "42", fiber.StatusBadRequest, 3},
+		{"step-up required", "/login?fail=step-up", "42", fiber.StatusUnauthorized, 3},
+		{"handler succeeds", "/login", "42", fiber.StatusOK, 3},
+	}
+
+	for _, c := range cases {
+		request := httptest.NewRequest(fiber.MethodPost, c.target, nil)
+		request.Header.Set("X-Challenge", "challenge")
+		if c.solution != "" {
+			request.Header.Set("X-Challenge-Solution", c.solution)
+		}
+
+		response, err := app.Test(request)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if response.StatusCode != c.status {
+			t.Errorf("%s: status = %d, want %d", c.name, response.StatusCode, c.status)
+		}
+		if verifier.failures != c.failures {
+			t.Errorf("%s: failures = %d, want %d", c.name, verifier.failures, c.failures)
+		}
+	}
+}
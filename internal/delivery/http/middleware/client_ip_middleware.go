@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/util"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientIP resolves the address of the client behind trusted proxies once per request, util.ClientIP reads it.
+// It must run ahead of everything that looks at client addresses
+func ClientIP(proxies util.TrustedProxies, proxyHeader string) fiber.Handler {
+	headerName := fiber.HeaderXForwardedFor
+	if proxyHeader == constant.TRUSTED_PROXY_HEADER_FORWARDED {
+		headerName = fiber.HeaderForwarded
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		peer, ok := netip.AddrFromSlice(ctx.Context().RemoteIP())
+		if !ok {
+			return ctx.Next()
+		}
+
+		// a header sent on several lines is one list, a proxy may append its own line after the client's
+		values := []string{}
+		for _, value := range ctx.Request().Header.PeekAll(headerName) {
+			values = append(values, string(value))
+		}
+
+		client := util.ResolveClientIP(peer, proxyHeader, strings.Join(values, ","), proxies)
+		ctx.Locals("clientIp", client.String())
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type IPFilterMiddleware struct {
+	Log             *zap.Logger
+	Config          *koanf.Koanf
+	IPFilterUsecase *usecase.IPFilterUsecase
+}
+
+func NewIPFilterMiddleware(zap *zap.Logger, koanf *koanf.Koanf, ipFilterUsecase *usecase.IPFilterUsecase) *IPFilterMiddleware {
+	return &IPFilterMiddleware{
+		Log:             zap,
+		Config:          koanf,
+		IPFilterUsecase: ipFilterUsecase,
+	}
+}
+
+// Filter rejects clients from denied networks, from outside the allow lists and from blocked countries, each
+// blocked request is logged and counted. It must run after ClientIP
+func (middleware *IPFilterMiddleware) Filter() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		ip := util.ClientIP(ctx)
+
+		reason, country := middleware.IPFilterUsecase.Check(ip)
+		if reason == "" {
+			return ctx.Next()
+		}
+
+		util.Logger(ctx, middleware.Log).Warn("Request blocked by IP filter", zap.String("reason", reason), zap.String("ip", ip),
+			zap.String("country", country), zap.String("method", ctx.Method()), zap.String("path", ctx.Path()))
+		middleware.IPFilterUsecase.RecordBlocked(ctx, reason)
+
+		return &model.ValidationError{
+			Code:    constant.ERR_IP_BLOCKED_ERROR,
+			Message: "Access from your network or country is not allowed",
+		}
+	}
+}
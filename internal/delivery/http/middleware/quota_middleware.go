@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type QuotaMiddleware struct {
+	Log          *zap.Logger
+	Config       *koanf.Koanf
+	QuotaUsecase *usecase.QuotaUsecase
+}
+
+func NewQuotaMiddleware(zap *zap.Logger, koanf *koanf.Koanf, quotaUsecase *usecase.QuotaUsecase) *QuotaMiddleware {
+	return &QuotaMiddleware{
+		Log:          zap,
+		Config:       koanf,
+		QuotaUsecase: quotaUsecase,
+	}
+}
+
+// Meter counts every request against the user's quota of metric and rejects it once the quota is used up,
+// it must be registered after ProtectedRoute. Requests without a user, such as service tokens, are not metered
+func (middleware *QuotaMiddleware) Meter(metric string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userId, ok := ctx.Locals("userId").(int)
+		if !ok {
+			return ctx.Next()
+		}
+
+		usage, err := middleware.QuotaUsecase.Consume(ctx, userId, metric)
+		if err != nil {
+			var validationErr *model.ValidationError
+			if !errors.As(err, &validationErr) {
+				// like rate limiting, metering must not take every endpoint down with Redis
+				util.Logger(ctx, middleware.Log).Error("Quota check failed, letting the request through", zap.String("metric", metric), zap.Error(err))
+				return ctx.Next()
+			}
+
+			if validationErr.Code == constant.ERR_QUOTA_EXCEEDED_ERROR {
+				ctx.Set(fiber.HeaderRetryAfter, ceilSeconds(time.Until(usage.ResetsAt)))
+			}
+			return err
+		}
+
+		return ctx.Next()
+	}
+}
@@ -1,47 +1,96 @@
 package middleware
 
 import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/knadh/koanf/v2"
 	"go.uber.org/zap"
 )
 
-// SetupRateLimiter configures rate limiting middleware for the application
-func SetupRateLimiter(logger *zap.Logger) fiber.Handler {
-	return limiter.New(limiter.Config{
-		Next: func(c *fiber.Ctx) bool {
-			// Skip rate limiting for health check endpoint
-			return c.Path() == "/api/health"
-		},
-		Max:        100, // Max requests per window
-		Expiration: 60,  // Window duration in seconds
-		KeyGenerator: func(c *fiber.Ctx) string {
-			// Use IP address as the key for rate limiting
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			logger.Warn("Rate limit exceeded", zap.String("ip", c.IP()))
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded, please try again later",
-			})
-		},
-	})
+type RateLimitMiddleware struct {
+	Log              *zap.Logger
+	Config           *koanf.Koanf
+	RateLimitUsecase *usecase.RateLimitUsecase
+}
+
+func NewRateLimitMiddleware(zap *zap.Logger, koanf *koanf.Koanf, rateLimitUsecase *usecase.RateLimitUsecase) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		Log:              zap,
+		Config:           koanf,
+		RateLimitUsecase: rateLimitUsecase,
+	}
+}
+
+// Limit applies the policy of a route group and answers with the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers of the IETF RateLimit header fields draft, plus Retry-After once
+// the limit is reached. Policies keyed by user or API key must be registered after the middleware that sets the
+// userId, serviceAccountId or scimTenant local
+func (middleware *RateLimitMiddleware) Limit(group string) fiber.Handler {
+	policy, enabled, err := middleware.RateLimitUsecase.Policy(group)
+	if err != nil {
+		middleware.Log.Fatal("Invalid rate limit policy", zap.String("group", group), zap.Error(err))
+	}
+
+	if !enabled {
+		return func(ctx *fiber.Ctx) error {
+			return ctx.Next()
+		}
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		result, err := middleware.RateLimitUsecase.Take(ctx, policy, rateLimitSubject(ctx, policy.By))
+		if err != nil {
+			// losing Redis must not take every endpoint down with it
+			util.Logger(ctx, middleware.Log).Error("Rate limit check failed, letting the request through", zap.String("group", group), zap.Error(err))
+			return ctx.Next()
+		}
+
+		ctx.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		ctx.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		ctx.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+		ctx.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds())))
+
+		if !result.Allowed {
+			util.Logger(ctx, middleware.Log).Warn("Rate limit exceeded", zap.String("group", group), zap.String("ip", util.ClientIP(ctx)))
+			ctx.Set(fiber.HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+			return &model.ValidationError{
+				Code:    constant.ERR_TOO_MANY_REQUESTS_ERROR,
+				Message: "Rate limit exceeded, please try again later",
+			}
+		}
+
+		return ctx.Next()
+	}
 }
 
-// SetupAuthRateLimiter configures a stricter rate limiting for authentication endpoints
-func SetupAuthRateLimiter(logger *zap.Logger) fiber.Handler {
-	return limiter.New(limiter.Config{
-		Max:        5,   // Max requests per window
-		Expiration: 300, // Window duration in seconds (5 minutes)
-		KeyGenerator: func(c *fiber.Ctx) string {
-			// Use IP address as the key for rate limiting
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			logger.Warn("Auth rate limit exceeded", zap.String("ip", c.IP()))
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Too many authentication attempts, please try again later",
-			})
-		},
-	})
-}
\ No newline at end of file
+// rateLimitSubject is who a request is counted for, requests without the principal the policy is keyed by
+// are counted by IP
+func rateLimitSubject(ctx *fiber.Ctx, by string) string {
+	switch by {
+	case constant.RATE_LIMIT_BY_USER:
+		if userId, ok := ctx.Locals("userId").(int); ok {
+			return fmt.Sprintf("user:%d", userId)
+		}
+	case constant.RATE_LIMIT_BY_API_KEY:
+		if serviceAccountId, ok := ctx.Locals("serviceAccountId").(int); ok {
+			return fmt.Sprintf("service:%d", serviceAccountId)
+		}
+		if tenant, ok := ctx.Locals("scimTenant").(model.SCIMTenant); ok {
+			return fmt.Sprintf("scim:%d", tenant.Id)
+		}
+	}
+
+	return "ip:" + util.ClientIP(ctx)
+}
+
+func ceilSeconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
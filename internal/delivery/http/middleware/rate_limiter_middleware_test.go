@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"cutterproject/internal/exception"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/usecase"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func newTestRateLimitMiddleware(t *testing.T, settings map[string]interface{}) (*RateLimitMiddleware, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	server.SetTime(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	config := koanf.New(".")
+	config.Set("RATE_LIMIT_ENABLED", true)
+	for key, value := range settings {
+		config.Set(key, value)
+	}
+
+	rateLimitUsecase := usecase.NewRateLimitUsecase(repository.NewRateLimitRepository(zap.NewNop(), client), zap.NewNop(), config)
+	return NewRateLimitMiddleware(zap.NewNop(), config, rateLimitUsecase), server
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	rateLimitMiddleware, _ := newTestRateLimitMiddleware(t, map[string]interface{}{
+		"RATE_LIMIT_AUTH":        2,
+		"RATE_LIMIT_AUTH_PERIOD": 60,
+	})
+
+	app := fiber.New(fiber.Config{ErrorHandler: exception.NewErrorHandler(zap.NewNop())})
+	app.Post("/login", rateLimitMiddleware.Limit("auth"), func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	cases := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{fiber.StatusOK, "1", "30", ""},
+		{fiber.StatusOK, "0", "60", ""},
+		{fiber.StatusTooManyRequests, "0", "60", "30"},
+	}
+
+	for i, c := range cases {
+		response, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/login", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.StatusCode != c.status {
+			t.Errorf("request %d: status = %d, want %d", i+1, response.StatusCode, c.status)
+		}
+		if limit := response.Header.Get("RateLimit-Limit"); limit != "2" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want 2", i+1, limit)
+		}
+		if policy := response.Header.Get("RateLimit-Policy"); policy != "2;w=60" {
+			t.Errorf("request %d: RateLimit-Policy = %q, want 2;w=60", i+1, policy)
+		}
+		if remaining := response.Header.Get("RateLimit-Remaining"); remaining != c.remaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %s", i+1, remaining, c.remaining)
+		}
+		if reset := response.Header.Get("RateLimit-Reset"); reset != c.reset {
+			t.Errorf("request %d: RateLimit-Reset = %q, want %s", i+1, reset, c.reset)
+		}
+		if retryAfter := response.Header.Get(fiber.HeaderRetryAfter); retryAfter != c.retryAfter {
+			t.Errorf("request %d: Retry-After = %q, want %q", i+1, retryAfter, c.retryAfter)
+		}
+	}
+}
+
+func TestRateLimitSubject(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		group    string
+		locals   map[string]interface{}
+		key      string
+	}{
+		{"by ip", nil, "api", map[string]interface{}{"userId": 7}, "ratelimit:api:ip:0.0.0.0"},
+		{"by user", nil, "users", map[string]interface{}{"userId": 7}, "ratelimit:users:user:7"},
+		{"by user without one", nil, "users", nil, "ratelimit:users:ip:0.0.0.0"},
+		{"by user overridden to ip", map[string]interface{}{"RATE_LIMIT_USERS_BY": "ip"}, "users", map[string]interface{}{"userId": 7}, "ratelimit:users:ip:0.0.0.0"},
+		{"by ip overridden to user", map[string]interface{}{"RATE_LIMIT_API_BY": "USER"}, "api", map[string]interface{}{"userId": 7}, "ratelimit:api:user:7"},
+		{"service account", map[string]interface{}{"RATE_LIMIT_ADMIN_BY": "apikey"}, "admin", map[string]interface{}{"serviceAccountId": 3}, "ratelimit:admin:service:3"},
+		{"SCIM tenant", nil, "scim", map[string]interface{}{"scimTenant": model.SCIMTenant{Id: 4}}, "ratelimit:scim:scim:4"},
+		{"SCIM tenant by ip", nil, "scim_auth", map[string]interface{}{"scimTenant": model.SCIMTenant{Id: 4}}, "ratelimit:scim_auth:ip:0.0.0.0"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rateLimitMiddleware, server := newTestRateLimitMiddleware(t, c.settings)
+
+			app := fiber.New()
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				for key, value := range c.locals {
+					ctx.Locals(key, value)
+				}
+				return ctx.Next()
+			}, rateLimitMiddleware.Limit(c.group), func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			_, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if keys := server.Keys(); !slices.Equal(keys, []string{c.key}) {
+				t.Errorf("counted as %v, want %s", keys, c.key)
+			}
+		})
+	}
+}
+
+func TestRateLimitPolicyRejectsUnknownSubject(t *testing.T) {
+	rateLimitMiddleware, _ := newTestRateLimitMiddleware(t, map[string]interface{}{"RATE_LIMIT_API_BY": "session"})
+
+	_, _, err := rateLimitMiddleware.RateLimitUsecase.Policy("api")
+	if err == nil {
+		t.Error("RATE_LIMIT_API_BY=session was accepted")
+	}
+}
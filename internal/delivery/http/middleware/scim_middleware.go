@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type SCIMMiddleware struct {
+	Log         *zap.Logger
+	Config      *koanf.Koanf
+	SCIMUsecase *usecase.SCIMUsecase
+}
+
+func NewSCIMMiddleware(zap *zap.Logger, koanf *koanf.Koanf, scimUsecase *usecase.SCIMUsecase) *SCIMMiddleware {
+	return &SCIMMiddleware{
+		Log:         zap,
+		Config:      koanf,
+		SCIMUsecase: scimUsecase,
+	}
+}
+
+// RequireToken authenticates the IdP by its tenant bearer token and stores the tenant in the scimTenant local
+func (middleware *SCIMMiddleware) RequireToken() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var scimErr *model.SCIMError
+
+		tenant, err := middleware.SCIMUsecase.Authenticate(ctx, ctx.Get(fiber.HeaderAuthorization))
+		if err != nil {
+			if errors.As(err, &scimErr) {
+				ctx.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+			}
+
+			return err
+		}
+
+		ctx.Locals("scimTenant", tenant)
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// OAuthController serves the OAuth 2.0 endpoints meant for machine clients
+type OAuthController struct {
+	ServiceAccountUsecase *usecase.ServiceAccountUsecase
+	SessionUsecase        *usecase.SessionUsecase
+	Log                   *zap.Logger
+	Config                *koanf.Koanf
+}
+
+func NewOAuthController(serviceAccountUsecase *usecase.ServiceAccountUsecase, sessionUsecase *usecase.SessionUsecase, zap *zap.Logger, koanf *koanf.Koanf) *OAuthController {
+	return &OAuthController{
+		ServiceAccountUsecase: serviceAccountUsecase,
+		SessionUsecase:        sessionUsecase,
+		Log:                   zap,
+		Config:                koanf,
+	}
+}
+
+func (controller OAuthController) Token(ctx *fiber.Ctx) error {
+	var payload model.ClientCredentialsRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return &model.OAuthError{ErrorCode: constant.OAUTH_ERR_INVALID_REQUEST}
+	}
+
+	response, err := controller.ServiceAccountUsecase.Token(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller OAuthController) Introspect(ctx *fiber.Ctx) error {
+	var payload model.TokenIntrospectionRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return &model.OAuthError{ErrorCode: constant.OAUTH_ERR_INVALID_REQUEST}
+	}
+
+	response, err := controller.SessionUsecase.Introspect(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller OAuthController) Revoke(ctx *fiber.Ctx) error {
+	var payload model.TokenRevocationRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return &model.OAuthError{ErrorCode: constant.OAUTH_ERR_INVALID_REQUEST}
+	}
+
+	err = controller.SessionUsecase.Revoke(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
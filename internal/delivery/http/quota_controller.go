@@ -0,0 +1,84 @@
+package http
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type QuotaController struct {
+	QuotaUsecase *usecase.QuotaUsecase
+	Log          *zap.Logger
+	Config       *koanf.Koanf
+}
+
+func NewQuotaController(quotaUsecase *usecase.QuotaUsecase, zap *zap.Logger, koanf *koanf.Koanf) *QuotaController {
+	return &QuotaController{
+		QuotaUsecase: quotaUsecase,
+		Log:          zap,
+		Config:       koanf,
+	}
+}
+
+func (controller QuotaController) GetMyUsage(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(int)
+
+	response, err := controller.QuotaUsecase.Usage(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller QuotaController) GetUserUsage(ctx *fiber.Ctx) error {
+	userId, err := userIdParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.QuotaUsecase.Usage(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller QuotaController) UpdateUserPlan(ctx *fiber.Ctx) error {
+	userId, err := userIdParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	var payload model.PlanUpdateRequest
+	err = util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.QuotaUsecase.SetPlan(ctx, userId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func userIdParam(ctx *fiber.Ctx) (int, error) {
+	userId, err := ctx.ParamsInt("userId")
+	if err != nil || userId <= 0 {
+		return 0, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "User id is required",
+			Param:   "userId",
+		}
+	}
+
+	return userId, nil
+}
@@ -1,31 +1,136 @@
 package route
 
 import (
+	"cutterproject/internal/constant"
 	"cutterproject/internal/delivery/http"
 	"cutterproject/internal/delivery/http/middleware"
+	"cutterproject/internal/util"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// FreshAuthMaxAge is how long after logging in or reauthenticating sensitive account operations are allowed
+var FreshAuthMaxAge = 5 * time.Minute
+
+// JSONBodyLimit caps the JSON bodies of /api requests, IdP metadata documents get SAMLMetadataBodyLimit instead
+var (
+	JSONBodyLimit         = 16 * 1024
+	SAMLMetadataBodyLimit = 1024 * 1024
+)
+
 type RouteConfig struct {
-	App            *fiber.App
-	AuthMiddleware *middleware.AuthMiddleware
-	UserController *http.UserController
+	App                      *fiber.App
+	TrustedProxies           util.TrustedProxies
+	TrustedProxyHeader       string
+	AuthMiddleware           *middleware.AuthMiddleware
+	ChallengeMiddleware      *middleware.ChallengeMiddleware
+	SCIMMiddleware           *middleware.SCIMMiddleware
+	RateLimitMiddleware      *middleware.RateLimitMiddleware
+	QuotaMiddleware          *middleware.QuotaMiddleware
+	IPFilterMiddleware       *middleware.IPFilterMiddleware
+	UserController           *http.UserController
+	InviteController         *http.InviteController
+	ChallengeController      *http.ChallengeController
+	DeviceController         *http.DeviceController
+	OAuthController          *http.OAuthController
+	ServiceAccountController *http.ServiceAccountController
+	ImpersonationController  *http.ImpersonationController
+	SAMLController           *http.SAMLController
+	SCIMController           *http.SCIMController
+	QuotaController          *http.QuotaController
+	IPFilterController       *http.IPFilterController
 }
 
 func (c *RouteConfig) SetupRoute() {
-	api := c.App.Group("/api")
+	// every consumer of the client address, from rate limits to audit events, reads what this resolves
+	c.App.Use(middleware.ClientIP(c.TrustedProxies, c.TrustedProxyHeader))
 
-	api.Get("/health", func(c *fiber.Ctx) error {
+	// registered ahead of the /api group so health checks are never rate limited
+	c.App.Get("/api/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
+	// after the health route so load balancer checks are never filtered
+	c.App.Use(c.IPFilterMiddleware.Filter())
+
+	api := c.App.Group("/api", middleware.BodyLimit(JSONBodyLimit), c.RateLimitMiddleware.Limit("api"))
+	// the credential endpoints share one stricter bucket per client
+	authLimit := c.RateLimitMiddleware.Limit("auth")
 
 	authGroup := api.Group("/auth")
-	authGroup.Post("/register", c.UserController.Register)
-	authGroup.Post("/login", c.UserController.Login)
+	authGroup.Get("/challenge", c.ChallengeController.Issue)
+	authGroup.Post("/register", authLimit, c.ChallengeMiddleware.RequireChallenge(), c.UserController.Register)
+	authGroup.Post("/login", authLimit, c.ChallengeMiddleware.RequireChallenge(), c.UserController.Login)
+	authGroup.Post("/login/verify", authLimit, c.ChallengeMiddleware.RequireChallenge(), c.UserController.VerifyLogin)
+	authGroup.Post("/magic-link", authLimit, c.ChallengeMiddleware.RequireChallenge(), c.UserController.RequestMagicLink)
+	authGroup.Post("/magic-link/verify", c.UserController.RedeemMagicLink)
+
+	authGroup.Post("/reauthenticate", authLimit, c.AuthMiddleware.ProtectedRoute(), c.AuthMiddleware.BlockImpersonation(), c.UserController.Reauthenticate)
+
+	authGroup.Post("/device/code", authLimit, c.DeviceController.CreateCode)
+	authGroup.Post("/device/token", c.RateLimitMiddleware.Limit("device"), c.DeviceController.Token)
+	// approving a device would hand out a token without the act claim
+	authGroup.Post("/device/approve", authLimit, c.AuthMiddleware.ProtectedRoute(), c.AuthMiddleware.BlockImpersonation(), c.DeviceController.Approve)
 
-	userGroup := api.Group("/users", c.AuthMiddleware.ProtectedRoute())
-	userGroup.Get("/me", c.UserController.GetUserInfo)
+	// only billable endpoints count against api_calls, a used up quota must not lock users out of checking their
+	// usage or securing and deleting their account, nor admins out of the admin endpoints that lift it
+	apiCalls := c.QuotaMiddleware.Meter(constant.QUOTA_METRIC_API_CALLS)
+
+	userGroup := api.Group("/users", c.AuthMiddleware.ProtectedRoute(), c.RateLimitMiddleware.Limit("users"))
+	userGroup.Get("/me", apiCalls, c.UserController.GetUserInfo)
+	userGroup.Get("/me/usage", c.QuotaController.GetMyUsage)
+	userGroup.Put("/me/password", c.AuthMiddleware.BlockImpersonation(), c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.UserController.UpdatePassword)
+	userGroup.Put("/me/email", c.AuthMiddleware.BlockImpersonation(), c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.UserController.UpdateEmail)
+	userGroup.Put("/me/locale", c.AuthMiddleware.BlockImpersonation(), apiCalls, c.UserController.UpdateLocale)
+	userGroup.Delete("/me", c.AuthMiddleware.BlockImpersonation(), c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.UserController.Delete)
 	//userGroup.Get("/:userId", c.UserController.GetUserInfo)
 	//userGroup.Delete("/:userId")
+
+	adminGroup := api.Group("/admin", c.AuthMiddleware.ProtectedRoute(), c.AuthMiddleware.AdminRoute(), c.RateLimitMiddleware.Limit("admin"))
+	adminGroup.Get("/users/:userId/usage", c.QuotaController.GetUserUsage)
+	adminGroup.Put("/users/:userId/plan", c.QuotaController.UpdateUserPlan)
+	adminGroup.Post("/invites", c.InviteController.Create)
+	adminGroup.Get("/invites", c.InviteController.List)
+	adminGroup.Post("/service-accounts", c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.ServiceAccountController.Create)
+	adminGroup.Get("/service-accounts", c.ServiceAccountController.List)
+	adminGroup.Put("/service-accounts/:serviceAccountId/disabled", c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.ServiceAccountController.SetDisabled)
+	adminGroup.Post("/service-accounts/:serviceAccountId/rotate-secret", c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.ServiceAccountController.RotateSecret)
+	adminGroup.Post("/saml/identity-providers", middleware.BodyLimit(SAMLMetadataBodyLimit), c.SAMLController.CreateIdentityProvider)
+	adminGroup.Get("/saml/identity-providers", c.SAMLController.ListIdentityProviders)
+	adminGroup.Post("/scim/tenants", c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.SCIMController.CreateTenant)
+	adminGroup.Get("/scim/tenants", c.SCIMController.ListTenants)
+	adminGroup.Get("/ip-filter/rules", c.IPFilterController.List)
+	adminGroup.Post("/ip-filter/rules", c.IPFilterController.Add)
+	adminGroup.Delete("/ip-filter/rules", c.IPFilterController.Remove)
+	adminGroup.Post("/impersonate", c.AuthMiddleware.RequireFreshAuth(FreshAuthMaxAge), c.ImpersonationController.Impersonate)
+
+	// SAML endpoints live outside /api, their URLs are registered with every IdP through the SP metadata
+	samlGroup := c.App.Group("/saml")
+	samlGroup.Get("/metadata", c.SAMLController.Metadata)
+	samlGroup.Get("/login", c.SAMLController.Login)
+	samlGroup.Post("/acs", c.SAMLController.ConsumeAssertion)
+
+	// SCIM endpoints live outside /api at the base URL IdPs are configured with, each tenant authenticates with its own token
+	scimGroup := c.App.Group("/scim/v2", c.RateLimitMiddleware.Limit("scim_auth"), c.SCIMMiddleware.RequireToken(), c.RateLimitMiddleware.Limit("scim"))
+	scimGroup.Get("/ServiceProviderConfig", c.SCIMController.ServiceProviderConfig)
+	scimGroup.Get("/Users", c.SCIMController.ListUsers)
+	scimGroup.Post("/Users", c.SCIMController.CreateUser)
+	scimGroup.Get("/Users/:id", c.SCIMController.GetUser)
+	scimGroup.Put("/Users/:id", c.SCIMController.ReplaceUser)
+	scimGroup.Patch("/Users/:id", c.SCIMController.PatchUser)
+	scimGroup.Delete("/Users/:id", c.SCIMController.DeleteUser)
+	scimGroup.Get("/Groups", c.SCIMController.ListGroups)
+	scimGroup.Post("/Groups", c.SCIMController.CreateGroup)
+	scimGroup.Get("/Groups/:id", c.SCIMController.GetGroup)
+	scimGroup.Put("/Groups/:id", c.SCIMController.ReplaceGroup)
+	scimGroup.Patch("/Groups/:id", c.SCIMController.PatchGroup)
+	scimGroup.Delete("/Groups/:id", c.SCIMController.DeleteGroup)
+
+	// OAuth endpoints live outside /api so their URLs match what OAuth client libraries expect
+	oauthGroup := c.App.Group("/oauth", c.RateLimitMiddleware.Limit("oauth"))
+	oauthGroup.Post("/token", c.OAuthController.Token)
+	oauthGroup.Post("/introspect", c.AuthMiddleware.ProtectedRoute(constant.PRINCIPAL_TYPE_SERVICE),
+		c.AuthMiddleware.RequireScope(constant.SCOPE_TOKEN_INTROSPECT), c.OAuthController.Introspect)
+	// holding a token is enough to revoke it, browser and CLI clients have no client credentials
+	oauthGroup.Post("/revoke", c.OAuthController.Revoke)
 }
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type SAMLController struct {
+	SAMLUsecase *usecase.SAMLUsecase
+	Log         *zap.Logger
+	Config      *koanf.Koanf
+}
+
+func NewSAMLController(samlUsecase *usecase.SAMLUsecase, zap *zap.Logger, koanf *koanf.Koanf) *SAMLController {
+	return &SAMLController{
+		SAMLUsecase: samlUsecase,
+		Log:         zap,
+		Config:      koanf,
+	}
+}
+
+func (controller SAMLController) Metadata(ctx *fiber.Ctx) error {
+	metadata, err := controller.SAMLUsecase.Metadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return ctx.Send(metadata)
+}
+
+func (controller SAMLController) Login(ctx *fiber.Ctx) error {
+	var payload model.SAMLLoginRequest
+	err := ctx.QueryParser(&payload)
+	if err != nil {
+		return &model.ValidationError{
+			Code:    constant.ERR_INVALID_REQUEST_BODY_ERROR_CODE,
+			Message: constant.ERR_INVALID_REQUEST_BODY_MESSAGE,
+		}
+	}
+
+	redirectURL, err := controller.SAMLUsecase.Login(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Redirect(redirectURL, fiber.StatusFound)
+}
+
+func (controller SAMLController) ConsumeAssertion(ctx *fiber.Ctx) error {
+	var payload model.SAMLResponseRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return &model.ValidationError{
+			Code:    constant.ERR_INVALID_REQUEST_BODY_ERROR_CODE,
+			Message: constant.ERR_INVALID_REQUEST_BODY_MESSAGE,
+		}
+	}
+
+	response, err := controller.SAMLUsecase.ConsumeAssertion(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller SAMLController) CreateIdentityProvider(ctx *fiber.Ctx) error {
+	var payload model.SAMLIdentityProviderCreateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.SAMLUsecase.CreateIdentityProvider(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller SAMLController) ListIdentityProviders(ctx *fiber.Ctx) error {
+	response, err := controller.SAMLUsecase.ListIdentityProviders(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
@@ -0,0 +1,194 @@
+package http
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// SCIMController serves the SCIM 2.0 API under /scim/v2 and the admin endpoints managing its tenants,
+// SCIM endpoints answer with RFC 7644 error bodies instead of the usual error response
+type SCIMController struct {
+	SCIMUsecase *usecase.SCIMUsecase
+	Log         *zap.Logger
+	Config      *koanf.Koanf
+}
+
+func NewSCIMController(scimUsecase *usecase.SCIMUsecase, zap *zap.Logger, koanf *koanf.Koanf) *SCIMController {
+	return &SCIMController{
+		SCIMUsecase: scimUsecase,
+		Log:         zap,
+		Config:      koanf,
+	}
+}
+
+func (controller SCIMController) CreateTenant(ctx *fiber.Ctx) error {
+	var payload model.SCIMTenantCreateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.SCIMUsecase.CreateTenant(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller SCIMController) ListTenants(ctx *fiber.Ctx) error {
+	response, err := controller.SCIMUsecase.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller SCIMController) ServiceProviderConfig(ctx *fiber.Ctx) error {
+	return util.SendSCIMResponse(ctx, fiber.StatusOK, controller.SCIMUsecase.ServiceProviderConfig())
+}
+
+func (controller SCIMController) ListUsers(ctx *fiber.Ctx) error {
+	var payload model.SCIMListRequest
+	err := ctx.QueryParser(&payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.ListUsers(ctx, scimTenant(ctx), payload)
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) GetUser(ctx *fiber.Ctx) error {
+	response, err := controller.SCIMUsecase.GetUser(ctx, scimTenant(ctx), ctx.Params("id"))
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) CreateUser(ctx *fiber.Ctx) error {
+	var payload model.SCIMUser
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.CreateUser(ctx, scimTenant(ctx), payload)
+	return controller.respond(ctx, fiber.StatusCreated, response, err)
+}
+
+func (controller SCIMController) ReplaceUser(ctx *fiber.Ctx) error {
+	var payload model.SCIMUser
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.ReplaceUser(ctx, scimTenant(ctx), ctx.Params("id"), payload)
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) PatchUser(ctx *fiber.Ctx) error {
+	var payload model.SCIMPatchRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.PatchUser(ctx, scimTenant(ctx), ctx.Params("id"), payload)
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) DeleteUser(ctx *fiber.Ctx) error {
+	err := controller.SCIMUsecase.DeleteUser(ctx, scimTenant(ctx), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (controller SCIMController) ListGroups(ctx *fiber.Ctx) error {
+	var payload model.SCIMListRequest
+	err := ctx.QueryParser(&payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.ListGroups(ctx, scimTenant(ctx), payload)
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) GetGroup(ctx *fiber.Ctx) error {
+	response, err := controller.SCIMUsecase.GetGroup(ctx, scimTenant(ctx), ctx.Params("id"))
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) CreateGroup(ctx *fiber.Ctx) error {
+	var payload model.SCIMGroup
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.CreateGroup(ctx, scimTenant(ctx), payload)
+	return controller.respond(ctx, fiber.StatusCreated, response, err)
+}
+
+func (controller SCIMController) ReplaceGroup(ctx *fiber.Ctx) error {
+	var payload model.SCIMGroup
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.ReplaceGroup(ctx, scimTenant(ctx), ctx.Params("id"), payload)
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) PatchGroup(ctx *fiber.Ctx) error {
+	var payload model.SCIMPatchRequest
+	err := util.ReadRequestBody(ctx, &payload)
+	if err != nil {
+		return errSCIMInvalidSyntax()
+	}
+
+	response, err := controller.SCIMUsecase.PatchGroup(ctx, scimTenant(ctx), ctx.Params("id"), payload)
+	return controller.respond(ctx, fiber.StatusOK, response, err)
+}
+
+func (controller SCIMController) DeleteGroup(ctx *fiber.Ctx) error {
+	err := controller.SCIMUsecase.DeleteGroup(ctx, scimTenant(ctx), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// respond writes a SCIM resource, errors are left to the error handler which keeps the SCIM error format
+func (controller SCIMController) respond(ctx *fiber.Ctx, status int, response interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+
+	return util.SendSCIMResponse(ctx, status, response)
+}
+
+func scimTenant(ctx *fiber.Ctx) model.SCIMTenant {
+	return ctx.Locals("scimTenant").(model.SCIMTenant)
+}
+
+func errSCIMInvalidSyntax() *model.SCIMError {
+	return &model.SCIMError{
+		Schemas:  []string{constant.SCIM_SCHEMA_ERROR},
+		Status:   "400",
+		ScimType: constant.SCIM_ERR_INVALID_SYNTAX,
+		Detail:   constant.ERR_INVALID_REQUEST_BODY_MESSAGE,
+	}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/usecase"
+	"cutterproject/internal/util"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+type ServiceAccountController struct {
+	ServiceAccountUsecase *usecase.ServiceAccountUsecase
+	Log                   *zap.Logger
+	Config                *koanf.Koanf
+}
+
+func NewServiceAccountController(serviceAccountUsecase *usecase.ServiceAccountUsecase, zap *zap.Logger, koanf *koanf.Koanf) *ServiceAccountController {
+	return &ServiceAccountController{
+		ServiceAccountUsecase: serviceAccountUsecase,
+		Log:                   zap,
+		Config:                koanf,
+	}
+}
+
+func (controller ServiceAccountController) Create(ctx *fiber.Ctx) error {
+	var payload model.ServiceAccountCreateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	adminId := ctx.Locals("userId").(int)
+
+	response, err := controller.ServiceAccountUsecase.Create(ctx, adminId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller ServiceAccountController) List(ctx *fiber.Ctx) error {
+	response, err := controller.ServiceAccountUsecase.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller ServiceAccountController) SetDisabled(ctx *fiber.Ctx) error {
+	serviceAccountId, err := serviceAccountIdParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	var payload model.ServiceAccountDisableRequest
+	err = util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.ServiceAccountUsecase.SetDisabled(ctx, serviceAccountId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller ServiceAccountController) RotateSecret(ctx *fiber.Ctx) error {
+	serviceAccountId, err := serviceAccountIdParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.ServiceAccountUsecase.RotateSecret(ctx, serviceAccountId)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func serviceAccountIdParam(ctx *fiber.Ctx) (int, error) {
+	serviceAccountId, err := ctx.ParamsInt("serviceAccountId")
+	if err != nil || serviceAccountId <= 0 {
+		return 0, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Service account id is required",
+			Param:   "serviceAccountId",
+		}
+	}
+
+	return serviceAccountId, nil
+}
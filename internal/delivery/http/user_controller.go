@@ -1,11 +1,9 @@
 package http
 
 import (
-	"cutterproject/internal/constant"
 	"cutterproject/internal/model"
 	"cutterproject/internal/usecase"
 	"cutterproject/internal/util"
-	"errors"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/knadh/koanf/v2"
@@ -28,23 +26,14 @@ func NewUserController(userUsecase *usecase.UserUsecase, zap *zap.Logger, koanf
 
 func (controller UserController) Register(ctx *fiber.Ctx) error {
 	var payload model.UserCreateRequest
-	err := util.ReadRequestBody(ctx, &payload)
+	err := util.ReadJSONBody(ctx, &payload)
 	if err != nil {
-		return util.SendErrorResponse(ctx, &model.ValidationError{
-			Code:    constant.ERR_INVALID_REQUEST_BODY_ERROR_CODE,
-			Message: constant.ERR_INVALID_REQUEST_BODY_MESSAGE,
-		})
+		return err
 	}
 
-	var validationErr *model.ValidationError
-
 	response, err := controller.UserUsecase.Register(ctx, payload)
 	if err != nil {
-		if errors.As(err, &validationErr) {
-			return util.SendErrorResponse(ctx, err)
-		}
-
-		return util.SendErrorResponseInternalServer(ctx, controller.Log, err)
+		return err
 	}
 
 	return util.SendSuccessResponseWithData(ctx, response)
@@ -52,23 +41,59 @@ func (controller UserController) Register(ctx *fiber.Ctx) error {
 
 func (controller UserController) Login(ctx *fiber.Ctx) error {
 	var payload model.UserLoginRequest
-	err := util.ReadRequestBody(ctx, &payload)
+	err := util.ReadJSONBody(ctx, &payload)
 	if err != nil {
-		return util.SendErrorResponse(ctx, &model.ValidationError{
-			Code:    constant.ERR_INVALID_REQUEST_BODY_ERROR_CODE,
-			Message: constant.ERR_INVALID_REQUEST_BODY_MESSAGE,
-		})
+		return err
 	}
 
-	var validationErr *model.ValidationError
-
 	response, err := controller.UserUsecase.Login(ctx, payload)
 	if err != nil {
-		if errors.As(err, &validationErr) {
-			return util.SendErrorResponse(ctx, err)
-		}
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller UserController) VerifyLogin(ctx *fiber.Ctx) error {
+	var payload model.StepUpVerifyRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := controller.UserUsecase.VerifyLogin(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller UserController) RequestMagicLink(ctx *fiber.Ctx) error {
+	var payload model.MagicLinkRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	err = controller.UserUsecase.RequestMagicLink(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseNoData(ctx)
+}
+
+func (controller UserController) RedeemMagicLink(ctx *fiber.Ctx) error {
+	var payload model.MagicLinkVerifyRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
 
-		return util.SendErrorResponseInternalServer(ctx, controller.Log, err)
+	response, err := controller.UserUsecase.RedeemMagicLink(ctx, payload)
+	if err != nil {
+		return err
 	}
 
 	return util.SendSuccessResponseWithData(ctx, response)
@@ -77,16 +102,89 @@ func (controller UserController) Login(ctx *fiber.Ctx) error {
 func (controller UserController) GetUserInfo(ctx *fiber.Ctx) error {
 	userId := ctx.Locals("userId").(int)
 
-	var validationErr *model.ValidationError
-
 	response, err := controller.UserUsecase.GetUserInfo(ctx, userId)
 	if err != nil {
-		if errors.As(err, &validationErr) {
-			return util.SendErrorResponseNotFound(ctx, err)
-		}
+		return err
+	}
+
+	return util.SendSuccessResponseWithData(ctx, response)
+}
+
+func (controller UserController) Reauthenticate(ctx *fiber.Ctx) error {
+	var payload model.ReauthenticateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	userId := ctx.Locals("userId").(int)
 
-		return util.SendErrorResponseInternalServer(ctx, controller.Log, err)
+	response, err := controller.UserUsecase.Reauthenticate(ctx, userId, payload)
+	if err != nil {
+		return err
 	}
 
 	return util.SendSuccessResponseWithData(ctx, response)
 }
+
+func (controller UserController) UpdatePassword(ctx *fiber.Ctx) error {
+	var payload model.UserPasswordUpdateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	userId := ctx.Locals("userId").(int)
+
+	err = controller.UserUsecase.UpdatePassword(ctx, userId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseNoData(ctx)
+}
+
+func (controller UserController) UpdateEmail(ctx *fiber.Ctx) error {
+	var payload model.UserEmailUpdateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	userId := ctx.Locals("userId").(int)
+
+	err = controller.UserUsecase.UpdateEmail(ctx, userId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseNoData(ctx)
+}
+
+func (controller UserController) UpdateLocale(ctx *fiber.Ctx) error {
+	var payload model.UserLocaleUpdateRequest
+	err := util.ReadJSONBody(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	userId := ctx.Locals("userId").(int)
+
+	err = controller.UserUsecase.UpdateLocale(ctx, userId, payload)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseNoData(ctx)
+}
+
+func (controller UserController) Delete(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(int)
+
+	err := controller.UserUsecase.Delete(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return util.SendSuccessResponseNoData(ctx)
+}
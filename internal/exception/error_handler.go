@@ -1 +1,183 @@
 package exception
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/i18n"
+	"cutterproject/internal/model"
+	"cutterproject/internal/util"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// codeStatuses maps ValidationError codes to the HTTP status they are answered with, unknown codes are a 400
+var codeStatuses = map[string]int{
+	constant.ERR_VALIDATION_CODE:                 fiber.StatusBadRequest,
+	constant.ERR_INVALID_REQUEST_BODY_ERROR_CODE: fiber.StatusBadRequest,
+	constant.ERR_UNATHORIZED_ERROR:               fiber.StatusUnauthorized,
+	constant.ERR_REAUTHENTICATION_REQUIRED_ERROR: fiber.StatusUnauthorized,
+	constant.ERR_STEP_UP_REQUIRED_ERROR:          fiber.StatusUnauthorized,
+	constant.ERR_INVALID_DPOP_PROOF_ERROR:        fiber.StatusUnauthorized,
+	constant.ERR_FORBIDDEN_ERROR:                 fiber.StatusForbidden,
+	constant.ERR_CHALLENGE_REQUIRED_ERROR:        fiber.StatusForbidden,
+	constant.ERR_CHALLENGE_FAILED_ERROR:          fiber.StatusForbidden,
+	constant.ERR_IMPERSONATION_FORBIDDEN_ERROR:   fiber.StatusForbidden,
+	constant.ERR_IP_BLOCKED_ERROR:                fiber.StatusForbidden,
+	constant.ERR_NOT_FOUND_ERROR:                 fiber.StatusNotFound,
+	constant.ERR_CONFLICT_ERROR:                  fiber.StatusConflict,
+	constant.ERR_TOO_MANY_REQUESTS_ERROR:         fiber.StatusTooManyRequests,
+	constant.ERR_QUOTA_EXCEEDED_ERROR:            fiber.StatusTooManyRequests,
+	constant.ERR_UNSUPPORTED_MEDIA_TYPE_ERROR:    fiber.StatusUnsupportedMediaType,
+	constant.ERR_PAYLOAD_TOO_LARGE_ERROR:         fiber.StatusRequestEntityTooLarge,
+	constant.ERR_INTERNAL_SERVER_ERROR_CODE:      fiber.StatusInternalServerError,
+}
+
+// Problem is an RFC 7807 problem details object, code, message and param carry the ValidationError fields clients
+// switch on. Message repeats detail for clients written against the ValidationError shape
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Param    string `json:"param,omitempty"`
+	// every violated field when a request failed declarative validation, see util.Validate
+	Errors []model.FieldError `json:"errors,omitempty"`
+	// the step-up fields are only set when a login needs a second factor
+	ChallengeId string   `json:"challengeId,omitempty"`
+	Method      string   `json:"method,omitempty"`
+	Reasons     []string `json:"reasons,omitempty"`
+	ExpiresIn   int      `json:"expiresIn,omitempty"`
+}
+
+// LegacyError is what the {"error": ...} envelope holds, the ValidationError shape errors were answered with before
+// problem+json. The step-up fields are only set when a login needs a second factor
+type LegacyError struct {
+	Code        string             `json:"code"`
+	Message     string             `json:"message"`
+	Param       string             `json:"param"`
+	Errors      []model.FieldError `json:"errors,omitempty"`
+	ChallengeId string             `json:"challengeId,omitempty"`
+	Method      string             `json:"method,omitempty"`
+	Reasons     []string           `json:"reasons,omitempty"`
+	ExpiresIn   int                `json:"expiresIn,omitempty"`
+}
+
+// NewErrorHandler is the fiber ErrorHandler, handlers and middleware return their errors and this writes the response.
+// OAuth and SCIM errors keep the formats their RFCs require, everything else is answered with application/problem+json
+// in the language of the request. Clients that accept application/json but not application/problem+json get the
+// same fields in the {"error": {code,message,param}} envelope instead
+func NewErrorHandler(log *zap.Logger) fiber.ErrorHandler {
+	return func(ctx *fiber.Ctx, err error) error {
+		var oauthErr *model.OAuthError
+		var scimErr *model.SCIMError
+		var stepUpErr *model.StepUpRequiredError
+		var validationErr *model.ValidationError
+		var appErr *AppError
+		var fiberErr *fiber.Error
+
+		status := StatusCode(err)
+		locale := i18n.Locale(ctx)
+
+		var problem Problem
+		switch {
+		case errors.As(err, &oauthErr):
+			return util.SendOAuthErrorResponse(ctx, oauthErr)
+		case errors.As(err, &scimErr):
+			return util.SendSCIMErrorResponse(ctx, scimErr)
+		case status >= fiber.StatusInternalServerError:
+			// server errors never show their message, it may carry queries or connection details
+			util.Logger(ctx, log).Error("Internal server error occured", zap.Error(err))
+			problem = newProblem(ctx, status, i18n.T(locale, constant.ERR_INTENRAL_SERVER_ERROR_MESSAGE, nil))
+			problem.Code = constant.ERR_INTERNAL_SERVER_ERROR_CODE
+		case errors.As(err, &stepUpErr):
+			problem = newProblem(ctx, status, i18n.T(locale, stepUpErr.Message, nil))
+			problem.Code = stepUpErr.Code
+			problem.ChallengeId = stepUpErr.ChallengeId
+			problem.Method = stepUpErr.Method
+			problem.Reasons = stepUpErr.Reasons
+			problem.ExpiresIn = stepUpErr.ExpiresIn
+		case errors.As(err, &validationErr):
+			localized := i18n.Localize(locale, validationErr)
+			problem = newProblem(ctx, status, localized.Message)
+			problem.Code = localized.Code
+			problem.Param = localized.Param
+			problem.Errors = localized.Errors
+		case errors.As(err, &appErr):
+			problem = newProblem(ctx, status, i18n.T(locale, appErr.Message, nil))
+		case errors.As(err, &fiberErr):
+			problem = newProblem(ctx, status, i18n.T(locale, fiberErr.Message, nil))
+		}
+
+		problem.Message = problem.Detail
+
+		ctx.Set(fiber.HeaderContentLanguage, locale)
+		if ctx.Accepts(ProblemContentType, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+			return ctx.Status(problem.Status).JSON(fiber.Map{"error": legacyError(problem)})
+		}
+		return ctx.Status(problem.Status).JSON(problem, ProblemContentType)
+	}
+}
+
+func legacyError(problem Problem) LegacyError {
+	return LegacyError{
+		Code:        problem.Code,
+		Message:     problem.Message,
+		Param:       problem.Param,
+		Errors:      problem.Errors,
+		ChallengeId: problem.ChallengeId,
+		Method:      problem.Method,
+		Reasons:     problem.Reasons,
+		ExpiresIn:   problem.ExpiresIn,
+	}
+}
+
+// StatusCode is the status NewErrorHandler answers err with, for middleware that has to know it before the response is written
+func StatusCode(err error) int {
+	var oauthErr *model.OAuthError
+	var scimErr *model.SCIMError
+	var stepUpErr *model.StepUpRequiredError
+	var validationErr *model.ValidationError
+	var appErr *AppError
+	var fiberErr *fiber.Error
+
+	switch {
+	case errors.As(err, &oauthErr):
+		if oauthErr.Status != 0 {
+			return oauthErr.Status
+		}
+		return fiber.StatusBadRequest
+	case errors.As(err, &scimErr):
+		return scimErr.StatusCode()
+	case errors.As(err, &stepUpErr):
+		return fiber.StatusUnauthorized
+	case errors.As(err, &validationErr):
+		if status, ok := codeStatuses[validationErr.Code]; ok {
+			return status
+		}
+		return fiber.StatusBadRequest
+	case errors.As(err, &appErr):
+		return appErr.Code
+	case errors.As(err, &fiberErr):
+		return fiberErr.Code
+	}
+
+	return fiber.StatusInternalServerError
+}
+
+// newProblem uses about:blank as the type, RFC 7807 section 4.2 then makes the title the status phrase
+func newProblem(ctx *fiber.Ctx, status int, detail string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: ctx.Path(),
+	}
+}
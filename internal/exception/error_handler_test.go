@@ -0,0 +1,147 @@
+package exception
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+func newTestApp(err error) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: NewErrorHandler(zap.NewNop())})
+	app.Get("/fail", func(ctx *fiber.Ctx) error {
+		return err
+	})
+
+	return app
+}
+
+func testRequest(t *testing.T, app *fiber.App, accept string) (int, string, map[string]interface{}) {
+	t.Helper()
+
+	request := httptest.NewRequest(fiber.MethodGet, "/fail", nil)
+	if accept != "" {
+		request.Header.Set(fiber.HeaderAccept, accept)
+	}
+
+	response, err := app.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := io.ReadAll(response.Body)
+	body := map[string]interface{}{}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		t.Fatalf("body %q is not JSON: %v", raw, err)
+	}
+
+	return response.StatusCode, response.Header.Get(fiber.HeaderContentType), body
+}
+
+func TestErrorHandlerStatuses(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"validation", &model.ValidationError{Code: constant.ERR_VALIDATION_CODE, Message: "Email is required", Param: "email"}, fiber.StatusBadRequest, constant.ERR_VALIDATION_CODE},
+		{"unauthorized", &model.ValidationError{Code: constant.ERR_UNATHORIZED_ERROR, Message: "Token is invalid"}, fiber.StatusUnauthorized, constant.ERR_UNATHORIZED_ERROR},
+		{"forbidden", &model.ValidationError{Code: constant.ERR_FORBIDDEN_ERROR, Message: "Forbidden"}, fiber.StatusForbidden, constant.ERR_FORBIDDEN_ERROR},
+		{"not found", &model.ValidationError{Code: constant.ERR_NOT_FOUND_ERROR, Message: "User not found"}, fiber.StatusNotFound, constant.ERR_NOT_FOUND_ERROR},
+		{"conflict", &model.ValidationError{Code: constant.ERR_CONFLICT_ERROR, Message: "Username is already exist"}, fiber.StatusConflict, constant.ERR_CONFLICT_ERROR},
+		{"too many requests", &model.ValidationError{Code: constant.ERR_TOO_MANY_REQUESTS_ERROR, Message: "Too many requests"}, fiber.StatusTooManyRequests, constant.ERR_TOO_MANY_REQUESTS_ERROR},
+		{"unknown code", &model.ValidationError{Code: "SOMETHING_NEW", Message: "Something new"}, fiber.StatusBadRequest, "SOMETHING_NEW"},
+		{"wrapped", fmt.Errorf("login: %w", &model.CredentialError{Err: &model.ValidationError{Code: constant.ERR_VALIDATION_CODE, Message: "Password is incorrect", Param: "password"}}), fiber.StatusBadRequest, constant.ERR_VALIDATION_CODE},
+		{"step-up", &model.StepUpRequiredError{Code: constant.ERR_STEP_UP_REQUIRED_ERROR, Message: "Verification code required", ChallengeId: "abc"}, fiber.StatusUnauthorized, constant.ERR_STEP_UP_REQUIRED_ERROR},
+		{"app error", ErrMethodNotAllowed, fiber.StatusMethodNotAllowed, ""},
+		{"fiber error", fiber.ErrNotFound, fiber.StatusNotFound, ""},
+		{"unknown error", errors.New("pq: connection refused"), fiber.StatusInternalServerError, constant.ERR_INTERNAL_SERVER_ERROR_CODE},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status := StatusCode(c.err); status != c.status {
+				t.Errorf("StatusCode = %d, want %d", status, c.status)
+			}
+
+			status, contentType, body := testRequest(t, newTestApp(c.err), "")
+			if status != c.status || contentType != ProblemContentType {
+				t.Errorf("response = %d %s, want %d %s", status, contentType, c.status, ProblemContentType)
+			}
+			if body["status"] != float64(c.status) || body["type"] != "about:blank" || body["instance"] != "/fail" {
+				t.Errorf("problem = %v", body)
+			}
+			if code, _ := body["code"].(string); code != c.code {
+				t.Errorf("code = %q, want %q", code, c.code)
+			}
+			if body["message"] != body["detail"] {
+				t.Errorf("message %q does not repeat detail %q", body["message"], body["detail"])
+			}
+		})
+	}
+}
+
+func TestErrorHandlerHidesServerErrors(t *testing.T) {
+	_, _, body := testRequest(t, newTestApp(errors.New("pq: password authentication failed for user postgres")), "")
+
+	if body["detail"] != constant.ERR_INTENRAL_SERVER_ERROR_MESSAGE {
+		t.Errorf("detail = %q, want the generic message", body["detail"])
+	}
+}
+
+func TestErrorHandlerLegacyEnvelope(t *testing.T) {
+	err := &model.ValidationError{
+		Code:    constant.ERR_VALIDATION_CODE,
+		Message: "Email is required to not be empty",
+		Param:   "email",
+		Errors:  []model.FieldError{{Param: "email", Code: constant.FIELD_ERR_REQUIRED, Message: "Email is required to not be empty", Label: "Email"}},
+	}
+	app := newTestApp(err)
+
+	cases := []struct {
+		accept string
+		legacy bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{ProblemContentType, false},
+		{"application/problem+json, application/json;q=0.9", false},
+		{"application/json", true},
+		{"application/json, text/plain, */*", true},
+	}
+
+	for _, c := range cases {
+		status, contentType, body := testRequest(t, app, c.accept)
+		if status != fiber.StatusBadRequest {
+			t.Errorf("Accept %q: status = %d, want 400", c.accept, status)
+		}
+
+		envelope, isLegacy := body["error"].(map[string]interface{})
+		if isLegacy != c.legacy {
+			t.Errorf("Accept %q: body = %v, want legacy %v", c.accept, body, c.legacy)
+			continue
+		}
+		if !c.legacy {
+			continue
+		}
+
+		if contentType != fiber.MIMEApplicationJSON {
+			t.Errorf("Accept %q: Content-Type = %s", c.accept, contentType)
+		}
+		if envelope["code"] != constant.ERR_VALIDATION_CODE || envelope["message"] != "Email is required to not be empty" || envelope["param"] != "email" {
+			t.Errorf("Accept %q: envelope = %v", c.accept, envelope)
+		}
+		if errors, _ := envelope["errors"].([]interface{}); len(errors) != 1 {
+			t.Errorf("Accept %q: field errors = %v", c.accept, envelope["errors"])
+		}
+	}
+}
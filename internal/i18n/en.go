@@ -0,0 +1,31 @@
+package i18n
+
+import "cutterproject/internal/constant"
+
+// english only holds the keyed messages, messages keyed by their English text need no entry
+var english = map[string]string{
+	constant.FIELD_ERR_REQUIRED:           "{label} is required to not be empty",
+	constant.FIELD_ERR_MIN_LENGTH:         "{label} must be at least {min} characters",
+	constant.FIELD_ERR_MAX_LENGTH:         "{label} must be at most {max} characters",
+	constant.FIELD_ERR_INVALID_EMAIL:      "{label} is not a valid email address",
+	constant.FIELD_ERR_RESERVED:           "{label} is reserved",
+	constant.FIELD_ERR_UNSUPPORTED_LOCALE: "{label} must be one of {locales}",
+	constant.FIELD_ERR_INVALID_JSON:       "Request body is not valid JSON at offset {offset}",
+	constant.FIELD_ERR_INVALID_TYPE:       "{label} must be of type {type}",
+	constant.FIELD_ERR_UNKNOWN_FIELD:      "{label} is not a known field",
+	constant.FIELD_ERR_DUPLICATE_FIELD:    "{label} appears more than once",
+	constant.FIELD_ERR_QUOTA_EXCEEDED:     "{label} quota of {limit} is used up until {resetsAt}",
+
+	MAIL_STEP_UP_SUBJECT:    "Your sign in verification code",
+	MAIL_STEP_UP_BODY:       "Your verification code is {code}\n\nIt expires in {minutes} minutes. If you did not try to sign in, change your password.",
+	MAIL_MAGIC_LINK_SUBJECT: "Your sign in link",
+	MAIL_MAGIC_LINK_BODY:    "Use the link below to sign in. It expires in {minutes} minutes and can only be used once.\n\n{link}\n\nIf you did not request this email you can safely ignore it.",
+}
+
+// mail template keys
+const (
+	MAIL_STEP_UP_SUBJECT    = "mail.stepUp.subject"
+	MAIL_STEP_UP_BODY       = "mail.stepUp.body"
+	MAIL_MAGIC_LINK_SUBJECT = "mail.magicLink.subject"
+	MAIL_MAGIC_LINK_BODY    = "mail.magicLink.body"
+)
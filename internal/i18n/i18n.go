@@ -0,0 +1,140 @@
+// Package i18n renders user facing messages in the language the client asked for. Catalogs hold two kinds of
+// keys: field error codes and mail templates with {name} placeholders, and the English text of other messages,
+// which is the key of its own translation. Anything a catalog lacks falls back to English
+package i18n
+
+import (
+	"cutterproject/internal/model"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	LocaleEnglish    = "en"
+	LocaleIndonesian = "id"
+	DefaultLocale    = LocaleEnglish
+)
+
+var catalogs = map[string]map[string]string{
+	LocaleEnglish:    english,
+	LocaleIndonesian: indonesian,
+}
+
+// Locales lists the supported locales in a stable order
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Locale is the locale of the request, the user's saved preference when the auth middleware found one and
+// otherwise the best match for Accept-Language
+func Locale(ctx *fiber.Ctx) string {
+	if locale, ok := ctx.Locals("locale").(string); ok && Supported(locale) {
+		return locale
+	}
+
+	return Negotiate(ctx.Get(fiber.HeaderAcceptLanguage))
+}
+
+// Negotiate picks the supported locale with the highest quality in an Accept-Language header (RFC 9110 section
+// 12.5.4), regional tags such as id-ID match their language. Ties go to the language listed first
+func Negotiate(acceptLanguage string) string {
+	best := DefaultLocale
+	bestQuality := 0.0
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || name != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				parsed = 0
+			}
+			quality = parsed
+		}
+
+		if language == "*" {
+			language = DefaultLocale
+		}
+		if !Supported(language) || quality <= bestQuality {
+			continue
+		}
+
+		best = language
+		bestQuality = quality
+	}
+
+	return best
+}
+
+// T translates key, args fill the {name} placeholders of the message
+func T(locale string, key string, args map[string]interface{}) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message, ok = english[key]
+	}
+	if !ok {
+		message = key
+	}
+
+	for name, value := range args {
+		message = strings.ReplaceAll(message, "{"+name+"}", fmt.Sprint(value))
+	}
+
+	return message
+}
+
+// FieldMessage renders a validation failure, codes with a template name the field by its translated label and
+// the rest translate the message the validator wrote
+func FieldMessage(locale string, fieldError model.FieldError) string {
+	if _, ok := english[fieldError.Code]; !ok {
+		return T(locale, fieldError.Message, nil)
+	}
+
+	args := map[string]interface{}{"label": T(locale, fieldError.Label, nil)}
+	for name, value := range fieldError.Args {
+		if values, ok := value.([]string); ok {
+			value = strings.Join(values, ", ")
+		}
+		args[name] = value
+	}
+
+	return T(locale, fieldError.Code, args)
+}
+
+// Localize returns a copy of a ValidationError with its messages in locale
+func Localize(locale string, validationErr *model.ValidationError) model.ValidationError {
+	localized := *validationErr
+	localized.Message = T(locale, validationErr.Message, nil)
+	localized.Errors = slices.Clone(validationErr.Errors)
+
+	for i := range localized.Errors {
+		localized.Errors[i].Message = FieldMessage(locale, localized.Errors[i])
+	}
+	if len(localized.Errors) > 0 {
+		localized.Message = localized.Errors[0].Message
+	}
+
+	return localized
+}
@@ -0,0 +1,117 @@
+package i18n
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		acceptLanguage string
+		locale         string
+	}{
+		{"", LocaleEnglish},
+		{"id", LocaleIndonesian},
+		{"ID", LocaleIndonesian},
+		{"id-ID", LocaleIndonesian},
+		{"en-US,en;q=0.9", LocaleEnglish},
+		{"fr-FR, fr;q=0.9", LocaleEnglish},
+		{"fr, id;q=0.5", LocaleIndonesian},
+		{"en;q=0.4, id;q=0.8", LocaleIndonesian},
+		{"id;q=0.8, en", LocaleEnglish},
+		// ties go to the language listed first
+		{"id;q=0.7, en;q=0.7", LocaleIndonesian},
+		{"en;q=0.7, id-ID;q=0.7", LocaleEnglish},
+		{"*;q=0.5, id;q=0.4", LocaleEnglish},
+		{"id;q=0", LocaleEnglish},
+		{"id;q=abc", LocaleEnglish},
+		{" id-ID ; q=0.9 , en ; q=0.1", LocaleIndonesian},
+	}
+
+	for _, c := range cases {
+		if locale := Negotiate(c.acceptLanguage); locale != c.locale {
+			t.Errorf("Negotiate(%q) = %s, want %s", c.acceptLanguage, locale, c.locale)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	cases := []struct {
+		locale  string
+		key     string
+		args    map[string]interface{}
+		message string
+	}{
+		{LocaleEnglish, "User not found", nil, "User not found"},
+		{LocaleIndonesian, "User not found", nil, "Pengguna tidak ditemukan"},
+		{LocaleIndonesian, "Quota exceeded", nil, "Kuota terlampaui"},
+		// messages without a translation stay English
+		{LocaleIndonesian, "Something only English has", nil, "Something only English has"},
+		{"fr", "User not found", nil, "User not found"},
+		{LocaleEnglish, MAIL_STEP_UP_BODY, map[string]interface{}{"code": "123456", "minutes": 10},
+			"Your verification code is 123456\n\nIt expires in 10 minutes. If you did not try to sign in, change your password."},
+		{LocaleIndonesian, constant.FIELD_ERR_MIN_LENGTH, map[string]interface{}{"label": "Kata sandi", "min": 8}, "Kata sandi minimal 8 karakter"},
+		// a template missing from a catalog falls back to the English template, not the key
+		{"fr", constant.FIELD_ERR_REQUIRED, map[string]interface{}{"label": "Email"}, "Email is required to not be empty"},
+	}
+
+	for _, c := range cases {
+		if message := T(c.locale, c.key, c.args); message != c.message {
+			t.Errorf("T(%s, %q) = %q, want %q", c.locale, c.key, message, c.message)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	validationErr := &model.ValidationError{
+		Code:    constant.ERR_VALIDATION_CODE,
+		Message: "Username is required to not be empty",
+		Param:   "username",
+		Errors: []model.FieldError{
+			{Param: "username", Code: constant.FIELD_ERR_REQUIRED, Message: "Username is required to not be empty", Label: "Username"},
+			{Param: "newPassword", Code: constant.FIELD_ERR_MIN_LENGTH, Message: "New password must be at least 8 characters", Label: "New password", Args: map[string]interface{}{"min": 8}},
+			{Param: "locale", Code: constant.FIELD_ERR_UNSUPPORTED_LOCALE, Message: "Language must be one of en, id", Label: "Language", Args: map[string]interface{}{"locales": []string{"en", "id"}}},
+			{Param: "username", Code: constant.FIELD_ERR_INVALID_USERNAME, Message: "Username must start and end with a letter or digit", Label: "Username"},
+		},
+	}
+
+	localized := Localize(LocaleIndonesian, validationErr)
+
+	want := []string{
+		"Nama pengguna wajib diisi",
+		"Kata sandi baru minimal 8 karakter",
+		"Bahasa harus salah satu dari en, id",
+		T(LocaleIndonesian, "Username must start and end with a letter or digit", nil),
+	}
+	for i, message := range want {
+		if localized.Errors[i].Message != message {
+			t.Errorf("errors[%d] = %q, want %q", i, localized.Errors[i].Message, message)
+		}
+	}
+	if localized.Message != want[0] {
+		t.Errorf("message = %q, want the first field error %q", localized.Message, want[0])
+	}
+
+	if validationErr.Errors[0].Message != "Username is required to not be empty" {
+		t.Errorf("Localize changed the original error to %q", validationErr.Errors[0].Message)
+	}
+
+	plain := Localize(LocaleIndonesian, &model.ValidationError{Code: "NOT_FOUND", Message: "User not found"})
+	if plain.Message != "Pengguna tidak ditemukan" {
+		t.Errorf("message = %q, want Pengguna tidak ditemukan", plain.Message)
+	}
+	if english := Localize(LocaleEnglish, validationErr); english.Errors[1].Message != "New password must be at least 8 characters" {
+		t.Errorf("english errors[1] = %q", english.Errors[1].Message)
+	}
+}
+
+func TestCatalogsTranslateEveryTemplate(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for key := range english {
+			if _, ok := catalog[key]; !ok {
+				t.Errorf("%s has no translation of %s", locale, key)
+			}
+		}
+	}
+}
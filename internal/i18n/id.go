@@ -0,0 +1,138 @@
+package i18n
+
+import "cutterproject/internal/constant"
+
+var indonesian = map[string]string{
+	constant.FIELD_ERR_REQUIRED:           "{label} wajib diisi",
+	constant.FIELD_ERR_MIN_LENGTH:         "{label} minimal {min} karakter",
+	constant.FIELD_ERR_MAX_LENGTH:         "{label} maksimal {max} karakter",
+	constant.FIELD_ERR_INVALID_EMAIL:      "{label} bukan alamat email yang valid",
+	constant.FIELD_ERR_RESERVED:           "{label} sudah dicadangkan",
+	constant.FIELD_ERR_UNSUPPORTED_LOCALE: "{label} harus salah satu dari {locales}",
+	constant.FIELD_ERR_INVALID_JSON:       "Isi permintaan bukan JSON yang valid pada offset {offset}",
+	constant.FIELD_ERR_INVALID_TYPE:       "{label} harus bertipe {type}",
+	constant.FIELD_ERR_UNKNOWN_FIELD:      "{label} bukan field yang dikenal",
+	constant.FIELD_ERR_DUPLICATE_FIELD:    "{label} muncul lebih dari sekali",
+	constant.FIELD_ERR_QUOTA_EXCEEDED:     "Kuota {label} sebanyak {limit} sudah habis hingga {resetsAt}",
+
+	MAIL_STEP_UP_SUBJECT:    "Kode verifikasi masuk Anda",
+	MAIL_STEP_UP_BODY:       "Kode verifikasi Anda adalah {code}\n\nKode ini berlaku selama {minutes} menit. Jika Anda tidak mencoba masuk, segera ganti kata sandi Anda.",
+	MAIL_MAGIC_LINK_SUBJECT: "Tautan masuk Anda",
+	MAIL_MAGIC_LINK_BODY:    "Gunakan tautan di bawah ini untuk masuk. Tautan berlaku selama {minutes} menit dan hanya dapat digunakan sekali.\n\n{link}\n\nJika Anda tidak meminta email ini, abaikan saja.",
+
+	// field labels
+	"Username":          "Nama pengguna",
+	"Email":             "Email",
+	"Password":          "Kata sandi",
+	"New password":      "Kata sandi baru",
+	"Username or email": "Nama pengguna atau email",
+	"Language":          "Bahasa",
+	"Request body":      "Isi permintaan",
+	"Plan":              "Paket",
+	"API calls":         "Panggilan API",
+	"Service accounts":  "Akun layanan",
+	"Invites":           "Undangan",
+	"List":              "Daftar",
+	"CIDR":              "CIDR",
+
+	constant.ERR_INTENRAL_SERVER_ERROR_MESSAGE: "Terjadi kesalahan. Jika masalah berlanjut, silakan hubungi dukungan",
+	constant.ERR_INVALID_REQUEST_BODY_MESSAGE:  "Permintaan tidak valid atau formatnya salah",
+
+	"A SCIM tenant is already configured for this domain":                               "Tenant SCIM untuk domain ini sudah dikonfigurasi",
+	"A group with this display name already exists":                                     "Grup dengan nama tampilan ini sudah ada",
+	"A verification code has been sent to your email":                                   "Kode verifikasi telah dikirim ke email Anda",
+	"Access from your network or country is not allowed":                                "Akses dari jaringan atau negara Anda tidak diizinkan",
+	"Account is deactivated":                                                            "Akun telah dinonaktifkan",
+	"Admin privileges are required":                                                     "Diperlukan hak akses admin",
+	"Admins cannot be impersonated":                                                     "Admin tidak dapat diimpersonasi",
+	"An identity provider is already configured for this domain":                        "Penyedia identitas untuk domain ini sudah dikonfigurasi",
+	"Authentication token format is not match":                                          "Format token autentikasi tidak sesuai",
+	"Authentication token has invalid signing method":                                   "Metode penandatanganan token autentikasi tidak valid",
+	"Authentication token is DPoP bound, use the DPoP scheme with a proof":              "Token autentikasi terikat DPoP, gunakan skema DPoP dengan bukti",
+	"Authentication token is empty":                                                     "Token autentikasi kosong",
+	"Authentication token is expired":                                                   "Token autentikasi sudah kedaluwarsa",
+	"Authentication token is invalid":                                                   "Token autentikasi tidak valid",
+	"Authentication token is malformed":                                                 "Format token autentikasi rusak",
+	"Authentication token is not DPoP bound, use the Bearer scheme":                     "Token autentikasi tidak terikat DPoP, gunakan skema Bearer",
+	"Authentication token is not valid yet":                                             "Token autentikasi belum berlaku",
+	"Authorization token is expired":                                                    "Token otorisasi sudah kedaluwarsa",
+	"CIDR must be an IP address or CIDR such as 203.0.113.0/24":                         "CIDR harus berupa alamat IP atau CIDR seperti 203.0.113.0/24",
+	"Challenge id is required to not be empty":                                          "Id tantangan wajib diisi",
+	"Challenge is not found or expired":                                                 "Tantangan tidak ditemukan atau sudah kedaluwarsa",
+	"Challenge is required":                                                             "Tantangan wajib diselesaikan",
+	"Challenge solution is incorrect":                                                   "Jawaban tantangan salah",
+	"Challenge solution is required":                                                    "Jawaban tantangan wajib diisi",
+	"Challenge verification failed":                                                     "Verifikasi tantangan gagal",
+	"Code is incorrect":                                                                 "Kode salah",
+	"Code must be 6 digits":                                                             "Kode harus 6 digit",
+	"Could not find a free username for this account":                                   "Tidak dapat menemukan nama pengguna yang tersedia untuk akun ini",
+	"DPoP proof has already been used":                                                  "Bukti DPoP sudah pernah digunakan",
+	"DPoP proof is invalid":                                                             "Bukti DPoP tidak valid",
+	"DPoP proof is not signed by the key the token is bound to":                         "Bukti DPoP tidak ditandatangani dengan kunci yang terikat pada token",
+	"Directory account cannot be used to log in":                                        "Akun direktori tidak dapat digunakan untuk masuk",
+	"Directory account has no valid email address":                                      "Akun direktori tidak memiliki alamat email yang valid",
+	"Disposable email addresses are not allowed":                                        "Alamat email sekali pakai tidak diperbolehkan",
+	"Domain must be an email domain such as example.com":                                "Domain harus berupa domain email seperti example.com",
+	"Email is already exist":                                                            "Email sudah terdaftar",
+	"Email is not a valid email address":                                                "Email bukan alamat email yang valid",
+	"Email is not found":                                                                "Email tidak ditemukan",
+	"Expires in must not be negative":                                                   "Masa berlaku tidak boleh negatif",
+	"Group not found":                                                                   "Grup tidak ditemukan",
+	"IP filter rule not found":                                                          "Aturan filter IP tidak ditemukan",
+	"Identity provider is not allowed to sign in users of this email domain":            "Penyedia identitas tidak diizinkan memasukkan pengguna dari domain email ini",
+	"Invite code is invalid, expired or already used up":                                "Kode undangan tidak valid, sudah kedaluwarsa, atau sudah habis digunakan",
+	"Invite code is required to register":                                               "Kode undangan wajib diisi untuk mendaftar",
+	"List must be allow or deny":                                                        "Daftar harus allow atau deny",
+	"Magic link is invalid, expired or already used":                                    "Tautan masuk tidak valid, sudah kedaluwarsa, atau sudah digunakan",
+	"Magic link login is disabled":                                                      "Masuk dengan tautan dinonaktifkan",
+	"Max uses must be at least 1":                                                       "Batas penggunaan minimal 1",
+	"Max uses must be at most 10000":                                                    "Batas penggunaan maksimal 10000",
+	"Metadata must be SAML IdP metadata with an HTTP-Redirect single sign-on service":   "Metadata harus berupa metadata IdP SAML dengan layanan single sign-on HTTP-Redirect",
+	"Name is required to not be empty":                                                  "Nama wajib diisi",
+	"Name must be at most 100 characters":                                               "Nama maksimal 100 karakter",
+	"No account exists for this email address":                                          "Tidak ada akun dengan alamat email ini",
+	"No authentication token is provided":                                               "Token autentikasi tidak disertakan",
+	"Password is incorrect":                                                             "Kata sandi salah",
+	"Passwords are managed by your organization's directory and cannot be changed here": "Kata sandi dikelola oleh direktori organisasi Anda dan tidak dapat diubah di sini",
+	"Request body must be application/json":                                             "Isi permintaan harus application/json",
+	"Request body is too large":                                                         "Isi permintaan terlalu besar",
+	"Plan is not known":                                                                 "Paket tidak dikenal",
+	"Public key must be a PEM encoded RSA, ECDSA or Ed25519 public key":                 "Kunci publik harus berupa kunci publik RSA, ECDSA, atau Ed25519 dalam format PEM",
+	"Quota exceeded":                                                                    "Kuota terlampaui",
+	"Rate limit exceeded, please try again later":                                       "Batas permintaan terlampaui, silakan coba lagi nanti",
+	"Reason is required to not be empty":                                                "Alasan wajib diisi",
+	"Refresh token is not found or has been revoked":                                    "Refresh token tidak ditemukan atau sudah dicabut",
+	"Registration is currently closed":                                                  "Pendaftaran sedang ditutup",
+	"Registration is not allowed for this email domain":                                 "Pendaftaran tidak diizinkan untuk domain email ini",
+	"SAML assertion has already been used":                                              "Assertion SAML sudah pernah digunakan",
+	"SAML response is invalid":                                                          "Respons SAML tidak valid",
+	"SAML single sign-on is not enabled":                                                "Single sign-on SAML tidak diaktifkan",
+	"Scopes must not be empty or contain spaces, quotes or backslashes":                 "Scope tidak boleh kosong atau berisi spasi, tanda kutip, atau garis miring terbalik",
+	"Service account authenticates with a public key and has no client secret":          "Akun layanan diautentikasi dengan kunci publik dan tidak memiliki client secret",
+	"Service account id is required":                                                    "ID akun layanan wajib diisi",
+	"Service account is not found":                                                      "Akun layanan tidak ditemukan",
+	"Session is not found or has been revoked":                                          "Sesi tidak ditemukan atau sudah dicabut",
+	"Single sign-on is not configured for this email domain":                            "Single sign-on belum dikonfigurasi untuk domain email ini",
+	"Single sign-on request is invalid, expired or already used":                        "Permintaan single sign-on tidak valid, sudah kedaluwarsa, atau sudah digunakan",
+	"This operation is not available while impersonating a user":                        "Operasi ini tidak tersedia saat mengimpersonasi pengguna",
+	"This rule would block your own address":                                            "Aturan ini akan memblokir alamat Anda sendiri",
+	"Token is not found or has been revoked":                                            "Token tidak ditemukan atau sudah dicabut",
+	"Too many authentication attempts, please try again later":                          "Terlalu banyak percobaan autentikasi, silakan coba lagi nanti",
+	"Too many incorrect codes, please sign in again":                                    "Terlalu banyak kode yang salah, silakan masuk kembali",
+	"User code has already been used":                                                   "Kode pengguna sudah pernah digunakan",
+	"User code is not found or expired":                                                 "Kode pengguna tidak ditemukan atau sudah kedaluwarsa",
+	"User code is not valid":                                                            "Kode pengguna tidak valid",
+	"User id is required":                                                               "Id pengguna wajib diisi",
+	"User name is already exist":                                                        "Nama pengguna sudah terdaftar",
+	"User not found":                                                                    "Pengguna tidak ditemukan",
+	"Username is already exist":                                                         "Nama pengguna sudah terdaftar",
+	"Username is ambiguous":                                                             "Nama pengguna ambigu",
+	"Username is not found":                                                             "Nama pengguna tidak ditemukan",
+	"Username is not valid":                                                             "Nama pengguna tidak valid",
+	"Username is too similar to an existing username":                                   "Nama pengguna terlalu mirip dengan nama pengguna yang sudah ada",
+	"Username may only contain letters, digits, '.', '_' and '-'":                       "Nama pengguna hanya boleh berisi huruf, angka, '.', '_' dan '-'",
+	"Username must not mix characters from different scripts":                           "Nama pengguna tidak boleh mencampur karakter dari aksara yang berbeda",
+	"Username must start and end with a letter or digit":                                "Nama pengguna harus diawali dan diakhiri dengan huruf atau angka",
+	"Verification challenge is not found or expired":                                    "Tantangan verifikasi tidak ditemukan atau sudah kedaluwarsa",
+	"You cannot impersonate yourself":                                                   "Anda tidak dapat mengimpersonasi diri sendiri",
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// AuditEvent records something an actor did to or as a user, events outlive both accounts so the ids may become zero
+type AuditEvent struct {
+	Id        int64
+	ActorId   int
+	UserId    int
+	Action    string
+	SessionId string
+	IP        string
+	Detail    string
+	CreatedAt time.Time
+}
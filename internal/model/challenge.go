@@ -0,0 +1,16 @@
+package model
+
+type ChallengeResponse struct {
+	Provider   string `json:"provider"`
+	Challenge  string `json:"challenge,omitempty"`
+	Algorithm  string `json:"algorithm,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	SiteKey    string `json:"siteKey,omitempty"`
+	ExpiresIn  int    `json:"expiresIn,omitempty"`
+}
+
+type ChallengeSolution struct {
+	Challenge string
+	Solution  string
+	RemoteIP  string
+}
@@ -1,11 +1,53 @@
 package model
 
+// ValidationError is the error clients get for a request they can fix. When several fields are wrong Errors lists
+// every violation, Message and Param then repeat the first one for clients that only read those
 type ValidationError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Param   string `json:"param"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Param   string       `json:"param"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is one violated validation rule, Args holds the rule's arguments such as the minimum length and
+// Label the English name of the field that messages in other languages are rendered with
+type FieldError struct {
+	Param   string                 `json:"param"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Label   string                 `json:"-"`
 }
 
 func (e *ValidationError) Error() string {
 	return e.Message
 }
+
+// CredentialError wraps the error of a failed credential check: a wrong password or one-time code, or an account or
+// challenge that does not exist. The challenge middleware counts only these against the client, it is answered
+// like the error it wraps
+type CredentialError struct {
+	Err error
+}
+
+func (e *CredentialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CredentialError) Unwrap() error {
+	return e.Err
+}
+
+// StepUpRequiredError is returned instead of tokens when a login needs a second factor first
+type StepUpRequiredError struct {
+	Code        string   `json:"code"`
+	Message     string   `json:"message"`
+	ChallengeId string   `json:"challengeId"`
+	Method      string   `json:"method"`
+	Reasons     []string `json:"reasons"`
+	ExpiresIn   int      `json:"expiresIn"`
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,6 @@
+package model
+
+type ImpersonationRequest struct {
+	UserId int    `json:"userId"`
+	Reason string `json:"reason"`
+}
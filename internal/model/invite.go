@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+type InviteCodeCreateRequest struct {
+	MaxUses   int `json:"maxUses"`
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type InviteCodeResponse struct {
+	Id        int        `json:"id"`
+	Code      string     `json:"code"`
+	MaxUses   int        `json:"max_uses"`
+	UsedCount int        `json:"used_count"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type InviteCode struct {
+	Id        int
+	Code      string
+	MaxUses   int
+	UsedCount int
+	ExpiresAt *time.Time
+	CreatedBy int
+	CreatedAt time.Time
+}
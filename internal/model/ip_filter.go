@@ -0,0 +1,18 @@
+package model
+
+type IPFilterRuleRequest struct {
+	List string `json:"list" validate:"required" label:"List"`
+	CIDR string `json:"cidr" validate:"required,max=50" label:"CIDR"`
+}
+
+// IPFilterResponse lists the rules in effect, the static ones come from configuration and only the dynamic ones
+// can be edited. Blocked counts blocked requests per reason since the counters were created
+type IPFilterResponse struct {
+	Allow          []string         `json:"allow"`
+	Deny           []string         `json:"deny"`
+	StaticAllow    []string         `json:"staticAllow"`
+	StaticDeny     []string         `json:"staticDeny"`
+	AllowCountries []string         `json:"allowCountries"`
+	DenyCountries  []string         `json:"denyCountries"`
+	Blocked        map[string]int64 `json:"blocked"`
+}
@@ -1,8 +1,44 @@
 package model
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"cutterproject/internal/constant"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type Claims struct {
 	UserId int `json:"userId"`
+	// AuthTime is when the user last proved their identity, it is kept as is when tokens are reissued
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// SessionId binds a user token to the session it was issued for, see Session
+	SessionId string `json:"sid,omitempty"`
+	// PrincipalType tells human users apart from service accounts, tokens issued before it existed are user tokens
+	PrincipalType    string `json:"principalType,omitempty"`
+	ServiceAccountId int    `json:"serviceAccountId,omitempty"`
+	ClientId         string `json:"client_id,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+	// Confirmation binds the token to a DPoP key, such a token is useless without a proof signed by that key
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// Actor is set on impersonation tokens, UserId is then the impersonated user and Actor the admin acting as them
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// Confirmation is the RFC 7800 cnf claim, Jkt is the RFC 7638 thumbprint of the DPoP public key
+type Confirmation struct {
+	Jkt string `json:"jkt"`
+}
+
+// Actor is the RFC 8693 act claim naming who is really behind a token
+type Actor struct {
+	Subject string `json:"sub"`
+	UserId  int    `json:"userId"`
+}
+
+func (claims *Claims) IsService() bool {
+	return claims.PrincipalType == constant.PRINCIPAL_TYPE_SERVICE
+}
+
+func (claims *Claims) IsImpersonated() bool {
+	return claims.Actor != nil
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type LoginEvent struct {
+	Id        int64
+	UserId    int
+	IP        string
+	Country   string
+	DeviceId  string
+	Success   bool
+	CreatedAt time.Time
+}
+
+// LoginSignals describe where a login attempt comes from, they feed the step-up risk rules
+type LoginSignals struct {
+	IP       string
+	Country  string
+	DeviceId string
+}
+
+type StepUpVerifyRequest struct {
+	ChallengeId string `json:"challengeId"`
+	Code        string `json:"code"`
+}
+
+type StepUpChallenge struct {
+	UserId   int
+	CodeHash string
+	Signals  LoginSignals
+}
@@ -0,0 +1,93 @@
+package model
+
+// OAuthError follows the RFC 6749 section 5.2 error response, OAuth clients expect this shape instead of ValidationError
+type OAuthError struct {
+	Status           int    `json:"-"`
+	ErrorCode        string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.ErrorDescription != "" {
+		return e.ErrorCode + ": " + e.ErrorDescription
+	}
+	return e.ErrorCode
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// DeviceCodeRequest accepts the scope parameter of RFC 8628 but ignores it, a device login is a full user session
+// and no scope is granted or reported for it
+type DeviceCodeRequest struct {
+	ClientId string `json:"client_id" form:"client_id"`
+	Scope    string `json:"scope" form:"scope"`
+}
+
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceTokenRequest struct {
+	GrantType  string `json:"grant_type" form:"grant_type"`
+	DeviceCode string `json:"device_code" form:"device_code"`
+	ClientId   string `json:"client_id" form:"client_id"`
+}
+
+type DeviceApproveRequest struct {
+	UserCode string `json:"userCode"`
+	Deny     bool   `json:"deny"`
+}
+
+type DeviceApproveResponse struct {
+	ClientId string `json:"clientId"`
+	Status   string `json:"status"`
+}
+
+type DeviceAuthorization struct {
+	UserCode string
+	ClientId string
+	Status   string
+	UserId   int
+	// AuthTime is when the approving user last proved their identity, the device session inherits it
+	AuthTime int64
+	Interval int
+	LastPoll int64
+}
+
+type TokenIntrospectionRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+// TokenIntrospectionResponse follows RFC 7662 section 2.2, an inactive token only reports active=false
+type TokenIntrospectionResponse struct {
+	Active    bool          `json:"active"`
+	Scope     string        `json:"scope,omitempty"`
+	ClientId  string        `json:"client_id,omitempty"`
+	TokenType string        `json:"token_type,omitempty"`
+	Exp       int64         `json:"exp,omitempty"`
+	Iat       int64         `json:"iat,omitempty"`
+	Sub       string        `json:"sub,omitempty"`
+	Iss       string        `json:"iss,omitempty"`
+	Jti       string        `json:"jti,omitempty"`
+	Sid       string        `json:"sid,omitempty"`
+	AuthTime  int64         `json:"auth_time,omitempty"`
+	Cnf       *Confirmation `json:"cnf,omitempty"`
+	Act       *Actor        `json:"act,omitempty"`
+}
+
+type TokenRevocationRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
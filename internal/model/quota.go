@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Plan holds the quota of each metric, metrics without one are only metered
+type Plan struct {
+	Name   string
+	Quotas map[string]int
+}
+
+type PlanUpdateRequest struct {
+	Plan string `json:"plan" validate:"required,max=50" label:"Plan"`
+}
+
+type UsageResponse struct {
+	UserId  int           `json:"userId"`
+	Plan    string        `json:"plan"`
+	Metrics []MetricUsage `json:"metrics"`
+}
+
+// MetricUsage is the usage of one metric in the current window, Limit is null when the plan has no quota for it
+type MetricUsage struct {
+	Metric      string    `json:"metric"`
+	Window      string    `json:"window"`
+	WindowStart time.Time `json:"windowStart"`
+	ResetsAt    time.Time `json:"resetsAt"`
+	Used        int       `json:"used"`
+	Limit       *int      `json:"limit"`
+}
+
+// UsageCounter is a Redis counter on its way to the usage_counters table
+type UsageCounter struct {
+	UserId      int
+	Metric      string
+	WindowStart time.Time
+	Count       int
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// RateLimitPolicy allows Limit requests per Period, requests are counted per By (see constant.RATE_LIMIT_BY_*)
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	By     string
+}
+
+// RateLimitResult is the outcome of one request against a policy, Reset is when the full limit is available again
+// and RetryAfter when a rejected request may be retried
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+type SAMLIdentityProviderCreateRequest struct {
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+	// MetadataXML is the IdP's SAML metadata document, it carries the entity id, SSO URL and signing certificates
+	MetadataXML string `json:"metadataXml"`
+	// ProvisionUsers creates a user on the first login of an unknown email, true when not given
+	ProvisionUsers *bool `json:"provisionUsers"`
+}
+
+type SAMLIdentityProviderResponse struct {
+	Id             int       `json:"id"`
+	Name           string    `json:"name"`
+	Domain         string    `json:"domain"`
+	EntityId       string    `json:"entity_id"`
+	ProvisionUsers bool      `json:"provision_users"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SAMLIdentityProvider is the IdP users of one email domain sign in with
+type SAMLIdentityProvider struct {
+	Id             int
+	Name           string
+	Domain         string
+	EntityId       string
+	MetadataXML    string
+	ProvisionUsers bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type SAMLLoginRequest struct {
+	Email string `query:"email"`
+}
+
+// SAMLResponseRequest is the HTTP-POST binding form the IdP sends to the assertion consumer service
+type SAMLResponseRequest struct {
+	SAMLResponse string `form:"SAMLResponse"`
+	RelayState   string `form:"RelayState"`
+}
+
+// SAMLRequestState remembers an AuthnRequest until its response arrives, the RelayState is its key
+type SAMLRequestState struct {
+	IdentityProviderId int
+	RequestId          string
+}
+
+// SAMLSubject is who a verified assertion speaks for, NameID is the persistent identifier the IdP knows them by
+type SAMLSubject struct {
+	NameId string
+	Email  string
+}
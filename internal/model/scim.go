@@ -0,0 +1,164 @@
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// SCIMError is the RFC 7644 section 3.12 error response, SCIM clients expect this shape instead of ValidationError
+type SCIMError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func (e *SCIMError) Error() string {
+	if e.ScimType != "" {
+		return e.Status + " " + e.ScimType + ": " + e.Detail
+	}
+	return e.Status + ": " + e.Detail
+}
+
+func (e *SCIMError) StatusCode() int {
+	status, _ := strconv.Atoi(e.Status)
+	return status
+}
+
+type SCIMTenantCreateRequest struct {
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+type SCIMTenantResponse struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+	// Token is the bearer token the IdP authenticates with, it is only returned when the tenant is created
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SCIMTenant is one customer's identity provider, it may only manage users and groups of its email domain
+type SCIMTenant struct {
+	Id        int
+	Name      string
+	Domain    string
+	TokenHash string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type SCIMListRequest struct {
+	Filter     string `query:"filter"`
+	StartIndex string `query:"startIndex"`
+	Count      string `query:"count"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMUser is the core User resource, attributes the service does not store such as name are accepted and ignored
+type SCIMUser struct {
+	Schemas    []string    `json:"schemas"`
+	Id         string      `json:"id,omitempty"`
+	ExternalId string      `json:"externalId,omitempty"`
+	UserName   string      `json:"userName"`
+	Active     *bool       `json:"active,omitempty"`
+	Emails     []SCIMEmail `json:"emails,omitempty"`
+	Meta       *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+type SCIMSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type SCIMFilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type SCIMBulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type SCIMAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SCIMServiceProviderConfig tells IdPs which optional parts of RFC 7644 are implemented
+type SCIMServiceProviderConfig struct {
+	Schemas               []string                   `json:"schemas"`
+	Patch                 SCIMSupported              `json:"patch"`
+	Bulk                  SCIMBulkSupport            `json:"bulk"`
+	Filter                SCIMFilterSupport          `json:"filter"`
+	ChangePassword        SCIMSupported              `json:"changePassword"`
+	Sort                  SCIMSupported              `json:"sort"`
+	Etag                  SCIMSupported              `json:"etag"`
+	AuthenticationSchemes []SCIMAuthenticationScheme `json:"authenticationSchemes"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Group is a SCIM group of a tenant, Members only carries the user ids and usernames shown as display
+type Group struct {
+	Id          int
+	TenantId    int
+	DisplayName string
+	ExternalId  string
+	Members     []GroupMember
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type GroupMember struct {
+	UserId   int
+	UserName string
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+type ServiceAccountCreateRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	PublicKey string   `json:"publicKey"`
+}
+
+type ServiceAccountDisableRequest struct {
+	Disabled bool `json:"disabled"`
+}
+
+type ServiceAccountResponse struct {
+	Id           int       `json:"id"`
+	Name         string    `json:"name"`
+	ClientId     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Scopes       []string  `json:"scopes"`
+	HasPublicKey bool      `json:"has_public_key"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ServiceAccount struct {
+	Id           int
+	Name         string
+	ClientId     string
+	ClientSecret *string
+	PublicKey    *string
+	Scopes       string
+	OwnerId      int
+	Disabled     bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type ClientCredentialsRequest struct {
+	GrantType           string `json:"grant_type" form:"grant_type"`
+	Scope               string `json:"scope" form:"scope"`
+	ClientId            string `json:"client_id" form:"client_id"`
+	ClientSecret        string `json:"client_secret" form:"client_secret"`
+	ClientAssertionType string `json:"client_assertion_type" form:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion" form:"client_assertion"`
+}
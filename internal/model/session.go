@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Session is one login of a user, every access token carries its id in the sid claim and the
+// refresh token is bound to it, revoking the session revokes both
+type Session struct {
+	Id     string
+	UserId int
+	// Jkt is the DPoP key thumbprint the session's access tokens are bound to, empty for bearer sessions
+	Jkt string
+	// ActorId is the admin impersonating UserId, zero for sessions the user started themselves
+	ActorId int
+	// Locale is the user's language preference, the error handler answers in it instead of Accept-Language
+	Locale    string
+	AuthTime  time.Time
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -3,29 +3,73 @@ package model
 import "time"
 
 type UserCreateRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username   string `json:"username" validate:"required,username"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,min=5,max=20"`
+	InviteCode string `json:"inviteCode"`
 }
 
+// UserLoginRequest leaves the password length alone, the rules of UserCreateRequest only bind passwords set here
+// and a directory password of any length has to reach the directory
 type UserLoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Identifier string `json:"identifier" validate:"required" label:"Username or email"`
+	Password   string `json:"password" validate:"required"`
+	// Deprecated: use Identifier, kept so older clients sending email keep working
+	Email string `json:"email"`
+}
+
+type ReauthenticateRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type UserPasswordUpdateRequest struct {
+	NewPassword string `json:"newPassword" validate:"required,min=5,max=20"`
+}
+
+type UserEmailUpdateRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type UserLocaleUpdateRequest struct {
+	Locale string `json:"locale" validate:"required,locale" label:"Language"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token"`
 }
 
 type UserResponse struct {
 	Id        int       `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Locale    string    `json:"locale"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type User struct {
-	Id        int
-	Username  string
-	Email     string
-	Password  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Id               int
+	Username         string
+	UsernameSkeleton string
+	Email            string
+	EmailCanonical   string
+	Password         string
+	Role             string
+	Active           bool
+	// SCIMTenantId is the tenant whose identity provider manages the user, zero for everyone else
+	SCIMTenantId int
+	SCIMUserName string
+	ExternalId   string
+	// DirectoryDN is the LDAP entry of users created by a directory login, empty for everyone else
+	DirectoryDN string
+	// SAMLIdentityProviderId and SAMLNameId identify users who sign in with SAML, zero and empty for everyone else
+	SAMLIdentityProviderId int
+	SAMLNameId             string
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
 }
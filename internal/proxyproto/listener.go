@@ -0,0 +1,234 @@
+// Package proxyproto accepts connections that a load balancer opened on behalf of a client and prefixed with a
+// HAProxy PROXY protocol header (version 1 text or version 2 binary), so the connection reports the client's
+// address instead of the load balancer's
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	// v1 headers are at most 107 bytes including the CRLF
+	v1MaxLength = 107
+	// v2 addresses take at most 216 bytes, the rest is TLVs. Load balancers send a few hundred bytes of them at
+	// most, a peer announcing more is not waited for
+	v2MaxLength = 4096
+)
+
+// Listener reads the PROXY header of connections from trusted peers, connections from anyone else are served
+// as they are. A trusted peer must send the header, a connection without one is closed
+type Listener struct {
+	net.Listener
+	// Trusted decides which peers may send a header, a header from other peers is never believed
+	Trusted func(netip.Addr) bool
+	// HeaderTimeout bounds how long a trusted peer may take to send the header
+	HeaderTimeout time.Duration
+}
+
+func NewListener(listener net.Listener, trusted func(netip.Addr) bool, headerTimeout time.Duration) *Listener {
+	return &Listener{
+		Listener:      listener,
+		Trusted:       trusted,
+		HeaderTimeout: headerTimeout,
+	}
+}
+
+// Accept does not read the header itself, a slow peer would stall every other connection. The header is read
+// on the first Read or RemoteAddr instead
+func (listener *Listener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil || !listener.Trusted(addrPort.Addr().Unmap()) {
+		return conn, nil
+	}
+
+	return &Conn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		headerTimeout: listener.HeaderTimeout,
+	}, nil
+}
+
+// Conn is a connection from a trusted peer, its remote address is the one in the PROXY header
+type Conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	headerErr  error
+}
+
+func (conn *Conn) Read(b []byte) (int, error) {
+	conn.once.Do(conn.readHeader)
+	if conn.headerErr != nil {
+		return 0, conn.headerErr
+	}
+
+	return conn.reader.Read(b)
+}
+
+func (conn *Conn) RemoteAddr() net.Addr {
+	conn.once.Do(conn.readHeader)
+	if conn.remoteAddr != nil {
+		return conn.remoteAddr
+	}
+
+	return conn.Conn.RemoteAddr()
+}
+
+func (conn *Conn) readHeader() {
+	if conn.headerTimeout > 0 {
+		err := conn.Conn.SetReadDeadline(time.Now().Add(conn.headerTimeout))
+		if err != nil {
+			conn.headerErr = err
+			return
+		}
+		defer conn.Conn.SetReadDeadline(time.Time{})
+	}
+
+	conn.remoteAddr, conn.headerErr = ReadHeader(conn.reader)
+	if conn.headerErr != nil {
+		conn.Conn.Close()
+	}
+}
+
+// ReadHeader consumes a version 1 or 2 header and returns the source address it carries. The address is nil for
+// UNKNOWN and LOCAL headers, which health checks of the load balancer itself send
+func ReadHeader(reader *bufio.Reader) (net.Addr, error) {
+	peek, err := reader.Peek(len(v1Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	if bytes.Equal(peek, v1Prefix) {
+		return readV1(reader)
+	}
+
+	peek, err = reader.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(peek, v2Signature) {
+		return readV2(reader)
+	}
+
+	return nil, fmt.Errorf("%w: header is missing", ErrInvalidHeader)
+}
+
+// readV1 reads "PROXY TCP4|TCP6 <src> <dst> <srcport> <dstport>\r\n" or "PROXY UNKNOWN ...\r\n"
+func readV1(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, v1MaxLength)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, fmt.Errorf("%w: v1 header is too long", ErrInvalidHeader)
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header must end with CRLF", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: v1 header is malformed", ErrInvalidHeader)
+	}
+
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("%w: v1 source address is invalid", ErrInvalidHeader)
+	}
+
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: v1 source port is invalid", ErrInvalidHeader)
+	}
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+// readV2 reads the 16 byte binary header and its address block, TLVs after the addresses are skipped
+func readV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, version)
+	}
+
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+	if length > v2MaxLength {
+		return nil, fmt.Errorf("%w: v2 header is too long", ErrInvalidHeader)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL, the load balancer speaking for itself
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", ErrInvalidHeader, command)
+	}
+
+	switch family {
+	case 0x11, 0x12:
+		// TCP or UDP over IPv4: src addr, dst addr, src port, dst port
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: v2 IPv4 addresses are truncated", ErrInvalidHeader)
+		}
+		addr := netip.AddrFrom4([4]byte(payload[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(payload[8:10]))), nil
+	case 0x21, 0x22:
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: v2 IPv6 addresses are truncated", ErrInvalidHeader)
+		}
+		addr := netip.AddrFrom16([16]byte(payload[0:16])).Unmap()
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(payload[32:34]))), nil
+	default:
+		// UNSPEC and unix sockets carry no address the client can be identified by
+		return nil, nil
+	}
+}
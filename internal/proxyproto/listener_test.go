@@ -0,0 +1,170 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// v2Header builds a version 2 header for command and family with payload as its address block
+func v2Header(command byte, family byte, payload []byte) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func v2IPv4Payload(src string, srcPort uint16) []byte {
+	payload := netip.MustParseAddr(src).AsSlice()
+	payload = append(payload, 10, 0, 0, 1)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	return binary.BigEndian.AppendUint16(payload, 443)
+}
+
+func v2IPv6Payload(src string, srcPort uint16) []byte {
+	payload := netip.MustParseAddr(src).AsSlice()
+	payload = append(payload, netip.MustParseAddr("2001:db8::1").AsSlice()...)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	return binary.BigEndian.AppendUint16(payload, 443)
+}
+
+func TestReadHeader(t *testing.T) {
+	withLength := func(header []byte, length uint16) []byte {
+		binary.BigEndian.PutUint16(header[14:16], length)
+		return header
+	}
+
+	cases := []struct {
+		name    string
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 4711 443\r\n"), "203.0.113.9:4711", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 4711 443\r\n"), "[2001:db8::7]:4711", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 UNKNOWN with addresses", []byte("PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n"), "", false},
+		{"v1 TCP4 with an IPv6 address", []byte("PROXY TCP4 2001:db8::7 10.0.0.1 4711 443\r\n"), "", true},
+		{"v1 bad port", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 70000 443\r\n"), "", true},
+		{"v1 missing fields", []byte("PROXY TCP4 203.0.113.9\r\n"), "", true},
+		{"v1 without CR", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 4711 443\n"), "", true},
+		{"v1 truncated", []byte("PROXY TCP4 203.0.113.9 10.0.0.1"), "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n"), "", true},
+		{"v2 PROXY TCP4", v2Header(0x1, 0x11, v2IPv4Payload("203.0.113.9", 4711)), "203.0.113.9:4711", false},
+		{"v2 PROXY TCP6", v2Header(0x1, 0x21, v2IPv6Payload("2001:db8::7", 4711)), "[2001:db8::7]:4711", false},
+		{"v2 PROXY TCP4 with TLVs", v2Header(0x1, 0x11, append(v2IPv4Payload("203.0.113.9", 4711), 0x04, 0, 1, 0)), "203.0.113.9:4711", false},
+		{"v2 LOCAL", v2Header(0x0, 0x00, nil), "", false},
+		{"v2 LOCAL ignores addresses", v2Header(0x0, 0x11, v2IPv4Payload("203.0.113.9", 4711)), "", false},
+		{"v2 PROXY UNSPEC", v2Header(0x1, 0x00, nil), "", false},
+		{"v2 unknown command", v2Header(0x2, 0x11, v2IPv4Payload("203.0.113.9", 4711)), "", true},
+		{"v2 wrong version", append(append([]byte{}, v2Signature...), 0x11, 0x11, 0, 0), "", true},
+		{"v2 truncated fixed header", append(append([]byte{}, v2Signature...), 0x21, 0x11), "", true},
+		{"v2 truncated addresses", v2Header(0x1, 0x11, []byte{203, 0, 113, 9}), "", true},
+		{"v2 truncated IPv6 addresses", v2Header(0x1, 0x21, v2IPv4Payload("203.0.113.9", 4711)), "", true},
+		{"v2 length beyond the data", withLength(v2Header(0x1, 0x11, v2IPv4Payload("203.0.113.9", 4711)), 100), "", true},
+		{"HTTP request", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), "", true},
+		{"TLS client hello", []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01, 0x00, 0x01, 0xfc, 0x03, 0x03, 0, 0, 0, 0, 0}, "", true},
+		{"empty", nil, "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr, err := ReadHeader(bufio.NewReader(bytes.NewReader(c.input)))
+			if c.wantErr {
+				if !errors.Is(err, ErrInvalidHeader) {
+					t.Fatalf("ReadHeader = (%v, %v), want ErrInvalidHeader", addr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ReadHeader = %v", err)
+			}
+			if c.want == "" {
+				if addr != nil {
+					t.Errorf("ReadHeader = %v, want no address", addr)
+				}
+				return
+			}
+			if addr == nil || addr.String() != c.want {
+				t.Errorf("ReadHeader = %v, want %s", addr, c.want)
+			}
+		})
+	}
+}
+
+// zeros never runs out, the way a peer that keeps sending does not
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+func TestReadHeaderRefusesOversizedLength(t *testing.T) {
+	header := v2Header(0x1, 0x11, nil)
+	binary.BigEndian.PutUint16(header[14:16], 0xffff)
+
+	addr, err := ReadHeader(bufio.NewReader(io.MultiReader(bytes.NewReader(header), zeros{})))
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("ReadHeader = (%v, %v), want the announced length refused", addr, err)
+	}
+}
+
+func TestReadHeaderLeavesTheRequest(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.9 10.0.0.1 4711 443\r\nGET / HTTP/1.1\r\n"))
+
+	_, err := ReadHeader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest, _ := io.ReadAll(reader)
+	if string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("request after the header = %q", rest)
+	}
+}
+
+func TestListener(t *testing.T) {
+	for _, trusted := range []bool{true, false} {
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener := NewListener(inner, func(netip.Addr) bool { return trusted }, time.Second)
+
+		go func() {
+			client, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				return
+			}
+			defer client.Close()
+			client.Write([]byte("PROXY TCP4 203.0.113.9 10.0.0.1 4711 443\r\nhello"))
+		}()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		remoteAddr := conn.RemoteAddr().String()
+		body, _ := io.ReadAll(conn)
+		conn.Close()
+		listener.Close()
+
+		if trusted && (remoteAddr != "203.0.113.9:4711" || string(body) != "hello") {
+			t.Errorf("trusted peer: RemoteAddr = %s, body = %q", remoteAddr, body)
+		}
+		// an untrusted peer's header is part of what it sent, never its address
+		if !trusted && (strings.HasPrefix(remoteAddr, "203.0.113.9") || !strings.HasPrefix(string(body), "PROXY ")) {
+			t.Errorf("untrusted peer: RemoteAddr = %s, body = %q", remoteAddr, body)
+		}
+	}
+}
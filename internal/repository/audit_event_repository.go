@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/model"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type AuditEventRepository struct {
+	Log *zap.Logger
+	DB  *pgxpool.Pool
+}
+
+func NewAuditEventRepository(zap *zap.Logger, db *pgxpool.Pool) *AuditEventRepository {
+	return &AuditEventRepository{
+		Log: zap,
+		DB:  db,
+	}
+}
+
+func (repository *AuditEventRepository) Create(ctx context.Context, event model.AuditEvent) error {
+	query := "INSERT INTO audit_events (actor_id,user_id,action,session_id,ip,detail,created_at) VALUES (NULLIF($1::integer,0),NULLIF($2::integer,0),$3,$4,$5,$6,$7)"
+
+	_, err := repository.DB.Exec(ctx, query, event.ActorId, event.UserId, event.Action, event.SessionId, event.IP, event.Detail, event.CreatedAt)
+	return err
+}
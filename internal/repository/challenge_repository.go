@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type ChallengeRepository struct {
+	Log     *zap.Logger
+	DBCache *redis.Client
+}
+
+func NewChallengeRepository(zap *zap.Logger, dbCache *redis.Client) *ChallengeRepository {
+	return &ChallengeRepository{
+		Log:     zap,
+		DBCache: dbCache,
+	}
+}
+
+// Redis - Cache
+func (repository *ChallengeRepository) SetChallenge(ctx context.Context, challenge string, difficulty int, ttl time.Duration) error {
+	challengeKey := fmt.Sprintf("auth:challenge:%s", challenge)
+
+	return repository.DBCache.Set(ctx, challengeKey, difficulty, ttl).Err()
+}
+
+// TakeChallenge returns the difficulty of the challenge and deletes it so a solution can only be used once
+func (repository *ChallengeRepository) TakeChallenge(ctx context.Context, challenge string) (int, error) {
+	challengeKey := fmt.Sprintf("auth:challenge:%s", challenge)
+
+	difficulty, err := repository.DBCache.GetDel(ctx, challengeKey).Int()
+	if err == redis.Nil {
+		return 0, &model.ValidationError{
+			Code:    constant.ERR_CHALLENGE_FAILED_ERROR,
+			Message: "Challenge is not found or expired",
+			Param:   "challenge",
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	return difficulty, nil
+}
+
+func (repository *ChallengeRepository) IncrementFailure(ctx context.Context, ip string, window time.Duration) error {
+	failureKey := fmt.Sprintf("auth:failures:%s", ip)
+
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, failureKey)
+		pipe.ExpireNX(ctx, failureKey, window)
+		return nil
+	})
+
+	return err
+}
+
+func (repository *ChallengeRepository) GetFailureCount(ctx context.Context, ip string) (int, error) {
+	failureKey := fmt.Sprintf("auth:failures:%s", ip)
+
+	count, err := repository.DBCache.Get(ctx, failureKey).Int()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUserCodeTaken              = errors.New("user code is already in use")
+	ErrDeviceAuthorizationNil     = errors.New("device authorization is not found or expired")
+	ErrDeviceAuthorizationDecided = errors.New("device authorization has already been approved or denied")
+)
+
+// decideDevice settles a pending authorization, checking and writing the status in one step so two approvals
+// can not both win. It returns -1 for a missing authorization, HSET alone would recreate it without a TTL
+var decideDevice = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if redis.call("HGET", KEYS[1], "status") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", ARGV[2], "userId", ARGV[3], "authTime", ARGV[4])
+return 1
+`)
+
+// updateDevicePoll only touches authorizations that still exist
+var updateDevicePoll = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], "lastPoll", ARGV[1], "interval", ARGV[2])
+end
+return 0
+`)
+
+type DeviceRepository struct {
+	Log     *zap.Logger
+	DBCache *redis.Client
+}
+
+func NewDeviceRepository(zap *zap.Logger, dbCache *redis.Client) *DeviceRepository {
+	return &DeviceRepository{
+		Log:     zap,
+		DBCache: dbCache,
+	}
+}
+
+// Redis - Cache
+func (repository *DeviceRepository) Create(ctx context.Context, deviceCodeHash string, authorization model.DeviceAuthorization, ttl time.Duration) error {
+	deviceCodeKey := fmt.Sprintf("auth:deviceCode:%s", deviceCodeHash)
+	userCodeKey := fmt.Sprintf("auth:userCode:%s", authorization.UserCode)
+
+	// user codes are short, claim it first so two pending authorizations never share one
+	claimed, err := repository.DBCache.SetNX(ctx, userCodeKey, deviceCodeHash, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrUserCodeTaken
+	}
+
+	_, err = repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, deviceCodeKey, map[string]interface{}{
+			"userCode": authorization.UserCode,
+			"clientId": authorization.ClientId,
+			"status":   authorization.Status,
+			"userId":   authorization.UserId,
+			"authTime": authorization.AuthTime,
+			"interval": authorization.Interval,
+			"lastPoll": authorization.LastPoll,
+		})
+		pipe.Expire(ctx, deviceCodeKey, ttl)
+		return nil
+	})
+
+	return err
+}
+
+func (repository *DeviceRepository) Find(ctx context.Context, deviceCodeHash string) (model.DeviceAuthorization, error) {
+	deviceCodeKey := fmt.Sprintf("auth:deviceCode:%s", deviceCodeHash)
+	authorization := model.DeviceAuthorization{}
+
+	values, err := repository.DBCache.HGetAll(ctx, deviceCodeKey).Result()
+	if err != nil {
+		return authorization, err
+	}
+	if len(values) == 0 {
+		return authorization, ErrDeviceAuthorizationNil
+	}
+
+	authorization.UserCode = values["userCode"]
+	authorization.ClientId = values["clientId"]
+	authorization.Status = values["status"]
+	authorization.UserId, _ = strconv.Atoi(values["userId"])
+	authorization.AuthTime, _ = strconv.ParseInt(values["authTime"], 10, 64)
+	authorization.Interval, _ = strconv.Atoi(values["interval"])
+	authorization.LastPoll, _ = strconv.ParseInt(values["lastPoll"], 10, 64)
+
+	return authorization, nil
+}
+
+func (repository *DeviceRepository) FindByUserCode(ctx context.Context, userCode string) (string, model.DeviceAuthorization, error) {
+	userCodeKey := fmt.Sprintf("auth:userCode:%s", userCode)
+
+	deviceCodeHash, err := repository.DBCache.Get(ctx, userCodeKey).Result()
+	if err == redis.Nil {
+		return "", model.DeviceAuthorization{}, ErrDeviceAuthorizationNil
+	} else if err != nil {
+		return "", model.DeviceAuthorization{}, err
+	}
+
+	authorization, err := repository.Find(ctx, deviceCodeHash)
+	return deviceCodeHash, authorization, err
+}
+
+// UpdateStatus approves or denies an authorization that is still pending, it fails with ErrDeviceAuthorizationDecided
+// when another call settled it first
+func (repository *DeviceRepository) UpdateStatus(ctx context.Context, deviceCodeHash string, status string, userId int, authTime int64) error {
+	deviceCodeKey := fmt.Sprintf("auth:deviceCode:%s", deviceCodeHash)
+
+	result, err := decideDevice.Run(ctx, repository.DBCache, []string{deviceCodeKey}, constant.DEVICE_STATUS_PENDING, status, userId, authTime).Int()
+	if err != nil {
+		return err
+	}
+
+	switch result {
+	case -1:
+		return ErrDeviceAuthorizationNil
+	case 0:
+		return ErrDeviceAuthorizationDecided
+	}
+
+	return nil
+}
+
+func (repository *DeviceRepository) UpdatePoll(ctx context.Context, deviceCodeHash string, lastPoll int64, interval int) error {
+	deviceCodeKey := fmt.Sprintf("auth:deviceCode:%s", deviceCodeHash)
+
+	return updateDevicePoll.Run(ctx, repository.DBCache, []string{deviceCodeKey}, lastPoll, interval).Err()
+}
+
+// Delete reports whether this call removed the authorization, only the caller that removed it may issue tokens
+func (repository *DeviceRepository) Delete(ctx context.Context, deviceCodeHash string, userCode string) (bool, error) {
+	deviceCodeKey := fmt.Sprintf("auth:deviceCode:%s", deviceCodeHash)
+	userCodeKey := fmt.Sprintf("auth:userCode:%s", userCode)
+
+	deleted, err := repository.DBCache.Del(ctx, deviceCodeKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	err = repository.DBCache.Del(ctx, userCodeKey).Err()
+	if err != nil {
+		return false, err
+	}
+
+	return deleted == 1, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+func TestDeviceRepositoryUpdateStatus(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewDeviceRepository(zap.NewNop(), client)
+	ctx := context.Background()
+
+	err := repository.Create(ctx, "hash", model.DeviceAuthorization{
+		UserCode: "BCDFGHJK",
+		ClientId: "cli",
+		Status:   constant.DEVICE_STATUS_PENDING,
+		Interval: 5,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	err = repository.UpdateStatus(ctx, "hash", constant.DEVICE_STATUS_APPROVED, 7, 1700000000)
+	if err != nil {
+		t.Fatalf("UpdateStatus() = %v", err)
+	}
+
+	err = repository.UpdateStatus(ctx, "hash", constant.DEVICE_STATUS_DENIED, 8, 1700000001)
+	if !errors.Is(err, ErrDeviceAuthorizationDecided) {
+		t.Fatalf("second UpdateStatus() = %v, want ErrDeviceAuthorizationDecided", err)
+	}
+
+	authorization, err := repository.Find(ctx, "hash")
+	if err != nil {
+		t.Fatalf("Find() = %v", err)
+	}
+	if authorization.Status != constant.DEVICE_STATUS_APPROVED || authorization.UserId != 7 || authorization.AuthTime != 1700000000 {
+		t.Fatalf("authorization = %+v, want the first approval", authorization)
+	}
+
+	server.FastForward(2 * time.Minute)
+
+	err = repository.UpdateStatus(ctx, "hash", constant.DEVICE_STATUS_APPROVED, 7, 1700000000)
+	if !errors.Is(err, ErrDeviceAuthorizationNil) {
+		t.Fatalf("UpdateStatus() after expiry = %v, want ErrDeviceAuthorizationNil", err)
+	}
+	if server.Exists("auth:deviceCode:hash") {
+		t.Fatal("UpdateStatus() recreated an expired authorization")
+	}
+}
+
+func TestDeviceRepositoryUpdatePollAfterExpiry(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewDeviceRepository(zap.NewNop(), client)
+	ctx := context.Background()
+
+	err := repository.Create(ctx, "hash", model.DeviceAuthorization{UserCode: "BCDFGHJK", Status: constant.DEVICE_STATUS_PENDING}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	err = repository.UpdatePoll(ctx, "hash", 1700000000, 10)
+	if err != nil {
+		t.Fatalf("UpdatePoll() = %v", err)
+	}
+	if ttl := server.TTL("auth:deviceCode:hash"); ttl <= 0 {
+		t.Fatalf("TTL after UpdatePoll() = %v, want it kept", ttl)
+	}
+
+	server.FastForward(2 * time.Minute)
+
+	err = repository.UpdatePoll(ctx, "hash", 1700000100, 10)
+	if err != nil {
+		t.Fatalf("UpdatePoll() after expiry = %v", err)
+	}
+	if server.Exists("auth:deviceCode:hash") {
+		t.Fatal("UpdatePoll() recreated an expired authorization")
+	}
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type DPoPRepository struct {
+	Log     *zap.Logger
+	DBCache *redis.Client
+}
+
+func NewDPoPRepository(zap *zap.Logger, dbCache *redis.Client) *DPoPRepository {
+	return &DPoPRepository{
+		Log:     zap,
+		DBCache: dbCache,
+	}
+}
+
+// Redis - Cache
+// MarkProofUsed remembers the jti of a DPoP proof while it could still be accepted, false means it was replayed
+func (repository *DPoPRepository) MarkProofUsed(ctx context.Context, jkt string, jti string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("auth:dpopProof:%s:%s", jkt, jti)
+
+	return repository.DBCache.SetNX(ctx, key, 1, ttl).Result()
+}
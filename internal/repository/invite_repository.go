@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type InviteRepository struct {
+	Log *zap.Logger
+	DB  *pgxpool.Pool
+}
+
+func NewInviteRepository(zap *zap.Logger, db *pgxpool.Pool) *InviteRepository {
+	return &InviteRepository{
+		Log: zap,
+		DB:  db,
+	}
+}
+
+func (repository *InviteRepository) Create(ctx context.Context, invite model.InviteCode) (int, error) {
+	query := "INSERT INTO invite_codes (code,max_uses,used_count,expires_at,created_by,created_at) VALUES ($1,$2,0,$3,$4,$5) RETURNING id"
+
+	var inviteId int
+	err := repository.DB.QueryRow(ctx, query, invite.Code, invite.MaxUses, invite.ExpiresAt, invite.CreatedBy, invite.CreatedAt).Scan(&inviteId)
+	if err != nil {
+		return inviteId, err
+	}
+
+	return inviteId, nil
+}
+
+func (repository *InviteRepository) FindAll(ctx context.Context) ([]model.InviteCodeResponse, error) {
+	query := "SELECT id,code,max_uses,used_count,expires_at,COALESCE(created_by,0),created_at FROM invite_codes ORDER BY created_at DESC"
+
+	rows, err := repository.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []model.InviteCodeResponse{}
+	for rows.Next() {
+		invite := model.InviteCodeResponse{}
+		err = rows.Scan(&invite.Id, &invite.Code, &invite.MaxUses, &invite.UsedCount, &invite.ExpiresAt, &invite.CreatedBy, &invite.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// Consume claims one use of the invite code inside the registration transaction,
+// the conditional update makes concurrent registrations unable to overspend it
+func (repository *InviteRepository) Consume(ctx context.Context, tx pgx.Tx, code string, now time.Time) error {
+	query := "UPDATE invite_codes SET used_count=used_count+1 WHERE code=$1 AND used_count<max_uses AND (expires_at IS NULL OR expires_at>$2) RETURNING id"
+
+	var inviteId int
+	err := tx.QueryRow(ctx, query, code, now).Scan(&inviteId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "Invite code is invalid, expired or already used up",
+				Param:   "inviteCode",
+			}
+		}
+		return err
+	}
+
+	return nil
+}
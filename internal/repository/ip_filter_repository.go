@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	ipFilterVersionKey = "ipfilter:version"
+	ipFilterBlockedKey = "ipfilter:blocked"
+)
+
+// IPFilterRepository keeps the admin managed allow and deny lists in Redis sets, every change bumps a version so
+// processes only reload the lists when they changed
+type IPFilterRepository struct {
+	Log     *zap.Logger
+	DBCache *redis.Client
+}
+
+func NewIPFilterRepository(zap *zap.Logger, dbCache *redis.Client) *IPFilterRepository {
+	return &IPFilterRepository{
+		Log:     zap,
+		DBCache: dbCache,
+	}
+}
+
+// Redis - Cache
+func (repository *IPFilterRepository) Add(ctx context.Context, list string, cidr string) error {
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, ipFilterListKey(list), cidr)
+		pipe.Incr(ctx, ipFilterVersionKey)
+		return nil
+	})
+
+	return err
+}
+
+// Remove reports whether the list held cidr
+func (repository *IPFilterRepository) Remove(ctx context.Context, list string, cidr string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.SRem(ctx, ipFilterListKey(list), cidr)
+		pipe.Incr(ctx, ipFilterVersionKey)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return removed.Val() > 0, nil
+}
+
+func (repository *IPFilterRepository) FindAll(ctx context.Context, list string) ([]string, error) {
+	return repository.DBCache.SMembers(ctx, ipFilterListKey(list)).Result()
+}
+
+// Version is zero until the lists are first changed
+func (repository *IPFilterRepository) Version(ctx context.Context) (int64, error) {
+	version, err := repository.DBCache.Get(ctx, ipFilterVersionKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (repository *IPFilterRepository) IncrementBlocked(ctx context.Context, reason string) error {
+	return repository.DBCache.HIncrBy(ctx, ipFilterBlockedKey, reason, 1).Err()
+}
+
+func (repository *IPFilterRepository) FindBlocked(ctx context.Context) (map[string]int64, error) {
+	values, err := repository.DBCache.HGetAll(ctx, ipFilterBlockedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	blocked := map[string]int64{}
+	for reason, value := range values {
+		blocked[reason], _ = strconv.ParseInt(value, 10, 64)
+	}
+
+	return blocked, nil
+}
+
+func ipFilterListKey(list string) string {
+	return "ipfilter:" + list
+}
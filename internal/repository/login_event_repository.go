@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type LoginEventRepository struct {
+	Log *zap.Logger
+	DB  *pgxpool.Pool
+}
+
+func NewLoginEventRepository(zap *zap.Logger, db *pgxpool.Pool) *LoginEventRepository {
+	return &LoginEventRepository{
+		Log: zap,
+		DB:  db,
+	}
+}
+
+func (repository *LoginEventRepository) Create(ctx context.Context, event model.LoginEvent) error {
+	query := "INSERT INTO login_events (user_id,ip,country,device_id,success,created_at) VALUES ($1,$2,$3,$4,$5,$6)"
+
+	_, err := repository.DB.Exec(ctx, query, event.UserId, event.IP, event.Country, event.DeviceId, event.Success, event.CreatedAt)
+	return err
+}
+
+func (repository *LoginEventRepository) HasSuccessfulDevice(ctx context.Context, userId int, deviceId string) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM login_events WHERE user_id=$1 AND device_id=$2 AND success)"
+
+	var exists bool
+	err := repository.DB.QueryRow(ctx, query, userId, deviceId).Scan(&exists)
+	return exists, err
+}
+
+// GetSuccessfulCountries returns every country the user has logged in from before, unknown countries are skipped
+func (repository *LoginEventRepository) GetSuccessfulCountries(ctx context.Context, userId int) ([]string, error) {
+	query := "SELECT DISTINCT country FROM login_events WHERE user_id=$1 AND success AND country<>''"
+
+	rows, err := repository.DB.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countries := []string{}
+	for rows.Next() {
+		var country string
+		err = rows.Scan(&country)
+		if err != nil {
+			return nil, err
+		}
+		countries = append(countries, country)
+	}
+
+	return countries, rows.Err()
+}
+
+// CountFailuresSince counts failed attempts after the most recent successful login within the window
+func (repository *LoginEventRepository) CountFailuresSince(ctx context.Context, userId int, since time.Time) (int, error) {
+	query := `SELECT count(*) FROM login_events WHERE user_id=$1 AND NOT success AND created_at>=$2
+		AND created_at>COALESCE((SELECT max(created_at) FROM login_events WHERE user_id=$1 AND success),'-infinity')`
+
+	var count int
+	err := repository.DB.QueryRow(ctx, query, userId, since).Scan(&count)
+	return count, err
+}
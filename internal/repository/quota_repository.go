@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	usageDirtyKey     = "usage:dirty"
+	usageWindowLayout = "20060102"
+	userPlanCacheTTL  = 5 * time.Minute
+)
+
+// consumeUsage counts one unit unless that would go over the limit, a negative limit only meters. Counted keys are
+// remembered in the dirty set so the flusher knows what to write to Postgres
+var consumeUsage = redis.NewScript(`
+local used = tonumber(redis.call("GET", KEYS[1]) or "0")
+local limit = tonumber(ARGV[1])
+if limit >= 0 and used >= limit then
+	return {0, used}
+end
+
+used = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+redis.call("SADD", KEYS[2], KEYS[1])
+return {1, used}
+`)
+
+// refundUsage gives back one unit of a counter that exists and is above zero. DECR would otherwise bring back an
+// expired counter as -1 without a TTL, which would never expire and be flushed as a negative count
+var refundUsage = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[1]) or "0") <= 0 then
+	return 0
+end
+
+redis.call("DECR", KEYS[1])
+redis.call("SADD", KEYS[2], KEYS[1])
+return 1
+`)
+
+// QuotaRepository keeps the usage counters of the current windows in Redis and their durable copy in usage_counters
+type QuotaRepository struct {
+	Log     *zap.Logger
+	DB      *pgxpool.Pool
+	DBCache *redis.Client
+}
+
+func NewQuotaRepository(zap *zap.Logger, db *pgxpool.Pool, dbCache *redis.Client) *QuotaRepository {
+	return &QuotaRepository{
+		Log:     zap,
+		DB:      db,
+		DBCache: dbCache,
+	}
+}
+
+// Postgresql - Nosql
+func (repository *QuotaRepository) GetUserPlan(ctx context.Context, userId int) (string, error) {
+	cacheKey := fmt.Sprintf("usage:plan:%d", userId)
+
+	plan, err := repository.DBCache.Get(ctx, cacheKey).Result()
+	if err == nil {
+		return plan, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+
+	query := "SELECT plan FROM users WHERE id=$1"
+	err = repository.DB.QueryRow(ctx, query, userId).Scan(&plan)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User not found",
+				Param:   "userId",
+			}
+		}
+		return "", err
+	}
+
+	err = repository.DBCache.Set(ctx, cacheKey, plan, userPlanCacheTTL).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return plan, nil
+}
+
+func (repository *QuotaRepository) UpdateUserPlan(ctx context.Context, userId int, plan string, updatedAt time.Time) error {
+	query := "UPDATE users SET plan=$2,updated_at=$3 WHERE id=$1"
+
+	tag, err := repository.DB.Exec(ctx, query, userId, plan, updatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return &model.ValidationError{
+			Code:    constant.ERR_NOT_FOUND_ERROR,
+			Message: "User not found",
+			Param:   "userId",
+		}
+	}
+
+	return repository.DBCache.Del(ctx, fmt.Sprintf("usage:plan:%d", userId)).Err()
+}
+
+// UpsertCounters writes flushed counters as Redis had them, refunds included, updatedAt is when they were read so
+// a flush that read them earlier but writes last does not overwrite a newer count
+func (repository *QuotaRepository) UpsertCounters(ctx context.Context, counters []model.UsageCounter, updatedAt time.Time) error {
+	query := `INSERT INTO usage_counters(user_id,metric,window_start,count,updated_at) VALUES($1,$2,$3,$4,$5)
+		ON CONFLICT (user_id,metric,window_start) DO UPDATE SET count=EXCLUDED.count,updated_at=EXCLUDED.updated_at
+		WHERE usage_counters.updated_at<=EXCLUDED.updated_at`
+
+	batch := &pgx.Batch{}
+	for _, counter := range counters {
+		batch.Queue(query, counter.UserId, counter.Metric, counter.WindowStart, counter.Count, updatedAt)
+	}
+
+	return repository.DB.SendBatch(ctx, batch).Close()
+}
+
+func (repository *QuotaRepository) findCounter(ctx context.Context, userId int, metric string, windowStart time.Time) (int, error) {
+	query := "SELECT count FROM usage_counters WHERE user_id=$1 AND metric=$2 AND window_start=$3"
+
+	var count int
+	err := repository.DB.QueryRow(ctx, query, userId, metric, windowStart).Scan(&count)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Redis - Cache
+func (repository *QuotaRepository) Consume(ctx context.Context, userId int, metric string, windowStart time.Time, ttl time.Duration, limit int) (int, bool, error) {
+	key, err := repository.counterKey(ctx, userId, metric, windowStart, ttl)
+	if err != nil {
+		return 0, false, err
+	}
+
+	values, err := consumeUsage.Run(ctx, repository.DBCache, []string{key, usageDirtyKey}, limit, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int(values[1]), values[0] == 1, nil
+}
+
+// Refund takes back a unit consumed for an operation that then failed, a counter that expired in between has
+// nothing left to take back
+func (repository *QuotaRepository) Refund(ctx context.Context, userId int, metric string, windowStart time.Time) error {
+	key := usageCounterKey(userId, metric, windowStart)
+
+	return refundUsage.Run(ctx, repository.DBCache, []string{key, usageDirtyKey}).Err()
+}
+
+func (repository *QuotaRepository) FindUsage(ctx context.Context, userId int, metric string, windowStart time.Time, ttl time.Duration) (int, error) {
+	key, err := repository.counterKey(ctx, userId, metric, windowStart, ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	used, err := repository.DBCache.Get(ctx, key).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	return used, nil
+}
+
+// TakeDirtyCounters pops up to count counters changed since they were last flushed, counters whose key expired
+// in the meantime were flushed before and are skipped
+func (repository *QuotaRepository) TakeDirtyCounters(ctx context.Context, count int) ([]model.UsageCounter, error) {
+	keys, err := repository.DBCache.SPopN(ctx, usageDirtyKey, int64(count)).Result()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	values, err := repository.DBCache.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counters := []model.UsageCounter{}
+	for i, key := range keys {
+		value, ok := values[i].(string)
+		if !ok {
+			continue
+		}
+
+		counter, err := parseUsageCounterKey(key)
+		if err != nil {
+			repository.Log.Warn("Skipping malformed usage counter", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		counter.Count, _ = strconv.Atoi(value)
+		counters = append(counters, counter)
+	}
+
+	return counters, nil
+}
+
+// MarkDirty queues counters for the next flush again
+func (repository *QuotaRepository) MarkDirty(ctx context.Context, counters []model.UsageCounter) error {
+	keys := make([]interface{}, 0, len(counters))
+	for _, counter := range counters {
+		keys = append(keys, usageCounterKey(counter.UserId, counter.Metric, counter.WindowStart))
+	}
+
+	return repository.DBCache.SAdd(ctx, usageDirtyKey, keys...).Err()
+}
+
+// counterKey makes sure the counter exists, a counter lost with Redis restarts from its last flushed count
+func (repository *QuotaRepository) counterKey(ctx context.Context, userId int, metric string, windowStart time.Time, ttl time.Duration) (string, error) {
+	key := usageCounterKey(userId, metric, windowStart)
+
+	exists, err := repository.DBCache.Exists(ctx, key).Result()
+	if err != nil || exists == 1 {
+		return key, err
+	}
+
+	count, err := repository.findCounter(ctx, userId, metric, windowStart)
+	if err != nil {
+		return key, err
+	}
+
+	return key, repository.DBCache.SetNX(ctx, key, count, ttl).Err()
+}
+
+func usageCounterKey(userId int, metric string, windowStart time.Time) string {
+	return fmt.Sprintf("usage:%d:%s:%s", userId, metric, windowStart.Format(usageWindowLayout))
+}
+
+func parseUsageCounterKey(key string) (model.UsageCounter, error) {
+	parts := strings.Split(key, ":")
+	if len(parts) != 4 {
+		return model.UsageCounter{}, fmt.Errorf("expected 4 parts, got %d", len(parts))
+	}
+
+	userId, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return model.UsageCounter{}, err
+	}
+
+	windowStart, err := time.Parse(usageWindowLayout, parts[3])
+	if err != nil {
+		return model.UsageCounter{}, err
+	}
+
+	return model.UsageCounter{UserId: userId, Metric: parts[2], WindowStart: windowStart}, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestQuotaRepositoryRefund(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewQuotaRepository(zap.NewNop(), nil, client)
+	ctx := context.Background()
+	windowStart := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	key := usageCounterKey(7, "invites", windowStart)
+
+	// the counter expired between Consume and Refund
+	err := repository.Refund(ctx, 7, "invites", windowStart)
+	if err != nil {
+		t.Fatalf("Refund(missing) = %v", err)
+	}
+	if server.Exists(key) {
+		value, _ := server.Get(key)
+		t.Fatalf("refunding a missing counter created it with %q", value)
+	}
+	if members, _ := server.Members(usageDirtyKey); len(members) != 0 {
+		t.Fatalf("refunding a missing counter queued %v for flushing", members)
+	}
+
+	server.Set(key, "0")
+	err = repository.Refund(ctx, 7, "invites", windowStart)
+	if err != nil {
+		t.Fatalf("Refund(0) = %v", err)
+	}
+	if value, _ := server.Get(key); value != "0" {
+		t.Fatalf("counter at 0 was refunded to %s", value)
+	}
+
+	server.Set(key, "2")
+	server.SetTTL(key, time.Hour)
+	err = repository.Refund(ctx, 7, "invites", windowStart)
+	if err != nil {
+		t.Fatalf("Refund(2) = %v", err)
+	}
+	if value, _ := server.Get(key); value != "1" {
+		t.Errorf("counter = %s, want 1", value)
+	}
+	if ttl := server.TTL(key); ttl != time.Hour {
+		t.Errorf("counter TTL = %v, want it kept at 1h", ttl)
+	}
+	if ok, _ := server.IsMember(usageDirtyKey, key); !ok {
+		t.Error("refunded counter was not queued for flushing")
+	}
+}
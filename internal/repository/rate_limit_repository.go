@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/model"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// takeRateLimit is the generic cell rate algorithm (GCRA), the key holds the theoretical arrival time (TAT) of the
+// next request in milliseconds. Every request moves it one emission interval (period / limit) further and is
+// rejected when that would put it more than a period ahead of now. The Redis clock is used so every process and
+// instance agrees on now
+var takeRateLimit = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval
+local allowAt = newTat - period
+if allowAt > now then
+	return {0, 0, tat - now, allowAt - now}
+end
+
+redis.call("SET", KEYS[1], newTat, "PX", newTat - now)
+return {1, math.floor((now - allowAt) / interval), newTat - now, 0}
+`)
+
+type RateLimitRepository struct {
+	Log     *zap.Logger
+	DBCache *redis.Client
+}
+
+func NewRateLimitRepository(zap *zap.Logger, dbCache *redis.Client) *RateLimitRepository {
+	return &RateLimitRepository{
+		Log:     zap,
+		DBCache: dbCache,
+	}
+}
+
+// Redis - Cache
+func (repository *RateLimitRepository) Take(ctx context.Context, policy model.RateLimitPolicy, subject string) (model.RateLimitResult, error) {
+	key := fmt.Sprintf("ratelimit:%s:%s", policy.Name, subject)
+	period := policy.Period.Milliseconds()
+	interval := max(period/int64(policy.Limit), 1)
+
+	values, err := takeRateLimit.Run(ctx, repository.DBCache, []string{key}, interval, period).Int64Slice()
+	if err != nil {
+		return model.RateLimitResult{}, err
+	}
+
+	return model.RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRateLimitRepositoryTake(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewRateLimitRepository(zap.NewNop(), client)
+	ctx := context.Background()
+
+	// one request every 2s on average, up to 5 at once
+	policy := model.RateLimitPolicy{Name: "auth", Limit: 5, Period: 10 * time.Second, By: constant.RATE_LIMIT_BY_IP}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	take := func() model.RateLimitResult {
+		t.Helper()
+		result, err := repository.Take(ctx, policy, "ip:203.0.113.9")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// the burst is used up at exactly Limit requests
+	for i := 1; i <= policy.Limit; i++ {
+		result := take()
+		if !result.Allowed || result.Remaining != policy.Limit-i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i, result, policy.Limit-i)
+		}
+		if result.Reset != time.Duration(i)*2*time.Second {
+			t.Errorf("request %d: Reset = %v, want %v", i, result.Reset, time.Duration(i)*2*time.Second)
+		}
+	}
+
+	result := take()
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("request over the limit = %+v, want rejected", result)
+	}
+	if result.RetryAfter != 2*time.Second || result.Reset != 10*time.Second {
+		t.Errorf("rejected request: RetryAfter = %v, Reset = %v, want 2s and 10s", result.RetryAfter, result.Reset)
+	}
+
+	// a rejected request costs nothing, it is still one interval until the next one fits
+	server.SetTime(now.Add(time.Second))
+	result = take()
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("request 1s later = %+v, want rejected with 1s to wait", result)
+	}
+
+	// one interval refills one request
+	server.SetTime(now.Add(2 * time.Second))
+	result = take()
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("request after one interval = %+v, want allowed with 0 remaining", result)
+	}
+	result = take()
+	if result.Allowed {
+		t.Errorf("second request after one interval = %+v, want rejected", result)
+	}
+
+	// a full period refills the whole burst
+	server.SetTime(now.Add(time.Minute))
+	result = take()
+	if !result.Allowed || result.Remaining != policy.Limit-1 {
+		t.Errorf("request after a quiet period = %+v, want allowed with %d remaining", result, policy.Limit-1)
+	}
+
+	// subjects and policies are counted apart
+	other, err := repository.Take(ctx, policy, "ip:198.51.100.7")
+	if err != nil || !other.Allowed || other.Remaining != policy.Limit-1 {
+		t.Errorf("another subject = (%+v, %v), want its own full bucket", other, err)
+	}
+}
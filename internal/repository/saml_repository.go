@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type SAMLRepository struct {
+	Log     *zap.Logger
+	DB      *pgxpool.Pool
+	DBCache *redis.Client
+}
+
+func NewSAMLRepository(zap *zap.Logger, db *pgxpool.Pool, dbCache *redis.Client) *SAMLRepository {
+	return &SAMLRepository{
+		Log:     zap,
+		DB:      db,
+		DBCache: dbCache,
+	}
+}
+
+func (repository *SAMLRepository) Create(ctx context.Context, identityProvider model.SAMLIdentityProvider) (int, error) {
+	query := "INSERT INTO saml_identity_providers (name,domain,entity_id,metadata_xml,provision_users,created_at,updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id"
+
+	var identityProviderId int
+	err := repository.DB.QueryRow(ctx, query, identityProvider.Name, identityProvider.Domain, identityProvider.EntityId, identityProvider.MetadataXML,
+		identityProvider.ProvisionUsers, identityProvider.CreatedAt, identityProvider.UpdatedAt).Scan(&identityProviderId)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return identityProviderId, &model.ValidationError{
+				Code:    constant.ERR_CONFLICT_ERROR,
+				Message: "An identity provider is already configured for this domain",
+				Param:   "domain",
+			}
+		}
+		return identityProviderId, err
+	}
+
+	return identityProviderId, nil
+}
+
+func (repository *SAMLRepository) FindAll(ctx context.Context) ([]model.SAMLIdentityProvider, error) {
+	query := "SELECT id,name,domain,entity_id,metadata_xml,provision_users,created_at,updated_at FROM saml_identity_providers ORDER BY domain"
+
+	rows, err := repository.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identityProviders := []model.SAMLIdentityProvider{}
+	for rows.Next() {
+		identityProvider := model.SAMLIdentityProvider{}
+		err = rows.Scan(&identityProvider.Id, &identityProvider.Name, &identityProvider.Domain, &identityProvider.EntityId, &identityProvider.MetadataXML,
+			&identityProvider.ProvisionUsers, &identityProvider.CreatedAt, &identityProvider.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identityProviders = append(identityProviders, identityProvider)
+	}
+
+	return identityProviders, rows.Err()
+}
+
+func (repository *SAMLRepository) FindByDomain(ctx context.Context, domain string) (model.SAMLIdentityProvider, error) {
+	query := "SELECT id,name,domain,entity_id,metadata_xml,provision_users,created_at,updated_at FROM saml_identity_providers WHERE domain=$1"
+
+	return repository.findOne(ctx, query, domain)
+}
+
+func (repository *SAMLRepository) FindById(ctx context.Context, id int) (model.SAMLIdentityProvider, error) {
+	query := "SELECT id,name,domain,entity_id,metadata_xml,provision_users,created_at,updated_at FROM saml_identity_providers WHERE id=$1"
+
+	return repository.findOne(ctx, query, id)
+}
+
+func (repository *SAMLRepository) findOne(ctx context.Context, query string, arg interface{}) (model.SAMLIdentityProvider, error) {
+	identityProvider := model.SAMLIdentityProvider{}
+	err := repository.DB.QueryRow(ctx, query, arg).Scan(&identityProvider.Id, &identityProvider.Name, &identityProvider.Domain, &identityProvider.EntityId,
+		&identityProvider.MetadataXML, &identityProvider.ProvisionUsers, &identityProvider.CreatedAt, &identityProvider.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return identityProvider, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "Single sign-on is not configured for this email domain",
+				Param:   "email",
+			}
+		}
+		return identityProvider, err
+	}
+
+	return identityProvider, nil
+}
+
+// Redis - Cache
+func (repository *SAMLRepository) SetRequestStateInCache(ctx context.Context, relayState string, state model.SAMLRequestState, ttl time.Duration) error {
+	key := fmt.Sprintf("auth:samlRequest:%s", relayState)
+
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"identityProviderId": state.IdentityProviderId,
+			"requestId":          state.RequestId,
+		})
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// TakeRequestStateInCache deletes the state while reading it so every AuthnRequest can be answered only once
+func (repository *SAMLRepository) TakeRequestStateInCache(ctx context.Context, relayState string) (model.SAMLRequestState, error) {
+	key := fmt.Sprintf("auth:samlRequest:%s", relayState)
+
+	var values *redis.MapStringStringCmd
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.HGetAll(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return model.SAMLRequestState{}, err
+	}
+
+	if len(values.Val()) == 0 {
+		return model.SAMLRequestState{}, &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "Single sign-on request is invalid, expired or already used",
+			Param:   "RelayState",
+		}
+	}
+
+	identityProviderId, _ := strconv.Atoi(values.Val()["identityProviderId"])
+
+	return model.SAMLRequestState{
+		IdentityProviderId: identityProviderId,
+		RequestId:          values.Val()["requestId"],
+	}, nil
+}
+
+// MarkAssertionUsed remembers an assertion id until the assertion expires, false means it was already consumed
+func (repository *SAMLRepository) MarkAssertionUsed(ctx context.Context, identityProviderId int, assertionId string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("auth:samlAssertion:%d:%s", identityProviderId, assertionId)
+
+	return repository.DBCache.SetNX(ctx, key, 1, ttl).Result()
+}
@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// scimGroupFilterColumns are the SCIM attributes groups can be filtered by, keyed by their lowercased name
+var scimGroupFilterColumns = map[string]string{
+	"displayname": "display_name",
+	"externalid":  "external_id",
+}
+
+// SCIMRepository stores SCIM tenants and their groups, the users they manage live in UserRepository
+type SCIMRepository struct {
+	Log *zap.Logger
+	DB  *pgxpool.Pool
+}
+
+func NewSCIMRepository(zap *zap.Logger, db *pgxpool.Pool) *SCIMRepository {
+	return &SCIMRepository{
+		Log: zap,
+		DB:  db,
+	}
+}
+
+func (repository *SCIMRepository) CreateTenant(ctx context.Context, tenant model.SCIMTenant) (int, error) {
+	query := "INSERT INTO scim_tenants (name,domain,token_hash,created_at,updated_at) VALUES ($1,$2,$3,$4,$5) RETURNING id"
+
+	var tenantId int
+	err := repository.DB.QueryRow(ctx, query, tenant.Name, tenant.Domain, tenant.TokenHash, tenant.CreatedAt, tenant.UpdatedAt).Scan(&tenantId)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return tenantId, &model.ValidationError{
+				Code:    constant.ERR_CONFLICT_ERROR,
+				Message: "A SCIM tenant is already configured for this domain",
+				Param:   "domain",
+			}
+		}
+		return tenantId, err
+	}
+
+	return tenantId, nil
+}
+
+func (repository *SCIMRepository) FindAllTenants(ctx context.Context) ([]model.SCIMTenant, error) {
+	query := "SELECT id,name,domain,token_hash,created_at,updated_at FROM scim_tenants ORDER BY domain"
+
+	rows, err := repository.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []model.SCIMTenant{}
+	for rows.Next() {
+		tenant := model.SCIMTenant{}
+		err = rows.Scan(&tenant.Id, &tenant.Name, &tenant.Domain, &tenant.TokenHash, &tenant.CreatedAt, &tenant.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+func (repository *SCIMRepository) FindTenantByTokenHash(ctx context.Context, tokenHash string) (model.SCIMTenant, error) {
+	query := "SELECT id,name,domain,token_hash,created_at,updated_at FROM scim_tenants WHERE token_hash=$1"
+
+	tenant := model.SCIMTenant{}
+	err := repository.DB.QueryRow(ctx, query, tokenHash).Scan(&tenant.Id, &tenant.Name, &tenant.Domain, &tenant.TokenHash, &tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tenant, &model.ValidationError{
+				Code:    constant.ERR_UNATHORIZED_ERROR,
+				Message: "SCIM token is invalid",
+			}
+		}
+		return tenant, err
+	}
+
+	return tenant, nil
+}
+
+func (repository *SCIMRepository) CreateGroup(ctx context.Context, group model.Group) (int, error) {
+	query := "INSERT INTO scim_groups (tenant_id,display_name,external_id,created_at,updated_at) VALUES ($1,$2,NULLIF($3,''),$4,$5) RETURNING id"
+
+	tx, err := repository.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var groupId int
+	err = tx.QueryRow(ctx, query, group.TenantId, group.DisplayName, group.ExternalId, group.CreatedAt, group.UpdatedAt).Scan(&groupId)
+	if err != nil {
+		return groupId, translateGroupUniqueViolation(err)
+	}
+
+	err = insertGroupMembers(ctx, tx, groupId, group.Members)
+	if err != nil {
+		return groupId, err
+	}
+
+	return groupId, tx.Commit(ctx)
+}
+
+// FindGroups pages through the groups of a tenant, attribute and value filter them with eq when attribute is not empty
+func (repository *SCIMRepository) FindGroups(ctx context.Context, tenantId int, attribute string, value string, offset int, limit int) ([]model.Group, int, error) {
+	where := "tenant_id=$1"
+	args := []interface{}{tenantId}
+	if attribute != "" {
+		column, ok := scimGroupFilterColumns[strings.ToLower(attribute)]
+		if !ok {
+			return nil, 0, &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: fmt.Sprintf("Filtering groups by %s is not supported", attribute),
+				Param:   "filter",
+			}
+		}
+		where += fmt.Sprintf(" AND %s=$2", column)
+		args = append(args, value)
+	}
+
+	var total int
+	err := repository.DB.QueryRow(ctx, "SELECT count(*) FROM scim_groups WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf("SELECT id,tenant_id,display_name,COALESCE(external_id,''),created_at,updated_at FROM scim_groups WHERE %s ORDER BY id LIMIT %d OFFSET %d", where, limit, offset)
+	rows, err := repository.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		group := model.Group{}
+		err = rows.Scan(&group.Id, &group.TenantId, &group.DisplayName, &group.ExternalId, &group.CreatedAt, &group.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for i := range groups {
+		groups[i].Members, err = repository.findGroupMembers(ctx, groups[i].Id)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return groups, total, nil
+}
+
+func (repository *SCIMRepository) FindGroup(ctx context.Context, tenantId int, id int) (model.Group, error) {
+	query := "SELECT id,tenant_id,display_name,COALESCE(external_id,''),created_at,updated_at FROM scim_groups WHERE id=$1 AND tenant_id=$2"
+
+	group := model.Group{}
+	err := repository.DB.QueryRow(ctx, query, id, tenantId).Scan(&group.Id, &group.TenantId, &group.DisplayName, &group.ExternalId, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return group, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "Group not found",
+				Param:   "id",
+			}
+		}
+		return group, err
+	}
+
+	group.Members, err = repository.findGroupMembers(ctx, group.Id)
+	return group, err
+}
+
+// UpdateGroup writes the group attributes and replaces its members with group.Members
+func (repository *SCIMRepository) UpdateGroup(ctx context.Context, group model.Group) error {
+	query := "UPDATE scim_groups SET display_name=$1,external_id=NULLIF($2,''),updated_at=$3 WHERE id=$4 AND tenant_id=$5"
+
+	tx, err := repository.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, query, group.DisplayName, group.ExternalId, group.UpdatedAt, group.Id, group.TenantId)
+	if err != nil {
+		return translateGroupUniqueViolation(err)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM scim_group_members WHERE group_id=$1", group.Id)
+	if err != nil {
+		return err
+	}
+
+	err = insertGroupMembers(ctx, tx, group.Id, group.Members)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (repository *SCIMRepository) DeleteGroup(ctx context.Context, tenantId int, id int) error {
+	query := "DELETE FROM scim_groups WHERE id=$1 AND tenant_id=$2"
+
+	_, err := repository.DB.Exec(ctx, query, id, tenantId)
+	return err
+}
+
+// CountTenantUsers counts how many of the user ids belong to the tenant, group members must all belong to it
+func (repository *SCIMRepository) CountTenantUsers(ctx context.Context, tenantId int, userIds []int) (int, error) {
+	query := "SELECT count(*) FROM users WHERE scim_tenant_id=$1 AND id=ANY($2)"
+
+	var count int
+	err := repository.DB.QueryRow(ctx, query, tenantId, userIds).Scan(&count)
+	return count, err
+}
+
+func (repository *SCIMRepository) findGroupMembers(ctx context.Context, groupId int) ([]model.GroupMember, error) {
+	query := `SELECT users.id,COALESCE(users.scim_user_name,users.username) FROM scim_group_members
+		JOIN users ON users.id=scim_group_members.user_id WHERE scim_group_members.group_id=$1 ORDER BY users.id`
+
+	rows, err := repository.DB.Query(ctx, query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.GroupMember{}
+	for rows.Next() {
+		member := model.GroupMember{}
+		err = rows.Scan(&member.UserId, &member.UserName)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+func insertGroupMembers(ctx context.Context, tx pgx.Tx, groupId int, members []model.GroupMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+
+	query := "INSERT INTO scim_group_members (group_id,user_id) SELECT $1,unnest($2::integer[]) ON CONFLICT DO NOTHING"
+	_, err := tx.Exec(ctx, query, groupId, userIds)
+	return err
+}
+
+func translateGroupUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return &model.ValidationError{
+			Code:    constant.ERR_CONFLICT_ERROR,
+			Message: "A group with this display name already exists",
+			Param:   "displayName",
+		}
+	}
+
+	return err
+}
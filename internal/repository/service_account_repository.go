@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type ServiceAccountRepository struct {
+	Log     *zap.Logger
+	DB      *pgxpool.Pool
+	DBCache *redis.Client
+}
+
+func NewServiceAccountRepository(zap *zap.Logger, db *pgxpool.Pool, dbCache *redis.Client) *ServiceAccountRepository {
+	return &ServiceAccountRepository{
+		Log:     zap,
+		DB:      db,
+		DBCache: dbCache,
+	}
+}
+
+func (repository *ServiceAccountRepository) Create(ctx context.Context, serviceAccount model.ServiceAccount) (int, error) {
+	query := "INSERT INTO service_accounts (name,client_id,client_secret,public_key,scopes,owner_id,disabled,created_at,updated_at) VALUES ($1,$2,$3,$4,$5,$6,false,$7,$8) RETURNING id"
+
+	var serviceAccountId int
+	err := repository.DB.QueryRow(ctx, query, serviceAccount.Name, serviceAccount.ClientId, serviceAccount.ClientSecret, serviceAccount.PublicKey,
+		serviceAccount.Scopes, serviceAccount.OwnerId, serviceAccount.CreatedAt, serviceAccount.UpdatedAt).Scan(&serviceAccountId)
+	if err != nil {
+		return serviceAccountId, err
+	}
+
+	return serviceAccountId, nil
+}
+
+func (repository *ServiceAccountRepository) FindAll(ctx context.Context) ([]model.ServiceAccount, error) {
+	query := "SELECT id,name,client_id,client_secret,public_key,scopes,COALESCE(owner_id,0),disabled,created_at,updated_at FROM service_accounts ORDER BY created_at DESC"
+
+	rows, err := repository.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serviceAccounts := []model.ServiceAccount{}
+	for rows.Next() {
+		serviceAccount := model.ServiceAccount{}
+		err = rows.Scan(&serviceAccount.Id, &serviceAccount.Name, &serviceAccount.ClientId, &serviceAccount.ClientSecret, &serviceAccount.PublicKey,
+			&serviceAccount.Scopes, &serviceAccount.OwnerId, &serviceAccount.Disabled, &serviceAccount.CreatedAt, &serviceAccount.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		serviceAccounts = append(serviceAccounts, serviceAccount)
+	}
+
+	return serviceAccounts, rows.Err()
+}
+
+func (repository *ServiceAccountRepository) FindById(ctx context.Context, id int) (model.ServiceAccount, error) {
+	query := "SELECT id,name,client_id,client_secret,public_key,scopes,COALESCE(owner_id,0),disabled,created_at,updated_at FROM service_accounts WHERE id=$1"
+
+	serviceAccount := model.ServiceAccount{}
+	err := repository.DB.QueryRow(ctx, query, id).Scan(&serviceAccount.Id, &serviceAccount.Name, &serviceAccount.ClientId, &serviceAccount.ClientSecret,
+		&serviceAccount.PublicKey, &serviceAccount.Scopes, &serviceAccount.OwnerId, &serviceAccount.Disabled, &serviceAccount.CreatedAt, &serviceAccount.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return serviceAccount, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "Service account is not found",
+				Param:   "serviceAccountId",
+			}
+		}
+		return serviceAccount, err
+	}
+
+	return serviceAccount, nil
+}
+
+func (repository *ServiceAccountRepository) UpdateDisabled(ctx context.Context, id int, disabled bool, updatedAt time.Time) error {
+	query := "UPDATE service_accounts SET disabled=$2,updated_at=$3 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, disabled, updatedAt)
+	return err
+}
+
+func (repository *ServiceAccountRepository) UpdateClientSecret(ctx context.Context, id int, clientSecretHash string, updatedAt time.Time) error {
+	query := "UPDATE service_accounts SET client_secret=$2,updated_at=$3 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, clientSecretHash, updatedAt)
+	return err
+}
+
+func (repository *ServiceAccountRepository) FindByClientId(ctx context.Context, clientId string) (model.ServiceAccount, error) {
+	query := "SELECT id,name,client_id,client_secret,public_key,scopes,COALESCE(owner_id,0),disabled,created_at,updated_at FROM service_accounts WHERE client_id=$1"
+
+	serviceAccount := model.ServiceAccount{}
+	err := repository.DB.QueryRow(ctx, query, clientId).Scan(&serviceAccount.Id, &serviceAccount.Name, &serviceAccount.ClientId, &serviceAccount.ClientSecret,
+		&serviceAccount.PublicKey, &serviceAccount.Scopes, &serviceAccount.OwnerId, &serviceAccount.Disabled, &serviceAccount.CreatedAt, &serviceAccount.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return serviceAccount, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "Service account is not found",
+				Param:   "client_id",
+			}
+		}
+		return serviceAccount, err
+	}
+
+	return serviceAccount, nil
+}
+
+// Redis - Cache
+// SetServiceTokenInCache stores a token and lists it under its service account so all of them can be revoked at once
+func (repository *ServiceAccountRepository) SetServiceTokenInCache(ctx context.Context, jti string, serviceAccountId int, ttl time.Duration) error {
+	key := fmt.Sprintf("auth:serviceToken:%s", jti)
+	serviceAccountTokensKey := fmt.Sprintf("auth:serviceAccountTokens:%d", serviceAccountId)
+
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, serviceAccountId, ttl)
+		pipe.SAdd(ctx, serviceAccountTokensKey, jti)
+		// the index lives as long as the longest lived token, GT alone never sets a TTL on a key that has none
+		pipe.ExpireNX(ctx, serviceAccountTokensKey, ttl)
+		pipe.ExpireGT(ctx, serviceAccountTokensKey, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// GetServiceTokenInCache returns the service account a token was issued to, a missing key means the token expired or was revoked
+func (repository *ServiceAccountRepository) GetServiceTokenInCache(ctx context.Context, jti string) (int, error) {
+	key := fmt.Sprintf("auth:serviceToken:%s", jti)
+
+	value, err := repository.DBCache.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "Token is not found or has been revoked",
+			}
+		}
+		return 0, err
+	}
+
+	return strconv.Atoi(value)
+}
+
+func (repository *ServiceAccountRepository) DeleteServiceTokenInCache(ctx context.Context, jti string) error {
+	key := fmt.Sprintf("auth:serviceToken:%s", jti)
+
+	return repository.DBCache.Del(ctx, key).Err()
+}
+
+// DeleteServiceTokensForAccount revokes every token issued to the service account
+func (repository *ServiceAccountRepository) DeleteServiceTokensForAccount(ctx context.Context, serviceAccountId int) error {
+	serviceAccountTokensKey := fmt.Sprintf("auth:serviceAccountTokens:%d", serviceAccountId)
+
+	jtis, err := repository.DBCache.SMembers(ctx, serviceAccountTokensKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{serviceAccountTokensKey}
+	for _, jti := range jtis {
+		keys = append(keys, fmt.Sprintf("auth:serviceToken:%s", jti))
+	}
+
+	return repository.DBCache.Del(ctx, keys...).Err()
+}
+
+// MarkClientAssertionUsed records the jti of a private_key_jwt assertion until it expires,
+// false means the assertion was already presented once and must be rejected
+func (repository *ServiceAccountRepository) MarkClientAssertionUsed(ctx context.Context, clientId string, jti string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("auth:clientAssertion:%s:%s", clientId, jti)
+
+	return repository.DBCache.SetNX(ctx, key, 1, ttl).Result()
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestServiceAccountRepositoryDeleteServiceTokensForAccount(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewServiceAccountRepository(zap.NewNop(), nil, client)
+	ctx := context.Background()
+
+	for jti, ttl := range map[string]time.Duration{"a": 10 * time.Minute, "b": time.Minute} {
+		err := repository.SetServiceTokenInCache(ctx, jti, 7, ttl)
+		if err != nil {
+			t.Fatalf("SetServiceTokenInCache(%s) = %v", jti, err)
+		}
+	}
+	err := repository.SetServiceTokenInCache(ctx, "other", 8, time.Minute)
+	if err != nil {
+		t.Fatalf("SetServiceTokenInCache(other) = %v", err)
+	}
+
+	if ttl := server.TTL("auth:serviceAccountTokens:7"); ttl != 10*time.Minute {
+		t.Fatalf("index TTL = %v, want the longest token TTL", ttl)
+	}
+
+	err = repository.DeleteServiceTokensForAccount(ctx, 7)
+	if err != nil {
+		t.Fatalf("DeleteServiceTokensForAccount() = %v", err)
+	}
+
+	for _, jti := range []string{"a", "b"} {
+		if _, err := repository.GetServiceTokenInCache(ctx, jti); err == nil {
+			t.Errorf("token %s survived the revocation", jti)
+		}
+	}
+	if _, err := repository.GetServiceTokenInCache(ctx, "other"); err != nil {
+		t.Errorf("token of another account was revoked: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// SessionRepository keeps login sessions in Redis, a session hash is indexed by its refresh token
+// hash and by the owning user so either one can be used to revoke it
+type SessionRepository struct {
+	Log     *zap.Logger
+	DBCache *redis.Client
+}
+
+func NewSessionRepository(zap *zap.Logger, dbCache *redis.Client) *SessionRepository {
+	return &SessionRepository{
+		Log:     zap,
+		DBCache: dbCache,
+	}
+}
+
+// Redis - Cache
+func (repository *SessionRepository) Create(ctx context.Context, session model.Session, refreshTokenHash string) error {
+	sessionKey := fmt.Sprintf("auth:session:%s", session.Id)
+	refreshTokenKey := fmt.Sprintf("auth:refreshToken:%s", refreshTokenHash)
+	userSessionsKey := fmt.Sprintf("auth:userSessions:%d", session.UserId)
+	ttl := time.Until(session.ExpiresAt)
+
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey, map[string]interface{}{
+			"userId":           session.UserId,
+			"authTime":         session.AuthTime.Unix(),
+			"createdAt":        session.CreatedAt.Unix(),
+			"expiresAt":        session.ExpiresAt.Unix(),
+			"refreshTokenHash": refreshTokenHash,
+			"jkt":              session.Jkt,
+			"actorId":          session.ActorId,
+			"locale":           session.Locale,
+		})
+		pipe.Expire(ctx, sessionKey, ttl)
+		pipe.Set(ctx, refreshTokenKey, session.Id, ttl)
+		pipe.SAdd(ctx, userSessionsKey, session.Id)
+		// the index lives as long as the longest lived session, a short impersonation session must not cut it
+		// down. GT alone never sets a TTL on a key that has none, ids of expired sessions in it are harmless
+		pipe.ExpireNX(ctx, userSessionsKey, ttl)
+		pipe.ExpireGT(ctx, userSessionsKey, ttl)
+		return nil
+	})
+
+	return err
+}
+
+func (repository *SessionRepository) Find(ctx context.Context, sessionId string) (model.Session, error) {
+	sessionKey := fmt.Sprintf("auth:session:%s", sessionId)
+
+	values, err := repository.DBCache.HGetAll(ctx, sessionKey).Result()
+	if err != nil {
+		return model.Session{}, err
+	}
+	if len(values) == 0 {
+		return model.Session{}, &model.ValidationError{
+			Code:    constant.ERR_NOT_FOUND_ERROR,
+			Message: "Session is not found or has been revoked",
+			Param:   "accessToken",
+		}
+	}
+
+	userId, _ := strconv.Atoi(values["userId"])
+	authTime, _ := strconv.ParseInt(values["authTime"], 10, 64)
+	createdAt, _ := strconv.ParseInt(values["createdAt"], 10, 64)
+	expiresAt, _ := strconv.ParseInt(values["expiresAt"], 10, 64)
+	// sessions stored before impersonation existed have no actorId and parse to zero
+	actorId, _ := strconv.Atoi(values["actorId"])
+
+	return model.Session{
+		Id:        sessionId,
+		UserId:    userId,
+		Jkt:       values["jkt"],
+		ActorId:   actorId,
+		Locale:    values["locale"],
+		AuthTime:  time.Unix(authTime, 0),
+		CreatedAt: time.Unix(createdAt, 0),
+		ExpiresAt: time.Unix(expiresAt, 0),
+	}, nil
+}
+
+func (repository *SessionRepository) FindIdByRefreshToken(ctx context.Context, refreshTokenHash string) (string, error) {
+	refreshTokenKey := fmt.Sprintf("auth:refreshToken:%s", refreshTokenHash)
+
+	sessionId, err := repository.DBCache.Get(ctx, refreshTokenKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "Refresh token is not found or has been revoked",
+				Param:   "refreshToken",
+			}
+		}
+		return "", err
+	}
+
+	return sessionId, nil
+}
+
+func (repository *SessionRepository) Delete(ctx context.Context, sessionId string) error {
+	sessionKey := fmt.Sprintf("auth:session:%s", sessionId)
+
+	values, err := repository.DBCache.HMGet(ctx, sessionKey, "userId", "refreshTokenHash").Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{sessionKey}
+	if refreshTokenHash, ok := values[1].(string); ok {
+		keys = append(keys, fmt.Sprintf("auth:refreshToken:%s", refreshTokenHash))
+	}
+
+	_, err = repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		if userId, ok := values[0].(string); ok {
+			pipe.SRem(ctx, fmt.Sprintf("auth:userSessions:%s", userId), sessionId)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// setSessionLocale only touches sessions that still exist, HSET alone would recreate an expired one without a TTL
+var setSessionLocale = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], "locale", ARGV[1])
+end
+return 0
+`)
+
+// SetLocaleForUser changes the locale of every live session of the user so a new preference applies right away
+func (repository *SessionRepository) SetLocaleForUser(ctx context.Context, userId int, locale string) error {
+	userSessionsKey := fmt.Sprintf("auth:userSessions:%d", userId)
+
+	sessionIds, err := repository.DBCache.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, sessionId := range sessionIds {
+		err = setSessionLocale.Run(ctx, repository.DBCache, []string{fmt.Sprintf("auth:session:%s", sessionId)}, locale).Err()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAllForUser revokes every session of the user, used when the credentials they were created with change
+func (repository *SessionRepository) DeleteAllForUser(ctx context.Context, userId int) error {
+	userSessionsKey := fmt.Sprintf("auth:userSessions:%d", userId)
+
+	sessionIds, err := repository.DBCache.SMembers(ctx, userSessionsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, sessionId := range sessionIds {
+		err = repository.Delete(ctx, sessionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return repository.DBCache.Del(ctx, userSessionsKey).Err()
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/model"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// an impersonation session of 15 minutes used to shorten the index of a user with a 30 day session, revoking all
+// sessions after that missed the long one
+func TestSessionRepositoryShortSessionKeepsIndex(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewSessionRepository(zap.NewNop(), client)
+	ctx := context.Background()
+	now := time.Now()
+
+	err := repository.Create(ctx, model.Session{Id: "login", UserId: 7, CreatedAt: now, ExpiresAt: now.Add(30 * 24 * time.Hour)}, "login-hash")
+	if err != nil {
+		t.Fatalf("Create(login) = %v", err)
+	}
+	err = repository.Create(ctx, model.Session{Id: "impersonation", UserId: 7, ActorId: 1, CreatedAt: now, ExpiresAt: now.Add(15 * time.Minute)}, "impersonation-hash")
+	if err != nil {
+		t.Fatalf("Create(impersonation) = %v", err)
+	}
+
+	if ttl := server.TTL("auth:userSessions:7"); ttl < 29*24*time.Hour {
+		t.Fatalf("index TTL = %v, want the TTL of the longest session", ttl)
+	}
+
+	server.FastForward(20 * time.Minute)
+
+	err = repository.DeleteAllForUser(ctx, 7)
+	if err != nil {
+		t.Fatalf("DeleteAllForUser() = %v", err)
+	}
+
+	if _, err := repository.Find(ctx, "login"); err == nil {
+		t.Fatal("DeleteAllForUser() missed the login session")
+	}
+	if _, err := repository.FindIdByRefreshToken(ctx, "login-hash"); err == nil {
+		t.Fatal("DeleteAllForUser() left the refresh token of the login session")
+	}
+}
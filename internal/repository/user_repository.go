@@ -6,14 +6,37 @@ import (
 	"cutterproject/internal/model"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+// readStepUpChallenge counts the attempt and reads the challenge in one step, an id that does not exist, or no
+// longer does because another verification consumed it, is not recreated by the count
+var readStepUpChallenge = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return {}
+end
+redis.call("HINCRBY", KEYS[1], "attempts", 1)
+return redis.call("HGETALL", KEYS[1])
+`)
+
+// consumeStepUpChallenge deletes a challenge only while it still holds the code hash the caller verified, so of two
+// requests with the right code only the one that deletes it signs in
+var consumeStepUpChallenge = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "codeHash") ~= ARGV[1] then
+	return 0
+end
+redis.call("DEL", KEYS[1])
+return 1
+`)
+
 type UserRepository struct {
 	Log     *zap.Logger
 	DB      *pgxpool.Pool
@@ -28,58 +51,174 @@ func NewUserRepository(zap *zap.Logger, db *pgxpool.Pool, dbCache *redis.Client)
 	}
 }
 
+const uniqueViolationCode = "23505"
+
+// uniqueConstraintErrors maps the unique constraints of the users table to the conflict reported for them
+var uniqueConstraintErrors = map[string]model.ValidationError{
+	"users_username_key": {
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "Username is already exist",
+		Param:   "username",
+	},
+	"users_username_skeleton_key": {
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "Username is too similar to an existing username",
+		Param:   "username",
+	},
+	"users_email_key": {
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "Email is already exist",
+		Param:   "email",
+	},
+	"users_email_canonical_key": {
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "Email is already exist",
+		Param:   "email",
+	},
+	"users_saml_identity_provider_id_saml_name_id_key": {
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "SAML identity is already linked to an account",
+		Param:   "SAMLResponse",
+	},
+	"users_scim_tenant_id_scim_user_name_key": {
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "User name is already exist",
+		Param:   "userName",
+	},
+}
+
+// scimUserFilterColumns are the SCIM attributes users can be filtered by, keyed by their lowercased name
+var scimUserFilterColumns = map[string]string{
+	"username":     "scim_user_name",
+	"externalid":   "external_id",
+	"emails.value": "email",
+	"emails":       "email",
+}
+
+const scimUserColumns = "id,username,email,active,COALESCE(scim_tenant_id,0),COALESCE(scim_user_name,''),COALESCE(external_id,''),created_at,updated_at"
+
 // Postgresql - Nosql
 func (repository *UserRepository) Register(ctx context.Context, tx pgx.Tx, user model.User) (int, error) {
-	query := "INSERT INTO users (username,email,password,created_at,updated_at) VALUES ($1,$2,$3,$4,$5) RETURNING id"
+	query := "INSERT INTO users (username,username_skeleton,email,email_canonical,password,role,created_at,updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id"
 
 	var userId int
-	err := tx.QueryRow(ctx, query, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&userId)
+	err := tx.QueryRow(ctx, query, user.Username, user.UsernameSkeleton, user.Email, user.EmailCanonical, user.Password, user.Role, user.CreatedAt, user.UpdatedAt).Scan(&userId)
 	if err != nil {
-		return userId, err
+		return userId, repository.uniqueConflicts(ctx, err, user)
 	}
 
 	return userId, nil
 }
 
-func (repository *UserRepository) CheckUsernameOrEmailUnique(ctx context.Context, username string, email string) error {
-	query := "SELECT username,email FROM users WHERE username=$1 OR email=$2 LIMIT 1"
+// UpsertDirectoryUser creates the row of a user managed by an external directory or refreshes its username, email
+// and role. Rows are matched by directory DN, so a local account that happens to share the username or email is
+// never taken over, the insert fails with a conflict instead. Directory users get an empty password so a password
+// login can never match them
+func (repository *UserRepository) UpsertDirectoryUser(ctx context.Context, user model.User) (int, error) {
+	query := `INSERT INTO users (username,username_skeleton,email,email_canonical,password,role,directory_dn,created_at,updated_at) VALUES ($1,$2,$3,$4,'',$5,$6,$7,$8)
+		ON CONFLICT ON CONSTRAINT users_directory_dn_key DO UPDATE SET username=EXCLUDED.username,username_skeleton=EXCLUDED.username_skeleton,
+		email=EXCLUDED.email,email_canonical=EXCLUDED.email_canonical,role=EXCLUDED.role,updated_at=EXCLUDED.updated_at
+		RETURNING id`
 
-	var existUsername string
-	var existEmail string
-	err := repository.DB.QueryRow(ctx, query, username, email).Scan(&existUsername, &existEmail)
+	var userId int
+	err := repository.DB.QueryRow(ctx, query, user.Username, user.UsernameSkeleton, user.Email, user.EmailCanonical, user.Role, user.DirectoryDN, user.CreatedAt, user.UpdatedAt).Scan(&userId)
+	if err != nil {
+		return userId, repository.uniqueConflicts(ctx, err, user)
+	}
+
+	return userId, nil
+}
+
+// GetDirectoryUserId finds the row created for a directory entry, zero when the entry never logged in
+func (repository *UserRepository) GetDirectoryUserId(ctx context.Context, dn string) (int, error) {
+	query := "SELECT id FROM users WHERE directory_dn=$1 LIMIT 1"
+
+	var id int
+	err := repository.DB.QueryRow(ctx, query, dn).Scan(&id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
+	}
+
+	return id, nil
+}
+
+// GetDirectoryDN is the LDAP entry a user was created for, empty for users who do not come from the directory
+func (repository *UserRepository) GetDirectoryDN(ctx context.Context, id int) (string, error) {
+	query := "SELECT COALESCE(directory_dn,'') FROM users WHERE id=$1 LIMIT 1"
+
+	var dn string
+	err := repository.DB.QueryRow(ctx, query, id).Scan(&dn)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil
+			return dn, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User not found",
+				Param:   "userId",
+			}
 		}
-		return err
+		return dn, err
 	}
 
-	if existUsername == username {
-		return &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Username is already exist",
-			Param:   "username",
-		}
+	return dn, nil
+}
+
+// CreateSAMLUser inserts a user who signs in through an identity provider, the empty password never matches a
+// bcrypt hash
+func (repository *UserRepository) CreateSAMLUser(ctx context.Context, user model.User) (int, error) {
+	query := `INSERT INTO users (username,username_skeleton,email,email_canonical,password,role,saml_identity_provider_id,saml_name_id,created_at,updated_at)
+		VALUES ($1,$2,$3,$4,'',$5,$6,$7,$8,$9) RETURNING id`
+
+	var userId int
+	err := repository.DB.QueryRow(ctx, query, user.Username, user.UsernameSkeleton, user.Email, user.EmailCanonical, user.Role,
+		user.SAMLIdentityProviderId, user.SAMLNameId, user.CreatedAt, user.UpdatedAt).Scan(&userId)
+	if err != nil {
+		return userId, repository.uniqueConflicts(ctx, err, user)
 	}
 
-	if existEmail == email {
-		return &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Email is already exist",
-			Param:   "email",
-		}
+	return userId, nil
+}
+
+// GetSAMLUserId finds the user an identity provider knows by nameId, zero when it never logged anyone in by it
+func (repository *UserRepository) GetSAMLUserId(ctx context.Context, identityProviderId int, nameId string) (int, error) {
+	query := "SELECT id FROM users WHERE saml_identity_provider_id=$1 AND saml_name_id=$2 LIMIT 1"
+
+	var id int
+	err := repository.DB.QueryRow(ctx, query, identityProviderId, nameId).Scan(&id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
 	}
 
-	return nil
+	return id, nil
+}
+
+// LinkSAMLUser links the account with exactly the email of subject to the identity provider and returns its id,
+// zero when there is none it may link. Only accounts that already sign in through an identity provider qualify:
+// those without a password or directory entry and no link yet, provisioned by SCIM or by a SAML login from before
+// links were stored. Password, directory and admin accounts are never linked, and neither is an account whose
+// email only shares the canonical form
+func (repository *UserRepository) LinkSAMLUser(ctx context.Context, identityProviderId int, subject model.SAMLSubject, updatedAt time.Time) (int, error) {
+	query := `UPDATE users SET saml_identity_provider_id=$1,saml_name_id=$2,updated_at=$3
+		WHERE email=$4 AND password='' AND directory_dn IS NULL AND saml_identity_provider_id IS NULL AND role<>$5
+		RETURNING id`
+
+	var id int
+	err := repository.DB.QueryRow(ctx, query, identityProviderId, subject.NameId, updatedAt, subject.Email, constant.ROLE_ADMIN).Scan(&id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return id, translateUniqueViolation(err)
+	}
+
+	return id, nil
 }
 
-func (repository *UserRepository) GetUserAuth(ctx context.Context, email string) (int, string, error) {
-	query := "SELECT id,password FROM users WHERE email=$1 LIMIT 1"
+// GetUserAuth finds a user by the canonical form of their email, or by the exact address for rows whose canonical
+// form was written under a different EMAIL_CANONICALIZE_* policy and has not been rewritten yet
+func (repository *UserRepository) GetUserAuth(ctx context.Context, email string, emailCanonical string) (int, string, error) {
+	query := "SELECT id,password FROM users WHERE email_canonical=$1 OR email=$2 ORDER BY email_canonical=$1 DESC LIMIT 1"
 
 	var id int
 	var passwordHash string
 
-	err := repository.DB.QueryRow(ctx, query, email).Scan(&id, &passwordHash)
+	err := repository.DB.QueryRow(ctx, query, emailCanonical, email).Scan(&id, &passwordHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return id, passwordHash, &model.ValidationError{
@@ -94,11 +233,32 @@ func (repository *UserRepository) GetUserAuth(ctx context.Context, email string)
 	return id, passwordHash, nil
 }
 
+func (repository *UserRepository) GetUserAuthByUsername(ctx context.Context, username string) (int, string, error) {
+	query := "SELECT id,password FROM users WHERE username=$1 LIMIT 1"
+
+	var id int
+	var passwordHash string
+
+	err := repository.DB.QueryRow(ctx, query, username).Scan(&id, &passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return id, passwordHash, &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "Username is not found",
+				Param:   "identifier",
+			}
+		}
+		return id, passwordHash, err
+	}
+
+	return id, passwordHash, nil
+}
+
 func (repository *UserRepository) GetUserInfo(ctx context.Context, id int) (model.UserResponse, error) {
-	query := "SELECT id,username,email, created_at,updated_at FROM users WHERE id=$1 LIMIT 1"
+	query := "SELECT id,username,email,role,locale,created_at,updated_at FROM users WHERE id=$1 LIMIT 1"
 
 	user := model.UserResponse{}
-	err := repository.DB.QueryRow(ctx, query, id).Scan(&user.Id, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	err := repository.DB.QueryRow(ctx, query, id).Scan(&user.Id, &user.Username, &user.Email, &user.Role, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return user, &model.ValidationError{
@@ -113,36 +273,439 @@ func (repository *UserRepository) GetUserInfo(ctx context.Context, id int) (mode
 	return user, nil
 }
 
-// Redis - Cache
-func (repository *UserRepository) SetAuthTokenInCache(ctx context.Context, accessToken string, refreeshToken string, userId int) error {
-	accessTokenKey := fmt.Sprintf("auth:acccessToken:%d", userId)
-	refreshTokenKey := fmt.Sprintf("auth:refreshToken:%d", userId)
+// translateUniqueViolation turns a unique_violation (23505) on users into a field specific conflict error,
+// the database constraint is the only uniqueness check so concurrent registrations can not both pass
+func translateUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationCode {
+		return err
+	}
 
-	err := repository.DBCache.Set(ctx, accessTokenKey, accessToken, 15*time.Minute).Err()
-	if err != nil {
+	conflictErr, ok := uniqueConstraintErrors[pgErr.ConstraintName]
+	if !ok {
 		return err
 	}
 
-	err = repository.DBCache.Set(ctx, refreshTokenKey, refreeshToken, 15*time.Minute).Err()
+	return &conflictErr
+}
+
+// uniqueConflicts reports every unique field of user that is taken once a write violated one of them, a
+// violation only names the first constraint it hit and the client would otherwise learn about the next field
+// on its next attempt. Fields of user that are empty are not checked, neither is the row of user itself, found
+// by its id or directory DN
+func (repository *UserRepository) uniqueConflicts(ctx context.Context, err error, user model.User) error {
+	conflictErr := translateUniqueViolation(err)
+	var validationErr *model.ValidationError
+	if !errors.As(conflictErr, &validationErr) || validationErr.Code != constant.ERR_CONFLICT_ERROR {
+		return conflictErr
+	}
+
+	query := `SELECT COALESCE(bool_or(username=$1),false),COALESCE(bool_or(username_skeleton=$2),false),COALESCE(bool_or(email_canonical=$3),false)
+		FROM users WHERE (username=NULLIF($1,'') OR username_skeleton=NULLIF($2,'') OR email_canonical=NULLIF($3,'')) AND id<>$4 AND ($5='' OR directory_dn IS DISTINCT FROM $5)`
+
+	var usernameTaken, skeletonTaken, emailTaken bool
+	queryErr := repository.DB.QueryRow(ctx, query, user.Username, user.UsernameSkeleton, user.EmailCanonical, user.Id, user.DirectoryDN).Scan(&usernameTaken, &skeletonTaken, &emailTaken)
+	if queryErr != nil {
+		repository.Log.Warn("Failed to look up conflicting users", zap.Error(queryErr))
+		return conflictErr
+	}
+
+	fieldErrors := []model.FieldError{}
+	switch {
+	case usernameTaken:
+		fieldErrors = append(fieldErrors, model.FieldError{Param: "username", Code: constant.FIELD_ERR_TAKEN, Message: "Username is already exist", Label: "Username"})
+	case skeletonTaken:
+		fieldErrors = append(fieldErrors, model.FieldError{Param: "username", Code: constant.FIELD_ERR_TOO_SIMILAR, Message: "Username is too similar to an existing username", Label: "Username"})
+	}
+	if emailTaken {
+		fieldErrors = append(fieldErrors, model.FieldError{Param: "email", Code: constant.FIELD_ERR_TAKEN, Message: "Email is already exist", Label: "Email"})
+	}
+
+	// the conflicting row may belong to a transaction that has not committed yet
+	if len(fieldErrors) == 0 {
+		return conflictErr
+	}
+
+	return &model.ValidationError{
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: fieldErrors[0].Message,
+		Param:   fieldErrors[0].Param,
+		Errors:  fieldErrors,
+	}
+}
+
+func (repository *UserRepository) GetUserRole(ctx context.Context, id int) (string, error) {
+	query := "SELECT role FROM users WHERE id=$1 LIMIT 1"
+
+	var role string
+	err := repository.DB.QueryRow(ctx, query, id).Scan(&role)
 	if err != nil {
-		return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return role, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User not found",
+				Param:   "userId",
+			}
+		}
+		return role, err
+	}
+
+	return role, nil
+}
+
+func (repository *UserRepository) GetUserPassword(ctx context.Context, id int) (string, error) {
+	query := "SELECT password FROM users WHERE id=$1 LIMIT 1"
+
+	var passwordHash string
+	err := repository.DB.QueryRow(ctx, query, id).Scan(&passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return passwordHash, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User not found",
+				Param:   "userId",
+			}
+		}
+		return passwordHash, err
+	}
+
+	return passwordHash, nil
+}
+
+func (repository *UserRepository) UpdatePassword(ctx context.Context, id int, passwordHash string, updatedAt time.Time) error {
+	query := "UPDATE users SET password=$2,updated_at=$3 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, passwordHash, updatedAt)
+	return err
+}
+
+func (repository *UserRepository) UpdateEmail(ctx context.Context, id int, email string, emailCanonical string, updatedAt time.Time) error {
+	query := "UPDATE users SET email=$2,email_canonical=$3,updated_at=$4 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, email, emailCanonical, updatedAt)
+	if err != nil {
+		return repository.uniqueConflicts(ctx, err, model.User{Id: id, EmailCanonical: emailCanonical})
 	}
 
 	return nil
 }
 
-func (repository *UserRepository) GetAccessTokenInCache(ctx context.Context, userId int) (string, error) {
-	accessTokenKey := fmt.Sprintf("auth:acccessToken:%d", userId)
-	token, err := repository.DBCache.Get(ctx, accessTokenKey).Result()
+// FindIdentities pages through the identity columns of all users by id, afterId is the last id of the previous page
+func (repository *UserRepository) FindIdentities(ctx context.Context, afterId int, limit int) ([]model.User, error) {
+	query := "SELECT id,username,username_skeleton,email,email_canonical FROM users WHERE id>$1 ORDER BY id LIMIT $2"
+
+	rows, err := repository.DB.Query(ctx, query, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user := model.User{}
+		err = rows.Scan(&user.Id, &user.Username, &user.UsernameSkeleton, &user.Email, &user.EmailCanonical)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (repository *UserRepository) UpdateEmailCanonical(ctx context.Context, id int, emailCanonical string) error {
+	query := "UPDATE users SET email_canonical=$2 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, emailCanonical)
+	return translateUniqueViolation(err)
+}
+
+func (repository *UserRepository) UpdateUsernameSkeleton(ctx context.Context, id int, usernameSkeleton string) error {
+	query := "UPDATE users SET username_skeleton=$2 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, usernameSkeleton)
+	return translateUniqueViolation(err)
+}
+
+// GetBackfillFingerprint is the policy the named backfill last completed with, empty when it never ran
+func (repository *UserRepository) GetBackfillFingerprint(ctx context.Context, name string) (string, error) {
+	query := "SELECT fingerprint FROM identity_backfills WHERE name=$1"
+
+	var fingerprint string
+	err := repository.DB.QueryRow(ctx, query, name).Scan(&fingerprint)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+
+	return fingerprint, err
+}
+
+func (repository *UserRepository) SetBackfillFingerprint(ctx context.Context, name string, fingerprint string, updatedAt time.Time) error {
+	query := `INSERT INTO identity_backfills (name,fingerprint,updated_at) VALUES ($1,$2,$3)
+		ON CONFLICT (name) DO UPDATE SET fingerprint=EXCLUDED.fingerprint,updated_at=EXCLUDED.updated_at`
+
+	_, err := repository.DB.Exec(ctx, query, name, fingerprint, updatedAt)
+	return err
+}
+
+// LockBackfill keeps other processes out of the named backfill until unlock is called, ok is false when another
+// process holds the lock. The advisory lock belongs to the connection, so one is held for the whole run
+func (repository *UserRepository) LockBackfill(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := repository.DB.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ok bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&ok)
+	if err != nil || !ok {
+		conn.Release()
+		return nil, false, err
+	}
+
+	unlock := func() {
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+		if err != nil {
+			repository.Log.Warn("Failed to release backfill lock", zap.String("name", name), zap.Error(err))
+		}
+		conn.Release()
+	}
+
+	return unlock, true, nil
+}
+
+func (repository *UserRepository) UpdateLocale(ctx context.Context, id int, locale string, updatedAt time.Time) error {
+	query := "UPDATE users SET locale=$2,updated_at=$3 WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id, locale, updatedAt)
+	return err
+}
+
+func (repository *UserRepository) Delete(ctx context.Context, id int) error {
+	query := "DELETE FROM users WHERE id=$1"
+
+	_, err := repository.DB.Exec(ctx, query, id)
+	return err
+}
+
+// IsActive reports whether the user may log in, deactivated users keep their row but not their access
+func (repository *UserRepository) IsActive(ctx context.Context, id int) (bool, error) {
+	query := "SELECT active FROM users WHERE id=$1"
+
+	var active bool
+	err := repository.DB.QueryRow(ctx, query, id).Scan(&active)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User not found",
+				Param:   "userId",
+			}
+		}
+		return false, err
+	}
+
+	return active, nil
+}
+
+// CreateSCIMUser inserts a user managed by a SCIM tenant, the empty password never matches a bcrypt hash
+func (repository *UserRepository) CreateSCIMUser(ctx context.Context, user model.User) (int, error) {
+	query := `INSERT INTO users (username,username_skeleton,email,email_canonical,password,role,active,scim_tenant_id,scim_user_name,external_id,created_at,updated_at)
+		VALUES ($1,$2,$3,$4,'',$5,$6,$7,$8,NULLIF($9,''),$10,$11) RETURNING id`
+
+	var userId int
+	err := repository.DB.QueryRow(ctx, query, user.Username, user.UsernameSkeleton, user.Email, user.EmailCanonical, user.Role, user.Active,
+		user.SCIMTenantId, user.SCIMUserName, user.ExternalId, user.CreatedAt, user.UpdatedAt).Scan(&userId)
+	if err != nil {
+		return userId, translateUniqueViolation(err)
+	}
+
+	return userId, nil
+}
+
+// FindSCIMUsers pages through the users of a tenant, attribute and value filter them with eq when attribute is not empty
+func (repository *UserRepository) FindSCIMUsers(ctx context.Context, tenantId int, attribute string, value string, offset int, limit int) ([]model.User, int, error) {
+	where := "scim_tenant_id=$1"
+	args := []interface{}{tenantId}
+	if attribute != "" {
+		column, ok := scimUserFilterColumns[strings.ToLower(attribute)]
+		if !ok {
+			return nil, 0, &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: fmt.Sprintf("Filtering users by %s is not supported", attribute),
+				Param:   "filter",
+			}
+		}
+		where += fmt.Sprintf(" AND %s=$2", column)
+		args = append(args, value)
+	}
+
+	var total int
+	err := repository.DB.QueryRow(ctx, "SELECT count(*) FROM users WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM users WHERE %s ORDER BY id LIMIT %d OFFSET %d", scimUserColumns, where, limit, offset)
+	rows, err := repository.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user := model.User{}
+		err = rows.Scan(&user.Id, &user.Username, &user.Email, &user.Active, &user.SCIMTenantId, &user.SCIMUserName, &user.ExternalId, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+func (repository *UserRepository) FindSCIMUser(ctx context.Context, tenantId int, id int) (model.User, error) {
+	query := fmt.Sprintf("SELECT %s FROM users WHERE id=$1 AND scim_tenant_id=$2", scimUserColumns)
+
+	user := model.User{}
+	err := repository.DB.QueryRow(ctx, query, id, tenantId).Scan(&user.Id, &user.Username, &user.Email, &user.Active, &user.SCIMTenantId,
+		&user.SCIMUserName, &user.ExternalId, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User not found",
+				Param:   "id",
+			}
+		}
+		return user, err
+	}
+
+	return user, nil
+}
+
+// UpdateSCIMUser writes the attributes a SCIM tenant manages, the username chosen at creation stays as it is
+func (repository *UserRepository) UpdateSCIMUser(ctx context.Context, user model.User) error {
+	query := `UPDATE users SET scim_user_name=$1,external_id=NULLIF($2,''),email=$3,email_canonical=$4,active=$5,updated_at=$6
+		WHERE id=$7 AND scim_tenant_id=$8`
+
+	_, err := repository.DB.Exec(ctx, query, user.SCIMUserName, user.ExternalId, user.Email, user.EmailCanonical, user.Active, user.UpdatedAt,
+		user.Id, user.SCIMTenantId)
+	return translateUniqueViolation(err)
+}
+
+// DetachSCIMUser deactivates a user and removes it from its tenant and the tenant's groups, the row is kept for the login and audit history
+func (repository *UserRepository) DetachSCIMUser(ctx context.Context, tenantId int, id int, updatedAt time.Time) error {
+	query := `WITH memberships AS (
+			DELETE FROM scim_group_members WHERE user_id=$2 AND group_id IN (SELECT id FROM scim_groups WHERE tenant_id=$3)
+		)
+		UPDATE users SET active=false,scim_tenant_id=NULL,scim_user_name=NULL,updated_at=$1 WHERE id=$2 AND scim_tenant_id=$3`
+
+	_, err := repository.DB.Exec(ctx, query, updatedAt, id, tenantId)
+	return err
+}
+
+// Redis - Cache
+func (repository *UserRepository) SetMagicLinkInCache(ctx context.Context, linkId string, userId int, ttl time.Duration) error {
+	magicLinkKey := fmt.Sprintf("auth:magicLink:%s", linkId)
+
+	return repository.DBCache.Set(ctx, magicLinkKey, userId, ttl).Err()
+}
+
+// TakeMagicLinkInCache deletes the link while reading it so every magic link can be redeemed only once
+func (repository *UserRepository) TakeMagicLinkInCache(ctx context.Context, linkId string) (int, error) {
+	magicLinkKey := fmt.Sprintf("auth:magicLink:%s", linkId)
+
+	userId, err := repository.DBCache.GetDel(ctx, magicLinkKey).Int()
 	if err == redis.Nil {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_NOT_FOUND_ERROR,
-			Message: "Authorization token not found or expired",
-			Param:   "accessToken",
+		return userId, &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "Magic link is invalid, expired or already used",
+			Param:   "token",
 		}
 	} else if err != nil {
-		return token, err
+		return userId, err
 	}
 
-	return token, nil
+	return userId, nil
+}
+
+func (repository *UserRepository) SetStepUpChallengeInCache(ctx context.Context, challengeId string, challenge model.StepUpChallenge, ttl time.Duration) error {
+	stepUpKey := fmt.Sprintf("auth:stepUp:%s", challengeId)
+
+	_, err := repository.DBCache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, stepUpKey, map[string]interface{}{
+			"userId":   challenge.UserId,
+			"codeHash": challenge.CodeHash,
+			"ip":       challenge.Signals.IP,
+			"country":  challenge.Signals.Country,
+			"deviceId": challenge.Signals.DeviceId,
+			"attempts": 0,
+		})
+		pipe.Expire(ctx, stepUpKey, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// GetStepUpChallengeInCache counts every read as a verification attempt and returns the attempts made so far
+func (repository *UserRepository) GetStepUpChallengeInCache(ctx context.Context, challengeId string) (model.StepUpChallenge, int, error) {
+	stepUpKey := fmt.Sprintf("auth:stepUp:%s", challengeId)
+	challenge := model.StepUpChallenge{}
+
+	fields, err := readStepUpChallenge.Run(ctx, repository.DBCache, []string{stepUpKey}).StringSlice()
+	if err != nil {
+		return challenge, 0, err
+	}
+	if len(fields) == 0 {
+		return challenge, 0, &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "Verification challenge is not found or expired",
+			Param:   "challengeId",
+		}
+	}
+
+	values := map[string]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		values[fields[i]] = fields[i+1]
+	}
+
+	attempts, err := strconv.Atoi(values["attempts"])
+	if err != nil {
+		return challenge, 0, err
+	}
+	challenge.UserId, err = strconv.Atoi(values["userId"])
+	if err != nil {
+		return challenge, 0, err
+	}
+	challenge.CodeHash = values["codeHash"]
+	challenge.Signals = model.LoginSignals{
+		IP:       values["ip"],
+		Country:  values["country"],
+		DeviceId: values["deviceId"],
+	}
+
+	return challenge, attempts, nil
+}
+
+// ConsumeStepUpChallengeInCache reports whether this call used up the challenge, false means it expired or another
+// verification consumed it first
+func (repository *UserRepository) ConsumeStepUpChallengeInCache(ctx context.Context, challengeId string, codeHash string) (bool, error) {
+	stepUpKey := fmt.Sprintf("auth:stepUp:%s", challengeId)
+
+	consumed, err := consumeStepUpChallenge.Run(ctx, repository.DBCache, []string{stepUpKey}, codeHash).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return consumed == 1, nil
+}
+
+func (repository *UserRepository) DeleteStepUpChallengeInCache(ctx context.Context, challengeId string) error {
+	stepUpKey := fmt.Sprintf("auth:stepUp:%s", challengeId)
+
+	return repository.DBCache.Del(ctx, stepUpKey).Err()
 }
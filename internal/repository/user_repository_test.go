@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestUserRepositoryConsumeStepUpChallenge(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewUserRepository(zap.NewNop(), nil, client)
+	ctx := context.Background()
+
+	err := repository.SetStepUpChallengeInCache(ctx, "challenge", model.StepUpChallenge{UserId: 7, CodeHash: "hash"}, time.Minute)
+	if err != nil {
+		t.Fatalf("SetStepUpChallengeInCache() = %v", err)
+	}
+
+	consumed, err := repository.ConsumeStepUpChallengeInCache(ctx, "challenge", "other")
+	if err != nil || consumed {
+		t.Fatalf("ConsumeStepUpChallengeInCache() with another hash = %t, %v, want false", consumed, err)
+	}
+	if !server.Exists("auth:stepUp:challenge") {
+		t.Fatal("a mismatched hash deleted the challenge")
+	}
+
+	consumed, err = repository.ConsumeStepUpChallengeInCache(ctx, "challenge", "hash")
+	if err != nil || !consumed {
+		t.Fatalf("ConsumeStepUpChallengeInCache() = %t, %v, want true", consumed, err)
+	}
+	if server.Exists("auth:stepUp:challenge") {
+		t.Fatal("the consumed challenge still exists")
+	}
+
+	consumed, err = repository.ConsumeStepUpChallengeInCache(ctx, "challenge", "hash")
+	if err != nil || consumed {
+		t.Fatalf("ConsumeStepUpChallengeInCache() a second time = %t, %v, want false", consumed, err)
+	}
+}
+
+func TestUserRepositoryTakeMagicLink(t *testing.T) {
+	server, client := newTestRedis(t)
+	repository := NewUserRepository(zap.NewNop(), nil, client)
+	ctx := context.Background()
+
+	for _, linkId := range []string{"first", "second", "expired"} {
+		err := repository.SetMagicLinkInCache(ctx, linkId, 7, time.Minute)
+		if err != nil {
+			t.Fatalf("SetMagicLinkInCache() = %v", err)
+		}
+	}
+
+	userId, err := repository.TakeMagicLinkInCache(ctx, "first")
+	if err != nil || userId != 7 {
+		t.Fatalf("TakeMagicLinkInCache() = %d, %v, want 7", userId, err)
+	}
+	if _, err := repository.TakeMagicLinkInCache(ctx, "first"); validationCode(err) != constant.ERR_UNATHORIZED_ERROR {
+		t.Fatalf("TakeMagicLinkInCache() a second time = %v, want %s", err, constant.ERR_UNATHORIZED_ERROR)
+	}
+
+	// concurrent redemptions of one link
+	results := make(chan error, 5)
+	for range 5 {
+		go func() {
+			_, err := repository.TakeMagicLinkInCache(ctx, "second")
+			results <- err
+		}()
+	}
+	taken := 0
+	for range 5 {
+		if err := <-results; err == nil {
+			taken++
+		} else if validationCode(err) != constant.ERR_UNATHORIZED_ERROR {
+			t.Errorf("TakeMagicLinkInCache() = %v", err)
+		}
+	}
+	if taken != 1 {
+		t.Errorf("the link was taken %d times, want 1", taken)
+	}
+
+	server.FastForward(time.Minute)
+	if _, err := repository.TakeMagicLinkInCache(ctx, "expired"); validationCode(err) != constant.ERR_UNATHORIZED_ERROR {
+		t.Fatalf("TakeMagicLinkInCache() after the TTL = %v, want %s", err, constant.ERR_UNATHORIZED_ERROR)
+	}
+}
+
+func validationCode(err error) string {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
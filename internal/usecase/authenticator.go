@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	AuthenticatorPassword = "password"
+	AuthenticatorLDAP     = "ldap"
+)
+
+// Authenticator checks the credentials of a login and returns the id of the users row they belong to.
+// When the account is known but the password is wrong the id is returned together with the error
+// so the failed attempt can still be recorded in the login history
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, identifier string, password string) (int, error)
+	// Reauthenticate checks the password of a logged in user against the identity stored with their row, the
+	// username may no longer be what the backend knows them by
+	Reauthenticate(ctx context.Context, userId int, password string) error
+	// ManagesPasswords is false when passwords live outside of the users table and cannot be changed here
+	ManagesPasswords() bool
+}
+
+// PasswordAuthenticator checks the bcrypt password hash stored with the user
+type PasswordAuthenticator struct {
+	UserRepository *repository.UserRepository
+	EmailPolicy    *util.EmailPolicy
+}
+
+func NewPasswordAuthenticator(userRepository *repository.UserRepository, emailPolicy *util.EmailPolicy) *PasswordAuthenticator {
+	return &PasswordAuthenticator{
+		UserRepository: userRepository,
+		EmailPolicy:    emailPolicy,
+	}
+}
+
+func (authenticator *PasswordAuthenticator) Name() string {
+	return AuthenticatorPassword
+}
+
+func (authenticator *PasswordAuthenticator) ManagesPasswords() bool {
+	return true
+}
+
+func (authenticator *PasswordAuthenticator) Authenticate(ctx context.Context, identifier string, password string) (int, error) {
+	userId, passwordHash, err := authenticator.getUserAuthByIdentifier(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+	if err != nil {
+		return userId, errIncorrectPassword()
+	}
+
+	return userId, nil
+}
+
+func (authenticator *PasswordAuthenticator) Reauthenticate(ctx context.Context, userId int, password string) error {
+	passwordHash, err := authenticator.UserRepository.GetUserPassword(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+	if err != nil {
+		return errIncorrectPassword()
+	}
+
+	return nil
+}
+
+// getUserAuthByIdentifier treats identifiers containing '@' as emails and everything else as usernames
+func (authenticator *PasswordAuthenticator) getUserAuthByIdentifier(ctx context.Context, identifier string) (int, string, error) {
+	if strings.Contains(identifier, "@") {
+		email, err := util.NormalizeEmail(identifier)
+		if err != nil {
+			return 0, "", &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "Email is not a valid email address",
+				Param:   "identifier",
+			}
+		}
+
+		return authenticator.UserRepository.GetUserAuth(ctx, email, authenticator.EmailPolicy.Canonicalize(email))
+	}
+
+	username, err := util.NormalizeUsername(identifier)
+	if err != nil && !errors.Is(err, util.ErrUsernameReserved) {
+		return 0, "", &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Username is not valid",
+			Param:   "identifier",
+		}
+	} else if err != nil {
+		username = identifier
+	}
+
+	return authenticator.UserRepository.GetUserAuthByUsername(ctx, username)
+}
+
+func errIncorrectPassword() error {
+	return &model.ValidationError{
+		Code:    constant.ERR_VALIDATION_CODE,
+		Message: "Password is incorrect",
+		Param:   "password",
+	}
+}
@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"errors"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// backfillBatch is how many users one page of a backfill reads
+var backfillBatch = 500
+
+// BackfillUsecase keeps the identity columns derived in Go in step with the code deriving them. SQL can not
+// reproduce EmailPolicy.Canonicalize or util.UsernameSkeleton, so migrations only seed these columns and Run
+// rewrites them whenever the fingerprint of the policy differs from the one the last run completed with
+type BackfillUsecase struct {
+	UserRepository *repository.UserRepository
+	EmailPolicy    *util.EmailPolicy
+	Log            *zap.Logger
+	Config         *koanf.Koanf
+}
+
+func NewBackfillUsecase(userRepository *repository.UserRepository, emailPolicy *util.EmailPolicy, zap *zap.Logger, koanf *koanf.Koanf) *BackfillUsecase {
+	return &BackfillUsecase{
+		UserRepository: userRepository,
+		EmailPolicy:    emailPolicy,
+		Log:            zap,
+		Config:         koanf,
+	}
+}
+
+// identityBackfill rewrites one derived column, derive returns the stored and the derived value of a user and
+// write is only called when they differ
+type identityBackfill struct {
+	name        string
+	fingerprint string
+	derive      func(user model.User) (string, string)
+	write       func(ctx context.Context, id int, value string) error
+}
+
+// Run brings every backfill up to date, logins keep working meanwhile through the exact email fallback of
+// UserRepository.GetUserAuth
+func (usecase *BackfillUsecase) Run(ctx context.Context) {
+	backfills := []identityBackfill{
+		{
+			name:        constant.BACKFILL_EMAIL_CANONICAL,
+			fingerprint: usecase.EmailPolicy.Fingerprint(),
+			derive: func(user model.User) (string, string) {
+				return user.EmailCanonical, usecase.EmailPolicy.Canonicalize(user.Email)
+			},
+			write: usecase.UserRepository.UpdateEmailCanonical,
+		},
+		{
+			name:        constant.BACKFILL_USERNAME_SKELETON,
+			fingerprint: util.UsernameSkeletonVersion,
+			derive: func(user model.User) (string, string) {
+				return user.UsernameSkeleton, util.UsernameSkeleton(user.Username)
+			},
+			write: usecase.UserRepository.UpdateUsernameSkeleton,
+		},
+	}
+
+	for _, backfill := range backfills {
+		err := usecase.run(ctx, backfill)
+		if err != nil {
+			usecase.Log.Error("Backfill failed", zap.String("name", backfill.name), zap.Error(err))
+		}
+	}
+}
+
+// run rewrites the column when the fingerprint changed. A user whose new value is taken by another user keeps
+// the old one and is logged, the first user by id wins the value
+func (usecase *BackfillUsecase) run(ctx context.Context, backfill identityBackfill) error {
+	current, err := usecase.UserRepository.GetBackfillFingerprint(ctx, backfill.name)
+	if err != nil || current == backfill.fingerprint {
+		return err
+	}
+
+	unlock, ok, err := usecase.UserRepository.LockBackfill(ctx, backfill.name)
+	if err != nil || !ok {
+		return err
+	}
+	defer unlock()
+
+	// another process may have finished while this one took the lock
+	current, err = usecase.UserRepository.GetBackfillFingerprint(ctx, backfill.name)
+	if err != nil || current == backfill.fingerprint {
+		return err
+	}
+
+	log := usecase.Log.With(zap.String("name", backfill.name))
+	log.Info("Backfill started", zap.String("from", current), zap.String("to", backfill.fingerprint))
+
+	var validationErr *model.ValidationError
+	rewritten, conflicts, afterId := 0, 0, 0
+	for {
+		users, err := usecase.UserRepository.FindIdentities(ctx, afterId, backfillBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			afterId = user.Id
+
+			stored, derived := backfill.derive(user)
+			if stored == derived {
+				continue
+			}
+
+			err = backfill.write(ctx, user.Id, derived)
+			if errors.As(err, &validationErr) {
+				conflicts++
+				log.Warn("Backfill value is taken by another user, keeping the old one", zap.Int("userId", user.Id), zap.String("value", derived))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			rewritten++
+		}
+
+		if len(users) < backfillBatch {
+			break
+		}
+	}
+
+	log.Info("Backfill finished", zap.Int("rewritten", rewritten), zap.Int("conflicts", conflicts))
+
+	return usecase.UserRepository.SetBackfillFingerprint(ctx, backfill.name, backfill.fingerprint, time.Now())
+}
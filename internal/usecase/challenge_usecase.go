@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/hex"
+	"encoding/json"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	ChallengeTTL                  = 2 * time.Minute
+	ChallengeFailureWindow        = 15 * time.Minute
+	DefaultChallengeDifficulty    = 16
+	DefaultChallengeMaxDifficulty = 24
+	HCaptchaVerifyURL             = "https://api.hcaptcha.com/siteverify"
+	TurnstileVerifyURL            = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// ChallengeVerifier is implemented by every challenge backend, it also keeps the failure counts a backend may
+// scale its challenges with. A fake implementation can be handed to NewChallengeUsecase to exercise the flow
+// without Redis or a third party service
+type ChallengeVerifier interface {
+	Issue(ctx context.Context, ip string) (model.ChallengeResponse, error)
+	Verify(ctx context.Context, solution model.ChallengeSolution) error
+	RecordFailure(ctx context.Context, ip string) error
+}
+
+type ChallengeUsecase struct {
+	Verifier ChallengeVerifier
+	Log      *zap.Logger
+	Config   *koanf.Koanf
+}
+
+// NewChallengeUsecase takes a nil verifier when challenges are disabled
+func NewChallengeUsecase(verifier ChallengeVerifier, zap *zap.Logger, koanf *koanf.Koanf) *ChallengeUsecase {
+	return &ChallengeUsecase{
+		Verifier: verifier,
+		Log:      zap,
+		Config:   koanf,
+	}
+}
+
+// NewProofOfWorkVerifier reads CHALLENGE_BASE_DIFFICULTY and CHALLENGE_MAX_DIFFICULTY
+func NewProofOfWorkVerifier(challengeRepository *repository.ChallengeRepository, koanf *koanf.Koanf) *ProofOfWorkVerifier {
+	baseDifficulty := koanf.Int("CHALLENGE_BASE_DIFFICULTY")
+	if baseDifficulty <= 0 {
+		baseDifficulty = DefaultChallengeDifficulty
+	}
+
+	maxDifficulty := koanf.Int("CHALLENGE_MAX_DIFFICULTY")
+	if maxDifficulty < baseDifficulty {
+		maxDifficulty = max(DefaultChallengeMaxDifficulty, baseDifficulty)
+	}
+
+	return &ProofOfWorkVerifier{
+		ChallengeRepository: challengeRepository,
+		BaseDifficulty:      baseDifficulty,
+		MaxDifficulty:       maxDifficulty,
+	}
+}
+
+// NewSiteVerifyVerifier reads the CHALLENGE_* settings of hCaptcha and Turnstile, CHALLENGE_VERIFY_URL defaults
+// to the provider's siteverify endpoint
+func NewSiteVerifyVerifier(provider string, koanf *koanf.Koanf) *SiteVerifyVerifier {
+	verifyURL := koanf.String("CHALLENGE_VERIFY_URL")
+	if verifyURL == "" {
+		verifyURL = HCaptchaVerifyURL
+		if provider == constant.CHALLENGE_PROVIDER_TURNSTILE {
+			verifyURL = TurnstileVerifyURL
+		}
+	}
+
+	return &SiteVerifyVerifier{
+		Provider:  provider,
+		VerifyURL: verifyURL,
+		SiteKey:   koanf.String("CHALLENGE_SITE_KEY"),
+		SecretKey: koanf.String("CHALLENGE_SECRET_KEY"),
+		Client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (usecase *ChallengeUsecase) Enabled() bool {
+	return usecase.Verifier != nil
+}
+
+func (usecase *ChallengeUsecase) Issue(ctx *fiber.Ctx) (model.ChallengeResponse, error) {
+	if !usecase.Enabled() {
+		return model.ChallengeResponse{Provider: constant.CHALLENGE_PROVIDER_NONE}, nil
+	}
+
+	return usecase.Verifier.Issue(ctx.Context(), util.ClientIP(ctx))
+}
+
+func (usecase *ChallengeUsecase) Verify(ctx *fiber.Ctx, challenge string, solution string) error {
+	if !usecase.Enabled() {
+		return nil
+	}
+
+	if solution == "" {
+		return &model.ValidationError{
+			Code:    constant.ERR_CHALLENGE_REQUIRED_ERROR,
+			Message: "Challenge solution is required",
+			Param:   "challenge",
+		}
+	}
+
+	return usecase.Verifier.Verify(ctx.Context(), model.ChallengeSolution{
+		Challenge: challenge,
+		Solution:  solution,
+		RemoteIP:  util.ClientIP(ctx),
+	})
+}
+
+// RecordFailure counts a failed attempt of the client, the proof of work difficulty is scaled from these counts
+func (usecase *ChallengeUsecase) RecordFailure(ctx *fiber.Ctx) {
+	if !usecase.Enabled() {
+		return
+	}
+
+	err := usecase.Verifier.RecordFailure(ctx.Context(), util.ClientIP(ctx))
+	if err != nil {
+		util.Logger(ctx, usecase.Log).Warn("Failed to record authentication failure", zap.String("ip", util.ClientIP(ctx)), zap.Error(err))
+	}
+}
+
+// ProofOfWorkVerifier issues random challenges kept in Redis, a solution is valid when
+// SHA-256("<challenge>:<solution>") starts with at least difficulty zero bits
+type ProofOfWorkVerifier struct {
+	ChallengeRepository *repository.ChallengeRepository
+	BaseDifficulty      int
+	MaxDifficulty       int
+}
+
+func (verifier *ProofOfWorkVerifier) Issue(ctx context.Context, ip string) (model.ChallengeResponse, error) {
+	failures, err := verifier.ChallengeRepository.GetFailureCount(ctx, ip)
+	if err != nil {
+		return model.ChallengeResponse{}, err
+	}
+
+	// every doubling of recent failures costs the client one more bit, roughly twice the work
+	difficulty := min(verifier.BaseDifficulty+bits.Len(uint(failures)), verifier.MaxDifficulty)
+
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return model.ChallengeResponse{}, err
+	}
+	challenge := hex.EncodeToString(buf)
+
+	err = verifier.ChallengeRepository.SetChallenge(ctx, challenge, difficulty, ChallengeTTL)
+	if err != nil {
+		return model.ChallengeResponse{}, err
+	}
+
+	return model.ChallengeResponse{
+		Provider:   constant.CHALLENGE_PROVIDER_POW,
+		Challenge:  challenge,
+		Algorithm:  "sha256",
+		Difficulty: difficulty,
+		ExpiresIn:  int(ChallengeTTL.Seconds()),
+	}, nil
+}
+
+func (verifier *ProofOfWorkVerifier) Verify(ctx context.Context, solution model.ChallengeSolution) error {
+	if solution.Challenge == "" {
+		return &model.ValidationError{
+			Code:    constant.ERR_CHALLENGE_REQUIRED_ERROR,
+			Message: "Challenge is required",
+			Param:   "challenge",
+		}
+	}
+
+	difficulty, err := verifier.ChallengeRepository.TakeChallenge(ctx, solution.Challenge)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(solution.Challenge + ":" + solution.Solution))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return &model.ValidationError{
+			Code:    constant.ERR_CHALLENGE_FAILED_ERROR,
+			Message: "Challenge solution is incorrect",
+			Param:   "challenge",
+		}
+	}
+
+	return nil
+}
+
+func (verifier *ProofOfWorkVerifier) RecordFailure(ctx context.Context, ip string) error {
+	return verifier.ChallengeRepository.IncrementFailure(ctx, ip, ChallengeFailureWindow)
+}
+
+func leadingZeroBits(sum []byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+
+	return count
+}
+
+// SiteVerifyVerifier checks tokens against hCaptcha or Turnstile, both share the same siteverify contract
+type SiteVerifyVerifier struct {
+	Provider  string
+	VerifyURL string
+	SiteKey   string
+	SecretKey string
+	Client    *http.Client
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (verifier *SiteVerifyVerifier) Issue(ctx context.Context, ip string) (model.ChallengeResponse, error) {
+	return model.ChallengeResponse{
+		Provider: verifier.Provider,
+		SiteKey:  verifier.SiteKey,
+	}, nil
+}
+
+// RecordFailure is a no-op, the provider decides how hard its challenges are
+func (verifier *SiteVerifyVerifier) RecordFailure(ctx context.Context, ip string) error {
+	return nil
+}
+
+func (verifier *SiteVerifyVerifier) Verify(ctx context.Context, solution model.ChallengeSolution) error {
+	form := url.Values{}
+	form.Set("secret", verifier.SecretKey)
+	form.Set("response", solution.Solution)
+	form.Set("remoteip", solution.RemoteIP)
+	if verifier.SiteKey != "" {
+		form.Set("sitekey", verifier.SiteKey)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, verifier.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := verifier.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	result := siteVerifyResponse{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+
+	if !result.Success {
+		return &model.ValidationError{
+			Code:    constant.ERR_CHALLENGE_FAILED_ERROR,
+			Message: "Challenge verification failed",
+			Param:   "challenge",
+		}
+	}
+
+	return nil
+}
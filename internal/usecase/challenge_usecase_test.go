@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+type fakeChallengeVerifier struct {
+	solutions []model.ChallengeSolution
+	failures  map[string]int
+	verifyErr error
+}
+
+func (verifier *fakeChallengeVerifier) Issue(ctx context.Context, ip string) (model.ChallengeResponse, error) {
+	return model.ChallengeResponse{Provider: "fake", Challenge: "challenge-for-" + ip}, nil
+}
+
+func (verifier *fakeChallengeVerifier) Verify(ctx context.Context, solution model.ChallengeSolution) error {
+	verifier.solutions = append(verifier.solutions, solution)
+	return verifier.verifyErr
+}
+
+func (verifier *fakeChallengeVerifier) RecordFailure(ctx context.Context, ip string) error {
+	if verifier.failures == nil {
+		verifier.failures = map[string]int{}
+	}
+	verifier.failures[ip]++
+	return nil
+}
+
+func withFiberCtx(t *testing.T, fn func(ctx *fiber.Ctx)) {
+	t.Helper()
+
+	app := fiber.New()
+	// Init gives the request a server, ctx.Context() is handed to Redis which waits on its Done channel
+	requestCtx := &fasthttp.RequestCtx{}
+	requestCtx.Init(&fasthttp.Request{}, nil, nil)
+	ctx := app.AcquireCtx(requestCtx)
+	defer app.ReleaseCtx(ctx)
+
+	fn(ctx)
+}
+
+func validationCode(err error) string {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
+
+func TestChallengeUsecaseWithFakeVerifier(t *testing.T) {
+	verifier := &fakeChallengeVerifier{}
+	challengeUsecase := NewChallengeUsecase(verifier, zap.NewNop(), koanf.New("."))
+
+	withFiberCtx(t, func(ctx *fiber.Ctx) {
+		response, err := challengeUsecase.Issue(ctx)
+		if err != nil || response.Provider != "fake" {
+			t.Fatalf("Issue() = %+v, %v", response, err)
+		}
+
+		err = challengeUsecase.Verify(ctx, response.Challenge, "")
+		if code := validationCode(err); code != constant.ERR_CHALLENGE_REQUIRED_ERROR {
+			t.Fatalf("Verify() without a solution = %v, want %s", err, constant.ERR_CHALLENGE_REQUIRED_ERROR)
+		}
+		if len(verifier.solutions) != 0 {
+			t.Fatalf("verifier was called without a solution")
+		}
+
+		err = challengeUsecase.Verify(ctx, response.Challenge, "42")
+		if err != nil {
+			t.Fatalf("Verify() = %v", err)
+		}
+		if len(verifier.solutions) != 1 || verifier.solutions[0].Solution != "42" {
+			t.Fatalf("verifier got %+v", verifier.solutions)
+		}
+
+		challengeUsecase.RecordFailure(ctx)
+		challengeUsecase.RecordFailure(ctx)
+		if verifier.failures[ctx.IP()] != 2 {
+			t.Fatalf("failures = %v, want 2 for %s", verifier.failures, ctx.IP())
+		}
+	})
+}
+
+func TestChallengeUsecaseDisabled(t *testing.T) {
+	challengeUsecase := NewChallengeUsecase(nil, zap.NewNop(), koanf.New("."))
+
+	withFiberCtx(t, func(ctx *fiber.Ctx) {
+		response, err := challengeUsecase.Issue(ctx)
+		if err != nil || response.Provider != constant.CHALLENGE_PROVIDER_NONE {
+			t.Fatalf("Issue() = %+v, %v", response, err)
+		}
+		if err := challengeUsecase.Verify(ctx, "", ""); err != nil {
+			t.Fatalf("Verify() = %v", err)
+		}
+		challengeUsecase.RecordFailure(ctx)
+	})
+}
+
+func TestProofOfWorkVerifier(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	config := koanf.New(".")
+	config.Set("CHALLENGE_BASE_DIFFICULTY", 8)
+	config.Set("CHALLENGE_MAX_DIFFICULTY", 10)
+	verifier := NewProofOfWorkVerifier(repository.NewChallengeRepository(zap.NewNop(), client), config)
+
+	ctx := context.Background()
+	ip := "203.0.113.7"
+
+	response, err := verifier.Issue(ctx, ip)
+	if err != nil {
+		t.Fatalf("Issue() = %v", err)
+	}
+	if response.Difficulty != 8 {
+		t.Fatalf("difficulty = %d, want 8", response.Difficulty)
+	}
+
+	solution := solveProofOfWork(response.Challenge, response.Difficulty)
+	err = verifier.Verify(ctx, model.ChallengeSolution{Challenge: response.Challenge, Solution: solution})
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	err = verifier.Verify(ctx, model.ChallengeSolution{Challenge: response.Challenge, Solution: solution})
+	if code := validationCode(err); code != constant.ERR_CHALLENGE_FAILED_ERROR {
+		t.Fatalf("reusing a solution = %v, want %s", err, constant.ERR_CHALLENGE_FAILED_ERROR)
+	}
+
+	for range 3 {
+		if err := verifier.RecordFailure(ctx, ip); err != nil {
+			t.Fatalf("RecordFailure() = %v", err)
+		}
+	}
+
+	response, err = verifier.Issue(ctx, ip)
+	if err != nil {
+		t.Fatalf("Issue() = %v", err)
+	}
+	if response.Difficulty != 10 {
+		t.Fatalf("difficulty after 3 failures = %d, want 10", response.Difficulty)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	cases := []struct {
+		sum  []byte
+		want int
+	}{
+		{[]byte{0xff}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x40}, 9},
+		{[]byte{0x00, 0x00}, 16},
+	}
+
+	for _, c := range cases {
+		if got := leadingZeroBits(c.sum); got != c.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", c.sum, got, c.want)
+		}
+	}
+}
+
+func solveProofOfWork(challenge string, difficulty int) string {
+	for nonce := 0; ; nonce++ {
+		solution := strconv.Itoa(nonce)
+		sum := sha256.Sum256([]byte(challenge + ":" + solution))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+}
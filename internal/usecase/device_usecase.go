@@ -0,0 +1,288 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	DeviceCodeTTL       = 10 * time.Minute
+	DevicePollInterval  = 5
+	DeviceSlowDownDelta = 5
+	// userCodeAlphabet has no vowels or look-alike characters, codes are read off one screen and typed on another
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// DeviceUsecase implements the OAuth 2.0 device authorization grant (RFC 8628) for CLI logins
+type DeviceUsecase struct {
+	DeviceRepository *repository.DeviceRepository
+	UserUsecase      *UserUsecase
+	DPoPUsecase      *DPoPUsecase
+	Log              *zap.Logger
+	Config           *koanf.Koanf
+}
+
+func NewDeviceUsecase(deviceRepository *repository.DeviceRepository, userUsecase *UserUsecase, dpopUsecase *DPoPUsecase, zap *zap.Logger, koanf *koanf.Koanf) *DeviceUsecase {
+	return &DeviceUsecase{
+		DeviceRepository: deviceRepository,
+		UserUsecase:      userUsecase,
+		DPoPUsecase:      dpopUsecase,
+		Log:              zap,
+		Config:           koanf,
+	}
+}
+
+func (usecase *DeviceUsecase) CreateCode(ctx *fiber.Ctx, payload model.DeviceCodeRequest) (model.DeviceCodeResponse, error) {
+	response := model.DeviceCodeResponse{}
+
+	if payload.ClientId == "" {
+		return response, &model.OAuthError{
+			ErrorCode:        constant.OAUTH_ERR_INVALID_REQUEST,
+			ErrorDescription: "client_id is required",
+		}
+	}
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return response, err
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(buf)
+
+	var userCode string
+	for attempt := 0; attempt < 5; attempt++ {
+		userCode, err = generateUserCode()
+		if err != nil {
+			return response, err
+		}
+
+		err = usecase.DeviceRepository.Create(ctx.Context(), hashDeviceCode(deviceCode), model.DeviceAuthorization{
+			UserCode: userCode,
+			ClientId: payload.ClientId,
+			Status:   constant.DEVICE_STATUS_PENDING,
+			Interval: DevicePollInterval,
+		}, DeviceCodeTTL)
+		if !errors.Is(err, repository.ErrUserCodeTaken) {
+			break
+		}
+	}
+	if err != nil {
+		return response, err
+	}
+
+	verificationUri := usecase.Config.String("DEVICE_VERIFICATION_URI")
+	formattedUserCode := userCode[:4] + "-" + userCode[4:]
+
+	return model.DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formattedUserCode,
+		VerificationUri:         verificationUri,
+		VerificationUriComplete: verificationUri + "?user_code=" + url.QueryEscape(formattedUserCode),
+		ExpiresIn:               int(DeviceCodeTTL.Seconds()),
+		Interval:                DevicePollInterval,
+	}, nil
+}
+
+// Approve is called by a logged in user who typed the user code shown by the CLI
+func (usecase *DeviceUsecase) Approve(ctx *fiber.Ctx, userId int, payload model.DeviceApproveRequest) (model.DeviceApproveResponse, error) {
+	response := model.DeviceApproveResponse{}
+
+	userCode := normalizeUserCode(payload.UserCode)
+	if len(userCode) != userCodeLength {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "User code is not valid",
+			Param:   "userCode",
+		}
+	}
+
+	deviceCodeHash, authorization, err := usecase.DeviceRepository.FindByUserCode(ctx.Context(), userCode)
+	if err != nil {
+		if errors.Is(err, repository.ErrDeviceAuthorizationNil) {
+			return response, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User code is not found or expired",
+				Param:   "userCode",
+			}
+		}
+		return response, err
+	}
+
+	status := constant.DEVICE_STATUS_APPROVED
+	if payload.Deny {
+		status = constant.DEVICE_STATUS_DENIED
+	}
+
+	// a device session is no fresher than the session that approved it, approving must not turn any valid
+	// token into a fresh login
+	var authTime int64
+	if claims, ok := ctx.Locals("claims").(*model.Claims); ok && claims.AuthTime != nil {
+		authTime = claims.AuthTime.Unix()
+	}
+
+	// the pending status is checked while it is written, so of two concurrent approvals only one wins
+	err = usecase.DeviceRepository.UpdateStatus(ctx.Context(), deviceCodeHash, status, userId, authTime)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDeviceAuthorizationNil):
+			return response, &model.ValidationError{
+				Code:    constant.ERR_NOT_FOUND_ERROR,
+				Message: "User code is not found or expired",
+				Param:   "userCode",
+			}
+		case errors.Is(err, repository.ErrDeviceAuthorizationDecided):
+			return response, &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "User code has already been used",
+				Param:   "userCode",
+			}
+		}
+		return response, err
+	}
+
+	return model.DeviceApproveResponse{
+		ClientId: authorization.ClientId,
+		Status:   status,
+	}, nil
+}
+
+// Token answers a CLI poll with authorization_pending / slow_down until the user code is approved or denied
+func (usecase *DeviceUsecase) Token(ctx *fiber.Ctx, payload model.DeviceTokenRequest) (model.OAuthTokenResponse, error) {
+	response := model.OAuthTokenResponse{}
+
+	if payload.GrantType != constant.GRANT_TYPE_DEVICE_CODE {
+		return response, &model.OAuthError{ErrorCode: constant.OAUTH_ERR_UNSUPPORTED_GRANT_TYPE}
+	}
+
+	if payload.DeviceCode == "" || payload.ClientId == "" {
+		return response, &model.OAuthError{
+			ErrorCode:        constant.OAUTH_ERR_INVALID_REQUEST,
+			ErrorDescription: "device_code and client_id are required",
+		}
+	}
+
+	// checked before the device code is looked at so a bad proof never redeems it
+	jkt, err := usecase.DPoPUsecase.oauthThumbprint(ctx)
+	if err != nil {
+		return response, err
+	}
+
+	deviceCodeHash := hashDeviceCode(payload.DeviceCode)
+	authorization, err := usecase.DeviceRepository.Find(ctx.Context(), deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrDeviceAuthorizationNil) {
+			return response, &model.OAuthError{ErrorCode: constant.OAUTH_ERR_EXPIRED_TOKEN}
+		}
+		return response, err
+	}
+
+	if authorization.ClientId != payload.ClientId {
+		return response, &model.OAuthError{
+			ErrorCode:        constant.OAUTH_ERR_INVALID_GRANT,
+			ErrorDescription: "device_code was issued to another client",
+		}
+	}
+
+	switch authorization.Status {
+	case constant.DEVICE_STATUS_PENDING:
+		now := time.Now()
+		interval := authorization.Interval
+		errorCode := constant.OAUTH_ERR_AUTHORIZATION_PENDING
+
+		// RFC 8628 section 3.5, a client polling faster than the interval must add 5 seconds to it
+		if authorization.LastPoll > 0 && now.Sub(time.Unix(authorization.LastPoll, 0)) < time.Duration(interval)*time.Second {
+			interval += DeviceSlowDownDelta
+			errorCode = constant.OAUTH_ERR_SLOW_DOWN
+		}
+
+		err = usecase.DeviceRepository.UpdatePoll(ctx.Context(), deviceCodeHash, now.Unix(), interval)
+		if err != nil {
+			return response, err
+		}
+
+		return response, &model.OAuthError{ErrorCode: errorCode}
+	case constant.DEVICE_STATUS_DENIED:
+		_, err = usecase.DeviceRepository.Delete(ctx.Context(), deviceCodeHash, authorization.UserCode)
+		if err != nil {
+			return response, err
+		}
+
+		return response, &model.OAuthError{ErrorCode: constant.OAUTH_ERR_ACCESS_DENIED}
+	}
+
+	deleted, err := usecase.DeviceRepository.Delete(ctx.Context(), deviceCodeHash, authorization.UserCode)
+	if err != nil {
+		return response, err
+	}
+	if !deleted {
+		// a concurrent poll already redeemed the device code
+		return response, &model.OAuthError{ErrorCode: constant.OAUTH_ERR_INVALID_GRANT}
+	}
+
+	// the user may have been deactivated between approving and this poll
+	var validationErr *model.ValidationError
+	err = usecase.UserUsecase.checkActive(ctx.Context(), authorization.UserId)
+	if errors.As(err, &validationErr) {
+		return response, &model.OAuthError{
+			ErrorCode:        constant.OAUTH_ERR_ACCESS_DENIED,
+			ErrorDescription: validationErr.Message,
+		}
+	}
+	if err != nil {
+		return response, err
+	}
+
+	token, err := usecase.UserUsecase.IssueTokenPair(ctx.Context(), authorization.UserId, time.Unix(authorization.AuthTime, 0), jkt)
+	if err != nil {
+		return response, err
+	}
+
+	return model.OAuthTokenResponse{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		ExpiresIn:    token.AccessTokenExpiresIn,
+		RefreshToken: token.RefreshToken,
+	}, nil
+}
+
+func generateUserCode() (string, error) {
+	var builder strings.Builder
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+
+	return builder.String(), nil
+}
+
+// normalizeUserCode accepts the code the way humans type it, lowercase and with or without the dash
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.ReplaceAll(userCode, "-", "")
+	return strings.ReplaceAll(userCode, " ", "")
+}
+
+// hashDeviceCode keeps raw device codes out of Redis, only the CLI ever holds them
+func hashDeviceCode(deviceCode string) string {
+	sum := sha256.Sum256([]byte(deviceCode))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	DPoPHeaderName      = "DPoP"
+	DefaultDPoPProofAge = time.Minute
+)
+
+// DPoPUsecase implements RFC 9449 sender-constrained tokens. Clients opt in by sending a DPoP proof
+// when they ask for tokens, the tokens are then bound to the proof key and need a fresh proof on every request
+type DPoPUsecase struct {
+	DPoPRepository *repository.DPoPRepository
+	Log            *zap.Logger
+	Config         *koanf.Koanf
+}
+
+func NewDPoPUsecase(dpopRepository *repository.DPoPRepository, zap *zap.Logger, koanf *koanf.Koanf) *DPoPUsecase {
+	return &DPoPUsecase{
+		DPoPRepository: dpopRepository,
+		Log:            zap,
+		Config:         koanf,
+	}
+}
+
+// Thumbprint verifies the proof sent to a token issuing endpoint and returns the key thumbprint
+// the new tokens must be bound to, an empty thumbprint means the client did not opt in
+func (usecase *DPoPUsecase) Thumbprint(ctx *fiber.Ctx) (string, error) {
+	// a bound token calling a token issuing endpoint already had its proof checked by ProtectedRoute
+	if jkt, ok := ctx.Locals("dpopJkt").(string); ok {
+		return jkt, nil
+	}
+
+	if ctx.Get(DPoPHeaderName) == "" {
+		return "", nil
+	}
+
+	return usecase.verifyProof(ctx, "")
+}
+
+// VerifyRequest enforces the binding of an access token, bound tokens must be presented with the DPoP
+// scheme and a proof signed by the bound key, unbound tokens must not use the DPoP scheme
+func (usecase *DPoPUsecase) VerifyRequest(ctx *fiber.Ctx, accessToken string, claims *model.Claims) error {
+	isDPoPScheme := strings.HasPrefix(ctx.Get(fiber.HeaderAuthorization), util.DPoPPrefix)
+
+	if claims.Confirmation == nil {
+		if isDPoPScheme {
+			return &model.ValidationError{
+				Code:    constant.ERR_INVALID_DPOP_PROOF_ERROR,
+				Message: "Authentication token is not DPoP bound, use the Bearer scheme",
+				Param:   "accessToken",
+			}
+		}
+		return nil
+	}
+
+	if !isDPoPScheme {
+		return &model.ValidationError{
+			Code:    constant.ERR_INVALID_DPOP_PROOF_ERROR,
+			Message: "Authentication token is DPoP bound, use the DPoP scheme with a proof",
+			Param:   "accessToken",
+		}
+	}
+
+	jkt, err := usecase.verifyProof(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if jkt != claims.Confirmation.Jkt {
+		return &model.ValidationError{
+			Code:    constant.ERR_INVALID_DPOP_PROOF_ERROR,
+			Message: "DPoP proof is not signed by the key the token is bound to",
+			Param:   DPoPHeaderName,
+		}
+	}
+
+	return nil
+}
+
+// oauthThumbprint is Thumbprint for the OAuth token endpoints, which report proof errors as invalid_dpop_proof
+func (usecase *DPoPUsecase) oauthThumbprint(ctx *fiber.Ctx) (string, error) {
+	jkt, err := usecase.Thumbprint(ctx)
+	if err != nil {
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			return "", &model.OAuthError{
+				ErrorCode:        constant.OAUTH_ERR_INVALID_DPOP_PROOF,
+				ErrorDescription: validationErr.Message,
+			}
+		}
+		return "", err
+	}
+
+	return jkt, nil
+}
+
+func (usecase *DPoPUsecase) verifyProof(ctx *fiber.Ctx, accessToken string) (string, error) {
+	maxAge := DefaultDPoPProofAge
+	if seconds := usecase.Config.Int("DPOP_PROOF_MAX_AGE"); seconds > 0 {
+		maxAge = time.Duration(seconds) * time.Second
+	}
+
+	proof, err := util.VerifyDPoPProof(ctx.Get(DPoPHeaderName), ctx.Method(), usecase.requestURL(ctx), accessToken, maxAge)
+	if err != nil {
+		if errors.Is(err, util.ErrInvalidDPoPProof) {
+			util.Logger(ctx, usecase.Log).Debug("DPoP proof rejected", zap.Error(err))
+			return "", &model.ValidationError{
+				Code:    constant.ERR_INVALID_DPOP_PROOF_ERROR,
+				Message: "DPoP proof is invalid",
+				Param:   DPoPHeaderName,
+			}
+		}
+		return "", err
+	}
+
+	// proofs can be up to maxAge old or maxAge/2 early, remember the jti for that whole window
+	fresh, err := usecase.DPoPRepository.MarkProofUsed(ctx.Context(), proof.Jkt, proof.Jti, maxAge+maxAge/2)
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", &model.ValidationError{
+			Code:    constant.ERR_INVALID_DPOP_PROOF_ERROR,
+			Message: "DPoP proof has already been used",
+			Param:   DPoPHeaderName,
+		}
+	}
+
+	ctx.Locals("dpopJkt", proof.Jkt)
+
+	return proof.Jkt, nil
+}
+
+// requestURL is what the htu claim is compared with, behind a proxy the public URL cannot be
+// derived from the request so its origin can be configured
+func (usecase *DPoPUsecase) requestURL(ctx *fiber.Ctx) string {
+	baseURL := usecase.Config.String("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		baseURL = ctx.BaseURL()
+	}
+
+	return baseURL + ctx.Path()
+}
@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type testDPoPKey struct {
+	key *ecdsa.PrivateKey
+	x   string
+	y   string
+	jkt string
+}
+
+func newTestDPoPKey(t *testing.T) testDPoPKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))
+	y := base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))
+	sum := sha256.Sum256([]byte(`{"crv":"P-256","kty":"EC","x":"` + x + `","y":"` + y + `"}`))
+
+	return testDPoPKey{key: key, x: x, y: y, jkt: base64.RawURLEncoding.EncodeToString(sum[:])}
+}
+
+func (dpopKey testDPoPKey) proof(t *testing.T, method string, htu string, accessToken string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{"htm": method, "htu": htu, "iat": time.Now().Unix(), "jti": uuid.NewString()}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]interface{}{"kty": "EC", "crv": "P-256", "x": dpopKey.x, "y": dpopKey.y}
+	proof, err := token.SignedString(dpopKey.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return proof
+}
+
+func TestDPoPUsecaseVerifyRequest(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	config := koanf.New(".")
+	config.Set("PUBLIC_BASE_URL", "https://auth.example.com")
+	dpopUsecase := NewDPoPUsecase(repository.NewDPoPRepository(zap.NewNop(), client), zap.NewNop(), config)
+
+	boundKey, otherKey := newTestDPoPKey(t), newTestDPoPKey(t)
+	const url = "https://auth.example.com/api/users/me"
+	replayed := boundKey.proof(t, fiber.MethodGet, url, "access-token")
+
+	bound := &model.Claims{Confirmation: &model.Confirmation{Jkt: boundKey.jkt}}
+	unbound := &model.Claims{}
+
+	cases := []struct {
+		name          string
+		claims        *model.Claims
+		authorization string
+		proof         string
+		message       string
+	}{
+		{"bound token with its proof", bound, "DPoP access-token", replayed, ""},
+		{"replayed proof", bound, "DPoP access-token", replayed, "DPoP proof has already been used"},
+		{"proof of another key", bound, "DPoP access-token", otherKey.proof(t, fiber.MethodGet, url, "access-token"),
+			"DPoP proof is not signed by the key the token is bound to"},
+		{"proof for another method", bound, "DPoP access-token", boundKey.proof(t, fiber.MethodPost, url, "access-token"),
+			"DPoP proof is invalid"},
+		{"proof for another URL", bound, "DPoP access-token", boundKey.proof(t, fiber.MethodGet, "https://auth.example.com/api/users/me/sessions", "access-token"),
+			"DPoP proof is invalid"},
+		{"proof for another token", bound, "DPoP access-token", boundKey.proof(t, fiber.MethodGet, url, "other-token"),
+			"DPoP proof is invalid"},
+		{"bound token without a proof", bound, "DPoP access-token", "", "DPoP proof is invalid"},
+		{"bound token as a bearer token", bound, "Bearer access-token", boundKey.proof(t, fiber.MethodGet, url, "access-token"),
+			"Authentication token is DPoP bound, use the DPoP scheme with a proof"},
+		{"unbound token as a bearer token", unbound, "Bearer access-token", "", ""},
+		{"unbound token with the DPoP scheme", unbound, "DPoP access-token", boundKey.proof(t, fiber.MethodGet, url, "access-token"),
+			"Authentication token is not DPoP bound, use the Bearer scheme"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var err error
+			app := fiber.New()
+			app.Get("/api/users/me", func(ctx *fiber.Ctx) error {
+				err = dpopUsecase.VerifyRequest(ctx, "access-token", c.claims)
+				return nil
+			})
+
+			request := httptest.NewRequest(fiber.MethodGet, "/api/users/me?fields=email", nil)
+			request.Header.Set(fiber.HeaderAuthorization, c.authorization)
+			if c.proof != "" {
+				request.Header.Set(DPoPHeaderName, c.proof)
+			}
+			_, testErr := app.Test(request)
+			if testErr != nil {
+				t.Fatal(testErr)
+			}
+
+			if c.message == "" {
+				if err != nil {
+					t.Fatalf("VerifyRequest() = %v, want nil", err)
+				}
+				return
+			}
+			if code := validationCode(err); code != constant.ERR_INVALID_DPOP_PROOF_ERROR || err.Error() != c.message {
+				t.Errorf("VerifyRequest() = %v, want %s", err, c.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	DefaultImpersonationTTL      = 15 * time.Minute
+	MaxImpersonationReasonLength = 500
+)
+
+// ImpersonationUsecase lets support admins act as a user for a short time, every impersonation and every
+// request made with it ends up in the audit events
+type ImpersonationUsecase struct {
+	UserRepository       *repository.UserRepository
+	AuditEventRepository *repository.AuditEventRepository
+	SessionUsecase       *SessionUsecase
+	DPoPUsecase          *DPoPUsecase
+	Log                  *zap.Logger
+	Config               *koanf.Koanf
+}
+
+func NewImpersonationUsecase(userRepository *repository.UserRepository, auditEventRepository *repository.AuditEventRepository, sessionUsecase *SessionUsecase, dpopUsecase *DPoPUsecase, zap *zap.Logger, koanf *koanf.Koanf) *ImpersonationUsecase {
+	return &ImpersonationUsecase{
+		UserRepository:       userRepository,
+		AuditEventRepository: auditEventRepository,
+		SessionUsecase:       sessionUsecase,
+		DPoPUsecase:          dpopUsecase,
+		Log:                  zap,
+		Config:               koanf,
+	}
+}
+
+// Impersonate issues tokens for payload.UserId carrying actorId in the act claim. Admins cannot be
+// impersonated so an impersonation can never be used to reach more than the actor already has
+func (usecase *ImpersonationUsecase) Impersonate(ctx *fiber.Ctx, actorId int, payload model.ImpersonationRequest) (model.TokenResponse, error) {
+	token := model.TokenResponse{}
+
+	reason := strings.TrimSpace(payload.Reason)
+	if payload.UserId <= 0 {
+		return token, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "User id is required",
+			Param:   "userId",
+		}
+	} else if reason == "" {
+		return token, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Reason is required to not be empty",
+			Param:   "reason",
+		}
+	} else if len(reason) > MaxImpersonationReasonLength {
+		return token, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: fmt.Sprintf("Reason must be at most %d characters", MaxImpersonationReasonLength),
+			Param:   "reason",
+		}
+	} else if payload.UserId == actorId {
+		return token, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "You cannot impersonate yourself",
+			Param:   "userId",
+		}
+	}
+
+	role, err := usecase.UserRepository.GetUserRole(ctx.Context(), payload.UserId)
+	if err != nil {
+		return token, err
+	}
+	if role == constant.ROLE_ADMIN {
+		return token, &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Admins cannot be impersonated",
+			Param:   "userId",
+		}
+	}
+
+	// the impersonation token is bound to the same DPoP key as the admin's own token, if any
+	jkt, err := usecase.DPoPUsecase.Thumbprint(ctx)
+	if err != nil {
+		return token, err
+	}
+
+	authTime := time.Now()
+	if claims, ok := ctx.Locals("claims").(*model.Claims); ok && claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	}
+
+	sessionId, token, err := usecase.SessionUsecase.CreateImpersonation(ctx.Context(), actorId, payload.UserId, authTime, jkt, usecase.ttl())
+	if err != nil {
+		return token, err
+	}
+
+	err = usecase.AuditEventRepository.Create(ctx.Context(), model.AuditEvent{
+		ActorId:   actorId,
+		UserId:    payload.UserId,
+		Action:    constant.AUDIT_ACTION_IMPERSONATION_STARTED,
+		SessionId: sessionId,
+		IP:        util.ClientIP(ctx),
+		Detail:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		// an impersonation nobody can trace back must not be usable
+		return model.TokenResponse{}, errors.Join(err, usecase.SessionUsecase.Delete(ctx.Context(), sessionId))
+	}
+
+	util.Logger(ctx, usecase.Log).Info("Impersonation started", zap.Int("actorId", actorId), zap.Int("impersonatedUserId", payload.UserId), zap.String("sessionId", sessionId))
+
+	return token, nil
+}
+
+// RecordRequest audits a request made with an impersonation token, it must be called after the token is validated
+func (usecase *ImpersonationUsecase) RecordRequest(ctx *fiber.Ctx, claims *model.Claims) error {
+	return usecase.AuditEventRepository.Create(ctx.Context(), model.AuditEvent{
+		ActorId:   claims.Actor.UserId,
+		UserId:    claims.UserId,
+		Action:    constant.AUDIT_ACTION_IMPERSONATED_REQUEST,
+		SessionId: claims.SessionId,
+		IP:        util.ClientIP(ctx),
+		Detail:    ctx.Method() + " " + ctx.Path(),
+		CreatedAt: time.Now(),
+	})
+}
+
+func (usecase *ImpersonationUsecase) ttl() time.Duration {
+	if seconds := usecase.Config.Int("IMPERSONATION_TTL"); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return DefaultImpersonationTTL
+}
@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"encoding/base32"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var inviteCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type InviteUsecase struct {
+	InviteRepository *repository.InviteRepository
+	QuotaUsecase     *QuotaUsecase
+	Log              *zap.Logger
+	Config           *koanf.Koanf
+}
+
+func NewInviteUsecase(inviteRepository *repository.InviteRepository, quotaUsecase *QuotaUsecase, zap *zap.Logger, koanf *koanf.Koanf) *InviteUsecase {
+	return &InviteUsecase{
+		InviteRepository: inviteRepository,
+		QuotaUsecase:     quotaUsecase,
+		Log:              zap,
+		Config:           koanf,
+	}
+}
+
+func (usecase *InviteUsecase) Create(ctx *fiber.Ctx, adminId int, payload model.InviteCodeCreateRequest) (model.InviteCodeResponse, error) {
+	response := model.InviteCodeResponse{}
+
+	if payload.MaxUses <= 0 {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Max uses must be at least 1",
+			Param:   "maxUses",
+		}
+	} else if payload.MaxUses > 10000 {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Max uses must be at most 10000",
+			Param:   "maxUses",
+		}
+	}
+
+	if payload.ExpiresIn < 0 {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Expires in must not be negative",
+			Param:   "expiresIn",
+		}
+	}
+
+	usage, err := usecase.QuotaUsecase.Consume(ctx, adminId, constant.QUOTA_METRIC_INVITES)
+	if err != nil {
+		return response, err
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		usecase.QuotaUsecase.Refund(ctx, adminId, usage)
+		return response, err
+	}
+
+	now := time.Now()
+	invite := model.InviteCode{
+		Code:      code,
+		MaxUses:   payload.MaxUses,
+		CreatedBy: adminId,
+		CreatedAt: now,
+	}
+
+	// zero means the invite code never expires
+	if payload.ExpiresIn > 0 {
+		expiresAt := now.Add(time.Duration(payload.ExpiresIn) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	inviteId, err := usecase.InviteRepository.Create(ctx.Context(), invite)
+	if err != nil {
+		usecase.QuotaUsecase.Refund(ctx, adminId, usage)
+		return response, err
+	}
+
+	return model.InviteCodeResponse{
+		Id:        inviteId,
+		Code:      invite.Code,
+		MaxUses:   invite.MaxUses,
+		UsedCount: 0,
+		ExpiresAt: invite.ExpiresAt,
+		CreatedBy: invite.CreatedBy,
+		CreatedAt: invite.CreatedAt,
+	}, nil
+}
+
+func (usecase *InviteUsecase) List(ctx *fiber.Ctx) ([]model.InviteCodeResponse, error) {
+	return usecase.InviteRepository.FindAll(ctx.Context())
+}
+
+func generateInviteCode() (string, error) {
+	buf := make([]byte, 10)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return inviteCodeEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,382 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// DefaultIPFilterRefreshInterval is how often each process checks whether the admin managed lists changed
+var DefaultIPFilterRefreshInterval = 2 * time.Second
+
+// IPFilterUsecase decides which clients may reach the server. IP_ALLOW_LIST, IP_DENY_LIST, GEO_ALLOW_COUNTRIES and
+// GEO_DENY_COUNTRIES are fixed at startup, the dynamic lists are edited by admins and every process keeps its own
+// copy, refreshed by RefreshPeriodically. Every rule, country rules included, is global: the filter runs before
+// authentication, when no tenant is known yet, so an organization cannot have rules of its own
+type IPFilterUsecase struct {
+	IPFilterRepository *repository.IPFilterRepository
+	GeoIP              *util.GeoIP
+	Log                *zap.Logger
+	Config             *koanf.Koanf
+
+	staticAllow    util.IPNetworks
+	staticDeny     util.IPNetworks
+	allowCountries []string
+	denyCountries  []string
+
+	mutex   sync.RWMutex
+	version int64
+	allow   util.IPNetworks
+	deny    util.IPNetworks
+}
+
+func NewIPFilterUsecase(ipFilterRepository *repository.IPFilterRepository, geoIP *util.GeoIP, zap *zap.Logger, koanf *koanf.Koanf) *IPFilterUsecase {
+	usecase := &IPFilterUsecase{
+		IPFilterRepository: ipFilterRepository,
+		GeoIP:              geoIP,
+		Log:                zap,
+		Config:             koanf,
+		version:            -1,
+	}
+
+	usecase.loadStaticRules()
+
+	return usecase
+}
+
+// loadStaticRules parses the configured rules once, the process does not start with rules it cannot apply
+func (usecase *IPFilterUsecase) loadStaticRules() {
+	var err error
+	usecase.staticAllow, err = util.ParseIPNetworks(usecase.Config.String("IP_ALLOW_LIST"))
+	if err != nil {
+		usecase.Log.Fatal("Invalid IP_ALLOW_LIST", zap.Error(err))
+	}
+	usecase.staticDeny, err = util.ParseIPNetworks(usecase.Config.String("IP_DENY_LIST"))
+	if err != nil {
+		usecase.Log.Fatal("Invalid IP_DENY_LIST", zap.Error(err))
+	}
+
+	usecase.allowCountries = countryCodes(usecase.Config.String("GEO_ALLOW_COUNTRIES"))
+	usecase.denyCountries = countryCodes(usecase.Config.String("GEO_DENY_COUNTRIES"))
+	if (len(usecase.allowCountries) > 0 || len(usecase.denyCountries) > 0) && usecase.GeoIP == nil {
+		usecase.Log.Fatal("GEO_ALLOW_COUNTRIES and GEO_DENY_COUNTRIES need GEOIP_DATABASE_FILE")
+	}
+}
+
+// Check returns why a client is blocked, or an empty string when it is not, and its country when it was looked
+// up. Denied networks always lose, an allow list with entries blocks everything outside it and countries are
+// checked last. Clients whose country is unknown, such as private networks, pass the country rules
+func (usecase *IPFilterUsecase) Check(ip string) (string, string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", ""
+	}
+	addr = addr.Unmap()
+
+	usecase.mutex.RLock()
+	allow, deny := usecase.allow, usecase.deny
+	usecase.mutex.RUnlock()
+
+	if reason := usecase.checkLists(addr, allow, deny); reason != "" {
+		return reason, ""
+	}
+
+	if len(usecase.allowCountries) == 0 && len(usecase.denyCountries) == 0 {
+		return "", ""
+	}
+
+	country := usecase.GeoIP.Country(addr.String())
+	if country == "" {
+		return "", ""
+	}
+	if slices.Contains(usecase.denyCountries, country) {
+		return constant.IP_FILTER_BLOCKED_COUNTRY, country
+	}
+	if len(usecase.allowCountries) > 0 && !slices.Contains(usecase.allowCountries, country) {
+		return constant.IP_FILTER_BLOCKED_COUNTRY, country
+	}
+
+	return "", country
+}
+
+// checkLists applies the static rules and the given dynamic lists to addr
+func (usecase *IPFilterUsecase) checkLists(addr netip.Addr, allow util.IPNetworks, deny util.IPNetworks) string {
+	if usecase.staticDeny.Contains(addr) || deny.Contains(addr) {
+		return constant.IP_FILTER_BLOCKED_DENY_LIST
+	}
+
+	if len(usecase.staticAllow) > 0 || len(allow) > 0 {
+		if !usecase.staticAllow.Contains(addr) && !allow.Contains(addr) {
+			return constant.IP_FILTER_BLOCKED_ALLOW_LIST
+		}
+	}
+
+	return ""
+}
+
+// RecordBlocked counts a blocked request, losing the count is not worth failing the request over
+func (usecase *IPFilterUsecase) RecordBlocked(ctx *fiber.Ctx, reason string) {
+	err := usecase.IPFilterRepository.IncrementBlocked(ctx.Context(), reason)
+	if err != nil {
+		util.Logger(ctx, usecase.Log).Warn("Failed to count blocked request", zap.String("reason", reason), zap.Error(err))
+	}
+}
+
+func (usecase *IPFilterUsecase) Rules(ctx *fiber.Ctx) (model.IPFilterResponse, error) {
+	response := model.IPFilterResponse{
+		StaticAllow:    networkStrings(usecase.staticAllow),
+		StaticDeny:     networkStrings(usecase.staticDeny),
+		AllowCountries: usecase.allowCountries,
+		DenyCountries:  usecase.denyCountries,
+	}
+
+	var err error
+	response.Allow, err = usecase.IPFilterRepository.FindAll(ctx.Context(), constant.IP_FILTER_LIST_ALLOW)
+	if err != nil {
+		return response, err
+	}
+	response.Deny, err = usecase.IPFilterRepository.FindAll(ctx.Context(), constant.IP_FILTER_LIST_DENY)
+	if err != nil {
+		return response, err
+	}
+	response.Blocked, err = usecase.IPFilterRepository.FindBlocked(ctx.Context())
+	if err != nil {
+		return response, err
+	}
+
+	slices.Sort(response.Allow)
+	slices.Sort(response.Deny)
+
+	return response, nil
+}
+
+func (usecase *IPFilterUsecase) AddRule(ctx *fiber.Ctx, payload model.IPFilterRuleRequest) (model.IPFilterResponse, error) {
+	network, err := validateIPFilterRule(payload)
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+
+	err = usecase.checkSelfLockout(ctx, func(allow util.IPNetworks, deny util.IPNetworks) (util.IPNetworks, util.IPNetworks) {
+		if payload.List == constant.IP_FILTER_LIST_ALLOW {
+			return append(slices.Clone(allow), network), deny
+		}
+		return allow, append(slices.Clone(deny), network)
+	})
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+
+	err = usecase.IPFilterRepository.Add(ctx.Context(), payload.List, network.String())
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+
+	return usecase.afterChange(ctx)
+}
+
+func (usecase *IPFilterUsecase) RemoveRule(ctx *fiber.Ctx, payload model.IPFilterRuleRequest) (model.IPFilterResponse, error) {
+	network, err := validateIPFilterRule(payload)
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+
+	// removing the allow rule an admin connects through blocks them as long as other allow rules remain
+	err = usecase.checkSelfLockout(ctx, func(allow util.IPNetworks, deny util.IPNetworks) (util.IPNetworks, util.IPNetworks) {
+		without := func(networks util.IPNetworks) util.IPNetworks {
+			return slices.DeleteFunc(slices.Clone(networks), func(entry netip.Prefix) bool { return entry == network })
+		}
+		if payload.List == constant.IP_FILTER_LIST_ALLOW {
+			return without(allow), deny
+		}
+		return allow, without(deny)
+	})
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+
+	removed, err := usecase.IPFilterRepository.Remove(ctx.Context(), payload.List, network.String())
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+	if !removed {
+		return model.IPFilterResponse{}, &model.ValidationError{
+			Code:    constant.ERR_NOT_FOUND_ERROR,
+			Message: "IP filter rule not found",
+			Param:   "cidr",
+		}
+	}
+
+	return usecase.afterChange(ctx)
+}
+
+// checkSelfLockout refuses a change to the dynamic lists that would block the admin making it, an admin locking
+// themselves out would need someone with Redis access to get back in
+func (usecase *IPFilterUsecase) checkSelfLockout(ctx *fiber.Ctx, change func(allow util.IPNetworks, deny util.IPNetworks) (util.IPNetworks, util.IPNetworks)) error {
+	addr, err := netip.ParseAddr(util.ClientIP(ctx))
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	usecase.mutex.RLock()
+	allow, deny := change(usecase.allow, usecase.deny)
+	usecase.mutex.RUnlock()
+
+	if usecase.checkLists(addr, allow, deny) != "" {
+		return &model.ValidationError{
+			Code:    constant.ERR_CONFLICT_ERROR,
+			Message: "This rule would block your own address",
+			Param:   "cidr",
+		}
+	}
+
+	return nil
+}
+
+// RefreshPeriodically reloads the dynamic lists every IP_FILTER_REFRESH_INTERVAL seconds when their version
+// changed, until ctx is done
+func (usecase *IPFilterUsecase) RefreshPeriodically(ctx context.Context) {
+	interval := DefaultIPFilterRefreshInterval
+	if seconds := usecase.Config.Int("IP_FILTER_REFRESH_INTERVAL"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	err := usecase.Refresh(ctx)
+	if err != nil {
+		usecase.Log.Error("Failed to load IP filter lists", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := usecase.Refresh(ctx)
+			if err != nil {
+				usecase.Log.Error("Failed to refresh IP filter lists", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Refresh reloads the dynamic lists when they changed since the last load, a list that cannot be loaded keeps
+// its previous copy
+func (usecase *IPFilterUsecase) Refresh(ctx context.Context) error {
+	version, err := usecase.IPFilterRepository.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	usecase.mutex.RLock()
+	current := usecase.version
+	usecase.mutex.RUnlock()
+	if version == current {
+		return nil
+	}
+
+	allow, err := usecase.loadList(ctx, constant.IP_FILTER_LIST_ALLOW)
+	if err != nil {
+		return err
+	}
+	deny, err := usecase.loadList(ctx, constant.IP_FILTER_LIST_DENY)
+	if err != nil {
+		return err
+	}
+
+	usecase.mutex.Lock()
+	usecase.version, usecase.allow, usecase.deny = version, allow, deny
+	usecase.mutex.Unlock()
+
+	return nil
+}
+
+func (usecase *IPFilterUsecase) loadList(ctx context.Context, list string) (util.IPNetworks, error) {
+	entries, err := usecase.IPFilterRepository.FindAll(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	networks := util.IPNetworks{}
+	for _, entry := range entries {
+		network, err := util.ParseIPNetwork(entry)
+		if err != nil {
+			usecase.Log.Warn("Skipping invalid IP filter rule", zap.String("list", list), zap.String("cidr", entry))
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// afterChange applies a change to this process right away, the others pick it up on their next refresh
+func (usecase *IPFilterUsecase) afterChange(ctx *fiber.Ctx) (model.IPFilterResponse, error) {
+	err := usecase.Refresh(ctx.Context())
+	if err != nil {
+		return model.IPFilterResponse{}, err
+	}
+
+	return usecase.Rules(ctx)
+}
+
+func validateIPFilterRule(payload model.IPFilterRuleRequest) (netip.Prefix, error) {
+	err := util.Validate(payload)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	if payload.List != constant.IP_FILTER_LIST_ALLOW && payload.List != constant.IP_FILTER_LIST_DENY {
+		return netip.Prefix{}, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "List must be allow or deny",
+			Param:   "list",
+		}
+	}
+
+	network, err := util.ParseIPNetwork(strings.TrimSpace(payload.CIDR))
+	if err != nil {
+		return netip.Prefix{}, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "CIDR must be an IP address or CIDR such as 203.0.113.0/24",
+			Param:   "cidr",
+		}
+	}
+
+	return network, nil
+}
+
+// countryCodes parses a comma separated list of ISO 3166-1 alpha-2 codes
+func countryCodes(value string) []string {
+	codes := []string{}
+	for _, code := range strings.Split(value, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	return codes
+}
+
+func networkStrings(networks util.IPNetworks) []string {
+	values := []string{}
+	for _, network := range networks {
+		values = append(values, network.String())
+	}
+
+	return values
+}
@@ -0,0 +1,251 @@
+package usecase
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// newTestGeoIP writes an IPv4 MaxMind database with 24 bit records that maps each network to its country
+func newTestGeoIP(t *testing.T, countries map[string]string) *util.GeoIP {
+	t.Helper()
+
+	const (
+		recordEmpty = iota
+		recordNode
+		recordData
+	)
+	type record struct {
+		kind  int
+		value int
+	}
+
+	nodes := [][2]record{{}}
+	data := []byte{}
+	for cidr, country := range countries {
+		offset := len(data)
+		data = append(data, 0xe1, 0x47)
+		data = append(data, "country"...)
+		data = append(data, 0xe1, 0x48)
+		data = append(data, "iso_code"...)
+		data = append(data, 0x40|byte(len(country)))
+		data = append(data, country...)
+
+		prefix := netip.MustParsePrefix(cidr)
+		addr := prefix.Addr().As4()
+		current := 0
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == prefix.Bits()-1 {
+				nodes[current][bit] = record{recordData, offset}
+				break
+			}
+			if nodes[current][bit].kind != recordNode {
+				nodes = append(nodes, [2]record{})
+				nodes[current][bit] = record{recordNode, len(nodes) - 1}
+			}
+			current = nodes[current][bit].value
+		}
+	}
+
+	database := []byte{}
+	for _, node := range nodes {
+		for _, entry := range node {
+			value := len(nodes)
+			switch entry.kind {
+			case recordNode:
+				value = entry.value
+			case recordData:
+				value = len(nodes) + 16 + entry.value
+			}
+			database = append(database, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	database = append(database, make([]byte, 16)...)
+	database = append(database, data...)
+
+	database = append(database, "\xab\xcd\xefMaxMind.com"...)
+	database = append(database, 0xe5)
+	database = append(database, 0x4a)
+	database = append(database, "node_count"...)
+	database = append(database, 0xc4)
+	database = binary.BigEndian.AppendUint32(database, uint32(len(nodes)))
+	database = append(database, 0x4b)
+	database = append(database, "record_size"...)
+	database = append(database, 0xa1, 24)
+	database = append(database, 0x4a)
+	database = append(database, "ip_version"...)
+	database = append(database, 0xa1, 4)
+	database = append(database, 0x5b)
+	database = append(database, "binary_format_major_version"...)
+	database = append(database, 0xa1, 2)
+	database = append(database, 0x4d)
+	database = append(database, "database_type"...)
+	database = append(database, 0x44)
+	database = append(database, "Test"...)
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	err := os.WriteFile(path, database, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	geoIP, err := util.NewGeoIP(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { geoIP.Close() })
+
+	return geoIP
+}
+
+func newTestIPFilterUsecase(t *testing.T, settings map[string]interface{}, geoIP *util.GeoIP) *IPFilterUsecase {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	config := koanf.New(".")
+	for key, value := range settings {
+		config.Set(key, value)
+	}
+
+	return NewIPFilterUsecase(repository.NewIPFilterRepository(zap.NewNop(), client), geoIP, zap.NewNop(), config)
+}
+
+func TestIPFilterCheck(t *testing.T) {
+	geoIP := newTestGeoIP(t, map[string]string{
+		"203.0.113.0/24":  "ID",
+		"198.51.100.0/24": "KP",
+		"192.0.2.0/24":    "US",
+	})
+
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		geoIP    *util.GeoIP
+		allow    []string
+		deny     []string
+		ip       string
+		reason   string
+		country  string
+	}{
+		{"no rules", nil, nil, nil, nil, "203.0.113.7", "", ""},
+		{"not an address", map[string]interface{}{"IP_ALLOW_LIST": "10.0.0.0/8"}, nil, nil, nil, "unknown", "", ""},
+		{"static deny", map[string]interface{}{"IP_DENY_LIST": "203.0.113.0/24"}, nil, nil, nil, "203.0.113.7", constant.IP_FILTER_BLOCKED_DENY_LIST, ""},
+		{"dynamic deny", nil, nil, nil, []string{"203.0.113.7"}, "203.0.113.7", constant.IP_FILTER_BLOCKED_DENY_LIST, ""},
+		{"deny of an IPv4-mapped address", nil, nil, nil, []string{"203.0.113.0/24"}, "::ffff:203.0.113.7", constant.IP_FILTER_BLOCKED_DENY_LIST, ""},
+		{"deny wins over allow", map[string]interface{}{"IP_ALLOW_LIST": "203.0.113.0/24"}, nil, nil, []string{"203.0.113.7"}, "203.0.113.7", constant.IP_FILTER_BLOCKED_DENY_LIST, ""},
+		{"outside the static allow list", map[string]interface{}{"IP_ALLOW_LIST": "10.0.0.0/8"}, nil, nil, nil, "203.0.113.7", constant.IP_FILTER_BLOCKED_ALLOW_LIST, ""},
+		{"outside the dynamic allow list", nil, nil, []string{"10.0.0.0/8"}, nil, "203.0.113.7", constant.IP_FILTER_BLOCKED_ALLOW_LIST, ""},
+		{"in the dynamic allow list", map[string]interface{}{"IP_ALLOW_LIST": "10.0.0.0/8"}, nil, []string{"2001:db8::/32"}, nil, "2001:db8::1", "", ""},
+		{"denied country", map[string]interface{}{"GEO_DENY_COUNTRIES": "kp, ru"}, geoIP, nil, nil, "198.51.100.9", constant.IP_FILTER_BLOCKED_COUNTRY, "KP"},
+		{"other country", map[string]interface{}{"GEO_DENY_COUNTRIES": "KP"}, geoIP, nil, nil, "203.0.113.7", "", "ID"},
+		{"allowed country", map[string]interface{}{"GEO_ALLOW_COUNTRIES": "ID,US"}, geoIP, nil, nil, "192.0.2.1", "", "US"},
+		{"outside the allowed countries", map[string]interface{}{"GEO_ALLOW_COUNTRIES": "ID"}, geoIP, nil, nil, "198.51.100.9", constant.IP_FILTER_BLOCKED_COUNTRY, "KP"},
+		{"unknown country passes", map[string]interface{}{"GEO_ALLOW_COUNTRIES": "ID"}, geoIP, nil, nil, "10.1.2.3", "", ""},
+		{"allow list before countries", map[string]interface{}{"IP_ALLOW_LIST": "10.0.0.0/8", "GEO_ALLOW_COUNTRIES": "ID"}, geoIP, nil, nil, "203.0.113.7", constant.IP_FILTER_BLOCKED_ALLOW_LIST, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ipFilterUsecase := newTestIPFilterUsecase(t, c.settings, c.geoIP)
+			ipFilterUsecase.allow, _ = util.ParseIPNetworks(strings.Join(c.allow, ","))
+			ipFilterUsecase.deny, _ = util.ParseIPNetworks(strings.Join(c.deny, ","))
+
+			reason, country := ipFilterUsecase.Check(c.ip)
+			if reason != c.reason || country != c.country {
+				t.Errorf("Check(%s) = %q, %q, want %q, %q", c.ip, reason, country, c.reason, c.country)
+			}
+		})
+	}
+}
+
+func TestIPFilterRulesRefuseSelfLockout(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		existing []model.IPFilterRuleRequest
+		add      *model.IPFilterRuleRequest
+		remove   *model.IPFilterRuleRequest
+		code     string
+	}{
+		{"deny own address", nil, nil,
+			&model.IPFilterRuleRequest{List: "deny", CIDR: "203.0.113.0/24"}, nil, constant.ERR_CONFLICT_ERROR},
+		{"deny another network", nil, nil,
+			&model.IPFilterRuleRequest{List: "deny", CIDR: "198.51.100.0/24"}, nil, ""},
+		{"first allow rule without own address", nil, nil,
+			&model.IPFilterRuleRequest{List: "allow", CIDR: "198.51.100.0/24"}, nil, constant.ERR_CONFLICT_ERROR},
+		{"first allow rule with own address", nil, nil,
+			&model.IPFilterRuleRequest{List: "allow", CIDR: "203.0.113.0/24"}, nil, ""},
+		{"allow rule next to the static allow list", map[string]interface{}{"IP_ALLOW_LIST": "203.0.113.7"}, nil,
+			&model.IPFilterRuleRequest{List: "allow", CIDR: "198.51.100.0/24"}, nil, ""},
+		{"remove the allow rule in use", nil,
+			[]model.IPFilterRuleRequest{{List: "allow", CIDR: "203.0.113.0/24"}, {List: "allow", CIDR: "198.51.100.0/24"}},
+			nil, &model.IPFilterRuleRequest{List: "allow", CIDR: "203.0.113.0/24"}, constant.ERR_CONFLICT_ERROR},
+		{"remove the allow rule in use, another covers it", nil,
+			[]model.IPFilterRuleRequest{{List: "allow", CIDR: "203.0.113.0/24"}, {List: "allow", CIDR: "203.0.0.0/16"}},
+			nil, &model.IPFilterRuleRequest{List: "allow", CIDR: "203.0.113.0/24"}, ""},
+		{"remove the allow rule in use, static allow covers it", map[string]interface{}{"IP_ALLOW_LIST": "203.0.113.7"},
+			[]model.IPFilterRuleRequest{{List: "allow", CIDR: "203.0.113.0/24"}},
+			nil, &model.IPFilterRuleRequest{List: "allow", CIDR: "203.0.113.0/24"}, ""},
+		{"remove the last allow rule", nil,
+			[]model.IPFilterRuleRequest{{List: "allow", CIDR: "203.0.113.0/24"}},
+			nil, &model.IPFilterRuleRequest{List: "allow", CIDR: "203.0.113.0/24"}, ""},
+		{"remove another allow rule", nil,
+			[]model.IPFilterRuleRequest{{List: "allow", CIDR: "203.0.113.0/24"}, {List: "allow", CIDR: "198.51.100.0/24"}},
+			nil, &model.IPFilterRuleRequest{List: "allow", CIDR: "198.51.100.0/24"}, ""},
+		{"remove a deny rule", nil,
+			[]model.IPFilterRuleRequest{{List: "deny", CIDR: "198.51.100.0/24"}},
+			nil, &model.IPFilterRuleRequest{List: "deny", CIDR: "198.51.100.0/24"}, ""},
+		{"remove a missing rule", nil, nil,
+			nil, &model.IPFilterRuleRequest{List: "deny", CIDR: "198.51.100.0/24"}, constant.ERR_NOT_FOUND_ERROR},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ipFilterUsecase := newTestIPFilterUsecase(t, c.settings, nil)
+
+			withFiberCtx(t, func(ctx *fiber.Ctx) {
+				for _, rule := range c.existing {
+					err := ipFilterUsecase.IPFilterRepository.Add(ctx.Context(), rule.List, rule.CIDR)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				err := ipFilterUsecase.Refresh(ctx.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ctx.Locals("clientIp", "203.0.113.7")
+				if c.add != nil {
+					_, err = ipFilterUsecase.AddRule(ctx, *c.add)
+				} else {
+					_, err = ipFilterUsecase.RemoveRule(ctx, *c.remove)
+				}
+				if code := validationCode(err); code != c.code || (c.code == "" && err != nil) {
+					t.Fatalf("error = %v, want code %q", err, c.code)
+				}
+
+				if reason, _ := ipFilterUsecase.Check("203.0.113.7"); reason != "" {
+					t.Errorf("the admin is blocked with %s after the change", reason)
+				}
+			})
+		})
+	}
+}
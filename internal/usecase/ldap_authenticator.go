@@ -0,0 +1,303 @@
+package usecase
+
+import (
+	"context"
+	"crypto/tls"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/util"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	DefaultLDAPUserFilter = "(&(objectClass=person)(|(uid={identifier})(mail={identifier})))"
+	DefaultLDAPTimeout    = 5 * time.Second
+)
+
+// DirectoryUserStore keeps the users rows of directory entries, it is the UserRepository outside of tests
+type DirectoryUserStore interface {
+	UpsertDirectoryUser(ctx context.Context, user model.User) (int, error)
+	GetDirectoryUserId(ctx context.Context, dn string) (int, error)
+	GetDirectoryDN(ctx context.Context, userId int) (string, error)
+}
+
+// LDAPAuthenticator checks credentials by binding as the directory entry found for the identifier. Directory
+// users get a users row on their first login and their username, email and role are refreshed from the directory
+// on every login. Local accounts with the same username or email are left alone and the login is refused
+type LDAPAuthenticator struct {
+	UserRepository    DirectoryUserStore
+	EmailPolicy       *util.EmailPolicy
+	Log               *zap.Logger
+	URL               string
+	StartTLS          bool
+	BindDN            string
+	BindPassword      string
+	BaseDN            string
+	UserFilter        string
+	UsernameAttribute string
+	EmailAttribute    string
+	GroupAttribute    string
+	// AdminGroups are the groups whose members get the admin role, everyone else is a user
+	AdminGroups []*ldap.DN
+	Timeout     time.Duration
+}
+
+func NewLDAPAuthenticator(userRepository DirectoryUserStore, emailPolicy *util.EmailPolicy, zap *zap.Logger, koanf *koanf.Koanf) (*LDAPAuthenticator, error) {
+	authenticator := &LDAPAuthenticator{
+		UserRepository:    userRepository,
+		EmailPolicy:       emailPolicy,
+		Log:               zap,
+		URL:               koanf.String("LDAP_URL"),
+		StartTLS:          koanf.Bool("LDAP_START_TLS"),
+		BindDN:            koanf.String("LDAP_BIND_DN"),
+		BindPassword:      koanf.String("LDAP_BIND_PASSWORD"),
+		BaseDN:            koanf.String("LDAP_BASE_DN"),
+		UserFilter:        koanf.String("LDAP_USER_FILTER"),
+		UsernameAttribute: koanf.String("LDAP_USERNAME_ATTRIBUTE"),
+		EmailAttribute:    koanf.String("LDAP_EMAIL_ATTRIBUTE"),
+		GroupAttribute:    koanf.String("LDAP_GROUP_ATTRIBUTE"),
+		Timeout:           DefaultLDAPTimeout,
+	}
+
+	if authenticator.URL == "" || authenticator.BaseDN == "" {
+		return nil, errors.New("LDAP_URL and LDAP_BASE_DN are required")
+	}
+	if authenticator.UserFilter == "" {
+		authenticator.UserFilter = DefaultLDAPUserFilter
+	}
+	if authenticator.UsernameAttribute == "" {
+		authenticator.UsernameAttribute = "uid"
+	}
+	if authenticator.EmailAttribute == "" {
+		authenticator.EmailAttribute = "mail"
+	}
+	if authenticator.GroupAttribute == "" {
+		authenticator.GroupAttribute = "memberOf"
+	}
+	if seconds := koanf.Int("LDAP_TIMEOUT"); seconds > 0 {
+		authenticator.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	// group DNs contain commas, so the list is separated by semicolons
+	for _, group := range strings.Split(koanf.String("LDAP_ADMIN_GROUPS"), ";") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+
+		dn, err := ldap.ParseDN(group)
+		if err != nil {
+			return nil, fmt.Errorf("LDAP_ADMIN_GROUPS contains an invalid DN %q: %w", group, err)
+		}
+		authenticator.AdminGroups = append(authenticator.AdminGroups, dn)
+	}
+
+	return authenticator, nil
+}
+
+func (authenticator *LDAPAuthenticator) Name() string {
+	return AuthenticatorLDAP
+}
+
+func (authenticator *LDAPAuthenticator) ManagesPasswords() bool {
+	return false
+}
+
+func (authenticator *LDAPAuthenticator) Authenticate(ctx context.Context, identifier string, password string) (int, error) {
+	// most directories treat a bind with an empty password as an anonymous bind that succeeds
+	if password == "" {
+		return 0, errIncorrectPassword()
+	}
+
+	conn, err := authenticator.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if authenticator.BindDN != "" {
+		err = conn.Bind(authenticator.BindDN, authenticator.BindPassword)
+		if err != nil {
+			return 0, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	entry, err := authenticator.findEntry(conn, identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	username, err := util.NormalizeUsername(entry.GetAttributeValue(authenticator.UsernameAttribute))
+	if err != nil {
+		util.ContextLogger(ctx, authenticator.Log).Warn("Directory username cannot be used as a username", zap.String("dn", entry.DN), zap.Error(err))
+		return 0, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Directory account cannot be used to log in",
+			Param:   "identifier",
+		}
+	}
+
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			// only entries that logged in before have a row the failure can be recorded for
+			userId, _ := authenticator.UserRepository.GetDirectoryUserId(ctx, entry.DN)
+			return userId, errIncorrectPassword()
+		}
+		return 0, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	return authenticator.provision(ctx, entry, username)
+}
+
+// Reauthenticate binds as the entry the user's row was created for. The username of the row may have been
+// suffixed to be unique or the directory may know the user by another attribute, the DN does not change with either
+func (authenticator *LDAPAuthenticator) Reauthenticate(ctx context.Context, userId int, password string) error {
+	if password == "" {
+		return errIncorrectPassword()
+	}
+
+	dn, err := authenticator.UserRepository.GetDirectoryDN(ctx, userId)
+	if err != nil {
+		return err
+	}
+	// a local account has no directory password to confirm
+	if dn == "" {
+		return errIncorrectPassword()
+	}
+
+	conn, err := authenticator.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Bind(dn, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return errIncorrectPassword()
+		}
+		return fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	return nil
+}
+
+func (authenticator *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(authenticator.URL, ldap.DialWithDialer(&net.Dialer{Timeout: authenticator.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(authenticator.Timeout)
+
+	if authenticator.StartTLS {
+		serverURL, err := url.Parse(authenticator.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		err = conn.StartTLS(&tls.Config{ServerName: serverURL.Hostname()})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// findEntry searches the user entry for an identifier, an identifier matching several entries is refused
+// since binding as an arbitrary one of them could log the person in as somebody else
+func (authenticator *LDAPAuthenticator) findEntry(conn *ldap.Conn, identifier string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(authenticator.UserFilter, "{identifier}", ldap.EscapeFilter(identifier))
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		authenticator.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(authenticator.Timeout.Seconds()), false,
+		filter,
+		[]string{authenticator.UsernameAttribute, authenticator.EmailAttribute, authenticator.GroupAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+
+	if result == nil || len(result.Entries) == 0 {
+		return nil, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Username is not found",
+			Param:   "identifier",
+		}
+	}
+	if len(result.Entries) > 1 {
+		authenticator.Log.Warn("Identifier matches more than one directory entry", zap.String("filter", filter))
+		return nil, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Username is ambiguous",
+			Param:   "identifier",
+		}
+	}
+
+	return result.Entries[0], nil
+}
+
+// provision creates or refreshes the users row of a directory entry that just authenticated
+func (authenticator *LDAPAuthenticator) provision(ctx context.Context, entry *ldap.Entry, username string) (int, error) {
+	email, err := util.NormalizeEmail(entry.GetAttributeValue(authenticator.EmailAttribute))
+	if err != nil {
+		util.ContextLogger(ctx, authenticator.Log).Warn("Directory entry has no valid email address", zap.String("dn", entry.DN))
+		return 0, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Directory account has no valid email address",
+			Param:   "identifier",
+		}
+	}
+
+	now := time.Now()
+	userId, err := authenticator.UserRepository.UpsertDirectoryUser(ctx, model.User{
+		Username:         username,
+		UsernameSkeleton: util.UsernameSkeleton(username),
+		Email:            email,
+		EmailCanonical:   authenticator.EmailPolicy.Canonicalize(email),
+		Role:             authenticator.role(entry),
+		DirectoryDN:      entry.DN,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	})
+	if err != nil {
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Code == constant.ERR_CONFLICT_ERROR {
+			util.ContextLogger(ctx, authenticator.Log).Warn("Directory entry collides with an account it does not own", zap.String("dn", entry.DN), zap.Error(err))
+		}
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (authenticator *LDAPAuthenticator) role(entry *ldap.Entry) string {
+	for _, group := range entry.GetAttributeValues(authenticator.GroupAttribute) {
+		dn, err := ldap.ParseDN(group)
+		if err != nil {
+			continue
+		}
+
+		for _, adminGroup := range authenticator.AdminGroups {
+			if adminGroup.EqualFold(dn) {
+				return constant.ROLE_ADMIN
+			}
+		}
+	}
+
+	return constant.ROLE_USER
+}
@@ -0,0 +1,335 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/util"
+	"errors"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	testLDAPBindDN       = "cn=service,dc=example,dc=com"
+	testLDAPBindPassword = "service-secret"
+	testLDAPAdminGroup   = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+// testLDAPFilterTerm picks the equality terms out of the user filter, enough to answer DefaultLDAPUserFilter
+var testLDAPFilterTerm = regexp.MustCompile(`\((uid|mail)=([^)]*)\)`)
+
+type testLDAPEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// startTestDirectory serves entries over plain LDAP on a loopback port until the test ends. Binds succeed for the
+// service account and for entries with their userPassword, searches match the uid and mail terms of the filter
+// ignoring case like the directory's attribute syntax does
+func startTestDirectory(t *testing.T, entries ...testLDAPEntry) string {
+	t.Helper()
+
+	bind := func(w *gldap.ResponseWriter, r *gldap.Request) {
+		response := r.NewBindResponse(gldap.WithResponseCode(gldap.ResultInvalidCredentials))
+		defer w.Write(response)
+
+		message, err := r.GetSimpleBindMessage()
+		if err != nil {
+			return
+		}
+
+		if message.UserName == testLDAPBindDN && string(message.Password) == testLDAPBindPassword {
+			response.SetResultCode(gldap.ResultSuccess)
+			return
+		}
+		for _, entry := range entries {
+			if entry.dn == message.UserName && slices.Contains(entry.attributes["userPassword"], string(message.Password)) {
+				response.SetResultCode(gldap.ResultSuccess)
+				return
+			}
+		}
+	}
+
+	search := func(w *gldap.ResponseWriter, r *gldap.Request) {
+		done := r.NewSearchDoneResponse(gldap.WithResponseCode(gldap.ResultSuccess))
+		defer w.Write(done)
+
+		message, err := r.GetSearchMessage()
+		if err != nil {
+			done.SetResultCode(gldap.ResultProtocolError)
+			return
+		}
+
+		terms := testLDAPFilterTerm.FindAllStringSubmatch(message.Filter, -1)
+		for _, entry := range entries {
+			matched := slices.ContainsFunc(terms, func(term []string) bool {
+				return slices.ContainsFunc(entry.attributes[term[1]], func(value string) bool {
+					return strings.EqualFold(value, term[2])
+				})
+			})
+			if !matched {
+				continue
+			}
+
+			result := r.NewSearchResponseEntry(entry.dn)
+			for name, values := range entry.attributes {
+				if name != "userPassword" {
+					result.AddAttribute(name, values)
+				}
+			}
+			w.Write(result)
+		}
+	}
+
+	mux, err := gldap.NewMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.Bind(bind)
+	mux.Search(search)
+
+	server, err := gldap.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Router(mux)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	go server.Run(addr)
+	t.Cleanup(func() { server.Stop() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("test directory did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return "ldap://" + addr
+}
+
+// fakeDirectoryUserStore keeps directory users by DN the way UpsertDirectoryUser does
+type fakeDirectoryUserStore struct {
+	users     map[string]model.User
+	upsertErr error
+}
+
+func (store *fakeDirectoryUserStore) UpsertDirectoryUser(ctx context.Context, user model.User) (int, error) {
+	if store.upsertErr != nil {
+		return 0, store.upsertErr
+	}
+
+	if existing, ok := store.users[user.DirectoryDN]; ok {
+		user.Id = existing.Id
+	} else {
+		user.Id = len(store.users) + 1
+	}
+	store.users[user.DirectoryDN] = user
+
+	return user.Id, nil
+}
+
+func (store *fakeDirectoryUserStore) GetDirectoryUserId(ctx context.Context, dn string) (int, error) {
+	return store.users[dn].Id, nil
+}
+
+func (store *fakeDirectoryUserStore) GetDirectoryDN(ctx context.Context, userId int) (string, error) {
+	for dn, user := range store.users {
+		if user.Id == userId {
+			return dn, nil
+		}
+	}
+
+	return "", nil
+}
+
+func newTestLDAPAuthenticator(t *testing.T, entries ...testLDAPEntry) (*LDAPAuthenticator, *fakeDirectoryUserStore) {
+	t.Helper()
+
+	config := koanf.New(".")
+	config.Set("LDAP_URL", startTestDirectory(t, entries...))
+	config.Set("LDAP_BIND_DN", testLDAPBindDN)
+	config.Set("LDAP_BIND_PASSWORD", testLDAPBindPassword)
+	config.Set("LDAP_BASE_DN", "dc=example,dc=com")
+	config.Set("LDAP_ADMIN_GROUPS", testLDAPAdminGroup)
+
+	store := &fakeDirectoryUserStore{users: map[string]model.User{}}
+	authenticator, err := NewLDAPAuthenticator(store, &util.EmailPolicy{}, zap.NewNop(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return authenticator, store
+}
+
+func testLDAPPerson(uid string, mail string, password string, groups ...string) testLDAPEntry {
+	return testLDAPEntry{
+		dn: "uid=" + uid + ",ou=people,dc=example,dc=com",
+		attributes: map[string][]string{
+			"uid":          {uid},
+			"mail":         {mail},
+			"userPassword": {password},
+			"memberOf":     groups,
+		},
+	}
+}
+
+func TestLDAPAuthenticatorProvisionsOnFirstLogin(t *testing.T) {
+	alice := testLDAPPerson("alice", "Alice@Example.com", "a directory passphrase longer than twenty bytes")
+	authenticator, store := newTestLDAPAuthenticator(t, alice)
+	ctx := context.Background()
+
+	userId, err := authenticator.Authenticate(ctx, "alice", "a directory passphrase longer than twenty bytes")
+	if err != nil {
+		t.Fatalf("Authenticate = %v", err)
+	}
+
+	user, ok := store.users[alice.dn]
+	if !ok || user.Id != userId {
+		t.Fatalf("directory entry was not provisioned, users = %+v", store.users)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.Role != constant.ROLE_USER {
+		t.Errorf("provisioned user = %+v", user)
+	}
+
+	// the second login finds the row by DN, logging in by email works as well
+	againId, err := authenticator.Authenticate(ctx, "alice@example.com", "a directory passphrase longer than twenty bytes")
+	if err != nil {
+		t.Fatalf("second Authenticate = %v", err)
+	}
+	if againId != userId || len(store.users) != 1 {
+		t.Errorf("second login gave user %d and %d rows, want user %d and 1 row", againId, len(store.users), userId)
+	}
+}
+
+func TestLDAPAuthenticatorWrongPassword(t *testing.T) {
+	bobby := testLDAPPerson("bobby", "bobby@example.com", "bobby-password")
+	authenticator, _ := newTestLDAPAuthenticator(t, bobby)
+	ctx := context.Background()
+
+	// an entry that never logged in has no row to record the failure for
+	userId, err := authenticator.Authenticate(ctx, "bobby", "wrong-password")
+	if validationCode(err) != constant.ERR_VALIDATION_CODE || userId != 0 {
+		t.Fatalf("Authenticate before the first login = (%d, %v), want (0, incorrect password)", userId, err)
+	}
+
+	knownId, err := authenticator.Authenticate(ctx, "bobby", "bobby-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userId, err = authenticator.Authenticate(ctx, "bobby", "wrong-password")
+	var validationErr *model.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Param != "password" {
+		t.Fatalf("Authenticate = %v, want incorrect password", err)
+	}
+	if userId != knownId {
+		t.Errorf("failed login returned user %d, want %d so the attempt is recorded", userId, knownId)
+	}
+
+	_, err = authenticator.Authenticate(ctx, "bobby", "")
+	if err == nil {
+		t.Error("an empty password was accepted, directories treat it as an anonymous bind")
+	}
+}
+
+func TestLDAPAuthenticatorRefusesAmbiguousIdentifier(t *testing.T) {
+	authenticator, store := newTestLDAPAuthenticator(t,
+		testLDAPPerson("carol", "team@example.com", "carol-password"),
+		testLDAPPerson("david", "team@example.com", "david-password"),
+	)
+
+	_, err := authenticator.Authenticate(context.Background(), "team@example.com", "carol-password")
+	var validationErr *model.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Message != "Username is ambiguous" {
+		t.Fatalf("Authenticate = %v, want the ambiguous username error", err)
+	}
+	if len(store.users) != 0 {
+		t.Errorf("ambiguous login provisioned %+v", store.users)
+	}
+}
+
+func TestLDAPAuthenticatorMapsGroupsToRoles(t *testing.T) {
+	erin := testLDAPPerson("erin", "erin@example.com", "erin-password", "CN=Admins,OU=Groups,DC=example,DC=com")
+	frank := testLDAPPerson("frank", "frank@example.com", "frank-password", "cn=staff,ou=groups,dc=example,dc=com", "not a dn")
+	authenticator, store := newTestLDAPAuthenticator(t, erin, frank)
+	ctx := context.Background()
+
+	for _, uid := range []string{"erin", "frank"} {
+		_, err := authenticator.Authenticate(ctx, uid, uid+"-password")
+		if err != nil {
+			t.Fatalf("Authenticate(%s) = %v", uid, err)
+		}
+	}
+
+	if role := store.users[erin.dn].Role; role != constant.ROLE_ADMIN {
+		t.Errorf("member of %s got role %q, want admin", testLDAPAdminGroup, role)
+	}
+	if role := store.users[frank.dn].Role; role != constant.ROLE_USER {
+		t.Errorf("member of other groups got role %q, want user", role)
+	}
+}
+
+func TestLDAPAuthenticatorReturnsConflicts(t *testing.T) {
+	authenticator, store := newTestLDAPAuthenticator(t, testLDAPPerson("grace", "grace@example.com", "grace-password"))
+	store.upsertErr = &model.ValidationError{Code: constant.ERR_CONFLICT_ERROR, Message: "Username is already exist", Param: "username"}
+
+	_, err := authenticator.Authenticate(context.Background(), "grace", "grace-password")
+	if validationCode(err) != constant.ERR_CONFLICT_ERROR {
+		t.Fatalf("Authenticate = %v, want the conflict with the local account", err)
+	}
+}
+
+func TestLDAPAuthenticatorReauthenticatesByDN(t *testing.T) {
+	henry := testLDAPPerson("henry", "henry@example.com", "henry-password")
+	authenticator, store := newTestLDAPAuthenticator(t, henry)
+	ctx := context.Background()
+
+	userId, err := authenticator.Authenticate(ctx, "henry", "henry-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the row's username was suffixed to be unique, the directory has no entry by that name
+	user := store.users[henry.dn]
+	user.Username = "henry-0042"
+	store.users[henry.dn] = user
+
+	err = authenticator.Reauthenticate(ctx, userId, "henry-password")
+	if err != nil {
+		t.Errorf("Reauthenticate = %v, want the directory password confirmed", err)
+	}
+
+	err = authenticator.Reauthenticate(ctx, userId, "wrong-password")
+	var validationErr *model.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Param != "password" {
+		t.Errorf("Reauthenticate with a wrong password = %v, want incorrect password", err)
+	}
+
+	err = authenticator.Reauthenticate(ctx, userId, "")
+	if err == nil {
+		t.Error("an empty password was accepted, directories treat it as an anonymous bind")
+	}
+
+	// a local account has no entry to bind as
+	err = authenticator.Reauthenticate(ctx, userId+1, "henry-password")
+	if !errors.As(err, &validationErr) || validationErr.Param != "password" {
+		t.Errorf("Reauthenticate of a local account = %v, want incorrect password", err)
+	}
+}
@@ -0,0 +1,298 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	// QuotaMetrics are the metered metrics in the order usage is reported, each with the window it is counted over
+	QuotaMetrics       = []string{constant.QUOTA_METRIC_API_CALLS, constant.QUOTA_METRIC_SERVICE_ACCOUNTS, constant.QUOTA_METRIC_INVITES}
+	QuotaMetricWindows = map[string]string{
+		constant.QUOTA_METRIC_API_CALLS:        constant.QUOTA_WINDOW_DAY,
+		constant.QUOTA_METRIC_SERVICE_ACCOUNTS: constant.QUOTA_WINDOW_MONTH,
+		constant.QUOTA_METRIC_INVITES:          constant.QUOTA_WINDOW_MONTH,
+	}
+	quotaMetricLabels = map[string]string{
+		constant.QUOTA_METRIC_API_CALLS:        "API calls",
+		constant.QUOTA_METRIC_SERVICE_ACCOUNTS: "Service accounts",
+		constant.QUOTA_METRIC_INVITES:          "Invites",
+	}
+
+	// DefaultPlans apply where PLAN_<PLAN>_<METRIC> is not set, enterprise has no quotas and is only metered
+	DefaultPlans = map[string]map[string]int{
+		constant.PLAN_FREE: {
+			constant.QUOTA_METRIC_API_CALLS:        1000,
+			constant.QUOTA_METRIC_SERVICE_ACCOUNTS: 2,
+			constant.QUOTA_METRIC_INVITES:          20,
+		},
+		constant.PLAN_PRO: {
+			constant.QUOTA_METRIC_API_CALLS:        50000,
+			constant.QUOTA_METRIC_SERVICE_ACCOUNTS: 20,
+			constant.QUOTA_METRIC_INVITES:          500,
+		},
+		constant.PLAN_ENTERPRISE: {},
+	}
+
+	DefaultUsageFlushInterval = time.Minute
+	// usageFlushBatch bounds how many counters one flush round writes
+	usageFlushBatch = 500
+	// usageCounterGrace keeps a counter in Redis a while after its window so the last flush still finds it
+	usageCounterGrace = time.Hour
+)
+
+// QuotaUsecase meters what each user consumes and enforces the quotas of their plan. Counters live in Redis
+// and are flushed to Postgres by FlushPeriodically
+type QuotaUsecase struct {
+	QuotaRepository *repository.QuotaRepository
+	Log             *zap.Logger
+	Config          *koanf.Koanf
+}
+
+func NewQuotaUsecase(quotaRepository *repository.QuotaRepository, zap *zap.Logger, koanf *koanf.Koanf) *QuotaUsecase {
+	return &QuotaUsecase{
+		QuotaRepository: quotaRepository,
+		Log:             zap,
+		Config:          koanf,
+	}
+}
+
+// Plan is a plan with its quotas, PLAN_<PLAN>_<METRIC> overrides a default quota and -1 removes it.
+// The bool is false for unknown plans
+func (usecase *QuotaUsecase) Plan(name string) (model.Plan, bool) {
+	defaults, ok := DefaultPlans[name]
+	if !ok {
+		return model.Plan{}, false
+	}
+
+	plan := model.Plan{Name: name, Quotas: map[string]int{}}
+	for _, metric := range QuotaMetrics {
+		limit, ok := defaults[metric]
+
+		key := "PLAN_" + strings.ToUpper(name) + "_" + strings.ToUpper(metric)
+		if value := usecase.Config.Int(key); value > 0 {
+			limit, ok = value, true
+		} else if value < 0 {
+			ok = false
+		}
+
+		if ok {
+			plan.Quotas[metric] = limit
+		}
+	}
+
+	return plan, true
+}
+
+// UserPlan is the plan of a user, users without one and users on a plan that no longer exists get DEFAULT_PLAN
+func (usecase *QuotaUsecase) UserPlan(ctx context.Context, userId int) (model.Plan, error) {
+	name, err := usecase.QuotaRepository.GetUserPlan(ctx, userId)
+	if err != nil {
+		return model.Plan{}, err
+	}
+
+	plan, ok := usecase.Plan(name)
+	if !ok {
+		plan, _ = usecase.Plan(usecase.defaultPlan())
+	}
+
+	return plan, nil
+}
+
+// Consume counts one unit of metric for the user and fails with QUOTA_EXCEEDED_ERROR once the plan's quota for
+// the current window is used up
+func (usecase *QuotaUsecase) Consume(ctx *fiber.Ctx, userId int, metric string) (model.MetricUsage, error) {
+	plan, err := usecase.UserPlan(ctx.Context(), userId)
+	if err != nil {
+		return model.MetricUsage{}, err
+	}
+
+	usage := newMetricUsage(metric, plan, time.Now())
+
+	limit := -1
+	if usage.Limit != nil {
+		limit = *usage.Limit
+	}
+
+	used, allowed, err := usecase.QuotaRepository.Consume(ctx.Context(), userId, metric, usage.WindowStart, usageCounterTTL(usage), limit)
+	if err != nil {
+		return usage, err
+	}
+	usage.Used = used
+
+	if !allowed {
+		return usage, &model.ValidationError{
+			Code:    constant.ERR_QUOTA_EXCEEDED_ERROR,
+			Message: "Quota exceeded",
+			Param:   metric,
+			Errors: []model.FieldError{{
+				Param: metric,
+				Code:  constant.FIELD_ERR_QUOTA_EXCEEDED,
+				Args: map[string]interface{}{
+					"limit":    limit,
+					"used":     used,
+					"resetsAt": usage.ResetsAt.Format(time.RFC3339),
+				},
+				Label: quotaMetricLabels[metric],
+			}},
+		}
+	}
+
+	return usage, nil
+}
+
+// Refund gives back a unit consumed for an operation that failed afterwards
+func (usecase *QuotaUsecase) Refund(ctx *fiber.Ctx, userId int, usage model.MetricUsage) {
+	err := usecase.QuotaRepository.Refund(ctx.Context(), userId, usage.Metric, usage.WindowStart)
+	if err != nil {
+		util.Logger(ctx, usecase.Log).Warn("Failed to refund quota", zap.Int("userId", userId), zap.String("metric", usage.Metric), zap.Error(err))
+	}
+}
+
+// Usage reports the user's usage of every metric in the current windows against their plan
+func (usecase *QuotaUsecase) Usage(ctx *fiber.Ctx, userId int) (model.UsageResponse, error) {
+	plan, err := usecase.UserPlan(ctx.Context(), userId)
+	if err != nil {
+		return model.UsageResponse{}, err
+	}
+
+	response := model.UsageResponse{UserId: userId, Plan: plan.Name, Metrics: []model.MetricUsage{}}
+	now := time.Now()
+
+	for _, metric := range QuotaMetrics {
+		usage := newMetricUsage(metric, plan, now)
+
+		usage.Used, err = usecase.QuotaRepository.FindUsage(ctx.Context(), userId, metric, usage.WindowStart, usageCounterTTL(usage))
+		if err != nil {
+			return response, err
+		}
+
+		response.Metrics = append(response.Metrics, usage)
+	}
+
+	return response, nil
+}
+
+func (usecase *QuotaUsecase) SetPlan(ctx *fiber.Ctx, userId int, payload model.PlanUpdateRequest) (model.UsageResponse, error) {
+	err := util.Validate(payload)
+	if err != nil {
+		return model.UsageResponse{}, err
+	}
+
+	if _, ok := usecase.Plan(payload.Plan); !ok {
+		return model.UsageResponse{}, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Plan is not known",
+			Param:   "plan",
+		}
+	}
+
+	err = usecase.QuotaRepository.UpdateUserPlan(ctx.Context(), userId, payload.Plan, time.Now())
+	if err != nil {
+		return model.UsageResponse{}, err
+	}
+
+	return usecase.Usage(ctx, userId)
+}
+
+// FlushPeriodically writes changed counters to Postgres every USAGE_FLUSH_INTERVAL seconds until ctx is done
+func (usecase *QuotaUsecase) FlushPeriodically(ctx context.Context) {
+	interval := DefaultUsageFlushInterval
+	if seconds := usecase.Config.Int("USAGE_FLUSH_INTERVAL"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := usecase.Flush(ctx)
+			if err != nil {
+				usecase.Log.Error("Failed to flush usage counters", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush writes every counter changed since the last flush, counters that fail to write are put back for the next one
+func (usecase *QuotaUsecase) Flush(ctx context.Context) error {
+	for {
+		takenAt := time.Now()
+		counters, err := usecase.QuotaRepository.TakeDirtyCounters(ctx, usageFlushBatch)
+		if err != nil {
+			return err
+		}
+		if len(counters) == 0 {
+			return nil
+		}
+
+		err = usecase.QuotaRepository.UpsertCounters(ctx, counters, takenAt)
+		if err != nil {
+			if markErr := usecase.QuotaRepository.MarkDirty(ctx, counters); markErr != nil {
+				usecase.Log.Error("Failed to requeue usage counters", zap.Error(markErr))
+			}
+			return err
+		}
+
+		if len(counters) < usageFlushBatch {
+			return nil
+		}
+	}
+}
+
+func (usecase *QuotaUsecase) defaultPlan() string {
+	if name := usecase.Config.String("DEFAULT_PLAN"); name != "" {
+		if _, ok := DefaultPlans[name]; ok {
+			return name
+		}
+	}
+
+	return constant.PLAN_FREE
+}
+
+// newMetricUsage is an empty usage of metric in the window now falls in, windows are calendar days and
+// months in UTC
+func newMetricUsage(metric string, plan model.Plan, now time.Time) model.MetricUsage {
+	now = now.UTC()
+	window := QuotaMetricWindows[metric]
+
+	var windowStart, resetsAt time.Time
+	switch window {
+	case constant.QUOTA_WINDOW_MONTH:
+		windowStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		resetsAt = windowStart.AddDate(0, 1, 0)
+	default:
+		window = constant.QUOTA_WINDOW_DAY
+		windowStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		resetsAt = windowStart.AddDate(0, 0, 1)
+	}
+
+	usage := model.MetricUsage{
+		Metric:      metric,
+		Window:      window,
+		WindowStart: windowStart,
+		ResetsAt:    resetsAt,
+	}
+	if limit, ok := plan.Quotas[metric]; ok {
+		usage.Limit = &limit
+	}
+
+	return usage
+}
+
+func usageCounterTTL(usage model.MetricUsage) time.Duration {
+	return time.Until(usage.ResetsAt) + usageCounterGrace
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// DefaultRateLimitPolicies apply to route groups whose RATE_LIMIT_<GROUP> settings are not set
+var DefaultRateLimitPolicies = map[string]model.RateLimitPolicy{
+	"api":  {Limit: 100, Period: time.Minute, By: constant.RATE_LIMIT_BY_IP},
+	"auth": {Limit: 5, Period: 5 * time.Minute, By: constant.RATE_LIMIT_BY_IP},
+	// a CLI polls for its device token every few seconds until the user approves it
+	"device": {Limit: 20, Period: time.Minute, By: constant.RATE_LIMIT_BY_IP},
+	"users":  {Limit: 60, Period: time.Minute, By: constant.RATE_LIMIT_BY_USER},
+	"admin":  {Limit: 60, Period: time.Minute, By: constant.RATE_LIMIT_BY_USER},
+	"oauth":  {Limit: 30, Period: time.Minute, By: constant.RATE_LIMIT_BY_IP},
+	"scim":   {Limit: 600, Period: time.Minute, By: constant.RATE_LIMIT_BY_API_KEY},
+	// counted before the SCIM token is checked, so guessing tokens is limited too. Several tenants may sync from
+	// the same IdP addresses, so it is well above the per tenant limit
+	"scim_auth": {Limit: 3000, Period: time.Minute, By: constant.RATE_LIMIT_BY_IP},
+}
+
+// RateLimitUsecase counts requests in Redis so the limits hold across prefork children and instances
+type RateLimitUsecase struct {
+	RateLimitRepository *repository.RateLimitRepository
+	Log                 *zap.Logger
+	Config              *koanf.Koanf
+}
+
+func NewRateLimitUsecase(rateLimitRepository *repository.RateLimitRepository, zap *zap.Logger, koanf *koanf.Koanf) *RateLimitUsecase {
+	return &RateLimitUsecase{
+		RateLimitRepository: rateLimitRepository,
+		Log:                 zap,
+		Config:              koanf,
+	}
+}
+
+// Policy is the policy of a route group, RATE_LIMIT_<GROUP>, RATE_LIMIT_<GROUP>_PERIOD (seconds) and
+// RATE_LIMIT_<GROUP>_BY override its defaults. The bool is false when RATE_LIMIT_ENABLED is off
+func (usecase *RateLimitUsecase) Policy(group string) (model.RateLimitPolicy, bool, error) {
+	if !usecase.Config.Bool("RATE_LIMIT_ENABLED") {
+		return model.RateLimitPolicy{}, false, nil
+	}
+
+	policy, ok := DefaultRateLimitPolicies[group]
+	if !ok {
+		policy = DefaultRateLimitPolicies["api"]
+	}
+	policy.Name = group
+
+	prefix := "RATE_LIMIT_" + strings.ToUpper(group)
+	if limit := usecase.Config.Int(prefix); limit > 0 {
+		policy.Limit = limit
+	}
+	if seconds := usecase.Config.Int(prefix + "_PERIOD"); seconds > 0 {
+		policy.Period = time.Duration(seconds) * time.Second
+	}
+	if by := usecase.Config.String(prefix + "_BY"); by != "" {
+		policy.By = strings.ToLower(by)
+	}
+
+	switch policy.By {
+	case constant.RATE_LIMIT_BY_IP, constant.RATE_LIMIT_BY_USER, constant.RATE_LIMIT_BY_API_KEY:
+		return policy, true, nil
+	default:
+		return policy, false, fmt.Errorf("%s_BY must be one of ip, user or apikey, got %q", prefix, policy.By)
+	}
+}
+
+// Take counts one request of subject against policy
+func (usecase *RateLimitUsecase) Take(ctx *fiber.Ctx, policy model.RateLimitPolicy, subject string) (model.RateLimitResult, error) {
+	return usecase.RateLimitRepository.Take(ctx.Context(), policy, subject)
+}
@@ -0,0 +1,431 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	SAMLRequestTTL = 10 * time.Minute
+	// samlEmailAttributes are looked up in order when the NameID is not an email address
+	samlEmailAttributes = []string{
+		"email",
+		"mail",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+)
+
+// SAMLUserStore keeps the users rows of SAML identities, it is the UserRepository outside of tests
+type SAMLUserStore interface {
+	GetSAMLUserId(ctx context.Context, identityProviderId int, nameId string) (int, error)
+	LinkSAMLUser(ctx context.Context, identityProviderId int, subject model.SAMLSubject, updatedAt time.Time) (int, error)
+	CreateSAMLUser(ctx context.Context, user model.User) (int, error)
+}
+
+// SAMLUsecase is the SAML 2.0 service provider, users are sent to the IdP configured for their email domain
+// and come back through the assertion consumer service where a signed assertion logs them in
+type SAMLUsecase struct {
+	SAMLRepository *repository.SAMLRepository
+	UserRepository SAMLUserStore
+	UserUsecase    *UserUsecase
+	EmailPolicy    *util.EmailPolicy
+	// ServiceProvider holds this server's SP settings, nil when SAML is not configured
+	ServiceProvider *saml.ServiceProvider
+	Log             *zap.Logger
+	Config          *koanf.Koanf
+}
+
+func NewSAMLUsecase(samlRepository *repository.SAMLRepository, userRepository SAMLUserStore, userUsecase *UserUsecase, emailPolicy *util.EmailPolicy, serviceProvider *saml.ServiceProvider, zap *zap.Logger, koanf *koanf.Koanf) *SAMLUsecase {
+	return &SAMLUsecase{
+		SAMLRepository:  samlRepository,
+		UserRepository:  userRepository,
+		UserUsecase:     userUsecase,
+		EmailPolicy:     emailPolicy,
+		ServiceProvider: serviceProvider,
+		Log:             zap,
+		Config:          koanf,
+	}
+}
+
+func (usecase *SAMLUsecase) CreateIdentityProvider(ctx *fiber.Ctx, payload model.SAMLIdentityProviderCreateRequest) (model.SAMLIdentityProviderResponse, error) {
+	response := model.SAMLIdentityProviderResponse{}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Name is required to not be empty",
+			Param:   "name",
+		}
+	} else if len(name) > 100 {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Name must be at most 100 characters",
+			Param:   "name",
+		}
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(payload.Domain))
+	if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ /") {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Domain must be an email domain such as example.com",
+			Param:   "domain",
+		}
+	}
+
+	metadata, err := parseIdentityProviderMetadata(payload.MetadataXML)
+	if err != nil {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Metadata must be SAML IdP metadata with an HTTP-Redirect single sign-on service",
+			Param:   "metadataXml",
+		}
+	}
+
+	provisionUsers := true
+	if payload.ProvisionUsers != nil {
+		provisionUsers = *payload.ProvisionUsers
+	}
+
+	now := time.Now()
+	identityProvider := model.SAMLIdentityProvider{
+		Name:           name,
+		Domain:         domain,
+		EntityId:       metadata.EntityID,
+		MetadataXML:    payload.MetadataXML,
+		ProvisionUsers: provisionUsers,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	identityProvider.Id, err = usecase.SAMLRepository.Create(ctx.Context(), identityProvider)
+	if err != nil {
+		return response, err
+	}
+
+	return identityProviderResponse(identityProvider), nil
+}
+
+func (usecase *SAMLUsecase) ListIdentityProviders(ctx *fiber.Ctx) ([]model.SAMLIdentityProviderResponse, error) {
+	identityProviders, err := usecase.SAMLRepository.FindAll(ctx.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]model.SAMLIdentityProviderResponse, 0, len(identityProviders))
+	for _, identityProvider := range identityProviders {
+		response = append(response, identityProviderResponse(identityProvider))
+	}
+
+	return response, nil
+}
+
+// Metadata is the SP metadata document IdP administrators import to register this server
+func (usecase *SAMLUsecase) Metadata(ctx *fiber.Ctx) ([]byte, error) {
+	if usecase.ServiceProvider == nil {
+		return nil, errSAMLNotConfigured()
+	}
+
+	return xml.MarshalIndent(usecase.ServiceProvider.Metadata(), "", "  ")
+}
+
+// Login starts an SP initiated login and returns the IdP URL the browser must be redirected to
+func (usecase *SAMLUsecase) Login(ctx *fiber.Ctx, payload model.SAMLLoginRequest) (string, error) {
+	if usecase.ServiceProvider == nil {
+		return "", errSAMLNotConfigured()
+	}
+
+	email, err := util.NormalizeEmail(payload.Email)
+	if err != nil {
+		return "", &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Email is not a valid email address",
+			Param:   "email",
+		}
+	}
+
+	identityProvider, err := usecase.SAMLRepository.FindByDomain(ctx.Context(), util.EmailDomain(email))
+	if err != nil {
+		return "", err
+	}
+
+	serviceProvider, err := usecase.serviceProvider(identityProvider)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := serviceProvider.MakeAuthenticationRequest(serviceProvider.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+
+	relayState, err := generateClientCredential(24)
+	if err != nil {
+		return "", err
+	}
+
+	err = usecase.SAMLRepository.SetRequestStateInCache(ctx.Context(), relayState, model.SAMLRequestState{
+		IdentityProviderId: identityProvider.Id,
+		RequestId:          request.ID,
+	}, SAMLRequestTTL)
+	if err != nil {
+		return "", err
+	}
+
+	redirectURL, err := request.Redirect(relayState, serviceProvider)
+	if err != nil {
+		return "", err
+	}
+
+	return redirectURL.String(), nil
+}
+
+// ConsumeAssertion is the assertion consumer service. The response must answer an AuthnRequest this server sent,
+// be signed by that request's IdP, be addressed to this SP and name an email of the IdP's domain. Only SP initiated
+// logins are accepted so every response is tied to a RelayState that can be used once
+func (usecase *SAMLUsecase) ConsumeAssertion(ctx *fiber.Ctx, payload model.SAMLResponseRequest) (model.TokenResponse, error) {
+	token := model.TokenResponse{}
+
+	if usecase.ServiceProvider == nil {
+		return token, errSAMLNotConfigured()
+	}
+
+	state, err := usecase.SAMLRepository.TakeRequestStateInCache(ctx.Context(), payload.RelayState)
+	if err != nil {
+		return token, err
+	}
+
+	identityProvider, err := usecase.SAMLRepository.FindById(ctx.Context(), state.IdentityProviderId)
+	if err != nil {
+		return token, err
+	}
+
+	subject, err := usecase.verifyResponse(ctx, identityProvider, state, payload.SAMLResponse)
+	if err != nil {
+		return token, err
+	}
+
+	userId, err := usecase.findOrProvisionUser(ctx, identityProvider, subject)
+	if err != nil {
+		return token, err
+	}
+
+	return usecase.UserUsecase.completeLogin(ctx, userId, usecase.UserUsecase.StepUpUsecase.Signals(ctx))
+}
+
+// verifyResponse checks a base64 encoded SAML response against the request it answers and returns the subject
+// it vouches for, every assertion is accepted once
+func (usecase *SAMLUsecase) verifyResponse(ctx *fiber.Ctx, identityProvider model.SAMLIdentityProvider, state model.SAMLRequestState, samlResponse string) (model.SAMLSubject, error) {
+	subject := model.SAMLSubject{}
+	invalid := &model.ValidationError{
+		Code:    constant.ERR_UNATHORIZED_ERROR,
+		Message: "SAML response is invalid",
+		Param:   "SAMLResponse",
+	}
+
+	serviceProvider, err := usecase.serviceProvider(identityProvider)
+	if err != nil {
+		return subject, err
+	}
+
+	responseXML, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return subject, invalid
+	}
+
+	assertion, err := serviceProvider.ParseXMLResponse(responseXML, []string{state.RequestId}, serviceProvider.AcsURL)
+	if err != nil {
+		var responseErr *saml.InvalidResponseError
+		if errors.As(err, &responseErr) {
+			util.Logger(ctx, usecase.Log).Debug("SAML response rejected", zap.String("domain", identityProvider.Domain), zap.Error(responseErr.PrivateErr))
+			return subject, invalid
+		}
+		return subject, err
+	}
+
+	// the request state is single use already, the assertion id guards against the same assertion answering another request
+	ttl := time.Until(assertion.Conditions.NotOnOrAfter.Add(saml.MaxClockSkew))
+	fresh, err := usecase.SAMLRepository.MarkAssertionUsed(ctx.Context(), identityProvider.Id, assertion.ID, max(ttl, time.Second))
+	if err != nil {
+		return subject, err
+	}
+	if !fresh {
+		return subject, &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "SAML assertion has already been used",
+			Param:   "SAMLResponse",
+		}
+	}
+
+	subject.NameId = assertionNameId(assertion)
+	if subject.NameId == "" {
+		util.Logger(ctx, usecase.Log).Debug("SAML assertion has no persistent NameID", zap.String("domain", identityProvider.Domain))
+		return subject, invalid
+	}
+
+	email, err := util.NormalizeEmail(assertionEmail(assertion))
+	if err != nil {
+		util.Logger(ctx, usecase.Log).Debug("SAML assertion has no email address", zap.String("domain", identityProvider.Domain))
+		return subject, invalid
+	}
+
+	// an IdP only speaks for its own domain, otherwise any customer's IdP could log in as anybody
+	if !strings.EqualFold(util.EmailDomain(email), identityProvider.Domain) {
+		return subject, &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Identity provider is not allowed to sign in users of this email domain",
+			Param:   "SAMLResponse",
+		}
+	}
+
+	subject.Email = email
+
+	return subject, nil
+}
+
+// findOrProvisionUser returns the user linked to the IdP's NameID. An account with the same email is only linked
+// on a first login when it already signs in through an identity provider, see UserRepository.LinkSAMLUser. Any
+// other account keeps its owner's credentials, the IdP gets a conflict instead of a login into it
+func (usecase *SAMLUsecase) findOrProvisionUser(ctx *fiber.Ctx, identityProvider model.SAMLIdentityProvider, subject model.SAMLSubject) (int, error) {
+	ctxContext := ctx.Context()
+
+	userId, err := usecase.UserRepository.GetSAMLUserId(ctxContext, identityProvider.Id, subject.NameId)
+	if err != nil {
+		return 0, err
+	}
+	if userId != 0 {
+		return userId, nil
+	}
+
+	userId, err = usecase.UserRepository.LinkSAMLUser(ctxContext, identityProvider.Id, subject, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if userId != 0 {
+		util.Logger(ctx, usecase.Log).Info("Linked account to SAML identity", zap.Int("userId", userId), zap.String("domain", identityProvider.Domain))
+		return userId, nil
+	}
+
+	if !identityProvider.ProvisionUsers {
+		return 0, &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "No account exists for this email address",
+			Param:   "email",
+		}
+	}
+
+	userId, err = provisionUsername(util.UsernameFromEmail(subject.Email), func(username string) (int, error) {
+		now := time.Now()
+		return usecase.UserRepository.CreateSAMLUser(ctxContext, model.User{
+			Username:               username,
+			UsernameSkeleton:       util.UsernameSkeleton(username),
+			Email:                  subject.Email,
+			EmailCanonical:         usecase.EmailPolicy.Canonicalize(subject.Email),
+			Role:                   constant.ROLE_USER,
+			SAMLIdentityProviderId: identityProvider.Id,
+			SAMLNameId:             subject.NameId,
+			CreatedAt:              now,
+			UpdatedAt:              now,
+		})
+	})
+	if err != nil {
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Code == constant.ERR_CONFLICT_ERROR {
+			util.Logger(ctx, usecase.Log).Warn("SAML identity collides with an account it does not own", zap.String("domain", identityProvider.Domain), zap.Error(err))
+		}
+		return 0, err
+	}
+
+	util.Logger(ctx, usecase.Log).Info("Provisioned user from SAML assertion", zap.Int("userId", userId), zap.String("domain", identityProvider.Domain))
+
+	return userId, nil
+}
+
+// serviceProvider is the SP configured to talk to one IdP
+func (usecase *SAMLUsecase) serviceProvider(identityProvider model.SAMLIdentityProvider) (*saml.ServiceProvider, error) {
+	metadata, err := parseIdentityProviderMetadata(identityProvider.MetadataXML)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceProvider := *usecase.ServiceProvider
+	serviceProvider.IDPMetadata = metadata
+
+	return &serviceProvider, nil
+}
+
+func parseIdentityProviderMetadata(metadataXML string) (*saml.EntityDescriptor, error) {
+	metadata, err := samlsp.ParseMetadata([]byte(metadataXML))
+	if err != nil {
+		return nil, err
+	}
+
+	serviceProvider := saml.ServiceProvider{IDPMetadata: metadata}
+	if metadata.EntityID == "" || serviceProvider.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" {
+		return nil, errors.New("metadata has no entity id or HTTP-Redirect single sign-on service")
+	}
+
+	return metadata, nil
+}
+
+// assertionNameId is the NameID users are linked by. Transient NameIDs change on every login and cannot link anyone
+func assertionNameId(assertion *saml.Assertion) string {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Format == string(saml.TransientNameIDFormat) {
+		return ""
+	}
+
+	return strings.TrimSpace(assertion.Subject.NameID.Value)
+}
+
+// assertionEmail prefers an email NameID and falls back to the common email attributes
+func assertionEmail(assertion *saml.Assertion) string {
+	if assertion.Subject != nil && assertion.Subject.NameID != nil && strings.Contains(assertion.Subject.NameID.Value, "@") {
+		return assertion.Subject.NameID.Value
+	}
+
+	for _, name := range samlEmailAttributes {
+		for _, statement := range assertion.AttributeStatements {
+			for _, attribute := range statement.Attributes {
+				if (attribute.Name == name || attribute.FriendlyName == name) && len(attribute.Values) > 0 {
+					return attribute.Values[0].Value
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func identityProviderResponse(identityProvider model.SAMLIdentityProvider) model.SAMLIdentityProviderResponse {
+	return model.SAMLIdentityProviderResponse{
+		Id:             identityProvider.Id,
+		Name:           identityProvider.Name,
+		Domain:         identityProvider.Domain,
+		EntityId:       identityProvider.EntityId,
+		ProvisionUsers: identityProvider.ProvisionUsers,
+		CreatedAt:      identityProvider.CreatedAt,
+	}
+}
+
+func errSAMLNotConfigured() error {
+	return &model.ValidationError{
+		Code:    constant.ERR_NOT_FOUND_ERROR,
+		Message: "SAML single sign-on is not enabled",
+	}
+}
@@ -0,0 +1,370 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	testSPEntityId = "https://sp.example.net/saml/metadata"
+	testSPAcsURL   = "https://sp.example.net/saml/acs"
+)
+
+// testIdentityProvider signs responses with a key pair generated for the test, its metadata is what an admin
+// would have registered for example.com
+type testIdentityProvider struct {
+	idp   *saml.IdentityProvider
+	model model.SAMLIdentityProvider
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(certificateDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	idp := &saml.IdentityProvider{
+		Key:         key,
+		Certificate: certificate,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}
+
+	metadataXML, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testIdentityProvider{
+		idp: idp,
+		model: model.SAMLIdentityProvider{
+			Id:             1,
+			Name:           "Example",
+			Domain:         "example.com",
+			EntityId:       idp.Metadata().EntityID,
+			MetadataXML:    string(metadataXML),
+			ProvisionUsers: true,
+		},
+	}
+}
+
+type testSAMLResponse struct {
+	requestId string
+	audience  string
+	email     string
+	// nameIdFormat defaults to the email address format
+	nameIdFormat string
+	issuedAt     time.Time
+	// conditionsEnd overrides the NotOnOrAfter of the assertion's conditions when set
+	conditionsEnd time.Time
+}
+
+// sign builds the base64 encoded response the browser would post to the assertion consumer service
+func (provider *testIdentityProvider) sign(t *testing.T, response testSAMLResponse) string {
+	t.Helper()
+
+	request := &saml.IdpAuthnRequest{
+		IDP:         provider.idp,
+		HTTPRequest: httptest.NewRequest("POST", testSPAcsURL, nil),
+		Request: saml.AuthnRequest{
+			ID:           response.requestId,
+			IssueInstant: response.issuedAt,
+		},
+		ServiceProviderMetadata: &saml.EntityDescriptor{EntityID: response.audience},
+		SPSSODescriptor:         &saml.SPSSODescriptor{},
+		ACSEndpoint:             &saml.IndexedEndpoint{Binding: saml.HTTPPostBinding, Location: testSPAcsURL},
+		Now:                     response.issuedAt,
+	}
+
+	nameIdFormat := response.nameIdFormat
+	if nameIdFormat == "" {
+		nameIdFormat = string(saml.EmailAddressNameIDFormat)
+	}
+
+	err := saml.DefaultAssertionMaker{}.MakeAssertion(request, &saml.Session{
+		NameID:       response.email,
+		NameIDFormat: nameIdFormat,
+		CreateTime:   response.issuedAt,
+		Index:        "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.conditionsEnd.IsZero() {
+		request.Assertion.Conditions.NotBefore = response.conditionsEnd.Add(-time.Hour)
+		request.Assertion.Conditions.NotOnOrAfter = response.conditionsEnd
+	}
+
+	err = request.MakeResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := etree.NewDocument()
+	document.SetRoot(request.ResponseEl)
+	responseXML, err := document.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(responseXML)
+}
+
+func newTestSAMLUsecase(t *testing.T) *SAMLUsecase {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	acsURL, _ := url.Parse(testSPAcsURL)
+	metadataURL, _ := url.Parse(testSPEntityId)
+
+	return &SAMLUsecase{
+		SAMLRepository: repository.NewSAMLRepository(zap.NewNop(), nil, client),
+		ServiceProvider: &saml.ServiceProvider{
+			EntityID:          testSPEntityId,
+			MetadataURL:       *metadataURL,
+			AcsURL:            *acsURL,
+			AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+		},
+		Log: zap.NewNop(),
+	}
+}
+
+func validSAMLResponse() testSAMLResponse {
+	return testSAMLResponse{
+		requestId: "id-request",
+		audience:  testSPEntityId,
+		email:     "alice@example.com",
+		issuedAt:  time.Now(),
+	}
+}
+
+func TestSAMLVerifyResponse(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	state := model.SAMLRequestState{IdentityProviderId: provider.model.Id, RequestId: "id-request"}
+
+	wrongAudience := validSAMLResponse()
+	wrongAudience.audience = "https://other-sp.example.net/saml/metadata"
+
+	// well past saml.MaxClockSkew, which is tolerated on either end of the conditions
+	expired := validSAMLResponse()
+	expired.conditionsEnd = time.Now().Add(-10 * time.Minute)
+
+	stale := validSAMLResponse()
+	stale.issuedAt = time.Now().Add(-time.Hour)
+
+	// an IdP initiated response answers no request of ours
+	unsolicited := validSAMLResponse()
+	unsolicited.requestId = ""
+
+	otherRequest := validSAMLResponse()
+	otherRequest.requestId = "id-another-request"
+
+	foreignDomain := validSAMLResponse()
+	foreignDomain.email = "mallory@example.org"
+
+	// a NameID that changes on every login cannot be linked to an account
+	transient := validSAMLResponse()
+	transient.nameIdFormat = string(saml.TransientNameIDFormat)
+
+	cases := []struct {
+		name     string
+		response testSAMLResponse
+		wantCode string
+	}{
+		{"valid", validSAMLResponse(), ""},
+		{"wrong audience", wrongAudience, constant.ERR_UNATHORIZED_ERROR},
+		{"expired conditions", expired, constant.ERR_UNATHORIZED_ERROR},
+		{"stale response", stale, constant.ERR_UNATHORIZED_ERROR},
+		{"unsolicited", unsolicited, constant.ERR_UNATHORIZED_ERROR},
+		{"answers another request", otherRequest, constant.ERR_UNATHORIZED_ERROR},
+		{"foreign email domain", foreignDomain, constant.ERR_FORBIDDEN_ERROR},
+		{"transient NameID", transient, constant.ERR_UNATHORIZED_ERROR},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			usecase := newTestSAMLUsecase(t)
+			samlResponse := provider.sign(t, c.response)
+
+			withFiberCtx(t, func(ctx *fiber.Ctx) {
+				subject, err := usecase.verifyResponse(ctx, provider.model, state, samlResponse)
+				if c.wantCode == "" {
+					if err != nil {
+						t.Fatalf("verifyResponse = %v", err)
+					}
+					if subject.Email != "alice@example.com" || subject.NameId != "alice@example.com" {
+						t.Errorf("subject = %+v, want alice@example.com", subject)
+					}
+					return
+				}
+
+				if validationCode(err) != c.wantCode {
+					t.Errorf("verifyResponse = (%+v, %v), want %s", subject, err, c.wantCode)
+				}
+			})
+		})
+	}
+}
+
+func TestSAMLVerifyResponseRejectsReplay(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	state := model.SAMLRequestState{IdentityProviderId: provider.model.Id, RequestId: "id-request"}
+	usecase := newTestSAMLUsecase(t)
+	samlResponse := provider.sign(t, validSAMLResponse())
+
+	withFiberCtx(t, func(ctx *fiber.Ctx) {
+		_, err := usecase.verifyResponse(ctx, provider.model, state, samlResponse)
+		if err != nil {
+			t.Fatalf("first use = %v", err)
+		}
+
+		_, err = usecase.verifyResponse(ctx, provider.model, state, samlResponse)
+		if validationCode(err) != constant.ERR_UNATHORIZED_ERROR {
+			t.Errorf("replayed assertion = %v, want it rejected", err)
+		}
+	})
+}
+
+// fakeSAMLUserStore keeps SAML links by IdP and NameID, linkable maps the emails of accounts LinkSAMLUser would link
+type fakeSAMLUserStore struct {
+	links    map[string]int
+	linkable map[string]int
+	taken    map[string]bool
+	created  []model.User
+}
+
+func (store *fakeSAMLUserStore) GetSAMLUserId(ctx context.Context, identityProviderId int, nameId string) (int, error) {
+	return store.links[fmt.Sprintf("%d/%s", identityProviderId, nameId)], nil
+}
+
+func (store *fakeSAMLUserStore) LinkSAMLUser(ctx context.Context, identityProviderId int, subject model.SAMLSubject, updatedAt time.Time) (int, error) {
+	userId := store.linkable[subject.Email]
+	if userId != 0 {
+		delete(store.linkable, subject.Email)
+		store.links[fmt.Sprintf("%d/%s", identityProviderId, subject.NameId)] = userId
+	}
+
+	return userId, nil
+}
+
+func (store *fakeSAMLUserStore) CreateSAMLUser(ctx context.Context, user model.User) (int, error) {
+	if store.taken[user.Email] {
+		return 0, &model.ValidationError{Code: constant.ERR_CONFLICT_ERROR, Message: "Email is already exist", Param: "email"}
+	}
+
+	store.created = append(store.created, user)
+	userId := 100 + len(store.created)
+	store.links[fmt.Sprintf("%d/%s", user.SAMLIdentityProviderId, user.SAMLNameId)] = userId
+
+	return userId, nil
+}
+
+func TestSAMLFindOrProvisionUser(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	store := &fakeSAMLUserStore{
+		links:    map[string]int{"1/persistent-alice": 7},
+		linkable: map[string]int{"scim.user@example.com": 8},
+		// a password account, or any other account LinkSAMLUser refuses to link
+		taken: map[string]bool{"admin@example.com": true},
+	}
+	usecase := newTestSAMLUsecase(t)
+	usecase.UserRepository = store
+	usecase.EmailPolicy = &util.EmailPolicy{}
+
+	withFiberCtx(t, func(ctx *fiber.Ctx) {
+		// the NameID decides, whatever email the IdP asserts for it today
+		userId, err := usecase.findOrProvisionUser(ctx, provider.model, model.SAMLSubject{NameId: "persistent-alice", Email: "alice.new@example.com"})
+		if err != nil || userId != 7 {
+			t.Errorf("linked NameID = (%d, %v), want user 7", userId, err)
+		}
+
+		userId, err = usecase.findOrProvisionUser(ctx, provider.model, model.SAMLSubject{NameId: "persistent-scim", Email: "scim.user@example.com"})
+		if err != nil || userId != 8 {
+			t.Errorf("linkable account = (%d, %v), want user 8", userId, err)
+		}
+		if store.links["1/persistent-scim"] != 8 {
+			t.Errorf("account was not linked to its NameID, links = %v", store.links)
+		}
+
+		_, err = usecase.findOrProvisionUser(ctx, provider.model, model.SAMLSubject{NameId: "persistent-mallory", Email: "admin@example.com"})
+		if validationCode(err) != constant.ERR_CONFLICT_ERROR {
+			t.Errorf("account that cannot be linked = %v, want a conflict instead of a login", err)
+		}
+
+		userId, err = usecase.findOrProvisionUser(ctx, provider.model, model.SAMLSubject{NameId: "persistent-carol", Email: "carol@example.com"})
+		if err != nil || len(store.created) != 1 {
+			t.Fatalf("new identity = (%d, %v), want it provisioned", userId, err)
+		}
+		created := store.created[0]
+		if created.SAMLIdentityProviderId != provider.model.Id || created.SAMLNameId != "persistent-carol" || created.Role != constant.ROLE_USER {
+			t.Errorf("provisioned user = %+v", created)
+		}
+
+		withoutProvisioning := provider.model
+		withoutProvisioning.ProvisionUsers = false
+		_, err = usecase.findOrProvisionUser(ctx, withoutProvisioning, model.SAMLSubject{NameId: "persistent-dave", Email: "dave@example.com"})
+		if validationCode(err) != constant.ERR_FORBIDDEN_ERROR {
+			t.Errorf("unknown identity without provisioning = %v, want forbidden", err)
+		}
+	})
+}
+
+func TestSAMLConsumeAssertionNeedsRequestState(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	usecase := newTestSAMLUsecase(t)
+	samlResponse := provider.sign(t, validSAMLResponse())
+
+	withFiberCtx(t, func(ctx *fiber.Ctx) {
+		// a response without a RelayState of ours, or with one that was already used, is never looked at
+		for _, relayState := range []string{"", "unknown-relay-state"} {
+			_, err := usecase.ConsumeAssertion(ctx, model.SAMLResponseRequest{SAMLResponse: samlResponse, RelayState: relayState})
+			if validationCode(err) != constant.ERR_UNATHORIZED_ERROR {
+				t.Errorf("RelayState %q = %v, want it rejected", relayState, err)
+			}
+		}
+	})
+}
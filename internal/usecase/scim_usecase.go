@@ -0,0 +1,972 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	DefaultSCIMMaxResults = 100
+	SCIMTokenPrefix       = "scim_"
+	// scimFilterPattern is the only filter form supported, IdPs send attribute eq "value" to look up a resource before creating it
+	scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9._:]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+	// scimMemberPathPattern matches the members[value eq "id"] path some IdPs remove a single member with
+	scimMemberPathPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+("(?:[^"\\]|\\.)*")\s*\]$`)
+)
+
+// SCIMUsecase is the SCIM 2.0 service provider (RFC 7643, RFC 7644). Every tenant is one customer's IdP holding a
+// bearer token, it only sees the users and groups it created and may only use email addresses of its own domain
+type SCIMUsecase struct {
+	UserRepository *repository.UserRepository
+	SCIMRepository *repository.SCIMRepository
+	SessionUsecase *SessionUsecase
+	EmailPolicy    *util.EmailPolicy
+	Log            *zap.Logger
+	Config         *koanf.Koanf
+}
+
+func NewSCIMUsecase(userRepository *repository.UserRepository, scimRepository *repository.SCIMRepository, sessionUsecase *SessionUsecase, emailPolicy *util.EmailPolicy, zap *zap.Logger, koanf *koanf.Koanf) *SCIMUsecase {
+	return &SCIMUsecase{
+		UserRepository: userRepository,
+		SCIMRepository: scimRepository,
+		SessionUsecase: sessionUsecase,
+		EmailPolicy:    emailPolicy,
+		Log:            zap,
+		Config:         koanf,
+	}
+}
+
+// CreateTenant registers an IdP for a domain, the bearer token is returned only here and just its hash is stored
+func (usecase *SCIMUsecase) CreateTenant(ctx *fiber.Ctx, payload model.SCIMTenantCreateRequest) (model.SCIMTenantResponse, error) {
+	response := model.SCIMTenantResponse{}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Name is required to not be empty",
+			Param:   "name",
+		}
+	} else if len(name) > 100 {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Name must be at most 100 characters",
+			Param:   "name",
+		}
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(payload.Domain))
+	if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ /") {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Domain must be an email domain such as example.com",
+			Param:   "domain",
+		}
+	}
+
+	secret, err := generateClientCredential(32)
+	if err != nil {
+		return response, err
+	}
+	token := SCIMTokenPrefix + secret
+
+	now := time.Now()
+	tenant := model.SCIMTenant{
+		Name:      name,
+		Domain:    domain,
+		TokenHash: hashSCIMToken(token),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	tenant.Id, err = usecase.SCIMRepository.CreateTenant(ctx.Context(), tenant)
+	if err != nil {
+		return response, err
+	}
+
+	response = scimTenantResponse(tenant)
+	response.Token = token
+
+	return response, nil
+}
+
+func (usecase *SCIMUsecase) ListTenants(ctx *fiber.Ctx) ([]model.SCIMTenantResponse, error) {
+	tenants, err := usecase.SCIMRepository.FindAllTenants(ctx.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]model.SCIMTenantResponse, 0, len(tenants))
+	for _, tenant := range tenants {
+		response = append(response, scimTenantResponse(tenant))
+	}
+
+	return response, nil
+}
+
+// Authenticate finds the tenant a bearer token belongs to
+func (usecase *SCIMUsecase) Authenticate(ctx *fiber.Ctx, authorization string) (model.SCIMTenant, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || !strings.HasPrefix(token, SCIMTokenPrefix) {
+		return model.SCIMTenant{}, newSCIMError(fiber.StatusUnauthorized, "", "A SCIM bearer token is required")
+	}
+
+	tenant, err := usecase.SCIMRepository.FindTenantByTokenHash(ctx.Context(), hashSCIMToken(token))
+	if err != nil {
+		return tenant, scimError(err)
+	}
+
+	return tenant, nil
+}
+
+func (usecase *SCIMUsecase) ServiceProviderConfig() model.SCIMServiceProviderConfig {
+	return model.SCIMServiceProviderConfig{
+		Schemas: []string{constant.SCIM_SCHEMA_SERVICE_PROVIDER_CONFIG},
+		Patch:   model.SCIMSupported{Supported: true},
+		Filter: model.SCIMFilterSupport{
+			Supported:  true,
+			MaxResults: usecase.maxResults(),
+		},
+		AuthenticationSchemes: []model.SCIMAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer token",
+			Description: "The token issued when the SCIM tenant was created",
+		}},
+	}
+}
+
+func (usecase *SCIMUsecase) ListUsers(ctx *fiber.Ctx, tenant model.SCIMTenant, payload model.SCIMListRequest) (model.SCIMListResponse, error) {
+	response := model.SCIMListResponse{}
+
+	attribute, value, err := parseSCIMFilter(payload.Filter)
+	if err != nil {
+		return response, err
+	}
+
+	startIndex, count, err := usecase.page(payload)
+	if err != nil {
+		return response, err
+	}
+
+	users, total, err := usecase.UserRepository.FindSCIMUsers(ctx.Context(), tenant.Id, attribute, value, startIndex-1, count)
+	if err != nil {
+		return response, scimError(err)
+	}
+
+	resources := make([]model.SCIMUser, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, usecase.scimUser(ctx, user))
+	}
+
+	return scimListResponse(total, startIndex, resources, len(resources)), nil
+}
+
+func (usecase *SCIMUsecase) GetUser(ctx *fiber.Ctx, tenant model.SCIMTenant, id string) (model.SCIMUser, error) {
+	user, err := usecase.findUser(ctx, tenant, id)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+
+	return usecase.scimUser(ctx, user), nil
+}
+
+// CreateUser provisions an account that can only log in through SSO, its username is derived from the email address
+func (usecase *SCIMUsecase) CreateUser(ctx *fiber.Ctx, tenant model.SCIMTenant, payload model.SCIMUser) (model.SCIMUser, error) {
+	now := time.Now()
+	user := model.User{
+		Role:         constant.ROLE_USER,
+		Active:       true,
+		SCIMTenantId: tenant.Id,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	err := usecase.applyUser(tenant, &user, payload)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+
+	user.Id, err = provisionUsername(util.UsernameFromEmail(user.Email), func(username string) (int, error) {
+		user.Username = username
+		user.UsernameSkeleton = util.UsernameSkeleton(username)
+		return usecase.UserRepository.CreateSCIMUser(ctx.Context(), user)
+	})
+	if err != nil {
+		return model.SCIMUser{}, scimError(err)
+	}
+
+	util.Logger(ctx, usecase.Log).Info("Provisioned user from SCIM", zap.Int("userId", user.Id), zap.Int("scimTenantId", tenant.Id))
+
+	return usecase.scimUser(ctx, user), nil
+}
+
+// ReplaceUser is PUT, attributes that are left out are cleared except active which keeps its value
+func (usecase *SCIMUsecase) ReplaceUser(ctx *fiber.Ctx, tenant model.SCIMTenant, id string, payload model.SCIMUser) (model.SCIMUser, error) {
+	user, err := usecase.findUser(ctx, tenant, id)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+	wasActive := user.Active
+
+	user.ExternalId = ""
+	err = usecase.applyUser(tenant, &user, payload)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+
+	err = usecase.saveUser(ctx, user, wasActive)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+
+	return usecase.scimUser(ctx, user), nil
+}
+
+// PatchUser applies RFC 7644 section 3.5.2 operations. Attributes the service does not store, such as name, are
+// accepted and dropped the same way they are on create, IdPs send them with every change
+func (usecase *SCIMUsecase) PatchUser(ctx *fiber.Ctx, tenant model.SCIMTenant, id string, payload model.SCIMPatchRequest) (model.SCIMUser, error) {
+	user, err := usecase.findUser(ctx, tenant, id)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+	wasActive := user.Active
+
+	err = applySCIMPatch(payload.Operations, func(op string, path string, value json.RawMessage) error {
+		return usecase.patchUserAttribute(tenant, &user, op, path, value)
+	})
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+
+	err = usecase.saveUser(ctx, user, wasActive)
+	if err != nil {
+		return model.SCIMUser{}, err
+	}
+
+	return usecase.scimUser(ctx, user), nil
+}
+
+// DeleteUser deprovisions a user, the account is deactivated and released by the tenant instead of deleted
+// so its history is kept, and every session it still has is revoked
+func (usecase *SCIMUsecase) DeleteUser(ctx *fiber.Ctx, tenant model.SCIMTenant, id string) error {
+	user, err := usecase.findUser(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+
+	err = usecase.UserRepository.DetachSCIMUser(ctx.Context(), tenant.Id, user.Id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	util.Logger(ctx, usecase.Log).Info("Deprovisioned user from SCIM", zap.Int("userId", user.Id), zap.Int("scimTenantId", tenant.Id))
+
+	return usecase.SessionUsecase.RevokeAll(ctx.Context(), user.Id)
+}
+
+func (usecase *SCIMUsecase) ListGroups(ctx *fiber.Ctx, tenant model.SCIMTenant, payload model.SCIMListRequest) (model.SCIMListResponse, error) {
+	response := model.SCIMListResponse{}
+
+	attribute, value, err := parseSCIMFilter(payload.Filter)
+	if err != nil {
+		return response, err
+	}
+
+	startIndex, count, err := usecase.page(payload)
+	if err != nil {
+		return response, err
+	}
+
+	groups, total, err := usecase.SCIMRepository.FindGroups(ctx.Context(), tenant.Id, attribute, value, startIndex-1, count)
+	if err != nil {
+		return response, scimError(err)
+	}
+
+	resources := make([]model.SCIMGroup, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, usecase.scimGroup(ctx, group))
+	}
+
+	return scimListResponse(total, startIndex, resources, len(resources)), nil
+}
+
+func (usecase *SCIMUsecase) GetGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, id string) (model.SCIMGroup, error) {
+	group, err := usecase.findGroup(ctx, tenant, id)
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	return usecase.scimGroup(ctx, group), nil
+}
+
+func (usecase *SCIMUsecase) CreateGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, payload model.SCIMGroup) (model.SCIMGroup, error) {
+	now := time.Now()
+	group := model.Group{
+		TenantId:  tenant.Id,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err := usecase.applyGroup(ctx, tenant, &group, payload)
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	groupId, err := usecase.SCIMRepository.CreateGroup(ctx.Context(), group)
+	if err != nil {
+		return model.SCIMGroup{}, scimError(err)
+	}
+
+	return usecase.GetGroup(ctx, tenant, strconv.Itoa(groupId))
+}
+
+func (usecase *SCIMUsecase) ReplaceGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, id string, payload model.SCIMGroup) (model.SCIMGroup, error) {
+	group, err := usecase.findGroup(ctx, tenant, id)
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	err = usecase.applyGroup(ctx, tenant, &group, payload)
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	return usecase.saveGroup(ctx, tenant, group)
+}
+
+// PatchGroup supports the operations IdPs use to sync memberships, adding and removing members one by one or
+// replacing all of them, next to changing displayName and externalId
+func (usecase *SCIMUsecase) PatchGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, id string, payload model.SCIMPatchRequest) (model.SCIMGroup, error) {
+	group, err := usecase.findGroup(ctx, tenant, id)
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	err = applySCIMPatch(payload.Operations, func(op string, path string, value json.RawMessage) error {
+		return patchGroupAttribute(&group, op, path, value)
+	})
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	err = usecase.checkMembers(ctx, tenant, group.Members)
+	if err != nil {
+		return model.SCIMGroup{}, err
+	}
+
+	return usecase.saveGroup(ctx, tenant, group)
+}
+
+func (usecase *SCIMUsecase) DeleteGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, id string) error {
+	group, err := usecase.findGroup(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+
+	return usecase.SCIMRepository.DeleteGroup(ctx.Context(), tenant.Id, group.Id)
+}
+
+func (usecase *SCIMUsecase) findUser(ctx *fiber.Ctx, tenant model.SCIMTenant, id string) (model.User, error) {
+	userId, err := strconv.Atoi(id)
+	if err != nil {
+		return model.User{}, newSCIMError(fiber.StatusNotFound, "", "User not found")
+	}
+
+	user, err := usecase.UserRepository.FindSCIMUser(ctx.Context(), tenant.Id, userId)
+	if err != nil {
+		return user, scimError(err)
+	}
+
+	return user, nil
+}
+
+// applyUser copies the attributes of a User resource, the email comes from the primary email or a userName that is one
+func (usecase *SCIMUsecase) applyUser(tenant model.SCIMTenant, user *model.User, payload model.SCIMUser) error {
+	userName := strings.TrimSpace(payload.UserName)
+	if userName == "" {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "userName is required")
+	}
+
+	email := primarySCIMEmail(payload.Emails)
+	if email == "" && strings.Contains(userName, "@") {
+		email = userName
+	}
+
+	user.SCIMUserName = userName
+	user.ExternalId = strings.TrimSpace(payload.ExternalId)
+	if payload.Active != nil {
+		user.Active = *payload.Active
+	}
+
+	return usecase.setEmail(tenant, user, email)
+}
+
+func (usecase *SCIMUsecase) patchUserAttribute(tenant model.SCIMTenant, user *model.User, op string, path string, value json.RawMessage) error {
+	attribute := strings.ToLower(strings.TrimSpace(path))
+	attribute = strings.TrimPrefix(attribute, strings.ToLower(constant.SCIM_SCHEMA_USER)+":")
+
+	required := func() error {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, path+" is required and cannot be removed")
+	}
+
+	switch {
+	case attribute == "active":
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			return required()
+		}
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+	case attribute == "username":
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			return required()
+		}
+		userName, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		if userName == "" {
+			return required()
+		}
+		user.SCIMUserName = userName
+	case attribute == "externalid":
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			user.ExternalId = ""
+			return nil
+		}
+		externalId, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.ExternalId = externalId
+	case attribute == "emails":
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			return required()
+		}
+		emails := []model.SCIMEmail{}
+		err := json.Unmarshal(value, &emails)
+		if err != nil {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "emails must be a list of emails")
+		}
+		return usecase.setEmail(tenant, user, primarySCIMEmail(emails))
+	case strings.HasPrefix(attribute, "emails[") && strings.HasSuffix(attribute, "].value"):
+		// the account has a single email, whichever one the filter selects replaces it
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			return required()
+		}
+		email, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		return usecase.setEmail(tenant, user, email)
+	}
+
+	return nil
+}
+
+// setEmail only accepts addresses of the tenant's domain, otherwise an IdP could take over accounts of other customers
+func (usecase *SCIMUsecase) setEmail(tenant model.SCIMTenant, user *model.User, email string) error {
+	email, err := util.NormalizeEmail(email)
+	if err != nil {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "A valid email address is required in emails or userName")
+	}
+
+	if !strings.EqualFold(util.EmailDomain(email), tenant.Domain) {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, fmt.Sprintf("Email must belong to the domain %s", tenant.Domain))
+	}
+
+	user.Email = email
+	user.EmailCanonical = usecase.EmailPolicy.Canonicalize(email)
+
+	return nil
+}
+
+// saveUser writes the user and revokes its sessions when this change deactivated it
+func (usecase *SCIMUsecase) saveUser(ctx *fiber.Ctx, user model.User, wasActive bool) error {
+	user.UpdatedAt = time.Now()
+
+	err := usecase.UserRepository.UpdateSCIMUser(ctx.Context(), user)
+	if err != nil {
+		return scimError(err)
+	}
+
+	if wasActive && !user.Active {
+		util.Logger(ctx, usecase.Log).Info("Deactivated user from SCIM", zap.Int("userId", user.Id), zap.Int("scimTenantId", user.SCIMTenantId))
+		return usecase.SessionUsecase.RevokeAll(ctx.Context(), user.Id)
+	}
+
+	return nil
+}
+
+func (usecase *SCIMUsecase) findGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, id string) (model.Group, error) {
+	groupId, err := strconv.Atoi(id)
+	if err != nil {
+		return model.Group{}, newSCIMError(fiber.StatusNotFound, "", "Group not found")
+	}
+
+	group, err := usecase.SCIMRepository.FindGroup(ctx.Context(), tenant.Id, groupId)
+	if err != nil {
+		return group, scimError(err)
+	}
+
+	return group, nil
+}
+
+func (usecase *SCIMUsecase) applyGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, group *model.Group, payload model.SCIMGroup) error {
+	displayName := strings.TrimSpace(payload.DisplayName)
+	if displayName == "" {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "displayName is required")
+	}
+
+	members, err := groupMembers(payload.Members)
+	if err != nil {
+		return err
+	}
+
+	err = usecase.checkMembers(ctx, tenant, members)
+	if err != nil {
+		return err
+	}
+
+	group.DisplayName = displayName
+	group.ExternalId = strings.TrimSpace(payload.ExternalId)
+	group.Members = members
+
+	return nil
+}
+
+// checkMembers makes sure a tenant only puts its own users in its groups
+func (usecase *SCIMUsecase) checkMembers(ctx *fiber.Ctx, tenant model.SCIMTenant, members []model.GroupMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	userIds := make([]int, 0, len(members))
+	seen := map[int]bool{}
+	for _, member := range members {
+		if !seen[member.UserId] {
+			seen[member.UserId] = true
+			userIds = append(userIds, member.UserId)
+		}
+	}
+
+	count, err := usecase.SCIMRepository.CountTenantUsers(ctx.Context(), tenant.Id, userIds)
+	if err != nil {
+		return err
+	}
+	if count != len(userIds) {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "members must be users provisioned by this tenant")
+	}
+
+	return nil
+}
+
+func (usecase *SCIMUsecase) saveGroup(ctx *fiber.Ctx, tenant model.SCIMTenant, group model.Group) (model.SCIMGroup, error) {
+	group.UpdatedAt = time.Now()
+
+	err := usecase.SCIMRepository.UpdateGroup(ctx.Context(), group)
+	if err != nil {
+		return model.SCIMGroup{}, scimError(err)
+	}
+
+	return usecase.GetGroup(ctx, tenant, strconv.Itoa(group.Id))
+}
+
+func patchGroupAttribute(group *model.Group, op string, path string, value json.RawMessage) error {
+	attribute := strings.ToLower(strings.TrimSpace(path))
+	attribute = strings.TrimPrefix(attribute, strings.ToLower(constant.SCIM_SCHEMA_GROUP)+":")
+
+	if match := scimMemberPathPattern.FindStringSubmatch(path); match != nil {
+		if op != constant.SCIM_PATCH_OP_REMOVE {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_PATH, "Only remove is supported with a members filter")
+		}
+
+		var memberId string
+		err := json.Unmarshal([]byte(match[1]), &memberId)
+		if err != nil {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_PATH, "members filter is invalid")
+		}
+		userId, err := strconv.Atoi(memberId)
+		if err != nil {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "members value must be a user id")
+		}
+
+		group.Members = removeGroupMembers(group.Members, map[int]bool{userId: true})
+		return nil
+	}
+
+	switch attribute {
+	case "displayname":
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "displayName is required and cannot be removed")
+		}
+		displayName, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		if displayName == "" {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "displayName is required")
+		}
+		group.DisplayName = displayName
+	case "externalid":
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			group.ExternalId = ""
+			return nil
+		}
+		externalId, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		group.ExternalId = externalId
+	case "members":
+		members := []model.SCIMMember{}
+		if len(value) > 0 && string(value) != "null" {
+			err := json.Unmarshal(value, &members)
+			if err != nil {
+				return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "members must be a list of members")
+			}
+		}
+
+		changed, err := groupMembers(members)
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case constant.SCIM_PATCH_OP_ADD:
+			group.Members = append(group.Members, changed...)
+		case constant.SCIM_PATCH_OP_REPLACE:
+			group.Members = changed
+		case constant.SCIM_PATCH_OP_REMOVE:
+			// remove without a value empties the group
+			if len(changed) == 0 {
+				group.Members = nil
+				return nil
+			}
+			userIds := map[int]bool{}
+			for _, member := range changed {
+				userIds[member.UserId] = true
+			}
+			group.Members = removeGroupMembers(group.Members, userIds)
+		}
+	default:
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_PATH, fmt.Sprintf("%s is not a supported group attribute", path))
+	}
+
+	return nil
+}
+
+// page reads startIndex and count as RFC 7644 section 3.4.2.4 defines them, startIndex is 1-based
+func (usecase *SCIMUsecase) page(payload model.SCIMListRequest) (int, int, error) {
+	startIndex := 1
+	if payload.StartIndex != "" {
+		parsed, err := strconv.Atoi(payload.StartIndex)
+		if err != nil {
+			return 0, 0, newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "startIndex must be a number")
+		}
+		startIndex = max(parsed, 1)
+	}
+
+	maxResults := usecase.maxResults()
+	count := maxResults
+	if payload.Count != "" {
+		parsed, err := strconv.Atoi(payload.Count)
+		if err != nil {
+			return 0, 0, newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "count must be a number")
+		}
+		count = min(max(parsed, 0), maxResults)
+	}
+
+	return startIndex, count, nil
+}
+
+func (usecase *SCIMUsecase) maxResults() int {
+	if maxResults := usecase.Config.Int("SCIM_MAX_RESULTS"); maxResults > 0 {
+		return maxResults
+	}
+
+	return DefaultSCIMMaxResults
+}
+
+func (usecase *SCIMUsecase) location(ctx *fiber.Ctx, resource string, id int) string {
+	baseURL := usecase.Config.String("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		baseURL = ctx.BaseURL()
+	}
+
+	return fmt.Sprintf("%s/scim/v2/%s/%d", strings.TrimRight(baseURL, "/"), resource, id)
+}
+
+func (usecase *SCIMUsecase) scimUser(ctx *fiber.Ctx, user model.User) model.SCIMUser {
+	active := user.Active
+
+	return model.SCIMUser{
+		Schemas:    []string{constant.SCIM_SCHEMA_USER},
+		Id:         strconv.Itoa(user.Id),
+		ExternalId: user.ExternalId,
+		UserName:   user.SCIMUserName,
+		Active:     &active,
+		Emails: []model.SCIMEmail{{
+			Value:   user.Email,
+			Type:    "work",
+			Primary: true,
+		}},
+		Meta: &model.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     usecase.location(ctx, "Users", user.Id),
+		},
+	}
+}
+
+func (usecase *SCIMUsecase) scimGroup(ctx *fiber.Ctx, group model.Group) model.SCIMGroup {
+	members := make([]model.SCIMMember, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, model.SCIMMember{
+			Value:   strconv.Itoa(member.UserId),
+			Display: member.UserName,
+			Ref:     usecase.location(ctx, "Users", member.UserId),
+		})
+	}
+
+	return model.SCIMGroup{
+		Schemas:     []string{constant.SCIM_SCHEMA_GROUP},
+		Id:          strconv.Itoa(group.Id),
+		ExternalId:  group.ExternalId,
+		DisplayName: group.DisplayName,
+		Members:     members,
+		Meta: &model.SCIMMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     usecase.location(ctx, "Groups", group.Id),
+		},
+	}
+}
+
+// applySCIMPatch hands every attribute a PATCH request changes to patch (RFC 7644 section 3.5.2), an operation
+// without a path changes each attribute of its value object
+func applySCIMPatch(operations []model.SCIMPatchOperation, patch func(op string, path string, value json.RawMessage) error) error {
+	if len(operations) == 0 {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "Operations must not be empty")
+	}
+
+	for _, operation := range operations {
+		op, err := scimPatchOp(operation.Op)
+		if err != nil {
+			return err
+		}
+
+		if operation.Path != "" {
+			err = patch(op, operation.Path, operation.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if op == constant.SCIM_PATCH_OP_REMOVE {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_NO_TARGET, "remove requires a path")
+		}
+
+		values := map[string]json.RawMessage{}
+		err = json.Unmarshal(operation.Value, &values)
+		if err != nil {
+			return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "value must be an object when there is no path")
+		}
+
+		for path, value := range values {
+			err = patch(op, path, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseSCIMFilter returns the attribute and value of an attribute eq "value" filter, both are empty without a filter
+func parseSCIMFilter(filter string) (string, string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_FILTER, `Only filters of the form attribute eq "value" are supported`)
+	}
+
+	var value string
+	err := json.Unmarshal([]byte(match[2]), &value)
+	if err != nil {
+		return "", "", newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_FILTER, "Filter value is not a valid string")
+	}
+
+	attribute := match[1]
+	if index := strings.LastIndex(attribute, ":"); index >= 0 {
+		attribute = attribute[index+1:]
+	}
+
+	return attribute, value, nil
+}
+
+// scimPatchOp lowercases op, some IdPs send Add, Replace and Remove
+func scimPatchOp(op string) (string, error) {
+	op = strings.ToLower(op)
+	switch op {
+	case constant.SCIM_PATCH_OP_ADD, constant.SCIM_PATCH_OP_REPLACE, constant.SCIM_PATCH_OP_REMOVE:
+		return op, nil
+	}
+
+	return "", newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_SYNTAX, fmt.Sprintf("%q is not a supported PATCH operation", op))
+}
+
+// scimBool accepts booleans and, since some IdPs send them, the strings "True" and "False"
+func scimBool(value json.RawMessage) (bool, error) {
+	var result bool
+	err := json.Unmarshal(value, &result)
+	if err == nil {
+		return result, nil
+	}
+
+	var text string
+	err = json.Unmarshal(value, &text)
+	if err == nil {
+		result, err = strconv.ParseBool(text)
+		if err == nil {
+			return result, nil
+		}
+	}
+
+	return false, newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "active must be a boolean")
+}
+
+func scimString(value json.RawMessage) (string, error) {
+	var result string
+	err := json.Unmarshal(value, &result)
+	if err != nil {
+		return "", newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "value must be a string")
+	}
+
+	return strings.TrimSpace(result), nil
+}
+
+func primarySCIMEmail(emails []model.SCIMEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+
+	return ""
+}
+
+func groupMembers(members []model.SCIMMember) ([]model.GroupMember, error) {
+	result := make([]model.GroupMember, 0, len(members))
+	seen := map[int]bool{}
+	for _, member := range members {
+		userId, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, "members value must be a user id")
+		}
+		if seen[userId] {
+			continue
+		}
+		seen[userId] = true
+		result = append(result, model.GroupMember{UserId: userId})
+	}
+
+	return result, nil
+}
+
+func removeGroupMembers(members []model.GroupMember, userIds map[int]bool) []model.GroupMember {
+	result := make([]model.GroupMember, 0, len(members))
+	for _, member := range members {
+		if !userIds[member.UserId] {
+			result = append(result, member)
+		}
+	}
+
+	return result
+}
+
+func scimListResponse(total int, startIndex int, resources interface{}, itemsPerPage int) model.SCIMListResponse {
+	return model.SCIMListResponse{
+		Schemas:      []string{constant.SCIM_SCHEMA_LIST_RESPONSE},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+func scimTenantResponse(tenant model.SCIMTenant) model.SCIMTenantResponse {
+	return model.SCIMTenantResponse{
+		Id:        tenant.Id,
+		Name:      tenant.Name,
+		Domain:    tenant.Domain,
+		CreatedAt: tenant.CreatedAt,
+	}
+}
+
+func newSCIMError(status int, scimType string, detail string) *model.SCIMError {
+	return &model.SCIMError{
+		Schemas:  []string{constant.SCIM_SCHEMA_ERROR},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// scimError turns a ValidationError of the repositories into the error SCIM clients understand, other errors are returned unchanged
+func scimError(err error) error {
+	var validationErr *model.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	switch validationErr.Code {
+	case constant.ERR_NOT_FOUND_ERROR:
+		return newSCIMError(fiber.StatusNotFound, "", validationErr.Message)
+	case constant.ERR_CONFLICT_ERROR:
+		return newSCIMError(fiber.StatusConflict, constant.SCIM_ERR_UNIQUENESS, validationErr.Message)
+	case constant.ERR_UNATHORIZED_ERROR:
+		return newSCIMError(fiber.StatusUnauthorized, "", validationErr.Message)
+	case constant.ERR_FORBIDDEN_ERROR:
+		return newSCIMError(fiber.StatusForbidden, "", validationErr.Message)
+	}
+
+	if validationErr.Param == "filter" {
+		return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_FILTER, validationErr.Message)
+	}
+
+	return newSCIMError(fiber.StatusBadRequest, constant.SCIM_ERR_INVALID_VALUE, validationErr.Message)
+}
+
+// hashSCIMToken keeps the bearer tokens out of the database, like refresh tokens they are long random strings
+func hashSCIMToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
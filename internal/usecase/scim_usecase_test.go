@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/util"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+)
+
+func scimType(err error) string {
+	var scimErr *model.SCIMError
+	if errors.As(err, &scimErr) {
+		return scimErr.ScimType
+	}
+	return ""
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	cases := []struct {
+		filter    string
+		attribute string
+		value     string
+		scimType  string
+	}{
+		{"", "", "", ""},
+		{"   ", "", "", ""},
+		{`userName eq "john@example.com"`, "userName", "john@example.com", ""},
+		{`  userName  EQ  "john"  `, "userName", "john", ""},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "john"`, "userName", "john", ""},
+		{`emails.value eq "john@example.com"`, "emails.value", "john@example.com", ""},
+		{`externalId eq "a \"quoted\" id"`, "externalId", `a "quoted" id`, ""},
+		{`displayName eq ""`, "displayName", "", ""},
+
+		{`userName co "john"`, "", "", constant.SCIM_ERR_INVALID_FILTER},
+		{`userName eq john`, "", "", constant.SCIM_ERR_INVALID_FILTER},
+		{`userName eq "john" and active eq true`, "", "", constant.SCIM_ERR_INVALID_FILTER},
+		{`userName eq "john" or userName eq "jane"`, "", "", constant.SCIM_ERR_INVALID_FILTER},
+		{`(userName eq "john")`, "", "", constant.SCIM_ERR_INVALID_FILTER},
+		{`userName eq "bad \q escape"`, "", "", constant.SCIM_ERR_INVALID_FILTER},
+	}
+
+	for _, c := range cases {
+		attribute, value, err := parseSCIMFilter(c.filter)
+		if c.scimType != "" {
+			if scimType(err) != c.scimType {
+				t.Errorf("parseSCIMFilter(%q) = %v, want %s", c.filter, err, c.scimType)
+			}
+			continue
+		}
+		if err != nil || attribute != c.attribute || value != c.value {
+			t.Errorf("parseSCIMFilter(%q) = %q, %q, %v, want %q, %q", c.filter, attribute, value, err, c.attribute, c.value)
+		}
+	}
+}
+
+func TestApplySCIMUserPatch(t *testing.T) {
+	scimUsecase := &SCIMUsecase{EmailPolicy: &util.EmailPolicy{}, Config: koanf.New(".")}
+	tenant := model.SCIMTenant{Id: 1, Domain: "example.com"}
+	original := model.User{SCIMUserName: "john", Email: "john@example.com", Active: true, ExternalId: "external"}
+
+	cases := []struct {
+		name       string
+		operations string
+		user       func(user *model.User)
+		scimType   string
+	}{
+		{"deactivate", `[{"op":"replace","path":"active","value":false}]`,
+			func(user *model.User) { user.Active = false }, ""},
+		{"capitalized op and string boolean", `[{"op":"Replace","path":"active","value":"False"}]`,
+			func(user *model.User) { user.Active = false }, ""},
+		{"value object without a path", `[{"op":"replace","value":{"active":false,"externalId":"other"}}]`,
+			func(user *model.User) { user.Active, user.ExternalId = false, "other" }, ""},
+		{"path with the schema", `[{"op":"replace","path":"urn:ietf:params:scim:schemas:core:2.0:User:userName","value":"johnny"}]`,
+			func(user *model.User) { user.SCIMUserName = "johnny" }, ""},
+		{"email filter path", `[{"op":"replace","path":"emails[type eq \"work\"].value","value":"John.Doe@Example.com"}]`,
+			func(user *model.User) {
+				user.Email, user.EmailCanonical = "john.doe@example.com", "john.doe@example.com"
+			}, ""},
+		{"primary of the emails", `[{"op":"replace","path":"emails","value":[{"value":"home@example.com"},{"value":"work@example.com","primary":true}]}]`,
+			func(user *model.User) { user.Email, user.EmailCanonical = "work@example.com", "work@example.com" }, ""},
+		{"remove externalId", `[{"op":"remove","path":"externalId"}]`,
+			func(user *model.User) { user.ExternalId = "" }, ""},
+		{"operations in order", `[{"op":"replace","path":"active","value":false},{"op":"replace","path":"active","value":true}]`,
+			func(user *model.User) {}, ""},
+		{"unsupported attributes are ignored", `[{"op":"replace","path":"name.givenName","value":"John"}]`,
+			func(user *model.User) {}, ""},
+
+		{"no operations", `[]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"unknown op", `[{"op":"move","path":"active","value":false}]`, nil, constant.SCIM_ERR_INVALID_SYNTAX},
+		{"remove without a path", `[{"op":"remove"}]`, nil, constant.SCIM_ERR_NO_TARGET},
+		{"value without a path is not an object", `[{"op":"replace","value":false}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"remove userName", `[{"op":"remove","path":"userName"}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"empty userName", `[{"op":"replace","path":"userName","value":" "}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"remove emails", `[{"op":"remove","path":"emails"}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"active is not a boolean", `[{"op":"replace","path":"active","value":"yes"}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"email of another domain", `[{"op":"replace","path":"emails[type eq \"work\"].value","value":"john@other.com"}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"invalid email", `[{"op":"replace","path":"emails","value":[{"value":"not an email"}]}]`, nil, constant.SCIM_ERR_INVALID_VALUE},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			operations := []model.SCIMPatchOperation{}
+			err := json.Unmarshal([]byte(c.operations), &operations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user := original
+			err = applySCIMPatch(operations, func(op string, path string, value json.RawMessage) error {
+				return scimUsecase.patchUserAttribute(tenant, &user, op, path, value)
+			})
+			if c.scimType != "" {
+				if scimType(err) != c.scimType {
+					t.Fatalf("applySCIMPatch() = %v, want %s", err, c.scimType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applySCIMPatch() = %v", err)
+			}
+
+			want := original
+			c.user(&want)
+			if user != want {
+				t.Errorf("user = %+v, want %+v", user, want)
+			}
+		})
+	}
+}
+
+func TestApplySCIMGroupPatch(t *testing.T) {
+	members := func(userIds ...int) []model.GroupMember {
+		result := []model.GroupMember{}
+		for _, userId := range userIds {
+			result = append(result, model.GroupMember{UserId: userId})
+		}
+		return result
+	}
+
+	cases := []struct {
+		name        string
+		operations  string
+		displayName string
+		members     []model.GroupMember
+		scimType    string
+	}{
+		{"add members", `[{"op":"add","path":"members","value":[{"value":"3"},{"value":"3"},{"value":"4"}]}]`,
+			"Team", members(1, 2, 3, 4), ""},
+		{"replace members", `[{"op":"replace","path":"members","value":[{"value":"4"}]}]`,
+			"Team", members(4), ""},
+		{"remove a member by filter", `[{"op":"remove","path":"members[value eq \"2\"]"}]`,
+			"Team", members(1), ""},
+		{"remove members by value", `[{"op":"Remove","path":"members","value":[{"value":"1"}]}]`,
+			"Team", members(2), ""},
+		{"remove every member", `[{"op":"remove","path":"members"}]`,
+			"Team", nil, ""},
+		{"rename without a path", `[{"op":"replace","value":{"displayName":"Admins"}}]`,
+			"Admins", members(1, 2), ""},
+		{"rename with the schema", `[{"op":"replace","path":"urn:ietf:params:scim:schemas:core:2.0:Group:displayName","value":"Admins"}]`,
+			"Admins", members(1, 2), ""},
+
+		{"add by filter", `[{"op":"add","path":"members[value eq \"3\"]"}]`, "", nil, constant.SCIM_ERR_INVALID_PATH},
+		{"member is not a user id", `[{"op":"add","path":"members","value":[{"value":"john"}]}]`, "", nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"members is not a list", `[{"op":"add","path":"members","value":{"value":"3"}}]`, "", nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"empty displayName", `[{"op":"replace","path":"displayName","value":""}]`, "", nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"remove displayName", `[{"op":"remove","path":"displayName"}]`, "", nil, constant.SCIM_ERR_INVALID_VALUE},
+		{"unsupported attribute", `[{"op":"replace","path":"owner","value":"john"}]`, "", nil, constant.SCIM_ERR_INVALID_PATH},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			operations := []model.SCIMPatchOperation{}
+			err := json.Unmarshal([]byte(c.operations), &operations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			group := model.Group{DisplayName: "Team", Members: members(1, 2)}
+			err = applySCIMPatch(operations, func(op string, path string, value json.RawMessage) error {
+				return patchGroupAttribute(&group, op, path, value)
+			})
+			if c.scimType != "" {
+				if scimType(err) != c.scimType {
+					t.Fatalf("applySCIMPatch() = %v, want %s", err, c.scimType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applySCIMPatch() = %v", err)
+			}
+
+			if group.DisplayName != c.displayName || (len(group.Members) > 0 || len(c.members) > 0) && !reflect.DeepEqual(group.Members, c.members) {
+				t.Errorf("group = %q %v, want %q %v", group.DisplayName, group.Members, c.displayName, c.members)
+			}
+		})
+	}
+}
+
+func TestSCIMUsecasePage(t *testing.T) {
+	config := koanf.New(".")
+	config.Set("SCIM_MAX_RESULTS", 50)
+	scimUsecase := &SCIMUsecase{Config: config}
+
+	cases := []struct {
+		startIndex string
+		count      string
+		start      int
+		limit      int
+		scimType   string
+	}{
+		{"", "", 1, 50, ""},
+		{"11", "10", 11, 10, ""},
+		{"0", "-5", 1, 0, ""},
+		{"1", "1000", 1, 50, ""},
+		{"first", "", 0, 0, constant.SCIM_ERR_INVALID_VALUE},
+		{"", "ten", 0, 0, constant.SCIM_ERR_INVALID_VALUE},
+	}
+
+	for _, c := range cases {
+		start, limit, err := scimUsecase.page(model.SCIMListRequest{StartIndex: c.startIndex, Count: c.count})
+		if scimType(err) != c.scimType || start != c.start || limit != c.limit {
+			t.Errorf("page(%q, %q) = %d, %d, %v, want %d, %d", c.startIndex, c.count, start, limit, err, c.start, c.limit)
+		}
+	}
+}
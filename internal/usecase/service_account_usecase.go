@@ -0,0 +1,456 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	DefaultServiceTokenTTL = 5 * time.Minute
+	// MaxClientAssertionAge bounds how long a used assertion jti has to be remembered
+	MaxClientAssertionAge = 10 * time.Minute
+	clientIdPrefix        = "svc_"
+)
+
+// ServiceAccountUsecase issues tokens to non-human clients with the OAuth 2.0 client credentials grant (RFC 6749 section 4.4)
+type ServiceAccountUsecase struct {
+	ServiceAccountRepository *repository.ServiceAccountRepository
+	DPoPUsecase              *DPoPUsecase
+	QuotaUsecase             *QuotaUsecase
+	TokenFormat              util.TokenFormat
+	Log                      *zap.Logger
+	Config                   *koanf.Koanf
+}
+
+func NewServiceAccountUsecase(serviceAccountRepository *repository.ServiceAccountRepository, dpopUsecase *DPoPUsecase, quotaUsecase *QuotaUsecase, tokenFormat util.TokenFormat, zap *zap.Logger, koanf *koanf.Koanf) *ServiceAccountUsecase {
+	return &ServiceAccountUsecase{
+		ServiceAccountRepository: serviceAccountRepository,
+		DPoPUsecase:              dpopUsecase,
+		QuotaUsecase:             quotaUsecase,
+		TokenFormat:              tokenFormat,
+		Log:                      zap,
+		Config:                   koanf,
+	}
+}
+
+// Create registers a service account, the client secret is only returned here and stored as a bcrypt hash.
+// Accounts registered with a public key authenticate with private_key_jwt and get no secret at all
+func (usecase *ServiceAccountUsecase) Create(ctx *fiber.Ctx, ownerId int, payload model.ServiceAccountCreateRequest) (model.ServiceAccountResponse, error) {
+	response := model.ServiceAccountResponse{}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Name is required to not be empty",
+			Param:   "name",
+		}
+	} else if len(name) > 100 {
+		return response, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Name must be at most 100 characters",
+			Param:   "name",
+		}
+	}
+
+	for _, scope := range payload.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \"\\") {
+			return response, &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "Scopes must not be empty or contain spaces, quotes or backslashes",
+				Param:   "scopes",
+			}
+		}
+	}
+
+	var publicKey *string
+	if payload.PublicKey != "" {
+		_, err := util.ParsePublicKeyPEM(payload.PublicKey)
+		if err != nil {
+			return response, &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "Public key must be a PEM encoded RSA, ECDSA or Ed25519 public key",
+				Param:   "publicKey",
+			}
+		}
+		publicKey = &payload.PublicKey
+	}
+
+	clientId, err := generateClientCredential(16)
+	if err != nil {
+		return response, err
+	}
+	clientId = clientIdPrefix + clientId
+
+	var clientSecret string
+	var clientSecretHash *string
+	if publicKey == nil {
+		clientSecret, err = generateClientCredential(32)
+		if err != nil {
+			return response, err
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+		if err != nil {
+			return response, err
+		}
+		hashString := string(hash)
+		clientSecretHash = &hashString
+	}
+
+	now := time.Now()
+	serviceAccount := model.ServiceAccount{
+		Name:         name,
+		ClientId:     clientId,
+		ClientSecret: clientSecretHash,
+		PublicKey:    publicKey,
+		Scopes:       strings.Join(payload.Scopes, " "),
+		OwnerId:      ownerId,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	usage, err := usecase.QuotaUsecase.Consume(ctx, ownerId, constant.QUOTA_METRIC_SERVICE_ACCOUNTS)
+	if err != nil {
+		return response, err
+	}
+
+	serviceAccount.Id, err = usecase.ServiceAccountRepository.Create(ctx.Context(), serviceAccount)
+	if err != nil {
+		usecase.QuotaUsecase.Refund(ctx, ownerId, usage)
+		return response, err
+	}
+
+	response = serviceAccountResponse(serviceAccount)
+	response.ClientSecret = clientSecret
+
+	return response, nil
+}
+
+func (usecase *ServiceAccountUsecase) List(ctx *fiber.Ctx) ([]model.ServiceAccountResponse, error) {
+	serviceAccounts, err := usecase.ServiceAccountRepository.FindAll(ctx.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	response := []model.ServiceAccountResponse{}
+	for _, serviceAccount := range serviceAccounts {
+		response = append(response, serviceAccountResponse(serviceAccount))
+	}
+
+	return response, nil
+}
+
+// SetDisabled disables or enables a service account, disabling it also revokes the tokens it holds
+func (usecase *ServiceAccountUsecase) SetDisabled(ctx *fiber.Ctx, serviceAccountId int, payload model.ServiceAccountDisableRequest) (model.ServiceAccountResponse, error) {
+	serviceAccount, err := usecase.ServiceAccountRepository.FindById(ctx.Context(), serviceAccountId)
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	serviceAccount.Disabled = payload.Disabled
+	serviceAccount.UpdatedAt = time.Now()
+	err = usecase.ServiceAccountRepository.UpdateDisabled(ctx.Context(), serviceAccountId, serviceAccount.Disabled, serviceAccount.UpdatedAt)
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	if serviceAccount.Disabled {
+		err = usecase.ServiceAccountRepository.DeleteServiceTokensForAccount(ctx.Context(), serviceAccountId)
+		if err != nil {
+			return model.ServiceAccountResponse{}, err
+		}
+	}
+
+	return serviceAccountResponse(serviceAccount), nil
+}
+
+// RotateSecret replaces the client secret and revokes the tokens issued with the old one, the new secret is only
+// returned here. Accounts that authenticate with private_key_jwt have no secret to rotate
+func (usecase *ServiceAccountUsecase) RotateSecret(ctx *fiber.Ctx, serviceAccountId int) (model.ServiceAccountResponse, error) {
+	serviceAccount, err := usecase.ServiceAccountRepository.FindById(ctx.Context(), serviceAccountId)
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	if serviceAccount.ClientSecret == nil {
+		return model.ServiceAccountResponse{}, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Service account authenticates with a public key and has no client secret",
+			Param:   "serviceAccountId",
+		}
+	}
+
+	clientSecret, err := generateClientCredential(32)
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	err = usecase.ServiceAccountRepository.UpdateClientSecret(ctx.Context(), serviceAccountId, string(hash), time.Now())
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	err = usecase.ServiceAccountRepository.DeleteServiceTokensForAccount(ctx.Context(), serviceAccountId)
+	if err != nil {
+		return model.ServiceAccountResponse{}, err
+	}
+
+	response := serviceAccountResponse(serviceAccount)
+	response.ClientSecret = clientSecret
+
+	return response, nil
+}
+
+// Token authenticates the client with HTTP Basic, client_secret_post or private_key_jwt and issues a short-lived
+// access token limited to the requested scopes, no refresh token is issued since the client can always ask again
+func (usecase *ServiceAccountUsecase) Token(ctx *fiber.Ctx, payload model.ClientCredentialsRequest) (model.OAuthTokenResponse, error) {
+	response := model.OAuthTokenResponse{}
+
+	if payload.GrantType != constant.GRANT_TYPE_CLIENT_CREDENTIALS {
+		return response, &model.OAuthError{ErrorCode: constant.OAUTH_ERR_UNSUPPORTED_GRANT_TYPE}
+	}
+
+	serviceAccount, err := usecase.authenticateClient(ctx, payload)
+	if err != nil {
+		return response, err
+	}
+
+	allowedScopes := strings.Fields(serviceAccount.Scopes)
+	scopes := allowedScopes
+	if payload.Scope != "" {
+		scopes = strings.Fields(payload.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(allowedScopes, scope) {
+				return response, &model.OAuthError{
+					ErrorCode:        constant.OAUTH_ERR_INVALID_SCOPE,
+					ErrorDescription: "scope " + scope + " is not granted to this client",
+				}
+			}
+		}
+	}
+	scope := strings.Join(scopes, " ")
+
+	jkt, err := usecase.DPoPUsecase.oauthThumbprint(ctx)
+	if err != nil {
+		return response, err
+	}
+
+	ttl := DefaultServiceTokenTTL
+	if seconds := usecase.Config.Int("SERVICE_TOKEN_TTL"); seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	accessToken, jti, err := util.GenerateServiceAccessToken(serviceAccount.Id, serviceAccount.ClientId, scope, jkt, ttl, usecase.TokenFormat)
+	if err != nil {
+		return response, err
+	}
+
+	err = usecase.ServiceAccountRepository.SetServiceTokenInCache(ctx.Context(), jti, serviceAccount.Id, ttl)
+	if err != nil {
+		return response, err
+	}
+
+	return model.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   util.TokenType(jkt),
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// ValidateServiceToken checks that a parsed service token was issued by Token and has not expired from the cache
+func (usecase *ServiceAccountUsecase) ValidateServiceToken(ctx *fiber.Ctx, claims *model.Claims) error {
+	serviceAccountId, err := usecase.ServiceAccountRepository.GetServiceTokenInCache(ctx.Context(), claims.ID)
+	if err != nil {
+		return err
+	}
+
+	if serviceAccountId != claims.ServiceAccountId {
+		return &model.ValidationError{
+			Code:    constant.ERR_NOT_FOUND_ERROR,
+			Message: "Token is not found or has been revoked",
+		}
+	}
+
+	return nil
+}
+
+func (usecase *ServiceAccountUsecase) authenticateClient(ctx *fiber.Ctx, payload model.ClientCredentialsRequest) (model.ServiceAccount, error) {
+	invalidClient := &model.OAuthError{
+		Status:    fiber.StatusUnauthorized,
+		ErrorCode: constant.OAUTH_ERR_INVALID_CLIENT,
+	}
+
+	clientId := payload.ClientId
+	clientSecret := payload.ClientSecret
+	if username, password, ok := parseBasicAuth(ctx.Get(fiber.HeaderAuthorization)); ok {
+		if clientSecret != "" || payload.ClientAssertion != "" {
+			return model.ServiceAccount{}, &model.OAuthError{
+				ErrorCode:        constant.OAUTH_ERR_INVALID_REQUEST,
+				ErrorDescription: "only one client authentication method may be used",
+			}
+		}
+		clientId = username
+		clientSecret = password
+		ctx.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	}
+
+	if payload.ClientAssertion != "" {
+		if payload.ClientAssertionType != constant.CLIENT_ASSERTION_TYPE_JWT {
+			return model.ServiceAccount{}, &model.OAuthError{
+				ErrorCode:        constant.OAUTH_ERR_INVALID_REQUEST,
+				ErrorDescription: "client_assertion_type is not supported",
+			}
+		}
+
+		// the client id may be omitted with private_key_jwt, the assertion subject carries it
+		if clientId == "" {
+			clientId = util.UnverifiedTokenSubject(payload.ClientAssertion)
+		}
+	}
+
+	if clientId == "" {
+		return model.ServiceAccount{}, invalidClient
+	}
+
+	serviceAccount, err := usecase.ServiceAccountRepository.FindByClientId(ctx.Context(), clientId)
+	if err != nil {
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			return serviceAccount, invalidClient
+		}
+		return serviceAccount, err
+	}
+
+	if serviceAccount.Disabled {
+		return serviceAccount, invalidClient
+	}
+
+	if payload.ClientAssertion != "" {
+		if serviceAccount.PublicKey == nil {
+			return serviceAccount, invalidClient
+		}
+
+		claims, err := util.VerifyClientAssertion(payload.ClientAssertion, *serviceAccount.PublicKey, serviceAccount.ClientId, usecase.tokenEndpointURL(ctx))
+		if err != nil {
+			util.Logger(ctx, usecase.Log).Debug("Client assertion rejected", zap.String("clientId", clientId), zap.Error(err))
+			return serviceAccount, invalidClient
+		}
+
+		if time.Until(claims.ExpiresAt.Time) > MaxClientAssertionAge {
+			return serviceAccount, &model.OAuthError{
+				Status:           fiber.StatusUnauthorized,
+				ErrorCode:        constant.OAUTH_ERR_INVALID_CLIENT,
+				ErrorDescription: "client assertion lifetime is too long",
+			}
+		}
+
+		fresh, err := usecase.ServiceAccountRepository.MarkClientAssertionUsed(ctx.Context(), serviceAccount.ClientId, claims.ID, MaxClientAssertionAge)
+		if err != nil {
+			return serviceAccount, err
+		}
+		if !fresh {
+			return serviceAccount, &model.OAuthError{
+				Status:           fiber.StatusUnauthorized,
+				ErrorCode:        constant.OAUTH_ERR_INVALID_CLIENT,
+				ErrorDescription: "client assertion has already been used",
+			}
+		}
+
+		return serviceAccount, nil
+	}
+
+	if serviceAccount.ClientSecret == nil || clientSecret == "" {
+		return serviceAccount, invalidClient
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(*serviceAccount.ClientSecret), []byte(clientSecret))
+	if err != nil {
+		return serviceAccount, invalidClient
+	}
+
+	return serviceAccount, nil
+}
+
+// tokenEndpointURL is the audience client assertions must be addressed to, behind a proxy the
+// public URL cannot be derived from the request so it can be configured
+func (usecase *ServiceAccountUsecase) tokenEndpointURL(ctx *fiber.Ctx) string {
+	endpoint := usecase.Config.String("OAUTH_TOKEN_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = ctx.BaseURL() + "/oauth/token"
+	}
+
+	return endpoint
+}
+
+func serviceAccountResponse(serviceAccount model.ServiceAccount) model.ServiceAccountResponse {
+	return model.ServiceAccountResponse{
+		Id:           serviceAccount.Id,
+		Name:         serviceAccount.Name,
+		ClientId:     serviceAccount.ClientId,
+		Scopes:       strings.Fields(serviceAccount.Scopes),
+		HasPublicKey: serviceAccount.PublicKey != nil,
+		Disabled:     serviceAccount.Disabled,
+		CreatedAt:    serviceAccount.CreatedAt,
+	}
+}
+
+// parseBasicAuth decodes client credentials sent with HTTP Basic, RFC 6749 section 2.3.1 requires
+// both parts to be form-urlencoded before they are joined
+func parseBasicAuth(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	username, err = url.QueryUnescape(username)
+	if err != nil {
+		return "", "", false
+	}
+	password, err = url.QueryUnescape(password)
+	if err != nil {
+		return "", "", false
+	}
+
+	return username, password, true
+}
+
+func generateClientCredential(size int) (string, error) {
+	buf := make([]byte, size)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,310 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+// SessionUsecase owns the Redis session data behind user tokens, the auth middleware, token
+// introspection (RFC 7662) and revocation (RFC 7009) all read the same sessions
+type SessionUsecase struct {
+	SessionRepository        *repository.SessionRepository
+	ServiceAccountRepository *repository.ServiceAccountRepository
+	TokenFormat              util.TokenFormat
+	Log                      *zap.Logger
+	Config                   *koanf.Koanf
+}
+
+func NewSessionUsecase(sessionRepository *repository.SessionRepository, serviceAccountRepository *repository.ServiceAccountRepository, tokenFormat util.TokenFormat, zap *zap.Logger, koanf *koanf.Koanf) *SessionUsecase {
+	return &SessionUsecase{
+		SessionRepository:        sessionRepository,
+		ServiceAccountRepository: serviceAccountRepository,
+		TokenFormat:              tokenFormat,
+		Log:                      zap,
+		Config:                   koanf,
+	}
+}
+
+// Create starts a new session and issues its token pair, jkt binds the session to a DPoP key when not empty
+// and locale is the user's language preference
+func (usecase *SessionUsecase) Create(ctx context.Context, userId int, authTime time.Time, jkt string, locale string) (model.TokenResponse, error) {
+	now := time.Now()
+	return usecase.create(ctx, model.Session{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		Jkt:       jkt,
+		Locale:    locale,
+		AuthTime:  authTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(util.RefreshTokenDuration),
+	})
+}
+
+// CreateImpersonation starts a session in which actorId acts as userId and returns its id with the tokens, it ends
+// after ttl and cannot be extended. The session is listed under userId so revoking all of the user's sessions ends it too
+func (usecase *SessionUsecase) CreateImpersonation(ctx context.Context, actorId int, userId int, authTime time.Time, jkt string, ttl time.Duration) (string, model.TokenResponse, error) {
+	now := time.Now()
+	session := model.Session{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		Jkt:       jkt,
+		ActorId:   actorId,
+		AuthTime:  authTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	token, err := usecase.create(ctx, session)
+	return session.Id, token, err
+}
+
+func (usecase *SessionUsecase) create(ctx context.Context, session model.Session) (model.TokenResponse, error) {
+	token, err := util.GenerateTokenPair(session, usecase.TokenFormat)
+	if err != nil {
+		return token, err
+	}
+
+	err = usecase.SessionRepository.Create(ctx, session, hashRefreshToken(token.RefreshToken))
+	if err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+// Validate checks that the session a user access token belongs to has not been revoked
+func (usecase *SessionUsecase) Validate(ctx *fiber.Ctx, claims *model.Claims) (model.Session, error) {
+	if claims.SessionId == "" {
+		return model.Session{}, &model.ValidationError{
+			Code:    constant.ERR_NOT_FOUND_ERROR,
+			Message: "Authorization token is expired",
+			Param:   "accessToken",
+		}
+	}
+
+	session, err := usecase.SessionRepository.Find(ctx.Context(), claims.SessionId)
+	if err != nil {
+		return session, err
+	}
+
+	if !sessionMatches(session, claims) {
+		return session, &model.ValidationError{
+			Code:    constant.ERR_NOT_FOUND_ERROR,
+			Message: "Authorization token is expired",
+			Param:   "accessToken",
+		}
+	}
+
+	return session, nil
+}
+
+func (usecase *SessionUsecase) Delete(ctx context.Context, sessionId string) error {
+	return usecase.SessionRepository.Delete(ctx, sessionId)
+}
+
+func (usecase *SessionUsecase) SetLocale(ctx context.Context, userId int, locale string) error {
+	return usecase.SessionRepository.SetLocaleForUser(ctx, userId, locale)
+}
+
+func (usecase *SessionUsecase) RevokeAll(ctx context.Context, userId int) error {
+	return usecase.SessionRepository.DeleteAllForUser(ctx, userId)
+}
+
+// Introspect reports whether an access or refresh token is active, the hint only decides which lookup runs first
+func (usecase *SessionUsecase) Introspect(ctx *fiber.Ctx, payload model.TokenIntrospectionRequest) (model.TokenIntrospectionResponse, error) {
+	inactive := model.TokenIntrospectionResponse{Active: false}
+
+	if payload.Token == "" {
+		return inactive, &model.OAuthError{
+			ErrorCode:        constant.OAUTH_ERR_INVALID_REQUEST,
+			ErrorDescription: "token is required",
+		}
+	}
+
+	if payload.TokenTypeHint == constant.TOKEN_TYPE_HINT_REFRESH_TOKEN || !looksLikeAccessToken(payload.Token) {
+		response, err := usecase.introspectRefreshToken(ctx.Context(), payload.Token)
+		if err != nil || response.Active || !looksLikeAccessToken(payload.Token) {
+			return response, err
+		}
+	}
+
+	return usecase.introspectAccessToken(ctx.Context(), payload.Token)
+}
+
+// Revoke ends the session behind an access or refresh token, or the service token itself. Per RFC 7009
+// section 2.2 unknown, expired and already revoked tokens are not an error
+func (usecase *SessionUsecase) Revoke(ctx *fiber.Ctx, payload model.TokenRevocationRequest) error {
+	if payload.Token == "" {
+		return &model.OAuthError{
+			ErrorCode:        constant.OAUTH_ERR_INVALID_REQUEST,
+			ErrorDescription: "token is required",
+		}
+	}
+
+	if !looksLikeAccessToken(payload.Token) {
+		sessionId, err := usecase.SessionRepository.FindIdByRefreshToken(ctx.Context(), hashRefreshToken(payload.Token))
+		if err != nil {
+			var validationErr *model.ValidationError
+			if errors.As(err, &validationErr) {
+				return nil
+			}
+			return err
+		}
+
+		return usecase.SessionRepository.Delete(ctx.Context(), sessionId)
+	}
+
+	claims, err := usecase.TokenFormat.Parse(payload.Token)
+	if err != nil {
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil
+		}
+		return err
+	}
+
+	if claims.IsService() {
+		return usecase.ServiceAccountRepository.DeleteServiceTokenInCache(ctx.Context(), claims.ID)
+	}
+
+	if claims.SessionId == "" {
+		return nil
+	}
+
+	return usecase.SessionRepository.Delete(ctx.Context(), claims.SessionId)
+}
+
+func (usecase *SessionUsecase) introspectAccessToken(ctx context.Context, token string) (model.TokenIntrospectionResponse, error) {
+	inactive := model.TokenIntrospectionResponse{Active: false}
+	var validationErr *model.ValidationError
+
+	claims, err := usecase.TokenFormat.Parse(token)
+	if err != nil {
+		if errors.As(err, &validationErr) {
+			return inactive, nil
+		}
+		return inactive, err
+	}
+
+	response := model.TokenIntrospectionResponse{
+		Active:    true,
+		TokenType: constant.TOKEN_TYPE_HINT_ACCESS_TOKEN,
+		Sub:       claims.Subject,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Scope:     claims.Scope,
+		ClientId:  claims.ClientId,
+		Cnf:       claims.Confirmation,
+		Act:       claims.Actor,
+	}
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+
+	if claims.IsService() {
+		serviceAccountId, err := usecase.ServiceAccountRepository.GetServiceTokenInCache(ctx, claims.ID)
+		if err != nil {
+			if errors.As(err, &validationErr) {
+				return inactive, nil
+			}
+			return inactive, err
+		}
+		if serviceAccountId != claims.ServiceAccountId {
+			return inactive, nil
+		}
+
+		return response, nil
+	}
+
+	if claims.SessionId == "" {
+		return inactive, nil
+	}
+
+	session, err := usecase.SessionRepository.Find(ctx, claims.SessionId)
+	if err != nil {
+		if errors.As(err, &validationErr) {
+			return inactive, nil
+		}
+		return inactive, err
+	}
+	if !sessionMatches(session, claims) {
+		return inactive, nil
+	}
+
+	response.Sid = session.Id
+	response.AuthTime = session.AuthTime.Unix()
+
+	return response, nil
+}
+
+func (usecase *SessionUsecase) introspectRefreshToken(ctx context.Context, token string) (model.TokenIntrospectionResponse, error) {
+	inactive := model.TokenIntrospectionResponse{Active: false}
+	var validationErr *model.ValidationError
+
+	sessionId, err := usecase.SessionRepository.FindIdByRefreshToken(ctx, hashRefreshToken(token))
+	if err != nil {
+		if errors.As(err, &validationErr) {
+			return inactive, nil
+		}
+		return inactive, err
+	}
+
+	session, err := usecase.SessionRepository.Find(ctx, sessionId)
+	if err != nil {
+		if errors.As(err, &validationErr) {
+			return inactive, nil
+		}
+		return inactive, err
+	}
+
+	return model.TokenIntrospectionResponse{
+		Active:    true,
+		TokenType: constant.TOKEN_TYPE_HINT_REFRESH_TOKEN,
+		Exp:       session.ExpiresAt.Unix(),
+		Iat:       session.CreatedAt.Unix(),
+		Sub:       util.UserSubject(session.UserId),
+		Iss:       util.TokenIssuer,
+		Sid:       session.Id,
+		AuthTime:  session.AuthTime.Unix(),
+		Cnf:       util.Confirmation(session.Jkt),
+		Act:       util.Actor(session.ActorId),
+	}, nil
+}
+
+// sessionMatches makes sure a token is used with the session it was issued for, including who is acting in it
+func sessionMatches(session model.Session, claims *model.Claims) bool {
+	actorId := 0
+	if claims.Actor != nil {
+		actorId = claims.Actor.UserId
+	}
+
+	return session.UserId == claims.UserId && session.ActorId == actorId
+}
+
+// looksLikeAccessToken tells access tokens apart from the opaque refresh tokens without parsing them,
+// both JWT and PASETO tokens are dot separated while refresh tokens are plain UUIDs
+func looksLikeAccessToken(token string) bool {
+	return strings.Contains(token, ".")
+}
+
+// hashRefreshToken keeps raw refresh tokens out of Redis, only the client ever holds them
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,326 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/i18n"
+	"cutterproject/internal/mail"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	DeviceCookieName         = "device_id"
+	DeviceHeaderName         = "X-Device-Id"
+	DeviceCookieDuration     = 365 * 24 * time.Hour
+	StepUpChallengeTTL       = 10 * time.Minute
+	StepUpMaxAttempts        = 5
+	DefaultStepUpFailures    = 5
+	DefaultStepUpFailureSpan = time.Hour
+)
+
+type StepUpUsecase struct {
+	LoginEventRepository *repository.LoginEventRepository
+	UserRepository       *repository.UserRepository
+	GeoIP                *util.GeoIP
+	Mailer               mail.Mailer
+	Log                  *zap.Logger
+	Config               *koanf.Koanf
+}
+
+func NewStepUpUsecase(loginEventRepository *repository.LoginEventRepository, userRepository *repository.UserRepository, geoIP *util.GeoIP, mailer mail.Mailer, zap *zap.Logger, koanf *koanf.Koanf) *StepUpUsecase {
+	return &StepUpUsecase{
+		LoginEventRepository: loginEventRepository,
+		UserRepository:       userRepository,
+		GeoIP:                geoIP,
+		Mailer:               mailer,
+		Log:                  zap,
+		Config:               koanf,
+	}
+}
+
+// Signals collects the risk signals of the current request, the device id is only trusted when its signature is valid
+func (usecase *StepUpUsecase) Signals(ctx *fiber.Ctx) model.LoginSignals {
+	signals := model.LoginSignals{
+		IP:      util.ClientIP(ctx),
+		Country: usecase.GeoIP.Country(util.ClientIP(ctx)),
+	}
+
+	deviceToken := ctx.Cookies(DeviceCookieName)
+	if deviceToken == "" {
+		deviceToken = ctx.Get(DeviceHeaderName)
+	}
+
+	deviceId, err := util.VerifySignedToken(deviceToken, usecase.deviceSecret())
+	if err == nil {
+		signals.DeviceId = deviceId
+	}
+
+	return signals
+}
+
+// Evaluate returns the reasons a login with these signals needs a second factor, none means tokens can be issued
+func (usecase *StepUpUsecase) Evaluate(ctx context.Context, userId int, signals model.LoginSignals) ([]string, error) {
+	reasons := []string{}
+	if !usecase.Config.Bool("STEP_UP_ENABLED") {
+		return reasons, nil
+	}
+
+	if usecase.Config.Bool("STEP_UP_NEW_DEVICE") {
+		known := false
+		if signals.DeviceId != "" {
+			var err error
+			known, err = usecase.LoginEventRepository.HasSuccessfulDevice(ctx, userId, signals.DeviceId)
+			if err != nil {
+				return reasons, err
+			}
+		}
+
+		if !known {
+			reasons = append(reasons, constant.STEP_UP_REASON_NEW_DEVICE)
+		}
+	}
+
+	if usecase.Config.Bool("STEP_UP_NEW_COUNTRY") && signals.Country != "" {
+		countries, err := usecase.LoginEventRepository.GetSuccessfulCountries(ctx, userId)
+		if err != nil {
+			return reasons, err
+		}
+
+		// the first country ever seen is not suspicious, there is nothing to compare it with
+		if len(countries) > 0 && !slices.Contains(countries, signals.Country) {
+			reasons = append(reasons, constant.STEP_UP_REASON_NEW_COUNTRY)
+		}
+	}
+
+	threshold := usecase.Config.Int("STEP_UP_FAILURE_THRESHOLD")
+	if threshold <= 0 {
+		threshold = DefaultStepUpFailures
+	}
+
+	window := DefaultStepUpFailureSpan
+	if seconds := usecase.Config.Int("STEP_UP_FAILURE_WINDOW"); seconds > 0 {
+		window = time.Duration(seconds) * time.Second
+	}
+
+	failures, err := usecase.LoginEventRepository.CountFailuresSince(ctx, userId, time.Now().Add(-window))
+	if err != nil {
+		return reasons, err
+	}
+
+	if failures >= threshold {
+		reasons = append(reasons, constant.STEP_UP_REASON_RECENT_FAILURES)
+	}
+
+	return reasons, nil
+}
+
+// Begin stores a one-time code for the login and emails it, the returned error carries the challenge id. The mail
+// is written in the user's language, or in requestLocale when they have not picked one
+func (usecase *StepUpUsecase) Begin(ctx context.Context, userId int, signals model.LoginSignals, reasons []string, requestLocale string) error {
+	user, err := usecase.UserRepository.GetUserInfo(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	code, err := generateOneTimeCode()
+	if err != nil {
+		return err
+	}
+
+	_, challengeId, err := util.GenerateSignedToken(usecase.Config.String("JWT_SECRET_KEY"))
+	if err != nil {
+		return err
+	}
+
+	err = usecase.UserRepository.SetStepUpChallengeInCache(ctx, challengeId, model.StepUpChallenge{
+		UserId:   userId,
+		CodeHash: hashOneTimeCode(challengeId, code),
+		Signals:  signals,
+	}, StepUpChallengeTTL)
+	if err != nil {
+		return err
+	}
+
+	locale := requestLocale
+	if i18n.Supported(user.Locale) {
+		locale = user.Locale
+	}
+
+	message := mail.Message{
+		To:      user.Email,
+		Subject: i18n.T(locale, i18n.MAIL_STEP_UP_SUBJECT, nil),
+		Body: i18n.T(locale, i18n.MAIL_STEP_UP_BODY, map[string]interface{}{
+			"code":    code,
+			"minutes": int(StepUpChallengeTTL.Minutes()),
+		}),
+	}
+
+	log := util.ContextLogger(ctx, usecase.Log)
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := usecase.Mailer.Send(sendCtx, message)
+		if err != nil {
+			log.Warn("Failed to send step-up code", zap.Int("userId", userId), zap.Error(err))
+		}
+	}()
+
+	return &model.StepUpRequiredError{
+		Code:        constant.ERR_STEP_UP_REQUIRED_ERROR,
+		Message:     "A verification code has been sent to your email",
+		ChallengeId: challengeId,
+		Method:      constant.STEP_UP_METHOD_EMAIL_OTP,
+		Reasons:     reasons,
+		ExpiresIn:   int(StepUpChallengeTTL.Seconds()),
+	}
+}
+
+// Verify checks the emailed code and returns the user and signals captured when the challenge began
+func (usecase *StepUpUsecase) Verify(ctx context.Context, payload model.StepUpVerifyRequest) (int, model.LoginSignals, error) {
+	if payload.ChallengeId == "" {
+		return 0, model.LoginSignals{}, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Challenge id is required to not be empty",
+			Param:   "challengeId",
+		}
+	}
+
+	if len(payload.Code) != 6 {
+		return 0, model.LoginSignals{}, &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Code must be 6 digits",
+			Param:   "code",
+		}
+	}
+
+	challenge, attempts, err := usecase.UserRepository.GetStepUpChallengeInCache(ctx, payload.ChallengeId)
+	if err != nil {
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			return 0, model.LoginSignals{}, &model.CredentialError{Err: err}
+		}
+		return 0, model.LoginSignals{}, err
+	}
+
+	if attempts > StepUpMaxAttempts {
+		err = usecase.UserRepository.DeleteStepUpChallengeInCache(ctx, payload.ChallengeId)
+		if err != nil {
+			return 0, model.LoginSignals{}, err
+		}
+
+		return 0, model.LoginSignals{}, &model.CredentialError{Err: &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "Too many incorrect codes, please sign in again",
+			Param:   "code",
+		}}
+	}
+
+	expected := []byte(challenge.CodeHash)
+	actual := []byte(hashOneTimeCode(payload.ChallengeId, payload.Code))
+	if subtle.ConstantTimeCompare(expected, actual) != 1 {
+		usecase.RecordLogin(ctx, challenge.UserId, challenge.Signals, false)
+		return 0, model.LoginSignals{}, &model.CredentialError{Err: &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Code is incorrect",
+			Param:   "code",
+		}}
+	}
+
+	// a code is good for one sign in, a second request that checked the same code loses the race here
+	consumed, err := usecase.UserRepository.ConsumeStepUpChallengeInCache(ctx, payload.ChallengeId, challenge.CodeHash)
+	if err != nil {
+		return 0, model.LoginSignals{}, err
+	}
+	if !consumed {
+		return 0, model.LoginSignals{}, &model.CredentialError{Err: &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "Verification challenge is not found or expired",
+			Param:   "challengeId",
+		}}
+	}
+
+	return challenge.UserId, challenge.Signals, nil
+}
+
+// RecordLogin stores the attempt in the login history, failing to record must not fail the login itself
+func (usecase *StepUpUsecase) RecordLogin(ctx context.Context, userId int, signals model.LoginSignals, success bool) {
+	err := usecase.LoginEventRepository.Create(ctx, model.LoginEvent{
+		UserId:    userId,
+		IP:        signals.IP,
+		Country:   signals.Country,
+		DeviceId:  signals.DeviceId,
+		Success:   success,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		util.ContextLogger(ctx, usecase.Log).Warn("Failed to record login event", zap.Int("userId", userId), zap.Error(err))
+	}
+}
+
+// RememberDevice makes sure the client holds a signed device id and returns it, a new one is minted when
+// the request did not carry a valid one
+func (usecase *StepUpUsecase) RememberDevice(ctx *fiber.Ctx, signals model.LoginSignals) (model.LoginSignals, error) {
+	if signals.DeviceId != "" {
+		return signals, nil
+	}
+
+	deviceToken, deviceId, err := util.GenerateSignedToken(usecase.deviceSecret())
+	if err != nil {
+		return signals, err
+	}
+
+	ctx.Cookie(&fiber.Cookie{
+		Name:     DeviceCookieName,
+		Value:    deviceToken,
+		Path:     "/",
+		Expires:  time.Now().Add(DeviceCookieDuration),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	ctx.Set(DeviceHeaderName, deviceToken)
+
+	signals.DeviceId = deviceId
+
+	return signals, nil
+}
+
+// deviceSecret keeps device ids from being interchangeable with other tokens signed by the same key
+func (usecase *StepUpUsecase) deviceSecret() string {
+	secret := usecase.Config.String("DEVICE_ID_SECRET_KEY")
+	if secret == "" {
+		secret = usecase.Config.String("JWT_SECRET_KEY") + ":device"
+	}
+
+	return secret
+}
+
+func generateOneTimeCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashOneTimeCode(challengeId string, code string) string {
+	sum := sha256.Sum256([]byte(challengeId + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
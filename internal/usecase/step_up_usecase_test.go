@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func TestStepUpVerifyConsumesTheChallengeOnce(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	userRepository := repository.NewUserRepository(zap.NewNop(), nil, client)
+	stepUpUsecase := NewStepUpUsecase(nil, userRepository, nil, nil, zap.NewNop(), koanf.New("."))
+	ctx := context.Background()
+
+	err := userRepository.SetStepUpChallengeInCache(ctx, "challenge", model.StepUpChallenge{
+		UserId:   7,
+		CodeHash: hashOneTimeCode("challenge", "123456"),
+		Signals:  model.LoginSignals{IP: "203.0.113.7"},
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more requests than StepUpMaxAttempts would end the challenge for everyone
+	requests := StepUpMaxAttempts
+	results := make(chan error, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userId, signals, err := stepUpUsecase.Verify(ctx, model.StepUpVerifyRequest{ChallengeId: "challenge", Code: "123456"})
+			if err == nil && (userId != 7 || signals.IP != "203.0.113.7") {
+				err = errors.New("wrong user or signals")
+			}
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		var credentialErr *model.CredentialError
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.As(err, &credentialErr):
+			t.Errorf("Verify() = %v, want a credential error", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of %d verifications with the right code succeeded, want 1", succeeded, requests)
+	}
+}
@@ -1,32 +1,66 @@
 package usecase
 
 import (
+	"context"
+	"crypto/rand"
 	"cutterproject/internal/constant"
+	"cutterproject/internal/i18n"
+	"cutterproject/internal/mail"
 	"cutterproject/internal/model"
 	"cutterproject/internal/repository"
 	"cutterproject/internal/util"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"github.com/knadh/koanf/v2"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	MagicLinkTTL = 15 * time.Minute
+	// provisionUsernameAttempts bounds how many suffixed usernames are tried when provisioning a user
+	provisionUsernameAttempts = 5
+)
+
+// TxBeginner starts the transactions registration writes in, a *pgxpool.Pool in production
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 type UserUsecase struct {
-	UserRepository *repository.UserRepository
-	DB             *pgxpool.Pool
-	Log            *zap.Logger
-	Config         *koanf.Koanf
+	UserRepository   *repository.UserRepository
+	InviteRepository *repository.InviteRepository
+	EmailPolicy      *util.EmailPolicy
+	Authenticator    Authenticator
+	Mailer           mail.Mailer
+	StepUpUsecase    *StepUpUsecase
+	SessionUsecase   *SessionUsecase
+	DPoPUsecase      *DPoPUsecase
+	DB               TxBeginner
+	Log              *zap.Logger
+	Config           *koanf.Koanf
 }
 
-func NewUserUsecase(userRepository *repository.UserRepository, db *pgxpool.Pool, zap *zap.Logger, koanf *koanf.Koanf) *UserUsecase {
+func NewUserUsecase(userRepository *repository.UserRepository, inviteRepository *repository.InviteRepository, emailPolicy *util.EmailPolicy, authenticator Authenticator, mailer mail.Mailer, stepUpUsecase *StepUpUsecase, sessionUsecase *SessionUsecase, dpopUsecase *DPoPUsecase, db TxBeginner, zap *zap.Logger, koanf *koanf.Koanf) *UserUsecase {
 	return &UserUsecase{
-		UserRepository: userRepository,
-		DB:             db,
-		Log:            zap,
-		Config:         koanf,
+		UserRepository:   userRepository,
+		InviteRepository: inviteRepository,
+		EmailPolicy:      emailPolicy,
+		Authenticator:    authenticator,
+		Mailer:           mailer,
+		StepUpUsecase:    stepUpUsecase,
+		SessionUsecase:   sessionUsecase,
+		DPoPUsecase:      dpopUsecase,
+		DB:               db,
+		Log:              zap,
+		Config:           koanf,
 	}
 }
 
@@ -34,67 +68,26 @@ func (usecase *UserUsecase) Register(ctx *fiber.Ctx, payload model.UserCreateReq
 	ctxContext := ctx.Context()
 	token := model.TokenResponse{}
 
-	if payload.Username == "" {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Username is required to not be empty",
-			Param:   "username",
-		}
-	} else if len(payload.Username) < 4 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Username must be at least 4 characters",
-			Param:   "username",
-		}
-	} else if len(payload.Username) > 22 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "username must be at most 22 characters",
-			Param:   "username",
-		}
+	err := util.Validate(payload)
+	if err != nil {
+		return token, err
 	}
 
-	if payload.Email == "" {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Email is required to not be empty",
-			Param:   "email",
-		}
-	} else if len(payload.Email) < 16 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "email must be at least 16 characters",
-			Param:   "email",
-		}
-	} else if len(payload.Email) > 80 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Email must be at most 80 characters",
-			Param:   "email",
-		}
-	}
+	// both were checked by Validate, normalizing them again can not fail
+	payload.Username, _ = util.NormalizeUsername(payload.Username)
+	email, _ := util.NormalizeEmail(payload.Email)
 
-	if payload.Password == "" {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password is required to not be empty",
-			Param:   "email",
-		}
-	} else if len(payload.Password) < 5 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password must be at least 5 characters",
-			Param:   "email",
-		}
-	} else if len(payload.Password) > 20 {
+	if usecase.EmailPolicy.IsDisposable(email) {
 		return token, &model.ValidationError{
 			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password must be at most 20 characters",
+			Message: "Disposable email addresses are not allowed",
 			Param:   "email",
 		}
 	}
+	payload.Email = email
 
-	err := usecase.UserRepository.CheckUsernameOrEmailUnique(ctxContext, payload.Username, payload.Email)
+	registrationMode := usecase.registrationMode()
+	err = usecase.checkRegistrationAllowed(registrationMode, payload)
 	if err != nil {
 		return token, err
 	}
@@ -106,113 +99,205 @@ func (usecase *UserUsecase) Register(ctx *fiber.Ctx, payload model.UserCreateReq
 	}
 
 	user := model.User{
-		Username:  payload.Username,
-		Email:     payload.Email,
-		Password:  string(hashedPassword),
-		CreatedAt: now,
-		UpdatedAt: now,
+		Username:         payload.Username,
+		UsernameSkeleton: util.UsernameSkeleton(payload.Username),
+		Email:            payload.Email,
+		EmailCanonical:   usecase.EmailPolicy.Canonicalize(payload.Email),
+		Password:         string(hashedPassword),
+		Role:             constant.ROLE_USER,
+		CreatedAt:        now,
+		UpdatedAt:        now,
 	}
 
-	// start transaction
-	tx, err := usecase.DB.Begin(ctx.Context())
+	userId, err := usecase.createUser(ctxContext, user, registrationMode, payload.InviteCode)
 	if err != nil {
 		return token, err
 	}
 
-	defer tx.Rollback(ctxContext)
+	return usecase.completeLogin(ctx, userId, usecase.StepUpUsecase.Signals(ctx))
+}
 
-	userId, err := usecase.UserRepository.Register(ctxContext, tx, user)
+// createUser writes a registered user, in invite mode a use of the invite code is claimed in the same transaction
+// so a registration that fails gives it back
+func (usecase *UserUsecase) createUser(ctx context.Context, user model.User, registrationMode string, inviteCode string) (int, error) {
+	// start transaction
+	tx, err := usecase.DB.Begin(ctx)
 	if err != nil {
-		return token, err
+		return 0, err
 	}
 
-	err = tx.Commit(ctxContext)
-	if err != nil {
-		return token, err
+	defer tx.Rollback(ctx)
+
+	if registrationMode == constant.REGISTRATION_MODE_INVITE {
+		err = usecase.InviteRepository.Consume(ctx, tx, inviteCode, user.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	token, err = util.GenerateTokenPair(userId, usecase.Config.String("JWT_SECRET_KEY"))
+	userId, err := usecase.UserRepository.Register(ctx, tx, user)
 	if err != nil {
-		return token, err
+		return 0, err
 	}
 
-	err = usecase.UserRepository.SetAuthTokenInCache(ctxContext, token.AccessToken, token.RefreshToken, userId)
+	err = tx.Commit(ctx)
 	if err != nil {
-		return token, err
+		return 0, err
 	}
 
-	return token, nil
+	return userId, nil
 }
 
 func (usecase *UserUsecase) Login(ctx *fiber.Ctx, payload model.UserLoginRequest) (model.TokenResponse, error) {
 	ctxContext := ctx.Context()
 	token := model.TokenResponse{}
 
-	if payload.Email == "" {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Email is required to not be empty",
-			Param:   "email",
-		}
-	} else if len(payload.Email) < 16 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "email must be at least 16 characters",
-			Param:   "email",
+	if payload.Identifier == "" {
+		payload.Identifier = payload.Email
+	}
+
+	err := util.Validate(payload)
+	if err != nil {
+		return token, err
+	}
+
+	signals := usecase.StepUpUsecase.Signals(ctx)
+
+	userId, err := usecase.Authenticator.Authenticate(ctxContext, payload.Identifier, payload.Password)
+	if err != nil {
+		if userId != 0 {
+			usecase.StepUpUsecase.RecordLogin(ctxContext, userId, signals, false)
 		}
-	} else if len(payload.Email) > 80 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Email must be at most 80 characters",
-			Param:   "email",
+		var validationErr *model.ValidationError
+		if errors.As(err, &validationErr) {
+			return token, &model.CredentialError{Err: err}
 		}
+		return token, err
 	}
 
-	if payload.Password == "" {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password is required to not be empty",
-			Param:   "email",
-		}
-	} else if len(payload.Password) < 5 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password must be at least 5 characters",
-			Param:   "email",
+	reasons, err := usecase.StepUpUsecase.Evaluate(ctxContext, userId, signals)
+	if err != nil {
+		return token, err
+	}
+
+	if len(reasons) > 0 {
+		return token, usecase.StepUpUsecase.Begin(ctxContext, userId, signals, reasons, i18n.Locale(ctx))
+	}
+
+	return usecase.completeLogin(ctx, userId, signals)
+}
+
+// VerifyLogin finishes a login that was held back by a step-up challenge
+func (usecase *UserUsecase) VerifyLogin(ctx *fiber.Ctx, payload model.StepUpVerifyRequest) (model.TokenResponse, error) {
+	userId, signals, err := usecase.StepUpUsecase.Verify(ctx.Context(), payload)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	return usecase.completeLogin(ctx, userId, signals)
+}
+
+// RequestMagicLink always succeeds for a well formed email so the endpoint can not be used to
+// find out which emails are registered, the mail itself is sent in the background
+func (usecase *UserUsecase) RequestMagicLink(ctx *fiber.Ctx, payload model.MagicLinkRequest) error {
+	ctxContext := ctx.Context()
+
+	if !usecase.Config.Bool("MAGIC_LINK_ENABLED") {
+		return &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Magic link login is disabled",
 		}
-	} else if len(payload.Password) > 20 {
-		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password must be at most 20 characters",
-			Param:   "email",
+	}
+
+	err := util.Validate(payload)
+	if err != nil {
+		return err
+	}
+	email, _ := util.NormalizeEmail(payload.Email)
+
+	var validationErr *model.ValidationError
+
+	userId, _, err := usecase.UserRepository.GetUserAuth(ctxContext, email, usecase.EmailPolicy.Canonicalize(email))
+	if err != nil {
+		if errors.As(err, &validationErr) {
+			util.Logger(ctx, usecase.Log).Debug("Magic link requested for unknown email")
+			return nil
 		}
+		return err
 	}
 
-	userId, password, err := usecase.UserRepository.GetUserAuth(ctxContext, payload.Email)
+	user, err := usecase.UserRepository.GetUserInfo(ctxContext, userId)
 	if err != nil {
-		return token, err
+		return err
 	}
+	locale := mailLocale(ctx, user)
 
-	err = bcrypt.CompareHashAndPassword([]byte(password), []byte(payload.Password))
+	linkToken, linkId, err := util.GenerateSignedToken(usecase.Config.String("JWT_SECRET_KEY"))
 	if err != nil {
+		return err
+	}
+
+	ttl := MagicLinkTTL
+	if seconds := usecase.Config.Int("MAGIC_LINK_TTL"); seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	err = usecase.UserRepository.SetMagicLinkInCache(ctxContext, linkId, userId, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := usecase.Config.String("MAGIC_LINK_URL") + "?token=" + url.QueryEscape(linkToken)
+	// the typed address only has to canonicalize to the account's, the link goes to the mailbox the account owns
+	message := mail.Message{
+		To:      user.Email,
+		Subject: i18n.T(locale, i18n.MAIL_MAGIC_LINK_SUBJECT, nil),
+		Body: i18n.T(locale, i18n.MAIL_MAGIC_LINK_BODY, map[string]interface{}{
+			"minutes": int(ttl.Minutes()),
+			"link":    link,
+		}),
+	}
+
+	log := util.Logger(ctx, usecase.Log)
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := usecase.Mailer.Send(sendCtx, message)
+		if err != nil {
+			log.Warn("Failed to send magic link", zap.Int("userId", userId), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+func (usecase *UserUsecase) RedeemMagicLink(ctx *fiber.Ctx, payload model.MagicLinkVerifyRequest) (model.TokenResponse, error) {
+	ctxContext := ctx.Context()
+	token := model.TokenResponse{}
+
+	if !usecase.Config.Bool("MAGIC_LINK_ENABLED") {
 		return token, &model.ValidationError{
-			Code:    constant.ERR_VALIDATION_CODE,
-			Message: "Password is incorrect",
-			Param:   "password",
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Magic link login is disabled",
 		}
 	}
 
-	token, err = util.GenerateTokenPair(userId, usecase.Config.String("JWT_SECRET_KEY"))
+	linkId, err := util.VerifySignedToken(payload.Token, usecase.Config.String("JWT_SECRET_KEY"))
 	if err != nil {
-		return token, err
+		return token, &model.ValidationError{
+			Code:    constant.ERR_UNATHORIZED_ERROR,
+			Message: "Magic link is invalid, expired or already used",
+			Param:   "token",
+		}
 	}
 
-	err = usecase.UserRepository.SetAuthTokenInCache(ctxContext, token.AccessToken, token.RefreshToken, userId)
+	userId, err := usecase.UserRepository.TakeMagicLinkInCache(ctxContext, linkId)
 	if err != nil {
 		return token, err
 	}
 
-	return token, nil
+	return usecase.completeLogin(ctx, userId, usecase.StepUpUsecase.Signals(ctx))
 }
 
 func (usecase *UserUsecase) GetUserInfo(ctx *fiber.Ctx, id int) (model.UserResponse, error) {
@@ -224,19 +309,249 @@ func (usecase *UserUsecase) GetUserInfo(ctx *fiber.Ctx, id int) (model.UserRespo
 	return user, nil
 }
 
-func (usecase *UserUsecase) GetAccessToken(ctx *fiber.Ctx, userId int, accessToken string) error {
-	token, err := usecase.UserRepository.GetAccessTokenInCache(ctx.Context(), userId)
+// Reauthenticate confirms the password of an already logged in user and issues tokens with a fresh auth_time
+func (usecase *UserUsecase) Reauthenticate(ctx *fiber.Ctx, userId int, payload model.ReauthenticateRequest) (model.TokenResponse, error) {
+	ctxContext := ctx.Context()
+	token := model.TokenResponse{}
+
+	err := util.Validate(payload)
+	if err != nil {
+		return token, err
+	}
+
+	signals := usecase.StepUpUsecase.Signals(ctx)
+
+	err = usecase.Authenticator.Reauthenticate(ctxContext, userId, payload.Password)
+	if err != nil {
+		usecase.StepUpUsecase.RecordLogin(ctxContext, userId, signals, false)
+
+		var validationErr *model.ValidationError
+		if !errors.As(err, &validationErr) {
+			return token, err
+		}
+		return token, errIncorrectPassword()
+	}
+
+	return usecase.completeLogin(ctx, userId, signals)
+}
+
+func (usecase *UserUsecase) UpdatePassword(ctx *fiber.Ctx, userId int, payload model.UserPasswordUpdateRequest) error {
+	if !usecase.Authenticator.ManagesPasswords() {
+		return &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Passwords are managed by your organization's directory and cannot be changed here",
+		}
+	}
+
+	err := util.Validate(payload)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = usecase.UserRepository.UpdatePassword(ctx.Context(), userId, string(hashedPassword), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// every existing session was created with the old password, make the user log in again
+	return usecase.SessionUsecase.RevokeAll(ctx.Context(), userId)
+}
+
+func (usecase *UserUsecase) UpdateEmail(ctx *fiber.Ctx, userId int, payload model.UserEmailUpdateRequest) error {
+	err := util.Validate(payload)
+	if err != nil {
+		return err
+	}
+	email, _ := util.NormalizeEmail(payload.Email)
+
+	if usecase.EmailPolicy.IsDisposable(email) {
+		return &model.ValidationError{
+			Code:    constant.ERR_VALIDATION_CODE,
+			Message: "Disposable email addresses are not allowed",
+			Param:   "email",
+		}
+	}
+
+	return usecase.UserRepository.UpdateEmail(ctx.Context(), userId, email, usecase.EmailPolicy.Canonicalize(email), time.Now())
+}
+
+// UpdateLocale saves the user's language preference, it is used for their mail and, in place of Accept-Language,
+// for the responses to their requests
+func (usecase *UserUsecase) UpdateLocale(ctx *fiber.Ctx, userId int, payload model.UserLocaleUpdateRequest) error {
+	err := util.Validate(payload)
+	if err != nil {
+		return err
+	}
+
+	err = usecase.UserRepository.UpdateLocale(ctx.Context(), userId, payload.Locale, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return usecase.SessionUsecase.SetLocale(ctx.Context(), userId, payload.Locale)
+}
+
+func (usecase *UserUsecase) Delete(ctx *fiber.Ctx, userId int) error {
+	err := usecase.UserRepository.Delete(ctx.Context(), userId)
 	if err != nil {
 		return err
 	}
 
-	if accessToken != token {
+	return usecase.SessionUsecase.RevokeAll(ctx.Context(), userId)
+}
+
+func (usecase *UserUsecase) GetUserRole(ctx *fiber.Ctx, id int) (string, error) {
+	return usecase.UserRepository.GetUserRole(ctx.Context(), id)
+}
+
+func (usecase *UserUsecase) registrationMode() string {
+	mode := strings.ToLower(strings.TrimSpace(usecase.Config.String("REGISTRATION_MODE")))
+	if mode == "" {
+		return constant.REGISTRATION_MODE_OPEN
+	}
+
+	return mode
+}
+
+// checkRegistrationAllowed applies the configured registration mode before any user row is written,
+// invite codes are only validated here, they are consumed later inside the registration transaction
+func (usecase *UserUsecase) checkRegistrationAllowed(mode string, payload model.UserCreateRequest) error {
+	switch mode {
+	case constant.REGISTRATION_MODE_OPEN:
+		return nil
+	case constant.REGISTRATION_MODE_INVITE:
+		if payload.InviteCode == "" {
+			return &model.ValidationError{
+				Code:    constant.ERR_VALIDATION_CODE,
+				Message: "Invite code is required to register",
+				Param:   "inviteCode",
+			}
+		}
+		return nil
+	case constant.REGISTRATION_MODE_DOMAIN:
+		domain := util.EmailDomain(payload.Email)
+		for _, allowed := range strings.Split(usecase.Config.String("REGISTRATION_ALLOWED_DOMAINS"), ",") {
+			allowed = strings.ToLower(strings.TrimSpace(allowed))
+			if allowed != "" && domain == allowed {
+				return nil
+			}
+		}
+		return &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Registration is not allowed for this email domain",
+			Param:   "email",
+		}
+	case constant.REGISTRATION_MODE_CLOSED:
+		return &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Registration is currently closed",
+		}
+	default:
+		usecase.Log.Warn("Unknown registration mode, refusing registration", zap.String("mode", mode))
 		return &model.ValidationError{
-			Code:    constant.ERR_NOT_FOUND_ERROR,
-			Message: "Authorization token is expired",
-			Param:   "accessToken",
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Registration is currently closed",
+		}
+	}
+}
+
+// completeLogin is the single place a successful login ends, it remembers the device,
+// records the login history and issues the token pair
+func (usecase *UserUsecase) completeLogin(ctx *fiber.Ctx, userId int, signals model.LoginSignals) (model.TokenResponse, error) {
+	// every login path ends here, so a user deprovisioned by their identity provider cannot come back through any of them
+	err := usecase.checkActive(ctx.Context(), userId)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	jkt, err := usecase.DPoPUsecase.Thumbprint(ctx)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	signals, err = usecase.StepUpUsecase.RememberDevice(ctx, signals)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	usecase.StepUpUsecase.RecordLogin(ctx.Context(), userId, signals, true)
+
+	return usecase.IssueTokenPair(ctx.Context(), userId, time.Now(), jkt)
+}
+
+// checkActive fails for users who may not log in, deactivated users keep their row but not their access
+func (usecase *UserUsecase) checkActive(ctx context.Context, userId int) error {
+	active, err := usecase.UserRepository.IsActive(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return &model.ValidationError{
+			Code:    constant.ERR_FORBIDDEN_ERROR,
+			Message: "Account is deactivated",
+			Param:   "userId",
 		}
 	}
 
 	return nil
 }
+
+// IssueTokenPair starts a new session for a user who proved their identity at authTime, bound to the DPoP key jkt
+// if not empty
+func (usecase *UserUsecase) IssueTokenPair(ctx context.Context, userId int, authTime time.Time, jkt string) (model.TokenResponse, error) {
+	user, err := usecase.UserRepository.GetUserInfo(ctx, userId)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	return usecase.SessionUsecase.Create(ctx, userId, authTime, jkt, user.Locale)
+}
+
+// mailLocale is the language mail to user is written in, their preference or else the language of the request
+func mailLocale(ctx *fiber.Ctx, user model.UserResponse) string {
+	if i18n.Supported(user.Locale) {
+		return user.Locale
+	}
+
+	return i18n.Locale(ctx)
+}
+
+// provisionUsername creates a user that did not pick a username, create is called with base and then with
+// randomly suffixed variants until one of them is free
+func provisionUsername(base string, create func(username string) (int, error)) (int, error) {
+	var validationErr *model.ValidationError
+
+	for attempt := 0; attempt < provisionUsernameAttempts; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return 0, err
+			}
+			username = fmt.Sprintf("%s-%04d", base, suffix.Int64())
+		}
+
+		username, err := util.NormalizeUsername(username)
+		if err != nil {
+			continue
+		}
+
+		userId, err := create(username)
+		if errors.As(err, &validationErr) && validationErr.Param == "username" {
+			continue
+		}
+
+		return userId, err
+	}
+
+	return 0, &model.ValidationError{
+		Code:    constant.ERR_CONFLICT_ERROR,
+		Message: "Could not find a free username for this account",
+		Param:   "username",
+	}
+}
@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"context"
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"cutterproject/internal/repository"
+	"cutterproject/internal/util"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/knadh/koanf/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// fakeTx answers QueryRow from results keyed by the table a statement writes, the methods registration does not
+// use are left to the embedded nil pgx.Tx
+type fakeTx struct {
+	pgx.Tx
+	results    map[string]fakeRow
+	statements []string
+	committed  bool
+	rolledBack bool
+}
+
+type fakeRow struct {
+	id  int
+	err error
+}
+
+func (row fakeRow) Scan(dest ...any) error {
+	if row.err != nil {
+		return row.err
+	}
+	*dest[0].(*int) = row.id
+	return nil
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	for table, row := range tx.results {
+		if strings.Contains(sql, table) {
+			tx.statements = append(tx.statements, table)
+			return row
+		}
+	}
+	return fakeRow{err: errors.New("unexpected statement: " + sql)}
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+type fakeTxBeginner struct {
+	tx *fakeTx
+}
+
+func (db *fakeTxBeginner) Begin(ctx context.Context) (pgx.Tx, error) {
+	return db.tx, nil
+}
+
+func TestUserUsecaseCreateUserConsumesTheInvite(t *testing.T) {
+	connectionErr := errors.New("connection reset")
+
+	cases := []struct {
+		name       string
+		mode       string
+		invite     fakeRow
+		user       fakeRow
+		code       string
+		err        error
+		statements []string
+		committed  bool
+	}{
+		{"open registration", constant.REGISTRATION_MODE_OPEN, fakeRow{}, fakeRow{id: 7}, "", nil,
+			[]string{"INTO users"}, true},
+		{"invite", constant.REGISTRATION_MODE_INVITE, fakeRow{id: 3}, fakeRow{id: 7}, "", nil,
+			[]string{"invite_codes", "INTO users"}, true},
+		{"invite used up", constant.REGISTRATION_MODE_INVITE, fakeRow{err: pgx.ErrNoRows}, fakeRow{id: 7}, constant.ERR_VALIDATION_CODE, nil,
+			[]string{"invite_codes"}, false},
+		// the claimed use is rolled back with the user that could not be written
+		{"user not written", constant.REGISTRATION_MODE_INVITE, fakeRow{id: 3}, fakeRow{err: connectionErr}, "", connectionErr,
+			[]string{"invite_codes", "INTO users"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tx := &fakeTx{results: map[string]fakeRow{"invite_codes": c.invite, "INTO users": c.user}}
+			userUsecase := &UserUsecase{
+				UserRepository:   repository.NewUserRepository(zap.NewNop(), nil, nil),
+				InviteRepository: repository.NewInviteRepository(zap.NewNop(), nil),
+				DB:               &fakeTxBeginner{tx: tx},
+				Log:              zap.NewNop(),
+			}
+
+			now := time.Now()
+			userId, err := userUsecase.createUser(context.Background(), model.User{Username: "john_doe", CreatedAt: now, UpdatedAt: now}, c.mode, "INVITE")
+
+			switch {
+			case c.code != "":
+				if code := validationCode(err); code != c.code {
+					t.Fatalf("createUser() = %v, want code %s", err, c.code)
+				}
+			case c.err != nil:
+				if !errors.Is(err, c.err) {
+					t.Fatalf("createUser() = %v, want %v", err, c.err)
+				}
+			default:
+				if err != nil || userId != 7 {
+					t.Fatalf("createUser() = %d, %v, want 7", userId, err)
+				}
+			}
+
+			if strings.Join(tx.statements, ",") != strings.Join(c.statements, ",") {
+				t.Errorf("statements = %v, want %v", tx.statements, c.statements)
+			}
+			if tx.committed != c.committed || tx.rolledBack == c.committed {
+				t.Errorf("committed = %t, rolled back = %t, want committed = %t", tx.committed, tx.rolledBack, c.committed)
+			}
+		})
+	}
+}
+
+func TestUserUsecaseRedeemMagicLink(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	config := koanf.New(".")
+	config.Set("MAGIC_LINK_ENABLED", true)
+	config.Set("JWT_SECRET_KEY", "secret")
+
+	userRepository := repository.NewUserRepository(zap.NewNop(), nil, client)
+	userUsecase := &UserUsecase{UserRepository: userRepository, Log: zap.NewNop(), Config: config}
+
+	linkToken, linkId, err := util.GenerateSignedToken("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedToken, _, err := util.GenerateSignedToken("other secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = userRepository.SetMagicLinkInCache(context.Background(), linkId, 7, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withFiberCtx(t, func(ctx *fiber.Ctx) {
+		for _, token := range []string{"", forgedToken, linkToken[:len(linkToken)-1]} {
+			_, err := userUsecase.RedeemMagicLink(ctx, model.MagicLinkVerifyRequest{Token: token})
+			if code := validationCode(err); code != constant.ERR_UNATHORIZED_ERROR {
+				t.Errorf("RedeemMagicLink(%q) = %v, want %s", token, err, constant.ERR_UNATHORIZED_ERROR)
+			}
+		}
+		if !server.Exists("auth:magicLink:" + linkId) {
+			t.Fatal("an invalid token used up the link")
+		}
+
+		// the first redemption takes the link, whatever happens to the login after it
+		userId, err := userRepository.TakeMagicLinkInCache(ctx.Context(), linkId)
+		if err != nil || userId != 7 {
+			t.Fatalf("TakeMagicLinkInCache() = %d, %v, want 7", userId, err)
+		}
+
+		_, err = userUsecase.RedeemMagicLink(ctx, model.MagicLinkVerifyRequest{Token: linkToken})
+		if code := validationCode(err); code != constant.ERR_UNATHORIZED_ERROR {
+			t.Errorf("RedeemMagicLink() of a used link = %v, want %s", err, constant.ERR_UNATHORIZED_ERROR)
+		}
+
+		config.Set("MAGIC_LINK_ENABLED", false)
+		_, err = userUsecase.RedeemMagicLink(ctx, model.MagicLinkVerifyRequest{Token: linkToken})
+		if code := validationCode(err); code != constant.ERR_FORBIDDEN_ERROR {
+			t.Errorf("RedeemMagicLink() while disabled = %v, want %s", err, constant.ERR_FORBIDDEN_ERROR)
+		}
+	})
+}
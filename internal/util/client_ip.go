@@ -0,0 +1,89 @@
+package util
+
+import (
+	"cutterproject/internal/constant"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TrustedProxies are the networks of the load balancers and proxies in front of the server, only the forwarding
+// headers they add are believed
+type TrustedProxies = IPNetworks
+
+// ResolveClientIP walks the forwarding chain from the nearest hop back and returns the first address that is not
+// a trusted proxy. Only proxyHeader, the header the proxies write (constant.TRUSTED_PROXY_HEADER_*), is read: a
+// proxy passes the other one through as the client sent it. Nothing is read unless the peer is trusted. When
+// every hop is trusted the furthest one is the client
+func ResolveClientIP(peer netip.Addr, proxyHeader string, header string, proxies TrustedProxies) netip.Addr {
+	peer = peer.Unmap()
+	if !proxies.Contains(peer) {
+		return peer
+	}
+
+	var hops []string
+	if proxyHeader == constant.TRUSTED_PROXY_HEADER_FORWARDED {
+		hops = forwardedFor(header)
+	} else {
+		hops = strings.Split(header, ",")
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedAddr(hops[i])
+		if !ok {
+			// a hop that cannot be read ends the chain of trust, the last trusted hop is all that is known
+			return client
+		}
+
+		client = addr
+		if !proxies.Contains(addr) {
+			return client
+		}
+	}
+
+	return client
+}
+
+// ClientIP is the address of the client behind any trusted proxies, see middleware.ClientIPMiddleware
+func ClientIP(ctx *fiber.Ctx) string {
+	if ip, ok := ctx.Locals("clientIp").(string); ok {
+		return ip
+	}
+
+	return ctx.IP()
+}
+
+// forwardedFor collects the for= parameters of a Forwarded header in order
+func forwardedFor(header string) []string {
+	hops := []string{}
+
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(name, "for") {
+				hops = append(hops, value)
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseForwardedAddr reads a hop in any of the forms proxies write: 203.0.113.7, 203.0.113.7:4711,
+// "[2001:db8::1]:4711" and 2001:db8::1. Obfuscated identifiers and "unknown" are not addresses
+func parseForwardedAddr(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"cutterproject/internal/constant"
+	"net/netip"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	proxies, err := ParseIPNetworks("10.0.0.0/8, 2001:db8:ffff::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		peer        string
+		proxyHeader string
+		header      string
+		want        string
+	}{
+		{"untrusted peer is the client", "198.51.100.7", constant.TRUSTED_PROXY_HEADER_XFF, "203.0.113.9", "198.51.100.7"},
+		{"untrusted peer with Forwarded", "198.51.100.7", constant.TRUSTED_PROXY_HEADER_FORWARDED, "for=203.0.113.9", "198.51.100.7"},
+		{"no header", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "", "10.0.0.1"},
+		{"appended by the proxy", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "203.0.113.9", "203.0.113.9"},
+		// the client wrote the left hand entries itself, only the one its proxy appended is believed
+		{"spoofed left hand entries", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "1.2.3.4, 10.0.0.5, 203.0.113.9", "203.0.113.9"},
+		{"through two trusted proxies", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "1.2.3.4, 203.0.113.9, 10.0.0.2", "203.0.113.9"},
+		{"every hop trusted", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"unreadable hop", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "203.0.113.9, garbage, 10.0.0.2", "10.0.0.2"},
+		{"IPv4 with a port", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "203.0.113.9:4711", "203.0.113.9"},
+		{"IPv6 with a port", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "[2001:db8::7]:4711", "2001:db8::7"},
+		{"IPv6 peer", "2001:db8:ffff::1", constant.TRUSTED_PROXY_HEADER_XFF, "2001:db8::7", "2001:db8::7"},
+		{"IPv4 mapped peer", "::ffff:10.0.0.1", constant.TRUSTED_PROXY_HEADER_XFF, "203.0.113.9", "203.0.113.9"},
+		{"Forwarded", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_FORWARDED, `for=203.0.113.9;proto=https`, "203.0.113.9"},
+		{"Forwarded IPv6 with a port", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_FORWARDED, `for="[2001:db8::7]:4711"`, "2001:db8::7"},
+		{"Forwarded spoofed by the client", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_FORWARDED, "for=1.2.3.4, for=203.0.113.9", "203.0.113.9"},
+		{"Forwarded obfuscated", "10.0.0.1", constant.TRUSTED_PROXY_HEADER_FORWARDED, "for=_hidden", "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ResolveClientIP(netip.MustParseAddr(c.peer), c.proxyHeader, c.header, proxies)
+			if got.String() != c.want {
+				t.Errorf("ResolveClientIP = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package util
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	DPoPPrefix          = "DPoP "
+	DPoPProofType       = "dpop+jwt"
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+)
+
+// DPoPProof is what is left of a verified proof, the caller still has to reject reused jti values
+type DPoPProof struct {
+	Jkt      string
+	Jti      string
+	IssuedAt time.Time
+}
+
+type dpopClaims struct {
+	Htm string `json:"htm"`
+	Htu string `json:"htu"`
+	Ath string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// VerifyDPoPProof checks a DPoP proof JWT (RFC 9449 section 4.3) against the request it was sent with.
+// accessToken is empty on token requests, otherwise the proof must carry its hash in ath
+func VerifyDPoPProof(proof string, method string, requestURL string, accessToken string, maxAge time.Duration) (DPoPProof, error) {
+	result := DPoPProof{}
+	claims := &dpopClaims{}
+
+	token, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != DPoPProofType {
+			return nil, fmt.Errorf("%w: typ must be %s", ErrInvalidDPoPProof, DPoPProofType)
+		}
+
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: jwk header is missing", ErrInvalidDPoPProof)
+		}
+
+		publicKey, jkt, err := parsePublicJWK(jwk)
+		if err != nil {
+			return nil, err
+		}
+		result.Jkt = jkt
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := publicKey.(*rsa.PublicKey); ok {
+				return publicKey, nil
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := publicKey.(*ecdsa.PublicKey); ok {
+				return publicKey, nil
+			}
+		case *jwt.SigningMethodEd25519:
+			if _, ok := publicKey.(ed25519.PublicKey); ok {
+				return publicKey, nil
+			}
+		}
+		return nil, ErrInvalidSigningMethod
+	}, jwt.WithoutClaimsValidation())
+	if err != nil || !token.Valid {
+		return result, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return result, fmt.Errorf("%w: jti and iat are required", ErrInvalidDPoPProof)
+	}
+
+	// a little clock skew is tolerated for proofs from the future, they are still remembered for maxAge
+	age := time.Since(claims.IssuedAt.Time)
+	if age > maxAge || age < -maxAge/2 {
+		return result, fmt.Errorf("%w: iat is outside the accepted window", ErrInvalidDPoPProof)
+	}
+
+	if !strings.EqualFold(claims.Htm, method) {
+		return result, fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+
+	if !sameDPoPTarget(claims.Htu, requestURL) {
+		return result, fmt.Errorf("%w: htu does not match the request URL", ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.Ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return result, fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+		}
+	}
+
+	result.Jti = claims.ID
+	result.IssuedAt = claims.IssuedAt.Time
+
+	return result, nil
+}
+
+// sameDPoPTarget compares URIs without query and fragment as RFC 9449 section 4.3 requires
+func sameDPoPTarget(htu string, requestURL string) bool {
+	expected, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	actual, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(expected.Scheme, actual.Scheme) &&
+		strings.EqualFold(expected.Host, actual.Host) &&
+		expected.EscapedPath() == actual.EscapedPath()
+}
+
+// parsePublicJWK builds the public key of a JWK and its RFC 7638 SHA-256 thumbprint, keys
+// carrying private members are rejected since a client must never send them
+func parsePublicJWK(jwk map[string]interface{}) (interface{}, string, error) {
+	member := func(name string) string {
+		value, _ := jwk[name].(string)
+		return value
+	}
+
+	if _, ok := jwk["d"]; ok {
+		return nil, "", fmt.Errorf("%w: jwk must not contain a private key", ErrInvalidDPoPProof)
+	}
+
+	var publicKey interface{}
+	var thumbprintMembers map[string]string
+
+	switch member("kty") {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(member("n"))
+		e, errE := base64.RawURLEncoding.DecodeString(member("e"))
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, "", fmt.Errorf("%w: jwk is not a valid RSA key", ErrInvalidDPoPProof)
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		thumbprintMembers = map[string]string{"e": member("e"), "kty": "RSA", "n": member("n")}
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch member("crv") {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, "", fmt.Errorf("%w: jwk curve is not supported", ErrInvalidDPoPProof)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		x, errX := base64.RawURLEncoding.DecodeString(member("x"))
+		y, errY := base64.RawURLEncoding.DecodeString(member("y"))
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, "", fmt.Errorf("%w: jwk is not a valid EC key", ErrInvalidDPoPProof)
+		}
+
+		// ecdh rejects points that are not on the curve
+		_, err := ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: jwk is not a valid EC key", ErrInvalidDPoPProof)
+		}
+
+		publicKey = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		thumbprintMembers = map[string]string{"crv": member("crv"), "kty": "EC", "x": member("x"), "y": member("y")}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(member("x"))
+		if member("crv") != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", fmt.Errorf("%w: jwk is not a valid Ed25519 key", ErrInvalidDPoPProof)
+		}
+		publicKey = ed25519.PublicKey(x)
+		thumbprintMembers = map[string]string{"crv": "Ed25519", "kty": "OKP", "x": member("x")}
+	default:
+		return nil, "", fmt.Errorf("%w: jwk key type is not supported", ErrInvalidDPoPProof)
+	}
+
+	// encoding/json sorts map keys, which is exactly the lexicographic order RFC 7638 asks for
+	canonical, err := json.Marshal(thumbprintMembers)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(canonical)
+
+	return publicKey, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
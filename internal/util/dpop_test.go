@@ -0,0 +1,169 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func ecJWK(key *ecdsa.PrivateKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, jkt, err := parsePublicJWK(ecJWK(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessTokenHash := sha256.Sum256([]byte("access-token"))
+	ath := base64.RawURLEncoding.EncodeToString(accessTokenHash[:])
+
+	cases := []struct {
+		name        string
+		method      jwt.SigningMethod
+		signingKey  interface{}
+		header      map[string]interface{}
+		claims      jwt.MapClaims
+		requestURL  string
+		accessToken string
+		valid       bool
+	}{
+		{"valid", nil, nil, nil, nil, "", "", true},
+		{"method in another case", nil, nil, nil, jwt.MapClaims{"htm": "post"}, "", "", true},
+		{"query and fragment are ignored", nil, nil, nil, nil, "https://auth.example.com/api/users/_login?next=%2F#top", "", true},
+		{"host in another case", nil, nil, nil, jwt.MapClaims{"htu": "https://AUTH.example.com/api/users/_login"}, "", "", true},
+		{"slightly early", nil, nil, nil, jwt.MapClaims{"iat": time.Now().Add(20 * time.Second).Unix()}, "", "", true},
+		{"ath", nil, nil, nil, jwt.MapClaims{"ath": ath}, "", "access-token", true},
+		{"Ed25519", jwt.SigningMethodEdDSA, edKey, map[string]interface{}{"jwk": map[string]interface{}{
+			"kty": "OKP", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)),
+		}}, nil, "", "", true},
+
+		{"other method", nil, nil, nil, jwt.MapClaims{"htm": "GET"}, "", "", false},
+		{"other path", nil, nil, nil, jwt.MapClaims{"htu": "https://auth.example.com/api/users/_register"}, "", "", false},
+		{"other host", nil, nil, nil, jwt.MapClaims{"htu": "https://evil.example.com/api/users/_login"}, "", "", false},
+		{"other scheme", nil, nil, nil, jwt.MapClaims{"htu": "http://auth.example.com/api/users/_login"}, "", "", false},
+		{"too old", nil, nil, nil, jwt.MapClaims{"iat": time.Now().Add(-2 * time.Minute).Unix()}, "", "", false},
+		{"too early", nil, nil, nil, jwt.MapClaims{"iat": time.Now().Add(time.Minute).Unix()}, "", "", false},
+		{"no iat", nil, nil, nil, jwt.MapClaims{"iat": nil}, "", "", false},
+		{"no jti", nil, nil, nil, jwt.MapClaims{"jti": nil}, "", "", false},
+		{"no ath", nil, nil, nil, nil, "", "access-token", false},
+		{"ath of another token", nil, nil, nil, jwt.MapClaims{"ath": ath}, "", "other-token", false},
+		{"typ", nil, nil, map[string]interface{}{"typ": "JWT"}, nil, "", "", false},
+		{"no jwk", nil, nil, map[string]interface{}{"jwk": nil}, nil, "", "", false},
+		{"private jwk", nil, nil, map[string]interface{}{"jwk": map[string]interface{}{
+			"kty": "EC", "crv": "P-256", "x": ecJWK(key)["x"], "y": ecJWK(key)["y"], "d": "private",
+		}}, nil, "", "", false},
+		{"jwk of another key", nil, nil, map[string]interface{}{"jwk": func() map[string]interface{} {
+			other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			return ecJWK(other)
+		}()}, nil, "", "", false},
+		{"point not on the curve", nil, nil, map[string]interface{}{"jwk": map[string]interface{}{
+			"kty": "EC", "crv": "P-256", "x": ecJWK(key)["x"], "y": ecJWK(key)["x"],
+		}}, nil, "", "", false},
+		{"symmetric algorithm", jwt.SigningMethodHS256, []byte("secret"), nil, nil, "", "", false},
+		{"algorithm of another key type", jwt.SigningMethodEdDSA, edKey, nil, nil, "", "", false},
+		{"none", jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, nil, nil, "", "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"htm": "POST",
+				"htu": "https://auth.example.com/api/users/_login",
+				"iat": time.Now().Unix(),
+				"jti": "proof-id",
+			}
+			for name, value := range c.claims {
+				if value == nil {
+					delete(claims, name)
+				} else {
+					claims[name] = value
+				}
+			}
+
+			method, signingKey := c.method, c.signingKey
+			if method == nil {
+				method, signingKey = jwt.SigningMethodES256, key
+			}
+			token := jwt.NewWithClaims(method, claims)
+			token.Header["typ"] = DPoPProofType
+			token.Header["jwk"] = ecJWK(key)
+			for name, value := range c.header {
+				if value == nil {
+					delete(token.Header, name)
+				} else {
+					token.Header[name] = value
+				}
+			}
+			proof, err := token.SignedString(signingKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requestURL := c.requestURL
+			if requestURL == "" {
+				requestURL = "https://auth.example.com/api/users/_login"
+			}
+
+			result, err := VerifyDPoPProof(proof, "POST", requestURL, c.accessToken, time.Minute)
+			if !c.valid {
+				if !errors.Is(err, ErrInvalidDPoPProof) {
+					t.Fatalf("VerifyDPoPProof() = %+v, %v, want ErrInvalidDPoPProof", result, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyDPoPProof() = %v", err)
+			}
+			if result.Jti != "proof-id" || result.IssuedAt.IsZero() {
+				t.Errorf("VerifyDPoPProof() = %+v, want jti proof-id and iat", result)
+			}
+			if c.method == nil && result.Jkt != jkt {
+				t.Errorf("jkt = %s, want %s", result.Jkt, jkt)
+			}
+		})
+	}
+}
+
+func TestParsePublicJWKThumbprint(t *testing.T) {
+	// the example of RFC 7638 section 3.1, members other than the required ones do not change the thumbprint
+	jwk := map[string]interface{}{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91" +
+			"CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+	}
+
+	_, jkt, err := parsePublicJWK(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jkt != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint = %s, want NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jkt)
+	}
+}
@@ -0,0 +1,238 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+)
+
+var (
+	MaxEmailLength      = 254
+	MaxEmailLocalLength = 64
+	ErrInvalidEmail     = errors.New("email address is invalid")
+)
+
+// NormalizeEmail parses a bare RFC 5322 addr-spec, display names and comments are rejected,
+// the domain is converted to its ASCII (punycode) form and the whole address is lowercased
+func NormalizeEmail(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalidEmail
+	}
+
+	address, err := mail.ParseAddress(raw)
+	if err != nil || address.Name != "" || address.Address != raw {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(address.Address, "@")
+	local := address.Address[:at]
+	domain := address.Address[at+1:]
+
+	// address literals like user@[127.0.0.1] are valid RFC 5322 but never a deliverable account
+	if local == "" || len(local) > MaxEmailLocalLength || strings.HasPrefix(domain, "[") {
+		return "", ErrInvalidEmail
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || !strings.Contains(asciiDomain, ".") {
+		return "", ErrInvalidEmail
+	}
+
+	normalized := strings.ToLower(local) + "@" + strings.ToLower(asciiDomain)
+	if len(normalized) > MaxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	return normalized, nil
+}
+
+// EmailDomain returns the domain part of an already normalized email address
+func EmailDomain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
+
+type EmailPolicy struct {
+	StripPlusTag    bool
+	DotAliasDomains map[string]struct{}
+	Blocklist       *DomainBlocklist
+}
+
+// Canonicalize maps aliases of the same mailbox to a single form used for uniqueness and lookups,
+// plus tags are only stripped and dots only removed when enabled for the domain
+func (policy *EmailPolicy) Canonicalize(email string) string {
+	at := strings.LastIndex(email, "@")
+	local := email[:at]
+	domain := email[at+1:]
+
+	if policy.StripPlusTag {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+
+	if _, ok := policy.DotAliasDomains[domain]; ok {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	return local + "@" + domain
+}
+
+// Fingerprint identifies the canonical form Canonicalize produces, stored canonical emails have to be rewritten
+// whenever it changes
+func (policy *EmailPolicy) Fingerprint() string {
+	domains := make([]string, 0, len(policy.DotAliasDomains))
+	for domain := range policy.DotAliasDomains {
+		domains = append(domains, domain)
+	}
+	slices.Sort(domains)
+
+	return fmt.Sprintf("plus=%t;dots=%s", policy.StripPlusTag, strings.Join(domains, ","))
+}
+
+func (policy *EmailPolicy) IsDisposable(email string) bool {
+	if policy.Blocklist == nil {
+		return false
+	}
+
+	return policy.Blocklist.Contains(EmailDomain(email))
+}
+
+// DomainBlocklist is a set of domains read from a file with one domain per line, '#' starts a comment
+type DomainBlocklist struct {
+	path    string
+	log     *zap.Logger
+	mu      sync.RWMutex
+	domains map[string]struct{}
+}
+
+func NewDomainBlocklist(path string, log *zap.Logger) (*DomainBlocklist, error) {
+	blocklist := &DomainBlocklist{
+		path:    filepath.Clean(path),
+		log:     log,
+		domains: map[string]struct{}{},
+	}
+
+	err := blocklist.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return blocklist, nil
+}
+
+func (blocklist *DomainBlocklist) Reload() error {
+	file, err := os.Open(blocklist.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	domains := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+
+		domain := strings.ToLower(strings.TrimSpace(line))
+		if domain == "" {
+			continue
+		}
+
+		asciiDomain, err := idna.Lookup.ToASCII(domain)
+		if err != nil {
+			blocklist.log.Warn("Skipping invalid blocklist domain", zap.String("domain", domain), zap.Error(err))
+			continue
+		}
+		domains[asciiDomain] = struct{}{}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	blocklist.mu.Lock()
+	blocklist.domains = domains
+	blocklist.mu.Unlock()
+
+	blocklist.log.Info("Domain blocklist loaded", zap.String("path", blocklist.path), zap.Int("domains", len(domains)))
+
+	return nil
+}
+
+// Contains also matches parent domains, so blocking example.com blocks mail.example.com
+func (blocklist *DomainBlocklist) Contains(domain string) bool {
+	blocklist.mu.RLock()
+	defer blocklist.mu.RUnlock()
+
+	for domain != "" {
+		if _, ok := blocklist.domains[domain]; ok {
+			return true
+		}
+
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+
+	return false
+}
+
+// Watch reloads the list whenever the file changes, the parent directory is watched
+// because most editors and config management tools replace the file instead of writing to it
+func (blocklist *DomainBlocklist) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	err = watcher.Add(filepath.Dir(blocklist.path))
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) != blocklist.path || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				err := blocklist.Reload()
+				if err != nil {
+					blocklist.log.Warn("Failed to reload domain blocklist, keeping previous list", zap.String("path", blocklist.path), zap.Error(err))
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				blocklist.log.Warn("Domain blocklist watcher error", zap.Error(err))
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := []struct {
+		raw   string
+		email string
+	}{
+		{"a@b.co", "a@b.co"},
+		{"  John.Doe@Example.COM ", "john.doe@example.com"},
+		{"user+tag@example.com", "user+tag@example.com"},
+		// internationalized domains are stored in their punycode form
+		{"user@bücher.de", "user@xn--bcher-kva.de"},
+		{"user@BÜCHER.de", "user@xn--bcher-kva.de"},
+		{"user@xn--bcher-kva.de", "user@xn--bcher-kva.de"},
+		{"user@例え.jp", "user@xn--r8jz45g.jp"},
+
+		{"", ""},
+		{"   ", ""},
+		{"@@@@@@@@", ""},
+		{"a@b@c.com", ""},
+		{"@example.com", ""},
+		{"user@", ""},
+		{"user", ""},
+		{"user@localhost", ""},
+		{"user@[127.0.0.1]", ""},
+		{"John <john@example.com>", ""},
+		{"john@example.com (John)", ""},
+		{"a@b.co, c@d.co", ""},
+		{"user@exa mple.com", ""},
+		{"user@-example.com", ""},
+		{strings.Repeat("a", 65) + "@example.com", ""},
+		{"a@" + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 63) + "." + strings.Repeat("e", 60) + ".com", ""},
+	}
+
+	for _, c := range cases {
+		email, err := NormalizeEmail(c.raw)
+		if c.email == "" {
+			if !errors.Is(err, ErrInvalidEmail) {
+				t.Errorf("NormalizeEmail(%q) = %q, %v, want ErrInvalidEmail", c.raw, email, err)
+			}
+			continue
+		}
+		if err != nil || email != c.email {
+			t.Errorf("NormalizeEmail(%q) = %q, %v, want %q", c.raw, email, err, c.email)
+		}
+	}
+}
+
+func TestEmailPolicyCanonicalize(t *testing.T) {
+	dotAliasDomains := map[string]struct{}{"gmail.com": {}}
+
+	cases := []struct {
+		policy    EmailPolicy
+		email     string
+		canonical string
+	}{
+		{EmailPolicy{}, "john.doe+news@gmail.com", "john.doe+news@gmail.com"},
+		{EmailPolicy{StripPlusTag: true}, "john.doe+news@gmail.com", "john.doe@gmail.com"},
+		{EmailPolicy{StripPlusTag: true}, "john+a+b@example.com", "john@example.com"},
+		// a local part that is only a tag is not stripped to nothing
+		{EmailPolicy{StripPlusTag: true}, "+news@example.com", "+news@example.com"},
+		{EmailPolicy{DotAliasDomains: dotAliasDomains}, "john.doe@gmail.com", "johndoe@gmail.com"},
+		{EmailPolicy{DotAliasDomains: dotAliasDomains}, "john.doe@example.com", "john.doe@example.com"},
+		{EmailPolicy{StripPlusTag: true, DotAliasDomains: dotAliasDomains}, "j.o.h.n+x.y@gmail.com", "john@gmail.com"},
+		{EmailPolicy{StripPlusTag: true, DotAliasDomains: dotAliasDomains}, "user@xn--bcher-kva.de", "user@xn--bcher-kva.de"},
+	}
+
+	for _, c := range cases {
+		if canonical := c.policy.Canonicalize(c.email); canonical != c.canonical {
+			t.Errorf("%s with %s: Canonicalize = %q, want %q", c.email, c.policy.Fingerprint(), canonical, c.canonical)
+		}
+	}
+}
+
+func TestEmailPolicyFingerprint(t *testing.T) {
+	first := EmailPolicy{StripPlusTag: true, DotAliasDomains: map[string]struct{}{"gmail.com": {}, "googlemail.com": {}}}
+	second := EmailPolicy{StripPlusTag: true, DotAliasDomains: map[string]struct{}{"googlemail.com": {}, "gmail.com": {}}}
+	if first.Fingerprint() != second.Fingerprint() {
+		t.Errorf("Fingerprint depends on the domain order: %q, %q", first.Fingerprint(), second.Fingerprint())
+	}
+
+	third := EmailPolicy{DotAliasDomains: first.DotAliasDomains}
+	if first.Fingerprint() == third.Fingerprint() {
+		t.Errorf("Fingerprint %q does not change with StripPlusTag", first.Fingerprint())
+	}
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP resolves client IPs against a local MaxMind-format (mmdb) country or city database
+type GeoIP struct {
+	reader *maxminddb.Reader
+}
+
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func NewGeoIP(path string) (*GeoIP, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeoIP{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 country code, or an empty string when it is unknown,
+// a nil GeoIP is valid and never knows the country
+func (geoIP *GeoIP) Country(ip string) string {
+	if geoIP == nil {
+		return ""
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	record := geoIPRecord{}
+	err := geoIP.reader.Lookup(parsed, &record)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToUpper(record.Country.ISOCode)
+}
+
+func (geoIP *GeoIP) Close() error {
+	if geoIP == nil {
+		return nil
+	}
+
+	return geoIP.reader.Close()
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPNetworks is a list of CIDRs, single IPs are kept as /32 or /128 networks
+type IPNetworks []netip.Prefix
+
+// ParseIPNetworks parses a comma separated list of CIDRs and single IPs
+func ParseIPNetworks(value string) (IPNetworks, error) {
+	networks := IPNetworks{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		network, err := ParseIPNetwork(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// ParseIPNetwork parses a CIDR or a single IP, IPv4-mapped IPv6 addresses are stored as IPv4
+func ParseIPNetwork(entry string) (netip.Prefix, error) {
+	if !strings.Contains(entry, "/") {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil || addr.Zone() != "" {
+			return netip.Prefix{}, fmt.Errorf("%q is not an IP address or CIDR", entry)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is not an IP address or CIDR", entry)
+	}
+
+	return prefix.Masked(), nil
+}
+
+func (networks IPNetworks) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
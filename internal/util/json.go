@@ -1,20 +1,199 @@
 package util
 
 import (
+	"bytes"
 	"cutterproject/internal/constant"
+	"cutterproject/internal/i18n"
+	"cutterproject/internal/model"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"go.uber.org/zap"
 )
 
+// ReadRequestBody decodes JSON, form or XML bodies leniently, it is only meant for protocol endpoints whose
+// clients send forms (OAuth, SAML) or extension attributes (SCIM). Everything else uses ReadJSONBody
 func ReadRequestBody(ctx *fiber.Ctx, result interface{}) error {
-	err := ctx.BodyParser(&result)
+	err := ctx.BodyParser(result)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ReadJSONBody strictly decodes a JSON object into result. The body must be application/json and within the
+// bodyLimit local set by middleware.BodyLimit, unknown and repeated fields are rejected so a misspelled field is
+// reported as such instead of as a missing one. Errors are ValidationErrors the error handler can answer directly
+func ReadJSONBody(ctx *fiber.Ctx, result interface{}) error {
+	mediaType, _, _ := strings.Cut(ctx.Get(fiber.HeaderContentType), ";")
+	if !strings.EqualFold(strings.TrimSpace(mediaType), fiber.MIMEApplicationJSON) {
+		return &model.ValidationError{
+			Code:    constant.ERR_UNSUPPORTED_MEDIA_TYPE_ERROR,
+			Message: "Request body must be application/json",
+		}
+	}
+
+	body := ctx.Body()
+	if limit, ok := ctx.Locals("bodyLimit").(int); ok && len(body) > limit {
+		return &model.ValidationError{
+			Code:    constant.ERR_PAYLOAD_TOO_LARGE_ERROR,
+			Message: "Request body is too large",
+		}
+	}
+
+	err := checkDuplicateFields(body)
+	if err != nil {
+		return invalidBody(body, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(result)
+	if err != nil {
+		return invalidBody(body, err)
+	}
+
+	// a second value after the object is as malformed as a broken one
+	_, err = decoder.Token()
+	if !errors.Is(err, io.EOF) {
+		return invalidBody(body, &json.SyntaxError{Offset: decoder.InputOffset()})
+	}
+
+	return nil
+}
+
+// duplicateFieldError is found by checkDuplicateFields, encoding/json itself keeps the last of repeated fields
+type duplicateFieldError struct {
+	Field  string
+	Offset int64
+}
+
+func (e *duplicateFieldError) Error() string {
+	return "duplicate field " + e.Field
+}
+
+// checkDuplicateFields walks the tokens of body and fails on the first object that repeats a field. Fields are
+// compared folded the way encoding/json matches them to struct fields, so "email" and "Email" are the same field
+func checkDuplicateFields(body []byte) error {
+	type object struct {
+		fields    map[string]bool
+		expectKey bool
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// nil entries stand for arrays
+	stack := []*object{}
+	valueDone := func() {
+		if len(stack) > 0 && stack[len(stack)-1] != nil {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(stack) > 0 && stack[len(stack)-1] != nil && stack[len(stack)-1].expectKey {
+			current := stack[len(stack)-1]
+			if token == json.Delim('}') {
+				stack = stack[:len(stack)-1]
+				valueDone()
+				continue
+			}
+
+			field := token.(string)
+			folded := strings.ToLower(strings.ToUpper(field))
+			if current.fields[folded] {
+				return &duplicateFieldError{Field: field, Offset: decoder.InputOffset()}
+			}
+			current.fields[folded] = true
+			current.expectKey = false
+			continue
+		}
+
+		switch token {
+		case json.Delim('{'):
+			stack = append(stack, &object{fields: map[string]bool{}, expectKey: true})
+		case json.Delim('['):
+			stack = append(stack, nil)
+		case json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+}
+
+// invalidBody describes why body could not be decoded, with the field and byte offset where that is known
+func invalidBody(body []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var duplicateErr *duplicateFieldError
+
+	fieldError := model.FieldError{
+		Code: constant.FIELD_ERR_INVALID_JSON,
+		Args: map[string]interface{}{"offset": len(body)},
+	}
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		fieldError.Args["offset"] = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		fieldError.Param = typeErr.Field
+		fieldError.Label = typeErr.Field
+		if typeErr.Field == "" {
+			fieldError.Label = "Request body"
+		}
+		fieldError.Code = constant.FIELD_ERR_INVALID_TYPE
+		fieldError.Args = map[string]interface{}{"type": jsonTypeName(typeErr), "offset": typeErr.Offset}
+	case errors.As(err, &duplicateErr):
+		fieldError.Param = duplicateErr.Field
+		fieldError.Label = duplicateErr.Field
+		fieldError.Code = constant.FIELD_ERR_DUPLICATE_FIELD
+		fieldError.Args = map[string]interface{}{"offset": duplicateErr.Offset}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		fieldError.Param = field
+		fieldError.Label = field
+		fieldError.Code = constant.FIELD_ERR_UNKNOWN_FIELD
+		fieldError.Args = nil
+	}
+	fieldError.Message = i18n.FieldMessage(i18n.DefaultLocale, fieldError)
+
+	return &model.ValidationError{
+		Code:    constant.ERR_INVALID_REQUEST_BODY_ERROR_CODE,
+		Message: fieldError.Message,
+		Param:   fieldError.Param,
+		Errors:  []model.FieldError{fieldError},
+	}
+}
+
+// jsonTypeName names the JSON type a Go field expects, the way API clients think about it
+func jsonTypeName(typeErr *json.UnmarshalTypeError) string {
+	switch typeErr.Type.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	default:
+		return "number"
+	}
+}
+
 func SendSuccessResponseNoData(ctx *fiber.Ctx) error {
 	err := ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "OK",
@@ -34,10 +213,15 @@ func SendSuccessResponseWithData(ctx *fiber.Ctx, data interface{}) error {
 	return nil
 }
 
-func SendErrorResponse(ctx *fiber.Ctx, error error) error {
-	err := ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-		"error": error,
-	})
+// SendOAuthErrorResponse writes the flat RFC 6749 error body used by the OAuth endpoints
+func SendOAuthErrorResponse(ctx *fiber.Ctx, error *model.OAuthError) error {
+	status := error.Status
+	if status == 0 {
+		status = fiber.StatusBadRequest
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	err := ctx.Status(status).JSON(error)
 	if err != nil {
 		return err
 	}
@@ -45,10 +229,9 @@ func SendErrorResponse(ctx *fiber.Ctx, error error) error {
 	return nil
 }
 
-func SendErrorResponseNotFound(ctx *fiber.Ctx, error error) error {
-	err := ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
-		"error": error,
-	})
+// SendSCIMResponse writes a SCIM resource with the media type RFC 7644 section 3.1 asks for
+func SendSCIMResponse(ctx *fiber.Ctx, status int, data interface{}) error {
+	err := ctx.Status(status).JSON(data, "application/scim+json")
 	if err != nil {
 		return err
 	}
@@ -56,18 +239,7 @@ func SendErrorResponseNotFound(ctx *fiber.Ctx, error error) error {
 	return nil
 }
 
-func SendErrorResponseInternalServer(ctx *fiber.Ctx, log *zap.Logger, error error) error {
-	log.Debug("Internal server error occured", zap.Error(error))
-	err := ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-		"error": fiber.Map{
-			"code":    constant.ERR_INTERNAL_SERVER_ERROR_CODE,
-			"message": constant.ERR_INTENRAL_SERVER_ERROR_MESSAGE,
-		},
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return err
+// SendSCIMErrorResponse writes the RFC 7644 section 3.12 error body used by the SCIM endpoints
+func SendSCIMErrorResponse(ctx *fiber.Ctx, error *model.SCIMError) error {
+	return SendSCIMResponse(ctx, error.StatusCode(), error)
 }
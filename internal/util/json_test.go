@@ -0,0 +1,53 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCheckDuplicateFields(t *testing.T) {
+	cases := []struct {
+		body      string
+		duplicate string
+	}{
+		{`{"email":"a@example.com","password":"secret"}`, ""},
+		{`{"email":"a@example.com","email":"b@example.com"}`, "email"},
+		// encoding/json would fill Email with the last of these
+		{`{"email":"a@example.com","Email":"b@example.com"}`, "Email"},
+		{`{"EMAIL":"a@example.com","eMail":"b@example.com"}`, "eMail"},
+		// U+017F LATIN SMALL LETTER LONG S folds to s for encoding/json
+		{`{"scope":"read","ſcope":"admin"}`, "ſcope"},
+		// the same field in different objects is not repeated
+		{`{"user":{"email":"a@example.com"},"invite":{"Email":"b@example.com"}}`, ""},
+		{`[{"email":"a@example.com"},{"EMAIL":"b@example.com"}]`, ""},
+	}
+
+	for _, c := range cases {
+		err := checkDuplicateFields([]byte(c.body))
+
+		var duplicateErr *duplicateFieldError
+		if c.duplicate == "" {
+			if err != nil {
+				t.Errorf("%s: checkDuplicateFields = %v, want nil", c.body, err)
+			}
+			continue
+		}
+		if !errors.As(err, &duplicateErr) || duplicateErr.Field != c.duplicate {
+			t.Errorf("%s: checkDuplicateFields = %v, want duplicate field %s", c.body, err, c.duplicate)
+		}
+	}
+}
+
+// TestCheckDuplicateFieldsMatchesDecoder checks the assumption checkDuplicateFields folds by, that encoding/json
+// decodes a field spelled with U+017F into the struct field spelled with s
+func TestCheckDuplicateFieldsMatchesDecoder(t *testing.T) {
+	var payload struct {
+		Scope string `json:"scope"`
+	}
+
+	err := json.Unmarshal([]byte(`{"ſcope":"admin"}`), &payload)
+	if err != nil || payload.Scope != "admin" {
+		t.Fatalf("encoding/json no longer folds U+017F, got %q and %v", payload.Scope, err)
+	}
+}
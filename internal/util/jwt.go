@@ -1,6 +1,10 @@
 package util
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"cutterproject/internal/constant"
 	"cutterproject/internal/model"
 	"errors"
@@ -22,30 +26,160 @@ var (
 	ErrInvalidSigningMethod = errors.New("invalid token signing method")
 )
 
-func GenerateAccessToken(userId int, jwtSecretKey string) (string, error) {
-	if jwtSecretKey == "" {
-		return "", errors.New("jwt secret key is not configured")
+// GenerateAccessToken issues an access token for a session, it is DPoP bound when the session has a key thumbprint
+// and carries an act claim when the session is an impersonation. It never outlives the session
+func GenerateAccessToken(session model.Session, tokenFormat TokenFormat) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenDuration)
+	if !session.ExpiresAt.IsZero() && session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+
+	claims := &model.Claims{
+		UserId:        session.UserId,
+		AuthTime:      jwt.NewNumericDate(session.AuthTime),
+		SessionId:     session.Id,
+		PrincipalType: constant.PRINCIPAL_TYPE_USER,
+		Confirmation:  Confirmation(session.Jkt),
+		Actor:         Actor(session.ActorId),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    TokenIssuer,
+			Subject:   UserSubject(session.UserId),
+		},
 	}
 
+	return tokenFormat.Issue(claims)
+}
+
+// UserSubject is the sub claim of tokens issued to a user
+func UserSubject(userId int) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+// Actor is the act claim of an impersonation session, nil when the user is acting as themselves
+func Actor(actorId int) *model.Actor {
+	if actorId == 0 {
+		return nil
+	}
+
+	return &model.Actor{Subject: UserSubject(actorId), UserId: actorId}
+}
+
+// GenerateServiceAccessToken issues a short-lived token for a service account, the returned jti is
+// what the server keeps to recognise and revoke the token since service tokens have no user session
+func GenerateServiceAccessToken(serviceAccountId int, clientId string, scope string, jkt string, ttl time.Duration, tokenFormat TokenFormat) (string, string, error) {
 	now := time.Now()
+	jti := uuid.New().String()
 	claims := &model.Claims{
-		UserId: userId,
+		PrincipalType:    constant.PRINCIPAL_TYPE_SERVICE,
+		ServiceAccountId: serviceAccountId,
+		ClientId:         clientId,
+		Scope:            scope,
+		Confirmation:     Confirmation(jkt),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenDuration)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    TokenIssuer,
-			Subject:   fmt.Sprintf("user:%d", userId),
+			Subject:   fmt.Sprintf("service:%d", serviceAccountId),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(jwtSecretKey))
+	signedToken, err := tokenFormat.Issue(claims)
+	if err != nil {
+		return "", "", err
+	}
+
+	return signedToken, jti, nil
+}
+
+// VerifyClientAssertion validates a private_key_jwt client assertion (RFC 7523) signed with the
+// service account's registered public key and returns its claims, the caller must reject reused jti values
+func VerifyClientAssertion(assertion string, publicKeyPEM string, clientId string, audience string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	publicKey, err := ParsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := publicKey.(*rsa.PublicKey); ok {
+				return publicKey, nil
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := publicKey.(*ecdsa.PublicKey); ok {
+				return publicKey, nil
+			}
+		case *jwt.SigningMethodEd25519:
+			if _, ok := publicKey.(ed25519.PublicKey); ok {
+				return publicKey, nil
+			}
+		}
+		return nil, ErrInvalidSigningMethod
+	},
+		jwt.WithIssuer(clientId),
+		jwt.WithSubject(clientId),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if claims.ID == "" {
+		return nil, errors.New("client assertion has no jti")
 	}
 
-	return signedToken, nil
+	return claims, nil
+}
+
+// ParsePublicKeyPEM accepts the RSA, ECDSA and Ed25519 public keys client assertions can be signed with
+func ParsePublicKeyPEM(publicKeyPEM string) (crypto.PublicKey, error) {
+	if publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM)); err == nil {
+		return publicKey, nil
+	}
+	if publicKey, err := jwt.ParseECPublicKeyFromPEM([]byte(publicKeyPEM)); err == nil {
+		return publicKey, nil
+	}
+
+	return jwt.ParseEdPublicKeyFromPEM([]byte(publicKeyPEM))
+}
+
+// UnverifiedTokenSubject reads the sub claim without checking the signature, it is only good
+// for finding the key the token must then be verified with
+func UnverifiedTokenSubject(tokenString string) string {
+	claims := &jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
+	if err != nil {
+		return ""
+	}
+
+	return claims.Subject
+}
+
+// TokenType is the token_type clients must use in the Authorization header, DPoP for bound tokens
+func TokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+
+	return "Bearer"
+}
+
+// Confirmation is the cnf claim for a DPoP key thumbprint, nil leaves the token a plain bearer token
+func Confirmation(jkt string) *model.Confirmation {
+	if jkt == "" {
+		return nil
+	}
+
+	return &model.Confirmation{Jkt: jkt}
 }
 
 // GenerateRefreshToken creates a unique refresh token
@@ -54,66 +188,100 @@ func GenerateRefreshToken() string {
 	return uuid.New().String()
 }
 
-// GenerateTokenPair creates both access and refresh tokens for a user
-func GenerateTokenPair(userId int, jwtSecretKey string) (model.TokenResponse, error) {
-	accessToken, err := GenerateAccessToken(userId, jwtSecretKey)
+// GenerateTokenPair creates both access and refresh tokens for a session
+func GenerateTokenPair(session model.Session, tokenFormat TokenFormat) (model.TokenResponse, error) {
+	accessToken, err := GenerateAccessToken(session, tokenFormat)
 	if err != nil {
 		return model.TokenResponse{}, err
 	}
 
 	refreshToken := GenerateRefreshToken()
 
+	refreshTokenExpiresIn := time.Until(session.ExpiresAt).Round(time.Second)
+	accessTokenExpiresIn := min(AccessTokenDuration, refreshTokenExpiresIn)
+
 	return model.TokenResponse{
 		AccessToken:           accessToken,
-		AccessTokenExpiresIn:  int(AccessTokenDuration.Seconds()),
+		AccessTokenExpiresIn:  int(accessTokenExpiresIn.Seconds()),
 		RefreshToken:          refreshToken,
-		RefreshTokenExpiresIn: int(RefreshTokenDuration.Seconds()),
-		TokenType:             "Bearer",
+		RefreshTokenExpiresIn: int(refreshTokenExpiresIn.Seconds()),
+		TokenType:             TokenType(session.Jkt),
 	}, nil
 }
 
-// ValidateAccessToken validates a JWT access token and returns the user ID
-func ValidateAccessToken(accessToken string, log *zap.Logger, jwtSecretKey string) (string, int, error) {
+// ValidateAccessToken validates the access token of an Authorization header and returns its claims
+func ValidateAccessToken(accessToken string, log *zap.Logger, tokenFormat TokenFormat) (string, *model.Claims, error) {
 	// Don't log the full token - security risk
 	log.Debug("Validating access token", zap.String("accessToken", accessToken))
 
-	if jwtSecretKey == "" {
-		return "", 0, errors.New("jwt secret key is not configured")
-	}
-
 	// Extract token from Authorization header
 	tokenString, err := extractBearerToken(accessToken)
 	if err != nil {
-		return "", 0, err
+		return "", nil, err
+	}
+
+	claims, err := tokenFormat.Parse(tokenString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tokenString, claims, nil
+}
+
+// JWTTokenFormat issues HS256 JWTs, the signing method is pinned when parsing so tokens signed
+// with any other algorithm, including none, are rejected
+type JWTTokenFormat struct {
+	SecretKey []byte
+}
+
+func NewJWTTokenFormat(secretKey string) *JWTTokenFormat {
+	return &JWTTokenFormat{SecretKey: []byte(secretKey)}
+}
+
+func (format *JWTTokenFormat) Name() string {
+	return TokenFormatJWT
+}
+
+func (format *JWTTokenFormat) Issue(claims *model.Claims) (string, error) {
+	if len(format.SecretKey) == 0 {
+		return "", errors.New("jwt secret key is not configured")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(format.SecretKey)
+}
+
+func (format *JWTTokenFormat) Parse(tokenString string) (*model.Claims, error) {
+	if len(format.SecretKey) == 0 {
+		return nil, errors.New("jwt secret key is not configured")
 	}
 
 	// Parse token with custom claims
 	token, err := jwt.ParseWithClaims(tokenString, &model.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method != jwt.SigningMethodHS256 {
 			return nil, ErrInvalidSigningMethod
 		}
-		return []byte(jwtSecretKey), nil
+		return format.SecretKey, nil
 	})
 
 	if err != nil {
-		return "", 0, handleParseError(err)
+		return nil, handleParseError(err)
 	}
 
 	// Extract and validate claims
 	claims, ok := token.Claims.(*model.Claims)
 	if !ok || !token.Valid {
-		return "", 0, &model.ValidationError{
+		return nil, &model.ValidationError{
 			Code:    constant.ERR_UNATHORIZED_ERROR,
 			Message: "Authentication token is invalid",
 			Param:   "accessToken",
 		}
 	}
 
-	return tokenString, claims.UserId, nil
+	return claims, nil
 }
 
-// extractBearerToken extracts the token from "Bearer <token>" format
+// extractBearerToken extracts the token from "Bearer <token>" or "DPoP <token>" format
 func extractBearerToken(authHeader string) (string, error) {
 	if authHeader == "" {
 		return "", &model.ValidationError{
@@ -123,7 +291,11 @@ func extractBearerToken(authHeader string) (string, error) {
 		}
 	}
 
-	if !strings.HasPrefix(authHeader, BearerPrefix) {
+	token, ok := strings.CutPrefix(authHeader, BearerPrefix)
+	if !ok {
+		token, ok = strings.CutPrefix(authHeader, DPoPPrefix)
+	}
+	if !ok {
 		return "", &model.ValidationError{
 			Code:    constant.ERR_UNATHORIZED_ERROR,
 			Message: "Authentication token format is not match",
@@ -131,7 +303,6 @@ func extractBearerToken(authHeader string) (string, error) {
 		}
 	}
 
-	token := strings.TrimPrefix(authHeader, BearerPrefix)
 	if token == "" {
 		return "", &model.ValidationError{
 			Code:    constant.ERR_UNATHORIZED_ERROR,
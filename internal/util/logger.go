@@ -0,0 +1,25 @@
+package util
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Logger returns log with the request's impersonation fields attached, every line written while an admin
+// acts as a user must say so. Requests that are not impersonated get log back unchanged
+func Logger(ctx *fiber.Ctx, log *zap.Logger) *zap.Logger {
+	return ContextLogger(ctx.Context(), log)
+}
+
+// ContextLogger is Logger for code that only has the request's context.Context, fiber's locals are its values
+func ContextLogger(ctx context.Context, log *zap.Logger) *zap.Logger {
+	actorId, ok := ctx.Value("actorId").(int)
+	if !ok || actorId == 0 {
+		return log
+	}
+
+	userId, _ := ctx.Value("userId").(int)
+	return log.With(zap.Bool("impersonated", true), zap.Int("actorId", actorId), zap.Int("impersonatedUserId", userId))
+}
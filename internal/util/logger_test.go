@@ -0,0 +1,43 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerAddsImpersonationFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log := zap.New(core)
+
+	app := fiber.New()
+	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(ctx)
+
+	Logger(ctx, log).Info("not impersonated")
+
+	ctx.Locals("userId", 7)
+	ctx.Locals("actorId", 1)
+	Logger(ctx, log).Info("impersonated")
+	// usecases that only get ctx.Context(), or a context derived from it, log the same fields
+	ContextLogger(context.WithoutCancel(ctx.Context()), log).Info("impersonated through the context")
+
+	entries := logs.All()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if fields := entries[0].ContextMap(); len(fields) != 0 {
+		t.Errorf("entry of a normal request has fields %v", fields)
+	}
+	for _, entry := range entries[1:] {
+		fields := entry.ContextMap()
+		if fields["impersonated"] != true || fields["actorId"] != int64(1) || fields["impersonatedUserId"] != int64(7) {
+			t.Errorf("%q has fields %v, want the impersonation fields", entry.Message, fields)
+		}
+	}
+}
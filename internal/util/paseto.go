@@ -0,0 +1,138 @@
+package util
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"encoding/json"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pasetoTimeClaims are the registered claims PASETO encodes as RFC 3339 strings where JWT uses numeric dates
+var pasetoTimeClaims = []string{"exp", "iat", "nbf"}
+
+// PasetoTokenFormat issues PASETO v4 tokens, v4.local when only a symmetric key is set (encrypted, only this
+// server can read them) and v4.public otherwise (Ed25519 signed, verifiable with the public key)
+type PasetoTokenFormat struct {
+	SymmetricKey *paseto.V4SymmetricKey
+	SecretKey    *paseto.V4AsymmetricSecretKey
+	PublicKey    *paseto.V4AsymmetricPublicKey
+}
+
+// NewPasetoLocalTokenFormat takes the hex encoded 32 byte key
+func NewPasetoLocalTokenFormat(keyHex string) (*PasetoTokenFormat, error) {
+	key, err := paseto.V4SymmetricKeyFromHex(keyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasetoTokenFormat{SymmetricKey: &key}, nil
+}
+
+// NewPasetoPublicTokenFormat takes the hex encoded 64 byte Ed25519 secret key, the public key is derived from it
+func NewPasetoPublicTokenFormat(secretKeyHex string) (*PasetoTokenFormat, error) {
+	secretKey, err := paseto.NewV4AsymmetricSecretKeyFromHex(secretKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := secretKey.Public()
+
+	return &PasetoTokenFormat{SecretKey: &secretKey, PublicKey: &publicKey}, nil
+}
+
+func (format *PasetoTokenFormat) Name() string {
+	if format.SymmetricKey != nil {
+		return TokenFormatPasetoLocal
+	}
+
+	return TokenFormatPasetoPublic
+}
+
+func (format *PasetoTokenFormat) Issue(claims *model.Claims) (string, error) {
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := paseto.NewTokenFromClaimsJSON(claimsJSON, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if claims.ExpiresAt != nil {
+		token.SetExpiration(claims.ExpiresAt.Time)
+	}
+	if claims.IssuedAt != nil {
+		token.SetIssuedAt(claims.IssuedAt.Time)
+	}
+	if claims.NotBefore != nil {
+		token.SetNotBefore(claims.NotBefore.Time)
+	}
+
+	if format.SymmetricKey != nil {
+		return token.V4Encrypt(*format.SymmetricKey, nil), nil
+	}
+
+	return token.V4Sign(*format.SecretKey, nil), nil
+}
+
+func (format *PasetoTokenFormat) Parse(tokenString string) (*model.Claims, error) {
+	invalid := &model.ValidationError{
+		Code:    constant.ERR_UNATHORIZED_ERROR,
+		Message: "Authentication token is invalid",
+		Param:   "accessToken",
+	}
+
+	// lifetime is checked below with the same rules and messages as JWT tokens
+	parser := paseto.NewParserWithoutExpiryCheck()
+
+	var token *paseto.Token
+	var err error
+	if format.SymmetricKey != nil {
+		token, err = parser.ParseV4Local(*format.SymmetricKey, tokenString, nil)
+	} else {
+		token, err = parser.ParseV4Public(*format.PublicKey, tokenString, nil)
+	}
+	if err != nil {
+		return nil, invalid
+	}
+
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(token.ClaimsJSON(), &fields)
+	if err != nil {
+		return nil, invalid
+	}
+
+	for _, name := range pasetoTimeClaims {
+		value, ok := fields[name].(string)
+		if !ok {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, invalid
+		}
+		fields[name] = parsed.Unix()
+	}
+
+	claimsJSON, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &model.Claims{}
+	err = json.Unmarshal(claimsJSON, claims)
+	if err != nil {
+		return nil, invalid
+	}
+
+	err = jwt.NewValidator().Validate(claims)
+	if err != nil {
+		return nil, handleParseError(err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidSignedToken = errors.New("signed token is invalid")
+
+// GenerateSignedToken returns "<id>.<signature>" where id is random and signature is HMAC-SHA256(id),
+// the id is what callers store server side, the signature lets forged tokens be rejected without a lookup
+func GenerateSignedToken(secretKey string) (string, string, error) {
+	if secretKey == "" {
+		return "", "", errors.New("signing secret key is not configured")
+	}
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(buf)
+
+	return id + "." + signTokenId(id, secretKey), id, nil
+}
+
+// VerifySignedToken checks the signature of a token created by GenerateSignedToken and returns its id
+func VerifySignedToken(token string, secretKey string) (string, error) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secretKey == "" {
+		return "", ErrInvalidSignedToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(signTokenId(id, secretKey))) {
+		return "", ErrInvalidSignedToken
+	}
+
+	return id, nil
+}
+
+func signTokenId(id string, secretKey string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(id))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
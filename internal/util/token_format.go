@@ -0,0 +1,20 @@
+package util
+
+import (
+	"cutterproject/internal/model"
+)
+
+var (
+	TokenFormatJWT          = "jwt"
+	TokenFormatPasetoLocal  = "paseto-local"
+	TokenFormatPasetoPublic = "paseto-public"
+)
+
+// TokenFormat issues and verifies access tokens. Each implementation only accepts tokens of its own
+// format and key, so there is no algorithm header to negotiate and nothing to confuse
+type TokenFormat interface {
+	Name() string
+	Issue(claims *model.Claims) (string, error)
+	// Parse verifies the token and its lifetime, failures are returned as ValidationError
+	Parse(token string) (*model.Claims, error)
+}
@@ -0,0 +1,188 @@
+package util
+
+import (
+	"cutterproject/internal/model"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestTokenFormats(t *testing.T) map[string]TokenFormat {
+	t.Helper()
+
+	local, err := NewPasetoLocalTokenFormat(paseto.NewV4SymmetricKey().ExportHex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := NewPasetoPublicTokenFormat(paseto.NewV4AsymmetricSecretKey().ExportHex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]TokenFormat{
+		TokenFormatJWT:          NewJWTTokenFormat("secret"),
+		TokenFormatPasetoLocal:  local,
+		TokenFormatPasetoPublic: public,
+	}
+}
+
+func TestTokenFormatRoundTrip(t *testing.T) {
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	session := model.Session{Id: "session", UserId: 7, Jkt: "thumbprint", ActorId: 1, AuthTime: authTime}
+
+	for name, format := range newTestTokenFormats(t) {
+		t.Run(name, func(t *testing.T) {
+			if format.Name() != name {
+				t.Errorf("Name() = %s, want %s", format.Name(), name)
+			}
+
+			token, err := GenerateAccessToken(session, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix := map[string]string{TokenFormatPasetoLocal: "v4.local.", TokenFormatPasetoPublic: "v4.public."}[name]
+			if !strings.HasPrefix(token, prefix) {
+				t.Errorf("token %s does not start with %s", token, prefix)
+			}
+
+			claims, err := format.Parse(token)
+			if err != nil {
+				t.Fatalf("Parse() = %v", err)
+			}
+			if claims.UserId != 7 || claims.SessionId != "session" || claims.Subject != "user:7" || claims.Issuer != TokenIssuer || claims.ID == "" {
+				t.Errorf("Parse() = %+v", claims)
+			}
+			if claims.Confirmation == nil || claims.Confirmation.Jkt != "thumbprint" {
+				t.Errorf("cnf = %+v, want jkt thumbprint", claims.Confirmation)
+			}
+			if claims.Actor == nil || claims.Actor.UserId != 1 || claims.Actor.Subject != "user:1" {
+				t.Errorf("act = %+v, want user 1", claims.Actor)
+			}
+			if !claims.AuthTime.Equal(authTime) {
+				t.Errorf("auth_time = %v, want %v", claims.AuthTime, authTime)
+			}
+			if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != AccessTokenDuration {
+				t.Errorf("exp - iat = %v, want %v", lifetime, AccessTokenDuration)
+			}
+		})
+	}
+}
+
+func TestTokenFormatRejectsOtherFormatsAndKeys(t *testing.T) {
+	formats := newTestTokenFormats(t)
+	others := newTestTokenFormats(t)
+	others[TokenFormatJWT] = NewJWTTokenFormat("other secret")
+	session := model.Session{Id: "session", UserId: 7}
+
+	tokens := map[string]string{}
+	for name, format := range formats {
+		token, err := GenerateAccessToken(session, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[name] = token
+	}
+
+	for name, format := range formats {
+		for issuer, token := range tokens {
+			if issuer == name {
+				continue
+			}
+			if _, err := format.Parse(token); validationCode(err) == "" {
+				t.Errorf("%s accepted a %s token: %v", name, issuer, err)
+			}
+		}
+
+		// the same format with another key
+		if _, err := others[name].Parse(tokens[name]); validationCode(err) == "" {
+			t.Errorf("%s accepted a token of another key: %v", name, err)
+		}
+	}
+
+	// a PASETO header names the version and purpose, any other than the configured one is refused
+	for _, name := range []string{TokenFormatPasetoLocal, TokenFormatPasetoPublic} {
+		for _, header := range []string{"v2.local.", "v3.local.", "v2.public.", "v3.public.", "v4.local.", "v4.public."} {
+			version, _, _ := strings.Cut(tokens[name], ".")
+			_, payload, _ := strings.Cut(strings.TrimPrefix(tokens[name], version+"."), ".")
+			token := header + payload
+			if token == tokens[name] {
+				continue
+			}
+			if _, err := formats[name].Parse(token); validationCode(err) == "" {
+				t.Errorf("%s accepted the token with header %s", name, header)
+			}
+		}
+	}
+}
+
+func TestJWTTokenFormatRejectsOtherAlgorithms(t *testing.T) {
+	format := NewJWTTokenFormat("secret")
+	claims := jwt.MapClaims{"userId": 7, "exp": time.Now().Add(time.Minute).Unix()}
+
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{hs512, none} {
+		_, err := format.Parse(token)
+		var validationErr *model.ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Message != "Authentication token has invalid signing method" {
+			t.Errorf("Parse(%s) = %v, want an invalid signing method", token, err)
+		}
+	}
+}
+
+func TestPasetoTokenFormatLifetime(t *testing.T) {
+	formats := newTestTokenFormats(t)
+
+	cases := []struct {
+		name      string
+		expiresAt time.Time
+		notBefore time.Time
+		message   string
+	}{
+		{"expired", time.Now().Add(-time.Minute), time.Now().Add(-time.Hour), "Authentication token is expired"},
+		{"not valid yet", time.Now().Add(time.Hour), time.Now().Add(time.Minute), "Authentication token is not valid yet"},
+	}
+
+	for _, name := range []string{TokenFormatPasetoLocal, TokenFormatPasetoPublic} {
+		for _, c := range cases {
+			token, err := formats[name].Issue(&model.Claims{UserId: 7, RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(c.expiresAt),
+				NotBefore: jwt.NewNumericDate(c.notBefore),
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = formats[name].Parse(token)
+			var validationErr *model.ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Message != c.message {
+				t.Errorf("%s %s: Parse() = %v, want %s", name, c.name, err, c.message)
+			}
+		}
+	}
+
+	// a garbled token is invalid, not a panic
+	if _, err := formats[TokenFormatPasetoPublic].Parse("v4.public." + base64.RawURLEncoding.EncodeToString([]byte("short"))); validationCode(err) == "" {
+		t.Errorf("Parse() of a garbled token = %v", err)
+	}
+}
+
+func validationCode(err error) string {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
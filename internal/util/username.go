@@ -0,0 +1,179 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	MinUsernameLength = 4
+	MaxUsernameLength = 20
+
+	ErrUsernameTooShort      = errors.New("username is too short")
+	ErrUsernameTooLong       = errors.New("username is too long")
+	ErrUsernameInvalidChar   = errors.New("username contains characters that are not allowed")
+	ErrUsernameMixedScript   = errors.New("username mixes characters from different scripts")
+	ErrUsernameReserved      = errors.New("username is reserved")
+	ErrUsernameInvalidBorder = errors.New("username must start and end with a letter or digit")
+)
+
+// UsernameSkeletonVersion identifies the rules of UsernameSkeleton, bump it with every change to them so the stored
+// skeletons are rewritten on the next start
+const UsernameSkeletonVersion = "1"
+
+// ReservedUsernames are compared against the skeleton, so look-alikes of these names are reserved too
+var ReservedUsernames = map[string]struct{}{
+	"admin": {}, "administrator": {}, "api": {}, "auth": {}, "billing": {}, "help": {},
+	"info": {}, "mail": {}, "moderator": {}, "noreply": {}, "null": {}, "oauth": {},
+	"owner": {}, "postmaster": {}, "root": {}, "scim": {}, "security": {}, "staff": {},
+	"support": {}, "system": {}, "undefined": {}, "webmaster": {}, "www": {},
+}
+
+// confusables maps characters to the prototype they are commonly mistaken for, it is a
+// subset of the Unicode confusables table covering Latin look-alikes from Cyrillic, Greek and digits
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l', 'I': 'l',
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i', 'ј': 'j',
+	'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y',
+	'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l',
+	'А': 'a', 'В': 'b', 'Е': 'e', 'Н': 'h', 'І': 'l', 'Ј': 'j', 'К': 'k', 'М': 'm',
+	'О': 'o', 'Р': 'p', 'С': 'c', 'Т': 't', 'Х': 'x', 'Ү': 'y',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Η': 'h', 'Ι': 'l', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n',
+	'Ο': 'o', 'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x', 'Ζ': 'z',
+}
+
+// multiConfusables are letter sequences that render like a single letter in most fonts
+var multiConfusables = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// NormalizeUsername applies the PRECIS UsernameCasePreserved profile (width mapping and NFC),
+// then restricts the result to letters, digits, '.', '_' and '-' from a single script
+func NormalizeUsername(raw string) (string, error) {
+	username, err := precis.UsernameCasePreserved.String(strings.TrimSpace(raw))
+	if err != nil {
+		return "", ErrUsernameInvalidChar
+	}
+
+	length := utf8.RuneCountInString(username)
+	if length < MinUsernameLength {
+		return "", ErrUsernameTooShort
+	} else if length > MaxUsernameLength {
+		return "", ErrUsernameTooLong
+	}
+
+	script := ""
+	for _, r := range username {
+		switch {
+		case unicode.IsLetter(r):
+			letterScript := runeScript(r)
+			if script != "" && letterScript != script {
+				return "", ErrUsernameMixedScript
+			}
+			script = letterScript
+		case unicode.IsDigit(r), r == '.', r == '_', r == '-':
+		default:
+			return "", ErrUsernameInvalidChar
+		}
+	}
+
+	first, _ := utf8.DecodeRuneInString(username)
+	last, _ := utf8.DecodeLastRuneInString(username)
+	if !isLetterOrDigit(first) || !isLetterOrDigit(last) {
+		return "", ErrUsernameInvalidBorder
+	}
+
+	if IsReservedUsername(username) {
+		return "", ErrUsernameReserved
+	}
+
+	return username, nil
+}
+
+// UsernameSkeleton reduces a username to the form used for uniqueness, two usernames that look
+// the same to a human (paypal / paypaI / paypa1) produce the same skeleton
+func UsernameSkeleton(username string) string {
+	var builder strings.Builder
+	for _, r := range norm.NFKD.String(username) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		if prototype, ok := confusables[r]; ok {
+			r = prototype
+		}
+
+		// separators are interchangeable, j.doe and j_doe are the same user to a reader
+		if r == '.' || r == '-' {
+			r = '_'
+		}
+
+		builder.WriteRune(unicode.ToLower(r))
+	}
+
+	return multiConfusables.Replace(builder.String())
+}
+
+// IsReservedUsername also checks the lowercased username, the skeleton maps a capital I to l, so ADMIN alone
+// would not match admin
+func IsReservedUsername(username string) bool {
+	if _, ok := ReservedUsernames[UsernameSkeleton(username)]; ok {
+		return true
+	}
+
+	_, ok := ReservedUsernames[UsernameSkeleton(strings.ToLower(username))]
+	return ok
+}
+
+func isLetterOrDigit(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func runeScript(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "Latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "Cyrillic"
+	case unicode.Is(unicode.Greek, r):
+		return "Greek"
+	case unicode.Is(unicode.Han, r), unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+		// Japanese mixes these scripts in ordinary names
+		return "Han"
+	default:
+		for name, table := range unicode.Scripts {
+			if unicode.Is(table, r) {
+				return name
+			}
+		}
+		return "Unknown"
+	}
+}
+
+// UsernameFromEmail derives a username candidate for accounts created by single sign-on, it keeps the ASCII
+// letters, digits and separators of the local part and leaves room for a disambiguating suffix
+func UsernameFromEmail(email string) string {
+	localPart := strings.ToLower(email[:max(strings.LastIndex(email, "@"), 0)])
+
+	var builder strings.Builder
+	for _, r := range localPart {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			builder.WriteRune(r)
+		}
+	}
+
+	username := strings.Trim(builder.String(), "._-")
+	if len(username) > MaxUsernameLength-5 {
+		username = strings.TrimRight(username[:MaxUsernameLength-5], "._-")
+	}
+	if len(username) < MinUsernameLength {
+		username = "user" + username
+	}
+
+	return username
+}
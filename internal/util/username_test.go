@@ -0,0 +1,127 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	cases := []struct {
+		raw      string
+		username string
+		err      error
+	}{
+		{"john_doe", "john_doe", nil},
+		{" JohnDoe ", "JohnDoe", nil},
+		{"j.doe-99", "j.doe-99", nil},
+		{"иван_петров", "иван_петров", nil},
+		{"山田たろう", "山田たろう", nil},
+		// fullwidth forms are mapped to their ASCII counterparts
+		{"ｊｏｈｎ", "john", nil},
+		// NFC composes the decomposed e + U+0301
+		{"josé", "josé", nil},
+
+		{"abc", "", ErrUsernameTooShort},
+		{"abcdefghijklmnopqrstu", "", ErrUsernameTooLong},
+		{"john doe", "", ErrUsernameInvalidChar},
+		{"john@doe", "", ErrUsernameInvalidChar},
+		{"john​doe", "", ErrUsernameInvalidChar},
+		{"_john", "", ErrUsernameInvalidBorder},
+		{"john.", "", ErrUsernameInvalidBorder},
+		// Cyrillic а in an otherwise Latin name
+		{"pаypal", "", ErrUsernameMixedScript},
+		{"johnδoe", "", ErrUsernameMixedScript},
+
+		{"admin", "", ErrUsernameReserved},
+		{"Admin", "", ErrUsernameReserved},
+		{"ADMIN", "", ErrUsernameReserved},
+		{"r00t", "", ErrUsernameReserved},
+		{"R0OT", "", ErrUsernameReserved},
+		{"p0stmaster", "", ErrUsernameReserved},
+		{"AdmIn", "", ErrUsernameReserved},
+		{"admins", "admins", nil},
+		// a look-alike in another script is caught before the reserved names
+		{"аdmin", "", ErrUsernameMixedScript},
+	}
+
+	for _, c := range cases {
+		username, err := NormalizeUsername(c.raw)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("NormalizeUsername(%q) = %q, %v, want %v", c.raw, username, err, c.err)
+			}
+			continue
+		}
+		if err != nil || username != c.username {
+			t.Errorf("NormalizeUsername(%q) = %q, %v, want %q", c.raw, username, err, c.username)
+		}
+	}
+}
+
+func TestUsernameSkeleton(t *testing.T) {
+	cases := []struct {
+		first  string
+		second string
+		same   bool
+	}{
+		{"paypal", "paypaI", true},
+		{"paypal", "paypa1", true},
+		{"paypal", "PayPal", true},
+		{"paypal", "раураl", true},
+		{"modern", "modem", true},
+		{"jane.doe", "jane_doe", true},
+		{"jane-doe", "jane_doe", true},
+		{"clown", "down", true},
+		{"vvalter", "walter", true},
+		{"josé", "jose", true},
+		{"ｊｏｈｎ", "john", true},
+
+		{"paypal", "paypals", false},
+		{"jane_doe", "janedoe", false},
+		{"john", "joan", false},
+	}
+
+	for _, c := range cases {
+		first, second := UsernameSkeleton(c.first), UsernameSkeleton(c.second)
+		if (first == second) != c.same {
+			t.Errorf("UsernameSkeleton(%q) = %q, UsernameSkeleton(%q) = %q, same = %t, want %t",
+				c.first, first, c.second, second, first == second, c.same)
+		}
+	}
+}
+
+func TestIsReservedUsername(t *testing.T) {
+	for _, username := range []string{"admin", "аdmin", "аdmіn", "ROOT", "r00t", "SUPPORT", "АDMIN", "hеlp", "sуstem"} {
+		if !IsReservedUsername(username) {
+			t.Errorf("IsReservedUsername(%q) = false, want true", username)
+		}
+	}
+	for _, username := range []string{"admins", "rooted", "helpdesk", "jane_doe"} {
+		if IsReservedUsername(username) {
+			t.Errorf("IsReservedUsername(%q) = true, want false", username)
+		}
+	}
+}
+
+func TestUsernameFromEmail(t *testing.T) {
+	cases := []struct {
+		email    string
+		username string
+	}{
+		{"john.doe@example.com", "john.doe"},
+		{"John+Tag@example.com", "johntag"},
+		{"._jo_.@example.com", "userjo"},
+		{"иван@example.com", "user"},
+		{"a.very.long.local.part@example.com", "a.very.long.loc"},
+	}
+
+	for _, c := range cases {
+		username := UsernameFromEmail(c.email)
+		if username != c.username {
+			t.Errorf("UsernameFromEmail(%q) = %q, want %q", c.email, username, c.username)
+		}
+		if _, err := NormalizeUsername(username); err != nil {
+			t.Errorf("UsernameFromEmail(%q) = %q is not a valid username: %v", c.email, username, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package util
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/i18n"
+	"cutterproject/internal/model"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Validate checks the validate tags of a request struct and reports every violation at once. Rules are separated
+// by commas and checked in order, a field stops at its first violated rule:
+//
+//	required   the value must not be blank
+//	min=N      at least N bytes
+//	max=N      at most N bytes
+//	email      a valid email address
+//	username   a valid username, see NormalizeUsername
+//	locale     one of the locales in i18n.Locales
+//
+// Empty fields without required are not checked. The param of a violation is the field's json name, messages name
+// the field by its label tag or else by the json name written out, newPassword becomes "New password". Messages
+// are English, the error handler renders them again in the language of the request
+func Validate(payload interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(payload))
+	fieldErrors := []model.FieldError{}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() != reflect.String {
+			panic(fmt.Sprintf("validate tag on %s.%s, only string fields can be validated", value.Type().Name(), field.Name))
+		}
+
+		param := jsonFieldName(field)
+		label := field.Tag.Get("label")
+		if label == "" {
+			label = fieldLabel(param)
+		}
+
+		fieldError, ok := checkRules(fieldValue.String(), rules)
+		if !ok {
+			fieldError.Param = param
+			if fieldError.Label == "" {
+				fieldError.Label = label
+			}
+			fieldError.Message = i18n.FieldMessage(i18n.DefaultLocale, fieldError)
+			fieldErrors = append(fieldErrors, fieldError)
+		}
+	}
+
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	return &model.ValidationError{
+		Code:    constant.ERR_VALIDATION_CODE,
+		Message: fieldErrors[0].Message,
+		Param:   fieldErrors[0].Param,
+		Errors:  fieldErrors,
+	}
+}
+
+// checkRules returns the first violated rule, the caller fills in the field's param, label and message
+func checkRules(value string, rules string) (model.FieldError, bool) {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name != "required" && value == "" {
+			return model.FieldError{}, true
+		}
+
+		switch name {
+		case "required":
+			if strings.TrimSpace(value) == "" {
+				return model.FieldError{Code: constant.FIELD_ERR_REQUIRED}, false
+			}
+		case "min":
+			limit := ruleLimit(rule, arg)
+			if len(value) < limit {
+				return model.FieldError{
+					Code: constant.FIELD_ERR_MIN_LENGTH,
+					Args: map[string]interface{}{"min": limit},
+				}, false
+			}
+		case "max":
+			limit := ruleLimit(rule, arg)
+			if len(value) > limit {
+				return model.FieldError{
+					Code: constant.FIELD_ERR_MAX_LENGTH,
+					Args: map[string]interface{}{"max": limit},
+				}, false
+			}
+		case "email":
+			_, err := NormalizeEmail(value)
+			if err != nil {
+				return model.FieldError{Code: constant.FIELD_ERR_INVALID_EMAIL}, false
+			}
+		case "username":
+			_, err := NormalizeUsername(value)
+			if err != nil {
+				return UsernameFieldError(err), false
+			}
+		case "locale":
+			if !i18n.Supported(value) {
+				return model.FieldError{
+					Code: constant.FIELD_ERR_UNSUPPORTED_LOCALE,
+					Args: map[string]interface{}{"locales": i18n.Locales()},
+				}, false
+			}
+		default:
+			panic(fmt.Sprintf("unknown validation rule %q", rule))
+		}
+	}
+
+	return model.FieldError{}, true
+}
+
+// UsernameFieldError describes why NormalizeUsername rejected a username
+func UsernameFieldError(err error) model.FieldError {
+	fieldError := model.FieldError{
+		Param:   "username",
+		Code:    constant.FIELD_ERR_INVALID_USERNAME,
+		Message: "Username is not valid",
+		Label:   "Username",
+	}
+
+	switch {
+	case errors.Is(err, ErrUsernameTooShort):
+		fieldError.Code = constant.FIELD_ERR_MIN_LENGTH
+		fieldError.Args = map[string]interface{}{"min": MinUsernameLength}
+	case errors.Is(err, ErrUsernameTooLong):
+		fieldError.Code = constant.FIELD_ERR_MAX_LENGTH
+		fieldError.Args = map[string]interface{}{"max": MaxUsernameLength}
+	case errors.Is(err, ErrUsernameInvalidChar):
+		fieldError.Message = "Username may only contain letters, digits, '.', '_' and '-'"
+	case errors.Is(err, ErrUsernameMixedScript):
+		fieldError.Message = "Username must not mix characters from different scripts"
+	case errors.Is(err, ErrUsernameInvalidBorder):
+		fieldError.Message = "Username must start and end with a letter or digit"
+	case errors.Is(err, ErrUsernameReserved):
+		fieldError.Code = constant.FIELD_ERR_RESERVED
+	}
+	fieldError.Message = i18n.FieldMessage(i18n.DefaultLocale, fieldError)
+
+	return fieldError
+}
+
+func ruleLimit(rule string, arg string) int {
+	limit, err := strconv.Atoi(arg)
+	if err != nil {
+		panic(fmt.Sprintf("validation rule %q needs a number", rule))
+	}
+
+	return limit
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
+
+func fieldLabel(param string) string {
+	var label strings.Builder
+	for i, r := range param {
+		switch {
+		case i == 0:
+			label.WriteRune(unicode.ToUpper(r))
+		case unicode.IsUpper(r):
+			label.WriteRune(' ')
+			label.WriteRune(unicode.ToLower(r))
+		default:
+			label.WriteRune(r)
+		}
+	}
+
+	return label.String()
+}
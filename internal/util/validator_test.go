@@ -0,0 +1,142 @@
+package util
+
+import (
+	"cutterproject/internal/constant"
+	"cutterproject/internal/model"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testValidateRequest struct {
+	Username    string `json:"username" validate:"required,username"`
+	Email       string `json:"email" validate:"required,email,max=50"`
+	NewPassword string `json:"newPassword,omitempty" validate:"required,min=8,max=72"`
+	Nickname    string `json:"nickname" validate:"min=3" label:"Display name"`
+	Locale      string `json:"locale" validate:"locale"`
+	Ignored     string `json:"ignored"`
+}
+
+func TestValidate(t *testing.T) {
+	valid := testValidateRequest{Username: "john_doe", Email: "john@example.com", NewPassword: "correct horse"}
+
+	cases := []struct {
+		name    string
+		request func(request *testValidateRequest)
+		errors  []model.FieldError
+	}{
+		{"valid", func(request *testValidateRequest) {}, nil},
+		{"optional fields left empty are not checked", func(request *testValidateRequest) {
+			request.Nickname, request.Locale = "", ""
+		}, nil},
+		{"every violated field is reported", func(request *testValidateRequest) {
+			request.Username, request.Email, request.NewPassword = "", "not an email", "short"
+		}, []model.FieldError{
+			{Param: "username", Code: constant.FIELD_ERR_REQUIRED, Message: "Username is required to not be empty"},
+			{Param: "email", Code: constant.FIELD_ERR_INVALID_EMAIL, Message: "Email is not a valid email address"},
+			{Param: "newPassword", Code: constant.FIELD_ERR_MIN_LENGTH, Message: "New password must be at least 8 characters", Args: map[string]interface{}{"min": 8}},
+		}},
+		{"blank is not filled", func(request *testValidateRequest) {
+			request.NewPassword = "   "
+		}, []model.FieldError{
+			{Param: "newPassword", Code: constant.FIELD_ERR_REQUIRED, Message: "New password is required to not be empty"},
+		}},
+		{"a field stops at its first violated rule", func(request *testValidateRequest) {
+			request.Email = "a-very-long-local-part-for-this-test@not a domain.example.com"
+		}, []model.FieldError{
+			{Param: "email", Code: constant.FIELD_ERR_INVALID_EMAIL, Message: "Email is not a valid email address"},
+		}},
+		{"max", func(request *testValidateRequest) {
+			request.Email = "a-very-long-local-part-for-this-test@example.com.au"
+		}, []model.FieldError{
+			{Param: "email", Code: constant.FIELD_ERR_MAX_LENGTH, Message: "Email must be at most 50 characters", Args: map[string]interface{}{"max": 50}},
+		}},
+		{"label tag", func(request *testValidateRequest) {
+			request.Nickname = "jd"
+		}, []model.FieldError{
+			{Param: "nickname", Code: constant.FIELD_ERR_MIN_LENGTH, Message: "Display name must be at least 3 characters", Args: map[string]interface{}{"min": 3}},
+		}},
+		{"locale", func(request *testValidateRequest) {
+			request.Locale = "fr"
+		}, []model.FieldError{
+			{Param: "locale", Code: constant.FIELD_ERR_UNSUPPORTED_LOCALE, Message: "Locale must be one of en, id", Args: map[string]interface{}{"locales": []string{"en", "id"}}},
+		}},
+		{"reserved username", func(request *testValidateRequest) {
+			request.Username = "admin"
+		}, []model.FieldError{
+			{Param: "username", Code: constant.FIELD_ERR_RESERVED, Message: "Username is reserved"},
+		}},
+		{"username rule without a code", func(request *testValidateRequest) {
+			request.Username = "pаypal"
+		}, []model.FieldError{
+			{Param: "username", Code: constant.FIELD_ERR_INVALID_USERNAME, Message: "Username must not mix characters from different scripts"},
+		}},
+		{"username length", func(request *testValidateRequest) {
+			request.Username = "abc"
+		}, []model.FieldError{
+			{Param: "username", Code: constant.FIELD_ERR_MIN_LENGTH, Message: "Username must be at least 4 characters", Args: map[string]interface{}{"min": MinUsernameLength}},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := valid
+			c.request(&request)
+
+			err := Validate(&request)
+			if c.errors == nil {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *model.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate = %v, want a ValidationError", err)
+			}
+			if validationErr.Code != constant.ERR_VALIDATION_CODE {
+				t.Errorf("code = %s, want %s", validationErr.Code, constant.ERR_VALIDATION_CODE)
+			}
+			if validationErr.Param != c.errors[0].Param || validationErr.Message != c.errors[0].Message {
+				t.Errorf("param, message = %s, %q, want the first field error %s, %q",
+					validationErr.Param, validationErr.Message, c.errors[0].Param, c.errors[0].Message)
+			}
+
+			for i := range validationErr.Errors {
+				validationErr.Errors[i].Label = ""
+			}
+			if !reflect.DeepEqual(validationErr.Errors, c.errors) {
+				t.Errorf("errors = %+v, want %+v", validationErr.Errors, c.errors)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMisconfiguredTags(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"unknown rule", &struct {
+			Name string `validate:"required,uppercase"`
+		}{Name: "john"}},
+		{"limit without a number", &struct {
+			Name string `validate:"max=ten"`
+		}{Name: "john"}},
+		{"not a string", &struct {
+			Age int `validate:"required"`
+		}{Age: 1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Validate did not panic")
+				}
+			}()
+			Validate(c.payload)
+		})
+	}
+}